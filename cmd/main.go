@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -9,7 +10,9 @@ import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/vnkhanh/survey-server/config"
+	"github.com/vnkhanh/survey-server/controllers"
 	"github.com/vnkhanh/survey-server/routes"
+	"github.com/vnkhanh/survey-server/services"
 )
 
 func main() {
@@ -18,6 +21,41 @@ func main() {
 	// Kết nối DB + AutoMigrate
 	config.ConnectDB()
 
+	// Khoá bí mật của đích lịch xuất và secret webhook còn lưu dạng rõ (dữ liệu cũ) → mã hoá
+	if err := services.SealStoredDestinations(); err != nil {
+		log.Printf("Failed to seal export destination secrets: %v", err)
+	}
+	if err := services.SealStoredWebhookSecrets(); err != nil {
+		log.Printf("Failed to seal webhook secrets: %v", err)
+	}
+
+	// Store dùng chung cho rate limit/cache (Redis nếu có REDIS_URL)
+	services.InitStore()
+
+	// File người trả lời nộp (dữ liệu cũ) còn ở thư mục công khai → chuyển vào thư mục riêng tư (một lần)
+	go func() {
+		if err := services.MigrateLegacyUploads(context.Background()); err != nil {
+			log.Printf("Failed to migrate legacy uploads: %v", err)
+		}
+	}()
+
+	// Nạp các nhà cung cấp đăng nhập OIDC (Google, Keycloak, ...) từ env
+	services.InitOIDCProviders()
+
+	// Worker gửi webhook (thử lại theo backoff, hết lượt → dead-letter)
+	services.StartWebhookWorker()
+
+	// Dispatcher giao sự kiện từ outbox cho các subscriber (đăng ký ở trên)
+	services.StartEventDispatcher()
+
+	// Hàng đợi job nền (xuất dữ liệu, ...): khôi phục job mồ côi rồi chạy JOB_WORKERS worker
+	controllers.RegisterJobHandlers()
+	services.StartJobWorkers()
+
+	// Tác vụ định kỳ (đóng form hết hạn, lưu trữ room không hoạt động, dọn dữ liệu cũ)
+	services.RegisterLifecycleTasks()
+	services.StartScheduler()
+
 	// Tạo instance router
 	r := gin.Default()
 
@@ -26,8 +64,8 @@ func main() {
 			return origin == "http://localhost:5173" || origin == "https://nguyendautoan.github.io"
 		},
 		AllowMethods:           []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:           []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:          []string{"Content-Length"},
+		AllowHeaders:           []string{"Origin", "Content-Type", "Authorization", "Idempotency-Key"},
+		ExposeHeaders:          []string{"Content-Length", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After", "Idempotent-Replayed"},
 		AllowCredentials:       true,
 		MaxAge:                 12 * time.Hour,
 		AllowWildcard:          true, // cho phép wildcard domain
@@ -0,0 +1,29 @@
+package config
+
+import "gorm.io/gorm"
+
+// ensureAuditLogImmutable tạo trigger chặn UPDATE/DELETE/TRUNCATE trên audit_logs,
+// kể cả khi thao tác trực tiếp bằng SQL (chỉ superuser tắt trigger mới sửa được).
+func ensureAuditLogImmutable(db *gorm.DB) error {
+	stmts := []string{
+		`CREATE OR REPLACE FUNCTION audit_logs_immutable() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'audit_logs chỉ cho phép thêm mới';
+		END;
+		$$ LANGUAGE plpgsql`,
+		`DROP TRIGGER IF EXISTS trg_audit_logs_immutable ON audit_logs`,
+		`CREATE TRIGGER trg_audit_logs_immutable BEFORE UPDATE OR DELETE ON audit_logs
+		FOR EACH ROW EXECUTE FUNCTION audit_logs_immutable()`,
+		`DROP TRIGGER IF EXISTS trg_audit_logs_no_truncate ON audit_logs`,
+		`CREATE TRIGGER trg_audit_logs_no_truncate BEFORE TRUNCATE ON audit_logs
+		FOR EACH STATEMENT EXECUTE FUNCTION audit_logs_immutable()`,
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, s := range stmts {
+			if err := tx.Exec(s).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
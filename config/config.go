@@ -76,10 +76,45 @@ func ConnectDB() {
 		&models.RoomNguoiThamGia{},
 		&models.RoomInvite{},
 		&models.ExportJob{},
+		&models.ApiKey{},
+		&models.OIDCProvider{},
+		&models.OIDCNonce{},
+		&models.UserIdentity{},
+		&models.RecoveryCode{},
+		&models.Permission{},
+		&models.Role{},
+		&models.AuditLog{},
+		&models.AuthThrottle{},
+		&models.IdempotencyKey{},
+		&models.WebhookSubscription{},
+		&models.WebhookDelivery{},
+		&models.OutboxEvent{},
+		&models.Job{},
+		&models.ScheduledTask{},
+		&models.ExportPreset{},
+		&models.ExportSchedule{},
+		&models.ExportScheduleRun{},
+		&models.ImportJob{},
+		&models.DataMigration{},
 	); err != nil {
 		log.Fatalf("Failed to migrate: %v", err)
 	}
 
+	// Nhật ký hệ thống: chỉ cho thêm mới
+	if err := ensureAuditLogImmutable(db); err != nil {
+		log.Fatalf("Failed to protect audit_logs: %v", err)
+	}
+
+	// Phản hồi nhập từ file: mỗi mã phản hồi gốc chỉ một lần trong một form
+	if err := ensureImportRefUnique(db); err != nil {
+		log.Fatalf("Failed to index imported responses: %v", err)
+	}
+
+	// Seed quyền & vai trò hệ thống
+	if err := seedRBAC(db); err != nil {
+		log.Fatalf("Failed to seed roles: %v", err)
+	}
+
 	// Set timezone cho session
 	if _, err := sqlDB.Exec(fmt.Sprintf("SET TIME ZONE '%s'", dbTZ)); err != nil {
 		log.Printf("Failed to set timezone in DB session: %v", err)
@@ -0,0 +1,24 @@
+package config
+
+import "gorm.io/gorm"
+
+// ensureImportRefUnique tạo unique index (form, mã phản hồi gốc) cho phản hồi nhập từ file để hai lần nhập
+// song song không ghi trùng. Dữ liệu cũ đã trùng thì bản nhập sau bị bỏ mã gốc (phản hồi vẫn giữ).
+func ensureImportRefUnique(db *gorm.DB) error {
+	var n int64
+	if err := db.Raw(`SELECT COUNT(*) FROM pg_indexes WHERE tablename = 'phan_hoi' AND indexname = 'ux_phan_hoi_source_ref'`).
+		Scan(&n).Error; err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`UPDATE phan_hoi p SET source_ref = '' WHERE p.source_ref <> '' AND EXISTS (
+			SELECT 1 FROM phan_hoi o WHERE o.khao_sat_id = p.khao_sat_id AND o.source_ref = p.source_ref AND o.id < p.id)`).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS ux_phan_hoi_source_ref
+			ON phan_hoi (khao_sat_id, source_ref) WHERE source_ref <> ''`).Error
+	})
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"github.com/vnkhanh/survey-server/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Danh sách quyền của hệ thống (mã → mô tả)
+var defaultPermissions = []models.Permission{
+	{Ma: models.PermAdminAccess, MoTa: "Truy cập khu vực quản trị"},
+	{Ma: models.PermUsersManage, MoTa: "Quản lý tài khoản người dùng"},
+	{Ma: models.PermRolesManage, MoTa: "Quản lý vai trò và phân quyền"},
+	{Ma: models.PermFormsReadAll, MoTa: "Xem mọi form (chỉ đọc)"},
+	{Ma: models.PermFormsManageAll, MoTa: "Quản trị mọi form"},
+	{Ma: models.PermRoomsReadAll, MoTa: "Xem mọi room (chỉ đọc)"},
+	{Ma: models.PermRoomsManageAll, MoTa: "Quản trị mọi room"},
+	{Ma: models.PermResponsesReadAll, MoTa: "Xem phản hồi của mọi form"},
+	{Ma: models.PermAuditRead, MoTa: "Xem nhật ký hệ thống"},
+	{Ma: models.PermStatsRead, MoTa: "Xem thống kê hệ thống"},
+	{Ma: models.PermJobsManage, MoTa: "Quản lý job chạy nền"},
+}
+
+// Vai trò hệ thống và quyền mặc định (admin luôn có toàn bộ quyền)
+var defaultRoles = []struct {
+	Ten   string
+	MoTa  string
+	Perms []string
+}{
+	{models.RoleAdmin, "Quản trị viên, có toàn bộ quyền", nil},
+	{models.RoleSupport, "Hỗ trợ người dùng, chỉ đọc form/room", []string{
+		models.PermAdminAccess, models.PermFormsReadAll, models.PermRoomsReadAll,
+	}},
+	{models.RoleAuditor, "Kiểm toán, xem nhật ký và thống kê", []string{
+		models.PermAdminAccess, models.PermAuditRead, models.PermStatsRead,
+		models.PermFormsReadAll, models.PermResponsesReadAll,
+	}},
+}
+
+// seedRBAC tạo quyền, vai trò hệ thống và gán vai trò admin cho user cũ có vai_tro = true.
+// Quyền của support/auditor chỉ gán lúc tạo để admin có thể tuỳ chỉnh về sau.
+func seedRBAC(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		seed := append([]models.Permission(nil), defaultPermissions...)
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "ma"}},
+			DoUpdates: clause.AssignmentColumns([]string{"mo_ta"}),
+		}).Create(&seed).Error; err != nil {
+			return err
+		}
+
+		var all []models.Permission
+		if err := tx.Find(&all).Error; err != nil {
+			return err
+		}
+		byCode := make(map[string]models.Permission, len(all))
+		for _, p := range all {
+			byCode[p.Ma] = p
+		}
+
+		for _, def := range defaultRoles {
+			role := models.Role{Ten: def.Ten}
+			res := tx.Where("ten = ?", def.Ten).
+				Attrs(models.Role{MoTa: def.MoTa, HeThong: true}).
+				FirstOrCreate(&role)
+			if res.Error != nil {
+				return res.Error
+			}
+
+			switch {
+			case def.Ten == models.RoleAdmin:
+				if err := tx.Model(&role).Association("Permissions").Replace(all); err != nil {
+					return err
+				}
+			case res.RowsAffected == 1:
+				perms := make([]models.Permission, 0, len(def.Perms))
+				for _, code := range def.Perms {
+					perms = append(perms, byCode[code])
+				}
+				if err := tx.Model(&role).Association("Permissions").Replace(perms); err != nil {
+					return err
+				}
+			}
+
+			if def.Ten == models.RoleAdmin {
+				// Dữ liệu cũ: vai_tro = true nghĩa là admin
+				if err := tx.Exec(`INSERT INTO user_roles (nguoi_dung_id, role_id)
+					SELECT id, ? FROM nguoi_dung WHERE vai_tro = true
+					ON CONFLICT DO NOTHING`, role.ID).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,699 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vnkhanh/survey-server/config"
+	"github.com/vnkhanh/survey-server/middleware"
+	"github.com/vnkhanh/survey-server/models"
+	"github.com/vnkhanh/survey-server/services"
+	"github.com/vnkhanh/survey-server/utils"
+	"gorm.io/gorm"
+)
+
+// adminPaging đọc page/limit (mặc định 1/20, tối đa 100)
+func adminPaging(c *gin.Context) (page, limit, offset int) {
+	page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ = strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	return page, limit, (page - 1) * limit
+}
+
+// GET /api/admin/forms — mọi form trong hệ thống (quyền forms.read_all)
+func AdminListForms(c *gin.Context) {
+	page, limit, offset := adminPaging(c)
+
+	q := config.DB.Model(&models.KhaoSat{})
+	if s := c.Query("q"); s != "" {
+		q = q.Where("tieu_de ILIKE ?", "%"+s+"%")
+	}
+	if st := c.Query("status"); st != "" {
+		q = q.Where("trang_thai = ?", st)
+	}
+	if owner, err := strconv.Atoi(c.Query("owner_id")); err == nil && owner > 0 {
+		q = q.Where("nguoi_tao_id = ?", owner)
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể đếm form"})
+		return
+	}
+	var forms []models.KhaoSat
+	if err := q.Order("ngay_tao DESC").Limit(limit).Offset(offset).Find(&forms).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể lấy danh sách form"})
+		return
+	}
+
+	out := make([]gin.H, 0, len(forms))
+	for _, f := range forms {
+		out = append(out, gin.H{
+			"id":          f.ID,
+			"title":       f.TieuDe,
+			"description": f.MoTa,
+			"status":      f.TrangThai,
+			"owner_id":    f.NguoiTaoID,
+			"responses":   f.SoPhanHoi,
+			"created_at":  f.NgayTao,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"data": out, "page": page, "limit": limit, "total": total})
+}
+
+// GET /api/admin/rooms — mọi room trong hệ thống (quyền rooms.read_all)
+func AdminListRooms(c *gin.Context) {
+	page, limit, offset := adminPaging(c)
+
+	q := config.DB.Model(&models.Room{})
+	if s := c.Query("q"); s != "" {
+		q = q.Where("ten_room ILIKE ?", "%"+s+"%")
+	}
+	if st := c.Query("status"); st != "" {
+		q = q.Where("trang_thai = ?", st)
+	}
+	if owner, err := strconv.Atoi(c.Query("owner_id")); err == nil && owner > 0 {
+		q = q.Where("nguoi_tao_id = ?", owner)
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể đếm room"})
+		return
+	}
+	var rooms []models.Room
+	if err := q.Order("ngay_tao DESC").Limit(limit).Offset(offset).Find(&rooms).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể lấy danh sách room"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": rooms, "page": page, "limit": limit, "total": total})
+}
+
+type adminReasonReq struct {
+	Reason string `json:"reason"`
+}
+
+type adminTransferReq struct {
+	NewOwnerID uint `json:"new_owner_id" binding:"required"`
+}
+
+type adminResetPasswordReq struct {
+	MatKhau string `json:"mat_khau"` // bỏ trống = sinh mật khẩu tạm
+}
+
+func adminUserDTO(u models.NguoiDung, roles []string) gin.H {
+	if roles == nil {
+		roles = []string{}
+	}
+	return gin.H{
+		"id":              u.ID,
+		"ten":             u.Ten,
+		"email":           u.Email,
+		"vai_tro":         u.VaiTro,
+		"roles":           roles,
+		"totp_enabled":    u.TOTPEnabled,
+		"disabled_at":     u.DisabledAt,
+		"disabled_reason": u.DisabledReason,
+		"ngay_tao":        u.NgayTao,
+	}
+}
+
+// GET /api/admin/users?q=&status=active|disabled&role=
+func AdminListUsers(c *gin.Context) {
+	page, limit, offset := adminPaging(c)
+
+	q := config.DB.Model(&models.NguoiDung{})
+	if s := strings.TrimSpace(c.Query("q")); s != "" {
+		q = q.Where("email ILIKE ? OR ten ILIKE ?", "%"+s+"%", "%"+s+"%")
+	}
+	switch c.Query("status") {
+	case "active":
+		q = q.Where("disabled_at IS NULL")
+	case "disabled":
+		q = q.Where("disabled_at IS NOT NULL")
+	}
+	if role := c.Query("role"); role != "" {
+		q = q.Where("id IN (?)", config.DB.Table("user_roles").
+			Select("user_roles.nguoi_dung_id").
+			Joins("JOIN roles ON roles.id = user_roles.role_id").
+			Where("roles.ten = ?", role))
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể đếm người dùng"})
+		return
+	}
+	var users []models.NguoiDung
+	if err := q.Order("id DESC").Limit(limit).Offset(offset).Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể lấy danh sách người dùng"})
+		return
+	}
+
+	// Nạp vai trò cho cả trang bằng một truy vấn
+	ids := make([]uint, 0, len(users))
+	for _, u := range users {
+		ids = append(ids, u.ID)
+	}
+	var pairs []struct {
+		NguoiDungID uint
+		Ten         string
+	}
+	if len(ids) > 0 {
+		if err := config.DB.Table("user_roles").
+			Select("user_roles.nguoi_dung_id, roles.ten").
+			Joins("JOIN roles ON roles.id = user_roles.role_id").
+			Where("user_roles.nguoi_dung_id IN ?", ids).
+			Order("roles.ten").
+			Scan(&pairs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể lấy vai trò"})
+			return
+		}
+	}
+	rolesOf := map[uint][]string{}
+	for _, p := range pairs {
+		rolesOf[p.NguoiDungID] = append(rolesOf[p.NguoiDungID], p.Ten)
+	}
+
+	out := make([]gin.H, 0, len(users))
+	for _, u := range users {
+		out = append(out, adminUserDTO(u, rolesOf[u.ID]))
+	}
+	c.JSON(http.StatusOK, gin.H{"data": out, "page": page, "limit": limit, "total": total})
+}
+
+// GET /api/admin/users/:id
+func AdminGetUser(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+	roles, err := services.UserRoleNames(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể lấy vai trò"})
+		return
+	}
+	var forms, rooms int64
+	config.DB.Model(&models.KhaoSat{}).Where("nguoi_tao_id = ? AND trang_thai <> 'deleted'", user.ID).Count(&forms)
+	config.DB.Model(&models.Room{}).Where("nguoi_tao_id = ?", user.ID).Count(&rooms)
+
+	// Trạng thái khoá đăng nhập do thử sai
+	var locks []models.AuthThrottle
+	config.DB.Where("(scope = ? AND key = ?) OR (scope = ? AND key = ?)",
+		models.ThrottleLoginAccount, strings.ToLower(user.Email),
+		models.ThrottleTwoFactor, strconv.FormatUint(uint64(user.ID), 10)).Find(&locks)
+
+	out := adminUserDTO(user, roles)
+	out["so_form"] = forms
+	out["so_room"] = rooms
+	out["lockouts"] = locks
+	c.JSON(http.StatusOK, out)
+}
+
+// canManageUser: người thao tác phải có mọi quyền của tài khoản đích (users.manage không đủ để
+// đặt lại mật khẩu/khoá tài khoản có quyền cao hơn); đã trả 403 nếu không
+func canManageUser(c *gin.Context, target models.NguoiDung) bool {
+	actor := c.MustGet(middleware.CtxUser).(models.NguoiDung)
+	actorPerms, err := services.UserPermissions(actor.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể kiểm tra quyền"})
+		return false
+	}
+	targetPerms, err := services.UserPermissions(target.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể kiểm tra quyền"})
+		return false
+	}
+	missing := services.MissingPermission(actorPerms, targetPerms)
+	if missing == "" && target.VaiTro && !actor.VaiTro {
+		missing = models.RoleAdmin
+	}
+	if missing != "" {
+		c.JSON(http.StatusForbidden, gin.H{
+			"message":            "Không thể thao tác trên tài khoản có quyền mà bạn không có",
+			"missing_permission": missing,
+		})
+		return false
+	}
+	return true
+}
+
+// POST /api/admin/users/:id/disable — khoá tài khoản và thu hồi mọi JWT/API key hiện có
+func AdminDisableUser(c *gin.Context) {
+	admin := c.MustGet(middleware.CtxUser).(models.NguoiDung)
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+	if user.ID == admin.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Không thể tự khoá tài khoản của mình"})
+		return
+	}
+	if user.DisabledAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"message": "Tài khoản đã bị khoá"})
+		return
+	}
+	if !canManageUser(c, user) {
+		return
+	}
+	var req adminReasonReq
+	_ = c.ShouldBindJSON(&req)
+
+	now := time.Now()
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		err := services.GuardLastAdmin(tx, func() error {
+			return tx.Model(&models.NguoiDung{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+				"disabled_at":     now,
+				"disabled_reason": strings.TrimSpace(req.Reason),
+			}).Error
+		})
+		if err != nil {
+			return err
+		}
+		if err := services.RevokeUserSessions(tx, user.ID); err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "user.disable", "user", user.ID, gin.H{"reason": strings.TrimSpace(req.Reason)})
+	})
+	if errors.Is(err, services.ErrLastAdmin) {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể khoá tài khoản"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Đã khoá tài khoản", "disabled_at": now})
+}
+
+// POST /api/admin/users/:id/enable — mở khoá tài khoản
+func AdminEnableUser(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+	if user.DisabledAt == nil {
+		c.JSON(http.StatusConflict, gin.H{"message": "Tài khoản đang hoạt động"})
+		return
+	}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.NguoiDung{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"disabled_at":     nil,
+			"disabled_reason": "",
+		}).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "user.enable", "user", user.ID, nil)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể mở khoá tài khoản"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Đã mở khoá tài khoản"})
+}
+
+// POST /api/admin/users/:id/reset-password — đặt mật khẩu mới (hoặc sinh mật khẩu tạm, chỉ trả về 1 lần);
+// mọi JWT/API key hiện có của user bị thu hồi
+func AdminResetPassword(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+	if !canManageUser(c, user) {
+		return
+	}
+	var req adminResetPasswordReq
+	_ = c.ShouldBindJSON(&req)
+
+	generated := false
+	if req.MatKhau == "" {
+		pw, err := utils.GenerateRandomPassword(14)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể sinh mật khẩu"})
+			return
+		}
+		req.MatKhau = pw
+		generated = true
+	} else if len(req.MatKhau) < 6 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "Mật khẩu tối thiểu 6 ký tự"})
+		return
+	}
+
+	hash, err := utils.HashPassword(req.MatKhau)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể mã hoá mật khẩu"})
+		return
+	}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.NguoiDung{}).Where("id = ?", user.ID).Update("mat_khau", hash).Error; err != nil {
+			return err
+		}
+		if err := services.RevokeUserSessions(tx, user.ID); err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "user.reset_password", "user", user.ID, gin.H{"generated": generated})
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể đặt lại mật khẩu"})
+		return
+	}
+
+	resp := gin.H{"message": "Đã đặt lại mật khẩu"}
+	if generated {
+		resp["mat_khau_tam"] = req.MatKhau
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// findNewOwner kiểm tra user nhận chuyển quyền sở hữu
+func findNewOwner(c *gin.Context) (models.NguoiDung, bool) {
+	var req adminTransferReq
+	var u models.NguoiDung
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "Thiếu new_owner_id"})
+		return u, false
+	}
+	if err := config.DB.First(&u, req.NewOwnerID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Người nhận không tồn tại"})
+		return u, false
+	}
+	if u.DisabledAt != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "Người nhận đang bị khoá"})
+		return u, false
+	}
+	return u, true
+}
+
+func adminFindForm(c *gin.Context) (models.KhaoSat, bool) {
+	var f models.KhaoSat
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID không hợp lệ"})
+		return f, false
+	}
+	if err := config.DB.Where("id = ? AND trang_thai <> 'deleted'", id).First(&f).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Form không tồn tại"})
+		return f, false
+	}
+	return f, true
+}
+
+func adminFindRoom(c *gin.Context) (models.Room, bool) {
+	var r models.Room
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID không hợp lệ"})
+		return r, false
+	}
+	if err := config.DB.First(&r, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Room không tồn tại"})
+		return r, false
+	}
+	return r, true
+}
+
+// POST /api/admin/forms/:id/transfer — chuyển quyền sở hữu form
+func AdminTransferForm(c *gin.Context) {
+	f, ok := adminFindForm(c)
+	if !ok {
+		return
+	}
+	owner, ok := findNewOwner(c)
+	if !ok {
+		return
+	}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.KhaoSat{}).Where("id = ?", f.ID).Update("nguoi_tao_id", owner.ID).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "form.transfer", "form", f.ID, gin.H{"from": f.NguoiTaoID, "to": owner.ID})
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể chuyển quyền sở hữu"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Đã chuyển quyền sở hữu form", "owner_id": owner.ID})
+}
+
+// POST /api/admin/rooms/:id/transfer — chuyển quyền sở hữu room
+func AdminTransferRoom(c *gin.Context) {
+	r, ok := adminFindRoom(c)
+	if !ok {
+		return
+	}
+	owner, ok := findNewOwner(c)
+	if !ok {
+		return
+	}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Room{}).Where("id = ?", r.ID).Update("nguoi_tao_id", owner.ID).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "room.transfer", "room", r.ID, gin.H{"from": r.NguoiTaoID, "to": owner.ID})
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể chuyển quyền sở hữu"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Đã chuyển quyền sở hữu room", "owner_id": owner.ID})
+}
+
+// POST /api/admin/forms/:id/archive — lưu trữ cưỡng chế (link public ngừng hoạt động, owner không tự khôi phục được)
+func AdminArchiveForm(c *gin.Context) {
+	f, ok := adminFindForm(c)
+	if !ok {
+		return
+	}
+	var req adminReasonReq
+	_ = c.ShouldBindJSON(&req)
+
+	now := time.Now()
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := setFormStatus(tx, f, map[string]interface{}{
+			"trang_thai":        "archived",
+			"force_archived_at": now,
+		}, services.EventFormClosed); err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "form.force_archive", "form", f.ID, gin.H{
+			"reason": strings.TrimSpace(req.Reason), "previous_status": f.TrangThai,
+		})
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể lưu trữ form"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Đã lưu trữ form", "force_archived_at": now})
+}
+
+// POST /api/admin/forms/:id/restore — gỡ lưu trữ cưỡng chế
+func AdminRestoreForm(c *gin.Context) {
+	f, ok := adminFindForm(c)
+	if !ok {
+		return
+	}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := setFormStatus(tx, f, map[string]interface{}{
+			"trang_thai":        "active",
+			"force_archived_at": nil,
+		}, services.EventFormPublished); err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "form.admin_restore", "form", f.ID, nil)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể khôi phục form"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Đã khôi phục form"})
+}
+
+// POST /api/admin/rooms/:id/archive — lưu trữ cưỡng chế room (ẩn khỏi lobby)
+func AdminArchiveRoom(c *gin.Context) {
+	r, ok := adminFindRoom(c)
+	if !ok {
+		return
+	}
+	var req adminReasonReq
+	_ = c.ShouldBindJSON(&req)
+
+	now := time.Now()
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Room{}).Where("id = ?", r.ID).Updates(map[string]interface{}{
+			"trang_thai":        "archived",
+			"is_public":         false,
+			"force_archived_at": now,
+		}).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "room.force_archive", "room", r.ID, gin.H{
+			"reason": strings.TrimSpace(req.Reason), "previous_status": r.TrangThai,
+		})
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể lưu trữ room"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Đã lưu trữ room", "force_archived_at": now})
+}
+
+// POST /api/admin/rooms/:id/restore — gỡ lưu trữ cưỡng chế (room vẫn ở chế độ riêng tư cho tới khi owner mở lại)
+func AdminRestoreRoom(c *gin.Context) {
+	r, ok := adminFindRoom(c)
+	if !ok {
+		return
+	}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Room{}).Where("id = ?", r.ID).Updates(map[string]interface{}{
+			"trang_thai":        "active",
+			"force_archived_at": nil,
+		}).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "room.admin_restore", "room", r.ID, nil)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể khôi phục room"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Đã khôi phục room"})
+}
+
+// GET /api/admin/stats — số liệu tổng quan toàn hệ thống
+func AdminStats(c *gin.Context) {
+	type statusCount struct {
+		TrangThai string
+		N         int64
+	}
+	countBy := func(table string) (map[string]int64, error) {
+		var rows []statusCount
+		if err := config.DB.Table(table).Select("trang_thai, COUNT(*) AS n").Group("trang_thai").Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		out := map[string]int64{}
+		for _, r := range rows {
+			out[r.TrangThai] = r.N
+		}
+		return out, nil
+	}
+
+	var users, disabled, admins, responses, responses24h, responses7d, activeKeys int64
+	db := config.DB
+	errs := []error{
+		db.Model(&models.NguoiDung{}).Count(&users).Error,
+		db.Model(&models.NguoiDung{}).Where("disabled_at IS NOT NULL").Count(&disabled).Error,
+		db.Model(&models.NguoiDung{}).Where("vai_tro = ?", true).Count(&admins).Error,
+		db.Model(&models.PhanHoi{}).Count(&responses).Error,
+		db.Model(&models.PhanHoi{}).Where("ngay_gui >= ?", time.Now().Add(-24*time.Hour)).Count(&responses24h).Error,
+		db.Model(&models.PhanHoi{}).Where("ngay_gui >= ?", time.Now().AddDate(0, 0, -7)).Count(&responses7d).Error,
+		db.Model(&models.ApiKey{}).Where("revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", time.Now()).Count(&activeKeys).Error,
+	}
+	for _, err := range errs {
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể lấy thống kê"})
+			return
+		}
+	}
+	forms, err := countBy("khao_sat")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể lấy thống kê"})
+		return
+	}
+	rooms, err := countBy("room")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể lấy thống kê"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users": gin.H{"total": users, "disabled": disabled, "admins": admins},
+		"forms": forms,
+		"rooms": rooms,
+		"responses": gin.H{
+			"total":    responses,
+			"last_24h": responses24h,
+			"last_7d":  responses7d,
+		},
+		"active_api_keys": activeKeys,
+	})
+}
+
+// GET /api/admin/lockouts?scope=&key=&active=true — bộ đếm thử sai / các key đang bị khoá
+// (active=false để xem cả key chưa bị khoá)
+func AdminListLockouts(c *gin.Context) {
+	q := config.DB.Model(&models.AuthThrottle{})
+	if v := c.Query("scope"); v != "" {
+		q = q.Where("scope = ?", v)
+	}
+	if v := c.Query("key"); v != "" {
+		q = q.Where("key LIKE ?", "%"+v+"%")
+	}
+	if c.DefaultQuery("active", "true") != "false" {
+		q = q.Where("locked_until > ?", time.Now())
+	}
+	page, limit, offset := adminPaging(c)
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể đếm"})
+		return
+	}
+	var rows []models.AuthThrottle
+	if err := q.Order("last_failure_at DESC").Limit(limit).Offset(offset).Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể lấy danh sách"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": rows, "page": page, "limit": limit, "total": total})
+}
+
+// DELETE /api/admin/lockouts/:id — gỡ khoá và xoá bộ đếm của một key
+func AdminClearLockout(c *gin.Context) {
+	var row models.AuthThrottle
+	if err := config.DB.First(&row, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Không tìm thấy"})
+		return
+	}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&row).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "lockout.clear", "lockout", row.ID, gin.H{"scope": row.Scope, "key": row.Key})
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể gỡ khoá"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Đã gỡ khoá"})
+}
+
+// POST /api/admin/users/:id/unlock — gỡ khoá đăng nhập (mật khẩu & 2FA) của một user
+func AdminUnlockUser(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("(scope = ? AND key = ?) OR (scope = ? AND key = ?)",
+			models.ThrottleLoginAccount, strings.ToLower(user.Email),
+			models.ThrottleTwoFactor, strconv.FormatUint(uint64(user.ID), 10)).
+			Delete(&models.AuthThrottle{})
+		if res.Error != nil {
+			return res.Error
+		}
+		return recordAudit(c, tx, "user.unlock", "user", user.ID, gin.H{"cleared": res.RowsAffected})
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể gỡ khoá"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Đã gỡ khoá đăng nhập"})
+}
@@ -3,6 +3,7 @@ package controllers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math"
@@ -13,9 +14,11 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/vnkhanh/survey-server/config"
 	"github.com/vnkhanh/survey-server/middleware"
 	"github.com/vnkhanh/survey-server/models"
+	"github.com/vnkhanh/survey-server/services"
 	"github.com/vnkhanh/survey-server/utils"
 	"gorm.io/gorm"
 )
@@ -31,6 +34,24 @@ type SubmitSurveyReq struct {
 	KhaoSatID uint        `json:"khao_sat_id" binding:"required"`
 	Email     *string     `json:"email"` // cho khách nhập
 	Answers   []AnswerReq `json:"answers" binding:"required"`
+
+	// Chống bot: challenge nhận từ GetPublicForm + nonce đã giải, và trường ẩn (honeypot) phải để trống
+	Challenge *ChallengeAnswer `json:"challenge"`
+	Website   string           `json:"website"`
+}
+
+// idempotencyPayload: phần của request dùng để so khi gửi lại cùng Idempotency-Key. Challenge và honeypot
+// không tính — client thử lại sau lỗi mạng có thể đã giải challenge mới
+func (r SubmitSurveyReq) idempotencyPayload() interface{} {
+	return struct {
+		Email   *string     `json:"email"`
+		Answers []AnswerReq `json:"answers"`
+	}{r.Email, r.Answers}
+}
+
+type ChallengeAnswer struct {
+	Token string `json:"token"`
+	Nonce string `json:"nonce"`
 }
 
 func SubmitSurvey(c *gin.Context) {
@@ -48,12 +69,61 @@ func SubmitSurvey(c *gin.Context) {
 		return
 	}
 
-	// 2.1. Check ngày kết thúc
+	// 3. Parse request body - QUAN TRỌNG: Xử lý multipart form
+	var req SubmitSurveyReq
+
+	// Kiểm tra xem request có phải là multipart form không
+	if strings.Contains(c.Request.Header.Get("Content-Type"), "multipart/form-data") {
+		// Xử lý multipart form
+		data := c.PostForm("data")
+		if data == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Thiếu dữ liệu form"})
+			return
+		}
+
+		if err := json.Unmarshal([]byte(data), &req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu JSON không hợp lệ"})
+			return
+		}
+	} else {
+		// Xử lý JSON request
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu gửi không hợp lệ: " + err.Error()})
+			return
+		}
+	}
+
+	// 3.1. Idempotency-Key: request gửi lại với cùng key nhận lại kết quả cũ — kiểm tra trước
+	// trạng thái/hạn/giới hạn phản hồi để lần gửi lại sau khi form đóng hoặc đầy vẫn nhận đúng kết quả
+	idemKey, ok := idempotencyKey(c)
+	if !ok {
+		return
+	}
+	idemHash := requestHash(req.idempotencyPayload())
+	if idemKey != "" {
+		row, err := findIdempotencyKey(idempotencyScopeSub, ks.ID, idemKey)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể kiểm tra Idempotency-Key"})
+			return
+		}
+		if row != nil {
+			replayIdempotent(c, row, idemHash)
+			return
+		}
+	}
+
+	// 4. Trạng thái khảo sát
+	if ks.TrangThai == "archived" || ks.TrangThai == "deleted" || ks.TrangThai == "closed" {
+		c.JSON(http.StatusGone, gin.H{"error": "Khảo sát không còn nhận phản hồi"})
+		return
+	}
+
+	// 4.1. Check ngày kết thúc
 	if ks.NgayKetThuc != nil && time.Now().After(*ks.NgayKetThuc) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Khảo sát đã hết hạn"})
 		return
 	}
-	// 3. Parse settings_json
+	// 5. Parse settings_json
 	var settings struct {
 		RequireLogin bool `json:"require_login"`
 		CollectEmail bool `json:"collect_email"`
@@ -64,7 +134,7 @@ func SubmitSurvey(c *gin.Context) {
 		return
 	}
 
-	// 4. Kiểm tra giới hạn số phản hồi
+	// 5.1. Kiểm tra giới hạn số phản hồi
 	if settings.MaxResponses != nil {
 		var count int64
 		if err := config.DB.Model(&models.PhanHoi{}).Where("khao_sat_id = ?", surveyID).Count(&count).Error; err != nil {
@@ -77,30 +147,6 @@ func SubmitSurvey(c *gin.Context) {
 		}
 	}
 
-	// 5. Parse request body - QUAN TRỌNG: Xử lý multipart form
-	var req SubmitSurveyReq
-
-	// Kiểm tra xem request có phải là multipart form không
-	if strings.Contains(c.Request.Header.Get("Content-Type"), "multipart/form-data") {
-		// Xử lý multipart form
-		data := c.PostForm("data")
-		if data == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Thiếu dữ liệu form"})
-			return
-		}
-
-		if err := json.Unmarshal([]byte(data), &req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu JSON không hợp lệ"})
-			return
-		}
-	} else {
-		// Xử lý JSON request
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu gửi không hợp lệ: " + err.Error()})
-			return
-		}
-	}
-
 	// 6. Validate email nếu có
 	if req.Email != nil && *req.Email != "" {
 		if !isValidEmail(*req.Email) {
@@ -168,6 +214,29 @@ func SubmitSurvey(c *gin.Context) {
 		}
 	}
 
+	// 8.1. Chấm điểm spam (proof-of-work, honeypot, thời gian điền) — sau khi đã validate
+	// để lỗi nhập liệu không làm mất challenge (mỗi challenge chỉ dùng một lần)
+	signals := services.SpamSignals{
+		FormID:    ks.ID,
+		Honeypot:  req.Website,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+	if req.Challenge != nil {
+		signals.ChallengeToken, signals.ChallengeNonce = req.Challenge.Token, req.Challenge.Nonce
+	}
+	antiSpam := formAntiSpam(ks)
+	spam := services.ScoreSubmission(c.Request.Context(), signals, antiSpam)
+	if spam.IsSpam && antiSpam.RejectSpam {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Phản hồi bị từ chối do nghi ngờ spam"})
+		return
+	}
+	spamReasons := ""
+	if len(spam.Reasons) > 0 {
+		b, _ := json.Marshal(spam.Reasons)
+		spamReasons = string(b)
+	}
+
 	// 9. Chuẩn bị phản hồi
 	emailPtr := req.Email
 	if userID != nil {
@@ -177,6 +246,18 @@ func SubmitSurvey(c *gin.Context) {
 		}
 	}
 
+	// 9.1. Chống gửi trùng (cookie trình duyệt / IP / email theo cấu hình form)
+	dupCfg := utils.DuplicateConfig{}
+	if fs, err := utils.ParseSettings([]byte(ks.SettingsJSON)); err == nil {
+		dupCfg = fs.Duplicates.Resolve()
+	}
+	rid := respondentID(c)
+	ipHash := utils.HashIP(c.ClientIP())
+	if dupCfg.OnePerEmail && (emailPtr == nil || strings.TrimSpace(*emailPtr) == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Vui lòng nhập email"})
+		return
+	}
+
 	lanGui := 1
 	if userID != nil {
 		var last models.PhanHoi
@@ -184,20 +265,52 @@ func SubmitSurvey(c *gin.Context) {
 			Order("lan_gui DESC").First(&last).Error; err == nil {
 			lanGui = last.LanGui + 1
 		}
+	} else if rid != "" {
+		// Khách: đếm lần gửi theo cookie trình duyệt
+		var last models.PhanHoi
+		if err := config.DB.Where("khao_sat_id = ? AND respondent_id = ?", surveyID, rid).
+			Order("lan_gui DESC").First(&last).Error; err == nil {
+			lanGui = last.LanGui + 1
+		}
 	}
 
 	// === Transaction đảm bảo rollback nếu lỗi ===
+	var idemRow *models.IdempotencyKey
+	var submissionID uint
+	releaseChallenge := func() {}
 	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if idemKey != "" {
+			var err error
+			if idemRow, err = claimIdempotencyKey(tx, idempotencyScopeSub, ks.ID, idemKey, idemHash); err != nil {
+				return err
+			}
+		}
+		if err := checkDuplicate(tx, ks.ID, dupCfg, rid, ipHash, emailPtr); err != nil {
+			return err
+		}
+		release, err := services.ConsumeFormChallenge(c.Request.Context(), spam)
+		if err != nil {
+			return err
+		}
+		releaseChallenge = release
+
 		submission := models.PhanHoi{
 			KhaoSatID:   uint(surveyID),
 			NguoiDungID: userID,
 			Email:       emailPtr,
 			NgayGui:     time.Now(),
 			LanGui:      lanGui,
+			SpamScore:   spam.Score,
+			SpamReasons: spamReasons,
+			IsSpam:      spam.IsSpam,
+
+			RespondentID: rid,
+			IPHash:       ipHash,
 		}
 		if err := tx.Create(&submission).Error; err != nil {
 			return err
 		}
+		submissionID = submission.ID
 
 		// 10. Lưu từng câu trả lời
 		for _, ans := range req.Answers {
@@ -207,14 +320,9 @@ func SubmitSurvey(c *gin.Context) {
 				return fmt.Errorf("không tìm thấy câu hỏi %d: %w", ans.CauHoiID, err)
 			}
 
-			ct := models.CauTraLoi{
-				PhanHoiID: submission.ID,
-				CauHoiID:  ans.CauHoiID,
-			}
+			ct := newAnswerRow(submission.ID, q, ans)
 
 			switch strings.ToUpper(q.LoaiCauHoi) {
-			case "MULTIPLE_CHOICE", "TRUE_FALSE":
-				ct.LuaChon = ans.LuaChon
 			case "UPLOAD_FILE", "FILE_UPLOAD":
 				fileKey := fmt.Sprintf("file_%d", ans.CauHoiID)
 				fileHeader, err := c.FormFile(fileKey)
@@ -227,24 +335,15 @@ func SubmitSurvey(c *gin.Context) {
 					return fmt.Errorf("file không hợp lệ cho câu hỏi %d: %w", ans.CauHoiID, err)
 				}
 
-				fileID := fmt.Sprintf("%d_%d", submission.ID, ans.CauHoiID)
-				folder := "answers"
-
-				publicURL, upErr := utils.UploadToSupabase(
-					fileHeader,
-					fileHeader.Filename,
-					fileID,
-					folder,
-					"",
-				)
-				if upErr != nil {
+				// Lưu key (không lưu URL công khai): chỉ tải được qua DownloadSubmissionFile.
+				// Thêm phần ngẫu nhiên để key không đoán được từ ID
+				fileID := fmt.Sprintf("%d_%d_%s", submission.ID, ans.CauHoiID, uuid.NewString())
+				key := services.UploadKey(services.PrivateUploadFolder, fileID, fileHeader.Filename)
+				if upErr := services.SaveAnswerUpload(c.Request.Context(), fileHeader, key); upErr != nil {
 					return fmt.Errorf("upload thất bại cho câu hỏi %d: %w", ans.CauHoiID, upErr)
 				}
 
-				ct.NoiDung = publicURL
-
-			default:
-				ct.NoiDung = ans.NoiDung
+				ct.NoiDung = key
 			}
 
 			if err := tx.Create(&ct).Error; err != nil {
@@ -253,11 +352,51 @@ func SubmitSurvey(c *gin.Context) {
 		}
 
 		// 11. Cập nhật số phản hồi
-		return tx.Model(&models.KhaoSat{}).
+		if err := tx.Model(&models.KhaoSat{}).
 			Where("id = ?", surveyID).
-			UpdateColumn("so_phan_hoi", gorm.Expr("so_phan_hoi + 1")).Error
+			UpdateColumn("so_phan_hoi", gorm.Expr("so_phan_hoi + 1")).Error; err != nil {
+			return err
+		}
+
+		// 11.1. Phát sự kiện qua outbox (webhook, ...) — cùng transaction nên không mất/không thừa
+		if err := services.PublishEvent(tx, services.EventSubmissionCreated, ks.ID, gin.H{
+			"submission_id": submission.ID,
+			"submitted_at":  submission.NgayGui,
+			"is_spam":       submission.IsSpam,
+		}); err != nil {
+			return err
+		}
+
+		// 12. Lưu kết quả cho Idempotency-Key
+		if idemRow != nil {
+			return completeIdempotencyKey(tx, idemRow, submission.ID, http.StatusOK, submitSuccessBody(submission.ID))
+		}
+		return nil
 	})
+	if err != nil {
+		// rollback: challenge chưa được phản hồi nào dùng
+		releaseChallenge()
+	}
+
+	if errors.Is(err, errIdempotentReplay) {
+		// Request song song cùng key đã lưu xong trước
+		if row, ferr := findIdempotencyKey(idempotencyScopeSub, ks.ID, idemKey); ferr == nil && row != nil {
+			replayIdempotent(c, row, idemHash)
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": "Request với Idempotency-Key này đang được xử lý"})
+		return
+	}
 
+	if errors.Is(err, services.ErrChallengeUsed) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Challenge đã được dùng, vui lòng tải lại form"})
+		return
+	}
+	var dup *duplicateError
+	if errors.As(err, &dup) {
+		c.JSON(http.StatusConflict, gin.H{"error": dup.Message, "code": dup.Code})
+		return
+	}
 	if err != nil {
 		log.Printf("Lỗi khi lưu phản hồi: %v", err)
 		c.JSON(http.StatusInternalServerError,
@@ -265,7 +404,11 @@ func SubmitSurvey(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Gửi khảo sát thành công"})
+	c.JSON(http.StatusOK, submitSuccessBody(submissionID))
+}
+
+func submitSuccessBody(submissionID uint) gin.H {
+	return gin.H{"message": "Gửi khảo sát thành công", "submission_id": submissionID}
 }
 
 func normalizeJSON(raw string) string {
@@ -366,6 +509,14 @@ func GetSubmissions(c *gin.Context) {
 	query := config.DB.Model(&models.PhanHoi{}).
 		Where("khao_sat_id = ?", surveyID)
 
+	// Lọc spam: spam=exclude (bỏ phản hồi spam) | only (chỉ spam) | all (mặc định)
+	switch c.Query("spam") {
+	case "exclude":
+		query = query.Where("is_spam = ?", false)
+	case "only":
+		query = query.Where("is_spam = ?", true)
+	}
+
 	// Nếu có start_date
 	if startDateStr != "" {
 		if startDate, err := time.Parse("2006-01-02", startDateStr); err == nil {
@@ -399,14 +550,11 @@ func GetSubmissions(c *gin.Context) {
 
 	// Format response
 	resp := []gin.H{}
+	uploads := uploadQuestionIDs(ks.ID)
 	for _, s := range submissions {
 		answers := []gin.H{}
 		for _, a := range s.CauTraLois {
-			answers = append(answers, gin.H{
-				"cau_hoi_id": a.CauHoiID,
-				"noi_dung":   a.NoiDung,
-				"lua_chon":   a.LuaChon,
-			})
+			answers = append(answers, answerJSON(ks.ID, s.ID, a, uploads))
 		}
 
 		resp = append(resp, gin.H{
@@ -417,6 +565,9 @@ func GetSubmissions(c *gin.Context) {
 			"ngay_gui": s.NgayGui,
 			"lan_gui":  s.LanGui,
 			"answers":  answers,
+
+			"spam_score": s.SpamScore,
+			"is_spam":    s.IsSpam,
 		})
 	}
 
@@ -429,6 +580,34 @@ func GetSubmissions(c *gin.Context) {
 	})
 }
 
+// canViewSubmission: người đọc được phản hồi của form (middleware.CanReadForm với responses.read_all)
+// hoặc chính người đã gửi phản hồi
+func canViewSubmission(c *gin.Context, ks models.KhaoSat, sub models.PhanHoi) (bool, error) {
+	if v, ok := c.Get(middleware.CtxUser); ok {
+		if u, ok2 := v.(models.NguoiDung); ok2 && sub.NguoiDungID != nil && *sub.NguoiDungID == u.ID {
+			return true, nil
+		}
+	}
+	return middleware.CanReadForm(c, &ks, models.PermResponsesReadAll)
+}
+
+// checkViewSubmission trả lời 403/500 và false nếu không được xem phản hồi
+func checkViewSubmission(c *gin.Context, ks models.KhaoSat, sub models.PhanHoi) bool {
+	ok, err := canViewSubmission(c, ks, sub)
+	switch {
+	case errors.Is(err, middleware.ErrMustEnroll2FA):
+		c.JSON(http.StatusForbidden, gin.H{"message": "Tài khoản có quyền quản trị cần bật xác thực 2 lớp", "require_2fa_enrollment": true})
+		return false
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể kiểm tra quyền"})
+		return false
+	case !ok:
+		c.JSON(http.StatusForbidden, gin.H{"message": "Bạn không có quyền xem phản hồi này"})
+		return false
+	}
+	return true
+}
+
 // GET /api/forms/:id/submissions/:sub_id
 func GetSubmissionDetail(c *gin.Context) {
 	// Parse form ID
@@ -464,15 +643,15 @@ func GetSubmissionDetail(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Phản hồi không tồn tại"})
 		return
 	}
+	if !checkViewSubmission(c, ks, submission) {
+		return
+	}
 
 	// Chuẩn hoá response
 	answers := []gin.H{}
+	uploads := uploadQuestionIDs(ks.ID)
 	for _, a := range submission.CauTraLois {
-		answers = append(answers, gin.H{
-			"cau_hoi_id": a.CauHoiID,
-			"noi_dung":   a.NoiDung,
-			"lua_chon":   a.LuaChon,
-		})
+		answers = append(answers, answerJSON(ks.ID, submission.ID, a, uploads))
 	}
 
 	resp := gin.H{
@@ -484,11 +663,32 @@ func GetSubmissionDetail(c *gin.Context) {
 		"ngay_gui": submission.NgayGui,
 		"lan_gui":  submission.LanGui,
 		"answers":  answers,
+
+		"spam_score":   submission.SpamScore,
+		"spam_reasons": rawJSONOrNil(submission.SpamReasons),
+		"is_spam":      submission.IsSpam,
 	}
 
 	c.JSON(http.StatusOK, resp)
 }
 
+// newAnswerRow: dòng CauTraLoi của một câu trả lời đã gửi. Chọn nhiều/đúng sai lưu LuaChon (JSON array),
+// các loại còn lại (kể cả SINGLE_CHOICE) lưu NoiDung; file tải lên do SubmitSurvey ghi key vào NoiDung
+func newAnswerRow(submissionID uint, q models.CauHoi, ans AnswerReq) models.CauTraLoi {
+	ct := models.CauTraLoi{
+		PhanHoiID: submissionID,
+		CauHoiID:  ans.CauHoiID,
+	}
+	switch strings.ToUpper(q.LoaiCauHoi) {
+	case "MULTIPLE_CHOICE", "TRUE_FALSE":
+		ct.LuaChon = ans.LuaChon
+	case "UPLOAD_FILE", "FILE_UPLOAD":
+	default:
+		ct.NoiDung = ans.NoiDung
+	}
+	return ct
+}
+
 // BE-26-1: Dashboard thống kê phản hồi
 func GetFormDashboard(c *gin.Context) {
 	formID := c.Param("id")
@@ -625,11 +825,12 @@ func GetFormDashboard(c *gin.Context) {
 		// Upload file
 		case "UPLOAD_FILE", "FILE_UPLOAD":
 			var rows []struct {
-				UserID sql.NullInt64
-				File   sql.NullString
+				SubmissionID uint
+				UserID       sql.NullInt64
+				File         sql.NullString
 			}
 			db.Raw(`
-				SELECT ph.nguoi_dung_id AS user_id, ctl.noi_dung AS file
+				SELECT ph.id AS submission_id, ph.nguoi_dung_id AS user_id, ctl.noi_dung AS file
 				FROM cau_tra_loi ctl
 				JOIN phan_hoi ph ON ctl.phan_hoi_id = ph.id
 				WHERE ctl.cau_hoi_id = $1
@@ -640,8 +841,9 @@ func GetFormDashboard(c *gin.Context) {
 			files := []gin.H{}
 			for _, r := range rows {
 				files = append(files, gin.H{
-					"user_id": r.UserID.Int64,
-					"file":    r.File.String,
+					"user_id":  r.UserID.Int64,
+					"file":     services.UploadRefForClient(r.File.String),
+					"file_url": submissionFileURL(q.KhaoSatID, r.SubmissionID, q.ID),
 				})
 			}
 			stat["stats"] = files
@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vnkhanh/survey-server/config"
+	"github.com/vnkhanh/survey-server/middleware"
+	"github.com/vnkhanh/survey-server/models"
+	"github.com/vnkhanh/survey-server/utils"
+)
+
+type createAPIKeyReq struct {
+	Ten       string     `json:"ten" binding:"required,min=1,max=100"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at"` // nil = không hết hạn
+}
+
+func apiKeyDTO(k models.ApiKey) gin.H {
+	scopes := []string{}
+	if k.Scopes != "" {
+		scopes = strings.Split(k.Scopes, ",")
+	}
+	return gin.H{
+		"id":           k.ID,
+		"ten":          k.Ten,
+		"prefix":       k.Prefix,
+		"scopes":       scopes,
+		"expires_at":   k.ExpiresAt,
+		"last_used_at": k.LastUsedAt,
+		"revoked_at":   k.RevokedAt,
+		"created_at":   k.CreatedAt,
+	}
+}
+
+// POST /api/api-keys — tạo key mới, key gốc chỉ trả về đúng 1 lần
+func CreateAPIKey(c *gin.Context) {
+	u := c.MustGet(middleware.CtxUser).(models.NguoiDung)
+
+	var req createAPIKeyReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "Payload không hợp lệ", "error": err.Error()})
+		return
+	}
+
+	scopes, bad := utils.NormalizeScopes(req.Scopes)
+	if bad != "" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "Scope không hợp lệ: " + bad})
+		return
+	}
+	if len(scopes) == 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "Cần ít nhất một scope"})
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "expires_at phải ở tương lai"})
+		return
+	}
+
+	raw, err := utils.GenerateAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể sinh API key"})
+		return
+	}
+
+	key := models.ApiKey{
+		NguoiDungID: u.ID,
+		Ten:         strings.TrimSpace(req.Ten),
+		Prefix:      utils.APIKeyDisplayPrefix(raw),
+		KeyHash:     utils.HashAPIKey(raw),
+		Scopes:      strings.Join(scopes, ","),
+		ExpiresAt:   req.ExpiresAt,
+	}
+	if err := config.DB.Create(&key).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể tạo API key"})
+		return
+	}
+
+	resp := apiKeyDTO(key)
+	resp["key"] = raw
+	c.JSON(http.StatusCreated, resp)
+}
+
+// GET /api/api-keys — danh sách key của chính mình (không bao gồm key gốc)
+func ListAPIKeys(c *gin.Context) {
+	u := c.MustGet(middleware.CtxUser).(models.NguoiDung)
+
+	var keys []models.ApiKey
+	if err := config.DB.Where("nguoi_dung_id = ?", u.ID).
+		Order("created_at DESC").
+		Find(&keys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể lấy danh sách API key"})
+		return
+	}
+
+	out := make([]gin.H, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, apiKeyDTO(k))
+	}
+	c.JSON(http.StatusOK, gin.H{"api_keys": out})
+}
+
+// DELETE /api/api-keys/:id — thu hồi key (giữ lại bản ghi để tra cứu)
+func RevokeAPIKey(c *gin.Context) {
+	u := c.MustGet(middleware.CtxUser).(models.NguoiDung)
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID không hợp lệ"})
+		return
+	}
+
+	var key models.ApiKey
+	if err := config.DB.Where("id = ? AND nguoi_dung_id = ?", id, u.ID).First(&key).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "API key không tồn tại"})
+		return
+	}
+	if key.RevokedAt != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "revoked"})
+		return
+	}
+
+	if err := config.DB.Model(&key).Update("revoked_at", time.Now()).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể thu hồi API key"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "revoked"})
+}
@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vnkhanh/survey-server/config"
+	"github.com/vnkhanh/survey-server/middleware"
+	"github.com/vnkhanh/survey-server/models"
+	"github.com/vnkhanh/survey-server/services"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// auditEntry dựng AuditEntry với tác nhân (user / edit token / API key) và IP lấy từ request
+func auditEntry(c *gin.Context, action, targetType string, targetID interface{}, meta interface{}) services.AuditEntry {
+	e := services.AuditEntry{
+		ActorType:  models.ActorAnonymous,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Metadata:   meta,
+		IP:         c.ClientIP(),
+	}
+	if v, ok := c.Get(middleware.CtxUser); ok {
+		if u, ok2 := v.(models.NguoiDung); ok2 {
+			id := u.ID
+			e.ActorType = models.ActorUser
+			e.ActorID = &id
+		}
+	}
+	if c.GetBool(middleware.CtxEditToken) {
+		e.ActorType = models.ActorEditToken
+	}
+	if v, ok := c.Get(middleware.CtxAPIKey); ok {
+		if k, ok2 := v.(models.ApiKey); ok2 {
+			id := k.ID
+			e.ActorType = models.ActorAPIKey
+			e.APIKeyID = &id
+		}
+	}
+	return e
+}
+
+// recordAudit ghi nhật ký trong transaction tx của thao tác
+func recordAudit(c *gin.Context, tx *gorm.DB, action, targetType string, targetID interface{}, meta interface{}) error {
+	return services.RecordAudit(tx, auditEntry(c, action, targetType, targetID, meta))
+}
+
+// recordChange ghi nhật ký kèm trạng thái trước/sau trong transaction tx
+func recordChange(c *gin.Context, tx *gorm.DB, action, targetType string, targetID, before, after interface{}) error {
+	e := auditEntry(c, action, targetType, targetID, nil)
+	e.Before, e.After = before, after
+	return services.RecordAudit(tx, e)
+}
+
+// auditEvent ghi sự kiện không làm thay đổi dữ liệu (tải file, xuất nhật ký, chặn tần suất, ...):
+// lỗi chỉ được log lại, không làm hỏng response. Thao tác ghi dùng recordAudit/recordChange trong transaction.
+func auditEvent(c *gin.Context, action, targetType string, targetID, meta interface{}) {
+	if err := recordAudit(c, config.DB, action, targetType, targetID, meta); err != nil {
+		log.Printf("[audit] %s %s#%v: %v", action, targetType, targetID, err)
+	}
+}
+
+// Ảnh chụp các trường đáng theo dõi của từng loại đối tượng (không gồm mật khẩu/hash)
+
+func formAuditView(f *models.KhaoSat) interface{} {
+	if f == nil {
+		return nil
+	}
+	return gin.H{
+		"tieu_de":           f.TieuDe,
+		"mo_ta":             f.MoTa,
+		"trang_thai":        f.TrangThai,
+		"nguoi_tao_id":      f.NguoiTaoID,
+		"ngay_ket_thuc":     f.NgayKetThuc,
+		"settings":          rawJSONOrNil(f.SettingsJSON),
+		"theme":             rawJSONOrNil(f.ThemeJSON),
+		"public_link":       f.PublicLink,
+		"gioi_han_tra_loi":  f.GioiHanTL,
+		"force_archived_at": f.ForceArchivedAt,
+	}
+}
+
+// formWithQuestionsAuditView: form kèm danh sách câu hỏi (cần Preload("CauHois"))
+func formWithQuestionsAuditView(f *models.KhaoSat) interface{} {
+	questions := make(map[string]interface{}, len(f.CauHois))
+	for i := range f.CauHois {
+		questions[strconv.FormatUint(uint64(f.CauHois[i].ID), 10)] = questionAuditView(&f.CauHois[i])
+	}
+	return gin.H{"form": formAuditView(f), "questions": questions}
+}
+
+func questionAuditView(q *models.CauHoi) interface{} {
+	if q == nil {
+		return nil
+	}
+	return gin.H{
+		"khao_sat_id":  q.KhaoSatID,
+		"noi_dung":     q.NoiDung,
+		"loai_cau_hoi": q.LoaiCauHoi,
+		"thu_tu":       q.ThuTu,
+		"props":        rawJSONOrNil(q.PropsJSON),
+	}
+}
+
+func roomAuditView(r *models.Room) interface{} {
+	if r == nil {
+		return nil
+	}
+	return gin.H{
+		"ten_room":          r.TenRoom,
+		"mo_ta":             r.MoTa,
+		"khao_sat_id":       r.KhaoSatID,
+		"nguoi_tao_id":      r.NguoiTaoID,
+		"trang_thai":        r.TrangThai,
+		"is_public":         r.IsPublic,
+		"khoa":              r.Khoa,
+		"is_locked":         r.IsLocked,
+		"co_mat_khau":       r.MatKhau != nil,
+		"share_url":         r.ShareURL,
+		"force_archived_at": r.ForceArchivedAt,
+	}
+}
+
+// lockForm khoá dòng form trong tx và trả trạng thái trước khi ghi (before của nhật ký)
+func lockForm(tx *gorm.DB, formID uint) (*models.KhaoSat, error) {
+	var f models.KhaoSat
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&f, formID).Error; err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// lockRoom khoá dòng room trong tx và trả trạng thái trước khi ghi
+func lockRoom(tx *gorm.DB, roomID uint) (*models.Room, error) {
+	var r models.Room
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&r, roomID).Error; err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// lockQuestion khoá dòng câu hỏi trong tx và trả trạng thái trước khi ghi
+func lockQuestion(tx *gorm.DB, questionID uint) (*models.CauHoi, error) {
+	var q models.CauHoi
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&q, questionID).Error; err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+// auditForm đọc lại form trong tx sau khi ghi rồi ghi nhật ký before/after trong cùng transaction
+func auditForm(c *gin.Context, tx *gorm.DB, action string, formID uint, before *models.KhaoSat) error {
+	var after *models.KhaoSat
+	var f models.KhaoSat
+	if err := tx.First(&f, formID).Error; err == nil {
+		after = &f
+	}
+	return recordChange(c, tx, action, "form", formID, formAuditView(before), formAuditView(after))
+}
+
+// auditRoom đọc lại room trong tx sau khi ghi rồi ghi nhật ký before/after (room đã xoá → after = nil)
+func auditRoom(c *gin.Context, tx *gorm.DB, action string, roomID uint, before *models.Room) error {
+	var after *models.Room
+	var r models.Room
+	if err := tx.First(&r, roomID).Error; err == nil {
+		after = &r
+	}
+	return recordChange(c, tx, action, "room", roomID, roomAuditView(before), roomAuditView(after))
+}
+
+// auditQuestion đọc lại câu hỏi trong tx sau khi ghi rồi ghi nhật ký before/after
+func auditQuestion(c *gin.Context, tx *gorm.DB, action string, questionID uint, before *models.CauHoi) error {
+	var after *models.CauHoi
+	var q models.CauHoi
+	if err := tx.First(&q, questionID).Error; err == nil {
+		after = &q
+	}
+	return recordChange(c, tx, action, "question", questionID, questionAuditView(before), questionAuditView(after))
+}
+
+func rawJSONOrNil(s string) interface{} {
+	if s == "" || !json.Valid([]byte(s)) {
+		return nil
+	}
+	return json.RawMessage(s)
+}
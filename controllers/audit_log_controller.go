@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vnkhanh/survey-server/config"
+	"github.com/vnkhanh/survey-server/models"
+	"gorm.io/gorm"
+)
+
+const auditExportBatch = 1000
+
+// auditLogQuery dựng truy vấn từ query string:
+// target_type, target_id, actor_type, actor_id, action (kết thúc bằng "*" = lọc theo tiền tố), from, to
+func auditLogQuery(c *gin.Context) (*gorm.DB, error) {
+	q := config.DB.Model(&models.AuditLog{})
+	if v := c.Query("target_type"); v != "" {
+		q = q.Where("target_type = ?", v)
+	}
+	if v := c.Query("target_id"); v != "" {
+		q = q.Where("target_id = ?", v)
+	}
+	if v := c.Query("actor_type"); v != "" {
+		q = q.Where("actor_type = ?", v)
+	}
+	if v := c.Query("actor_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("actor_id không hợp lệ")
+		}
+		q = q.Where("actor_id = ?", id)
+	}
+	if v := c.Query("action"); v != "" {
+		if strings.HasSuffix(v, "*") {
+			q = q.Where("action LIKE ?", strings.TrimSuffix(v, "*")+"%")
+		} else {
+			q = q.Where("action = ?", v)
+		}
+	}
+	if v := c.Query("from"); v != "" {
+		t, err := parseAuditTime(v)
+		if err != nil {
+			return nil, fmt.Errorf("from không hợp lệ (RFC3339 hoặc YYYY-MM-DD)")
+		}
+		q = q.Where("created_at >= ?", t)
+	}
+	if v := c.Query("to"); v != "" {
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			q = q.Where("created_at <= ?", t)
+		} else if d, err := time.Parse("2006-01-02", v); err == nil {
+			// to=YYYY-MM-DD: lấy trọn ngày đó
+			q = q.Where("created_at < ?", d.AddDate(0, 0, 1))
+		} else {
+			return nil, fmt.Errorf("to không hợp lệ (RFC3339 hoặc YYYY-MM-DD)")
+		}
+	}
+	return q, nil
+}
+
+func parseAuditTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
+
+// auditLogDTO trả JSON lồng nhau thay vì chuỗi JSON
+func auditLogDTO(l models.AuditLog) gin.H {
+	return gin.H{
+		"id":          l.ID,
+		"created_at":  l.CreatedAt,
+		"actor_type":  l.ActorType,
+		"actor_id":    l.ActorID,
+		"api_key_id":  l.APIKeyID,
+		"action":      l.Action,
+		"target_type": l.TargetType,
+		"target_id":   l.TargetID,
+		"metadata":    rawJSONOrNil(l.Metadata),
+		"before":      rawJSONOrNil(l.Before),
+		"after":       rawJSONOrNil(l.After),
+		"changes":     rawJSONOrNil(l.Changes),
+		"ip":          l.IP,
+	}
+}
+
+// GET /api/admin/audit-logs — tra cứu nhật ký, mới nhất trước
+func ListAuditLogs(c *gin.Context) {
+	q, err := auditLogQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	page, limit, offset := adminPaging(c)
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể đếm nhật ký"})
+		return
+	}
+	var logs []models.AuditLog
+	if err := q.Order("id DESC").Limit(limit).Offset(offset).Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể lấy nhật ký"})
+		return
+	}
+
+	out := make([]gin.H, 0, len(logs))
+	for _, l := range logs {
+		out = append(out, auditLogDTO(l))
+	}
+	c.JSON(http.StatusOK, gin.H{"data": out, "page": page, "limit": limit, "total": total})
+}
+
+// GET /api/admin/audit-logs/export?format=csv|ndjson — xuất toàn bộ kết quả lọc (đọc theo lô, ghi dạng stream)
+func ExportAuditLogs(c *gin.Context) {
+	format := strings.ToLower(c.DefaultQuery("format", "csv"))
+	if format != "csv" && format != "ndjson" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "format chỉ hỗ trợ csv hoặc ndjson"})
+		return
+	}
+	if _, err := auditLogQuery(c); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	// Việc xuất nhật ký cũng được ghi lại
+	auditEvent(c, "audit.export", "audit_log", nil, gin.H{"format": format, "filters": c.Request.URL.Query()})
+
+	filename := fmt.Sprintf("audit-logs-%s.%s", time.Now().Format("20060102-150405"), format)
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		c.Header("Content-Type", "application/x-ndjson")
+	}
+	c.Status(http.StatusOK)
+
+	var cw *csv.Writer
+	enc := json.NewEncoder(c.Writer)
+	if format == "csv" {
+		c.Writer.Write([]byte("\xEF\xBB\xBF")) // BOM cho Excel
+		cw = csv.NewWriter(c.Writer)
+		cw.Write([]string{"id", "created_at", "actor_type", "actor_id", "api_key_id", "action",
+			"target_type", "target_id", "ip", "metadata", "changes", "before", "after"})
+	}
+
+	var lastID uint64
+	for {
+		q, _ := auditLogQuery(c)
+		var batch []models.AuditLog
+		if err := q.Where("id > ?", lastID).Order("id ASC").Limit(auditExportBatch).Find(&batch).Error; err != nil {
+			// Header đã gửi → chỉ có thể dừng stream
+			c.Error(err)
+			break
+		}
+		for _, l := range batch {
+			if cw != nil {
+				cw.Write(csvSafeRow([]string{
+					strconv.FormatUint(l.ID, 10),
+					l.CreatedAt.Format(time.RFC3339),
+					l.ActorType,
+					uintPtrString(l.ActorID),
+					uintPtrString(l.APIKeyID),
+					l.Action,
+					l.TargetType,
+					l.TargetID,
+					l.IP,
+					l.Metadata,
+					l.Changes,
+					l.Before,
+					l.After,
+				}))
+			} else {
+				enc.Encode(auditLogDTO(l))
+			}
+		}
+		if cw != nil {
+			cw.Flush()
+		}
+		c.Writer.Flush()
+
+		if len(batch) < auditExportBatch {
+			break
+		}
+		lastID = batch[len(batch)-1].ID
+	}
+}
+
+func uintPtrString(v *uint) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatUint(uint64(*v), 10)
+}
+
+// csvSafeRow chặn CSV injection: ô bắt đầu bằng = + - @ (hoặc tab, CR) bị Excel/Sheets hiểu là công thức
+// → thêm ' ở đầu. Giá trị trong nhật ký (email, tên form, metadata) do người dùng nhập
+func csvSafeRow(row []string) []string {
+	for i, v := range row {
+		if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+			row[i] = "'" + v
+		}
+	}
+	return row
+}
@@ -0,0 +1,18 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCSVSafeRow(t *testing.T) {
+	got := csvSafeRow([]string{
+		"12", "", "=HYPERLINK(\"http://x\")", "+1", "-2+3", "@SUM(A1)", "\tx", "a=b", "user@example.com",
+	})
+	want := []string{
+		"12", "", "'=HYPERLINK(\"http://x\")", "'+1", "'-2+3", "'@SUM(A1)", "'\tx", "a=b", "user@example.com",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("csvSafeRow = %q, muốn %q", got, want)
+	}
+}
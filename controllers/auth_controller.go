@@ -1,8 +1,9 @@
 package controllers
 
 import (
-	"context"
+	"errors"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -13,7 +14,7 @@ import (
 	"github.com/vnkhanh/survey-server/models"
 	"github.com/vnkhanh/survey-server/services"
 	"github.com/vnkhanh/survey-server/utils"
-	"google.golang.org/api/idtoken"
+	"gorm.io/gorm"
 )
 
 func Me(c *gin.Context) {
@@ -37,27 +38,77 @@ func Login(c *gin.Context) {
 
 	email := strings.TrimSpace(strings.ToLower(req.Email))
 
-	// Tìm user theo email
-	var u models.NguoiDung
-	if err := config.DB.Where("email = ?", email).First(&u).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"message": "Email hoặc mật khẩu không đúng"})
+	// Chống dò mật khẩu: đếm lần thử theo email+IP, theo email và theo IP
+	accountIPKey, accountKey, ipKey := loginThrottleKeys(c, email)
+	if throttleBlocked(c, "account", email, msgLoginLocked, accountIPKey, accountKey, ipKey) {
 		return
 	}
 
+	// Tìm user theo email (email không tồn tại cũng tính là một lần sai)
+	var u models.NguoiDung
+	found := config.DB.Where("email = ?", email).First(&u).Error == nil
+
 	// So khớp mật khẩu (chú ý thứ tự: hash trước, raw sau)
-	if ok := utils.CheckPassword(u.MatKhau, req.MatKhau); !ok {
+	if !found || !utils.CheckPassword(u.MatKhau, req.MatKhau) {
 		c.JSON(http.StatusUnauthorized, gin.H{"message": "Email hoặc mật khẩu không đúng"})
 		return
 	}
 
-	// Vai trò trong token
+	// Đúng mật khẩu → xoá bộ đếm của tài khoản, trả lại lượt đã tính cho IP
+	throttlePassed([]services.ThrottleKey{accountIPKey, accountKey}, ipKey)
+	completeLogin(c, u)
+}
+
+// completeLogin: nếu user đã bật 2FA thì trả về challenge để nhập mã (POST /api/auth/2fa/verify),
+// ngược lại cấp phiên đăng nhập luôn
+func completeLogin(c *gin.Context, u models.NguoiDung) {
+	if u.DisabledAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Tài khoản đã bị khoá"})
+		return
+	}
+	if !u.TOTPEnabled {
+		issueSession(c, u)
+		return
+	}
+
+	challenge, err := utils.GenerateChallengeToken(strconv.FormatUint(uint64(u.ID), 10), utils.PurposeTwoFactor, twoFactorChallengeTTL, u.TokenVersion)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không tạo được token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"require_2fa":     true,
+		"challenge_token": challenge,
+		"expires_at":      time.Now().Add(twoFactorChallengeTTL),
+	})
+}
+
+// issueSession sinh JWT của hệ thống và trả về thông tin đăng nhập (dùng chung cho mọi kiểu login)
+func issueSession(c *gin.Context, u models.NguoiDung) {
+	// Vai trò & quyền hiện tại của user
+	roles, err := services.UserRoleNames(u.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể đọc vai trò"})
+		return
+	}
+	perms, err := services.UserPermissions(u.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể đọc quyền"})
+		return
+	}
+	permList := make([]string, 0, len(perms))
+	for p := range perms {
+		permList = append(permList, p)
+	}
+	sort.Strings(permList)
+
 	role := "user"
 	if u.VaiTro {
 		role = "admin"
 	}
 
 	// Tạo JWT token
-	token, err := utils.GenerateToken(strconv.FormatUint(uint64(u.ID), 10), role)
+	token, err := utils.GenerateToken(strconv.FormatUint(uint64(u.ID), 10), roles, u.TokenVersion)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không tạo được token"})
 		return
@@ -66,15 +117,20 @@ func Login(c *gin.Context) {
 	exp := time.Now().Add(24 * time.Hour)
 
 	c.JSON(http.StatusOK, gin.H{
-		"token":      token,
-		"expires_at": exp,
-		"role":       role,
+		"token":       token,
+		"expires_at":  exp,
+		"role":        role,
+		"roles":       roles,
+		"permissions": permList,
+		// Admin/vai trò có quyền *.read_all chưa bật 2FA: FE cần chuyển sang màn hình đăng ký 2FA
+		"must_enroll_2fa": middleware.MustEnroll2FA(u, perms),
 		"user": gin.H{
-			"id":       u.ID,
-			"ten":      u.Ten,
-			"email":    u.Email,
-			"vai_tro":  u.VaiTro,
-			"ngay_tao": u.NgayTao,
+			"id":           u.ID,
+			"ten":          u.Ten,
+			"email":        u.Email,
+			"vai_tro":      u.VaiTro,
+			"ngay_tao":     u.NgayTao,
+			"totp_enabled": u.TOTPEnabled,
 		},
 	})
 }
@@ -83,52 +139,133 @@ type GoogleTokenRequest struct {
 	IDToken string `json:"id_token" binding:"required"`
 }
 
+// POST /api/auth/google/login — giữ route cũ, thực chất là provider OIDC "google"
 func GoogleLoginHandler(c *gin.Context) {
-	var req GoogleTokenRequest
+	oidcLogin(c, "google")
+}
+
+type OIDCTokenRequest struct {
+	IDToken string `json:"id_token" binding:"required"`
+	Nonce   string `json:"nonce"` // nonce lấy từ POST /api/auth/oidc/nonce, đã gửi trong yêu cầu xác thực
+}
+
+// POST /api/auth/oidc/nonce — nonce dùng một lần cho yêu cầu xác thực tới provider (Google, OIDC)
+func IssueOIDCNonce(c *gin.Context) {
+	nonce, err := services.IssueOIDCNonce(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể tạo nonce"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"nonce": nonce})
+}
+
+// POST /api/auth/oidc/:provider/login
+func OIDCLoginHandler(c *gin.Context) {
+	oidcLogin(c, c.Param("provider"))
+}
+
+// GET /api/auth/oidc/providers — danh sách provider để FE hiển thị nút đăng nhập
+func ListOIDCProviders(c *gin.Context) {
+	out := []gin.H{}
+	for _, p := range services.ListOIDCProviders() {
+		out = append(out, gin.H{
+			"name":         p.Name,
+			"display_name": p.DisplayName,
+			"issuer":       p.Issuer,
+			"client_id":    p.ClientID,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"providers": out})
+}
+
+func oidcLogin(c *gin.Context, providerName string) {
+	var req OIDCTokenRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Thiếu id_token"})
 		return
 	}
 
-	// Xác minh id_token với Google
-	payload, err := idtoken.Validate(context.Background(), req.IDToken, services.GoogleClientID)
+	provider, ok := services.GetOIDCProvider(providerName)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Nhà cung cấp đăng nhập không tồn tại"})
+		return
+	}
+
+	// Xác minh id_token với issuer (discovery + JWKS), claim nonce phải trùng nonce server đã cấp
+	// và chưa dùng: id_token bị lộ không dùng lại được
+	claims, err := provider.Verify(c.Request.Context(), req.IDToken, req.Nonce)
+	if err == nil {
+		err = services.ConsumeOIDCNonce(c.Request.Context(), req.Nonce)
+	}
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{
-			"message": "Token Google không hợp lệ",
+			"message": "Token không hợp lệ",
 			"error":   err.Error(),
 		})
 		return
 	}
 
-	// Lấy thông tin user từ payload
-	email, _ := payload.Claims["email"].(string)
-	name, _ := payload.Claims["name"].(string)
+	user, status, err := findOrLinkOIDCUser(provider.Name, claims)
+	if err != nil {
+		c.JSON(status, gin.H{"message": err.Error()})
+		return
+	}
+
+	completeLogin(c, user)
+}
 
-	// Tìm user trong DB hoặc tạo mới
+// findOrLinkOIDCUser: (provider, sub) đã liên kết → dùng luôn; chưa liên kết thì
+// liên kết theo email đã xác minh (tạo user mới nếu email chưa có trong hệ thống)
+func findOrLinkOIDCUser(provider string, claims *services.OIDCClaims) (models.NguoiDung, int, error) {
 	var user models.NguoiDung
-	if err := config.DB.Where("email = ?", email).First(&user).Error; err != nil {
-		user = models.NguoiDung{
-			Ten:     name,
-			Email:   email,
-			VaiTro:  false,
-			NgayTao: time.Now(),
+
+	var identity models.UserIdentity
+	err := config.DB.Where("provider = ? AND subject = ?", provider, claims.Subject).First(&identity).Error
+	if err == nil {
+		if err := config.DB.First(&user, identity.NguoiDungID).Error; err != nil {
+			return user, http.StatusUnauthorized, errors.New("Tài khoản liên kết không tồn tại")
 		}
-		config.DB.Create(&user)
+		return user, http.StatusOK, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, http.StatusInternalServerError, errors.New("Lỗi DB")
 	}
 
-	// Sinh JWT của hệ thống
-	token, _ := utils.GenerateToken(strconv.FormatUint(uint64(user.ID), 10), "user")
+	// Chỉ liên kết/tạo tài khoản khi email đã được issuer xác minh
+	if claims.Email == "" || !claims.EmailVerified {
+		return user, http.StatusForbidden, errors.New("Email chưa được nhà cung cấp xác minh")
+	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"token": token,
-		"user": gin.H{
-			"id":       user.ID,
-			"ten":      user.Ten,
-			"email":    user.Email,
-			"vai_tro":  user.VaiTro,
-			"ngay_tao": user.NgayTao,
-		},
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("email = ?", claims.Email).First(&user).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			name := claims.Name
+			if name == "" {
+				name = claims.Email
+			}
+			user = models.NguoiDung{
+				Ten:     name,
+				Email:   claims.Email,
+				VaiTro:  false,
+				NgayTao: time.Now(),
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(&models.UserIdentity{
+			NguoiDungID: user.ID,
+			Provider:    provider,
+			Subject:     claims.Subject,
+			Email:       claims.Email,
+		}).Error
 	})
+	if err != nil {
+		return user, http.StatusInternalServerError, errors.New("Không thể liên kết tài khoản")
+	}
+	return user, http.StatusOK, nil
 }
 
 func GetUserByEmail(c *gin.Context) {
@@ -151,4 +288,4 @@ func GetUserByEmail(c *gin.Context) {
 			"email": user.Email,
 		},
 	})
-}
\ No newline at end of file
+}
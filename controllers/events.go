@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/vnkhanh/survey-server/models"
+	"github.com/vnkhanh/survey-server/services"
+	"gorm.io/gorm"
+)
+
+// Dữ liệu đi kèm sự kiện nghiệp vụ (payload của outbox, cũng là "data" của webhook)
+
+func formEventData(id uint, title, status string) gin.H {
+	return gin.H{"form_id": id, "title": title, "status": status}
+}
+
+func exportEventData(job models.ExportJob, rows int) gin.H {
+	return gin.H{"job_id": job.JobID, "format": job.Format, "rows": rows}
+}
+
+// setFormStatus đổi trạng thái form và phát sự kiện tương ứng trong cùng transaction
+func setFormStatus(tx *gorm.DB, f models.KhaoSat, updates map[string]interface{}, event string) error {
+	if err := tx.Model(&models.KhaoSat{}).Where("id = ?", f.ID).Updates(updates).Error; err != nil {
+		return err
+	}
+	status, _ := updates["trang_thai"].(string)
+	return services.PublishEvent(tx, event, f.ID, formEventData(f.ID, f.TieuDe, status))
+}
+
+// setFormStatusAudited: setFormStatus kèm nhật ký before/after trong cùng transaction
+func setFormStatusAudited(c *gin.Context, tx *gorm.DB, f models.KhaoSat, action string, updates map[string]interface{}, event string) error {
+	before, err := lockForm(tx, f.ID)
+	if err != nil {
+		return err
+	}
+	if err := setFormStatus(tx, f, updates, event); err != nil {
+		return err
+	}
+	return auditForm(c, tx, action, f.ID, before)
+}
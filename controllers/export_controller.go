@@ -1,29 +1,37 @@
 package controllers
 
 import (
-	"encoding/csv"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/xuri/excelize/v2"
 	"gorm.io/gorm"
 
 	"github.com/vnkhanh/survey-server/config"
+	"github.com/vnkhanh/survey-server/middleware"
 	"github.com/vnkhanh/survey-server/models"
+	"github.com/vnkhanh/survey-server/services"
 )
 
 type ExportRequest struct {
 	Format             string  `json:"format"`
 	RangeFrom          *string `json:"range_from,omitempty"`
 	RangeTo            *string `json:"range_to,omitempty"`
-	IncludeAttachments bool    `json:"include_attachments"`
+	IncludeAttachments bool    `json:"include_attachments"` // xuất ZIP: file dữ liệu + file đính kèm + manifest.json
+	ExcludeSpam        bool    `json:"exclude_spam"`        // bỏ các phản hồi bị đánh dấu spam
+	PresetID           *uint   `json:"preset_id,omitempty"` // preset của form; các tuỳ chọn gửi kèm ghi đè preset
+
+	services.ExportOptions
 }
 
 // POST /api/forms/:id/export
@@ -48,6 +56,31 @@ func CreateExport(c *gin.Context) {
 	if req.Format == "" {
 		req.Format = "csv"
 	}
+	format, ok := services.ExportFormatByName(req.Format)
+	if !ok {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"message":   "Định dạng xuất không được hỗ trợ",
+			"supported": services.ExportFormatNames(),
+		})
+		return
+	}
+
+	opts := req.ExportOptions
+	if req.PresetID != nil {
+		var preset models.ExportPreset
+		if err := config.DB.Where("id = ? AND khao_sat_id = ?", *req.PresetID, form.ID).First(&preset).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Preset không tồn tại"})
+			return
+		}
+		var base services.ExportOptions
+		json.Unmarshal([]byte(preset.OptionsJSON), &base)
+		opts = base.Merge(req.ExportOptions)
+	}
+	if err := validateExportOptions(form.ID, &opts); err != nil {
+		exportOptionsError(c, err)
+		return
+	}
+	optsJSON, _ := json.Marshal(opts)
 
 	var fromPtr, toPtr *time.Time
 	if req.RangeFrom != nil {
@@ -65,15 +98,38 @@ func CreateExport(c *gin.Context) {
 	job := models.ExportJob{
 		JobID:              jobID,
 		KhaoSatID:          form.ID,
-		Format:             req.Format,
+		Format:             format.Name,
 		RangeFrom:          fromPtr,
 		RangeTo:            toPtr,
 		IncludeAttachments: req.IncludeAttachments,
+		ExcludeSpam:        req.ExcludeSpam,
+		OptionsJSON:        string(optsJSON),
 		Status:             "queued",
 	}
-	config.DB.Create(&job)
-
-	go processExportJob(jobID)
+	// Job xuất và job trong hàng đợi được tạo cùng transaction: không có job "queued" mà không ai chạy
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		qj, err := services.EnqueueJob(tx, jobKindExport, exportJobPayload{JobID: jobID})
+		if err != nil {
+			return err
+		}
+		job.QueueJobID = &qj.ID
+		if err := tx.Create(&job).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "export.create", "form", form.ID, gin.H{
+			"job_id":              jobID,
+			"format":              job.Format,
+			"range_from":          job.RangeFrom,
+			"range_to":            job.RangeTo,
+			"include_attachments": job.IncludeAttachments,
+			"exclude_spam":        job.ExcludeSpam,
+			"preset_id":           req.PresetID,
+			"options":             opts,
+		})
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể tạo job xuất dữ liệu"})
+		return
+	}
 
 	c.JSON(http.StatusAccepted, gin.H{
 		"job_id": jobID,
@@ -83,228 +139,425 @@ func CreateExport(c *gin.Context) {
 
 // GET /api/exports/:job_id
 func GetExport(c *gin.Context) {
-	jobID := c.Param("job_id")
-	var job models.ExportJob
-	if err := config.DB.First(&job, "job_id = ?", jobID).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"message": "Job không tìm thấy"})
+	// exportJobObj đã được middleware.CheckExportJob nạp và kiểm tra quyền (trước khi ký link tải)
+	job := c.MustGet(middleware.CtxExportJob).(models.ExportJob)
+
+	dto := exportJobDTO(job)
+	if job.Status == "done" && job.FilePath != nil {
+		u, err := exportDownloadURL(c, job)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể tạo link tải"})
+			return
+		}
+		// ?download=1: chuyển thẳng tới link tải
+		if c.Query("download") == "1" {
+			c.Redirect(http.StatusFound, u)
 			return
 		}
+		dto["download_url"] = u
+		dto["download_url_expires_in"] = int(services.ExportLinkTTL().Seconds())
+	}
+	c.JSON(http.StatusOK, dto)
+}
+
+func exportJobDTO(job models.ExportJob) gin.H {
+	var opts services.ExportOptions
+	if job.OptionsJSON != "" {
+		json.Unmarshal([]byte(job.OptionsJSON), &opts)
+	}
+	return gin.H{
+		"job_id":              job.JobID,
+		"form_id":             job.KhaoSatID,
+		"format":              job.Format,
+		"status":              job.Status,
+		"progress":            job.Progress,
+		"error":               job.ErrorMsg,
+		"range_from":          job.RangeFrom,
+		"range_to":            job.RangeTo,
+		"include_attachments": job.IncludeAttachments,
+		"exclude_spam":        job.ExcludeSpam,
+		"options":             opts,
+		"expires_at":          job.ExpiresAt,
+		"created_at":          job.CreatedAt,
+		"updated_at":          job.UpdatedAt,
+	}
+}
+
+// exportDownloadURL: link tải có hạn EXPORT_LINK_TTL của file xuất
+func exportDownloadURL(c *gin.Context, job models.ExportJob) (string, error) {
+	st, err := services.ExportStorage()
+	if err != nil {
+		return "", err
+	}
+	return st.SignedURL(c.Request.Context(), services.ExportFileKey(*job.FilePath), services.ExportLinkTTL())
+}
+
+// GET /api/forms/:id/exports — các job xuất của form (mới nhất trước), lọc ?status=
+func ListFormExports(c *gin.Context) {
+	form := c.MustGet("formObj").(models.KhaoSat)
+	page, limit, offset := adminPaging(c)
+
+	q := config.DB.Model(&models.ExportJob{}).Where("khao_sat_id = ?", form.ID)
+	if st := c.Query("status"); st != "" {
+		q = q.Where("status = ?", st)
+	}
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Lỗi DB"})
 		return
 	}
+	var jobs []models.ExportJob
+	if err := q.Order("created_at DESC").Limit(limit).Offset(offset).Find(&jobs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Lỗi DB"})
+		return
+	}
+	out := make([]gin.H, 0, len(jobs))
+	for _, j := range jobs {
+		out = append(out, exportJobDTO(j))
+	}
+	c.JSON(http.StatusOK, gin.H{"exports": out, "page": page, "limit": limit, "total": total})
+}
 
-	if job.Status == "done" && job.FilePath != nil {
-		c.FileAttachment(*job.FilePath, path.Base(*job.FilePath))
+// GET /api/export-downloads?key=&exp=&sig= — tải file xuất lưu trên đĩa (link do LocalStorage.SignedURL tạo)
+func DownloadExportFile(c *gin.Context) {
+	st, err := services.ExportStorage()
+	local, ok := st.(*services.LocalStorage)
+	if err != nil || !ok {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Không tìm thấy"})
 		return
 	}
+	key := c.Query("key")
+	if !local.VerifySignedURL(key, c.Query("exp"), c.Query("sig")) {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Link tải không hợp lệ hoặc đã hết hạn"})
+		return
+	}
+	p, err := local.FilePath(key)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Key không hợp lệ"})
+		return
+	}
+	if _, err := os.Stat(p); err != nil {
+		c.JSON(http.StatusGone, gin.H{"message": "File đã hết hạn"})
+		return
+	}
+	c.FileAttachment(p, path.Base(key))
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"job_id": job.JobID,
-		"status": job.Status,
-		"error":  job.ErrorMsg,
+// finishExportJob đánh dấu job xong (file giữ tới hết EXPORT_TTL) và phát export.done trong cùng transaction;
+// job của lịch xuất thì xếp hàng giao file
+func finishExportJob(job *models.ExportJob, key string, rows int) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(job).Updates(map[string]interface{}{
+			"status":     "done",
+			"file_path":  key,
+			"progress":   100,
+			"expires_at": time.Now().Add(services.ExportTTL()),
+		}).Error; err != nil {
+			return err
+		}
+		if err := services.PublishEvent(tx, services.EventExportDone, job.KhaoSatID, exportEventData(*job, rows)); err != nil {
+			return err
+		}
+		return queueScheduleDelivery(tx, job, rows)
 	})
 }
 
-// xử lý job xuất dữ liệu
-func processExportJob(jobID string) {
-	var job models.ExportJob
-	if err := config.DB.First(&job, "job_id = ?", jobID).Error; err != nil {
+// DELETE /api/exports/:job_id — huỷ job đang chờ/đang chạy
+func CancelExport(c *gin.Context) {
+	// exportJobObj đã được middleware.CheckExportJob nạp và kiểm tra quyền
+	job := c.MustGet(middleware.CtxExportJob).(models.ExportJob)
+	if job.Status != "queued" && job.Status != "processing" {
+		c.JSON(http.StatusConflict, gin.H{"message": "Job đã kết thúc", "status": job.Status})
+		return
+	}
+	if job.QueueJobID == nil {
+		c.JSON(http.StatusConflict, gin.H{"message": "Job không thể huỷ"})
+		return
+	}
+	var qj models.Job
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if qj, err = services.CancelJob(tx, *job.QueueJobID); err != nil {
+			return err
+		}
+		if qj.Status == models.JobCancelled {
+			if err := tx.Model(&job).Update("status", "cancelled").Error; err != nil {
+				return err
+			}
+		}
+		return recordAudit(c, tx, "export.cancel", "form", job.KhaoSatID, gin.H{"job_id": job.JobID})
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể huỷ job"})
+		return
+	}
+	if qj.Status == models.JobCancelled {
+		c.JSON(http.StatusOK, gin.H{"job_id": job.JobID, "status": "cancelled"})
 		return
 	}
-	config.DB.Model(&job).Update("status", "processing")
+	// Đang chạy: worker sẽ dừng ở lần kiểm tra kế tiếp
+	c.JSON(http.StatusAccepted, gin.H{"job_id": job.JobID, "status": "cancelling"})
+}
+
+const jobKindExport = "export"
+
+type exportJobPayload struct {
+	JobID string `json:"job_id"`
+}
+
+// runExportJob: handler của hàng đợi cho job xuất dữ liệu
+func runExportJob(ctx context.Context, qj models.Job) error {
+	var p exportJobPayload
+	if err := json.Unmarshal([]byte(qj.Payload), &p); err != nil {
+		return services.PermanentJobError(err)
+	}
+	var job models.ExportJob
+	if err := config.DB.First(&job, "job_id = ?", p.JobID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return services.PermanentJobError(err)
+		}
+		return err
+	}
+
+	err := processExportJob(ctx, &job)
+	if err == nil {
+		return nil
+	}
+	em := err.Error()
+	switch {
+	case ctx.Err() != nil:
+		// huỷ hoặc mất lease: hàng đợi quyết định trạng thái cuối
+		config.DB.Model(&job).Update("status", "cancelled")
+	case services.IsFinalAttempt(qj, err):
+		config.DB.Model(&job).Updates(map[string]interface{}{"status": "failed", "error_msg": em})
+		failScheduleRunForJob(job.JobID, em)
+	default:
+		// sẽ được thử lại
+		config.DB.Model(&job).Updates(map[string]interface{}{"status": "queued", "error_msg": em})
+	}
+	return err
+}
 
-	outDir := "./exports"
-	os.MkdirAll(outDir, 0755)
+// Số phản hồi đọc mỗi lần khi xuất
+const exportBatchSize = 500
 
-	// Đặt tên file
-	ext := strings.ToLower(job.Format)
-	if ext != "xlsx" {
-		ext = "csv"
+// xử lý job xuất dữ liệu
+func processExportJob(ctx context.Context, job *models.ExportJob) error {
+	config.DB.Model(job).Updates(map[string]interface{}{"status": "processing", "progress": 0})
+
+	format, ok := services.ExportFormatByName(job.Format)
+	if !ok {
+		return services.PermanentJobError(fmt.Errorf("định dạng không hỗ trợ: %s", job.Format))
 	}
-	filename := fmt.Sprintf("export_%s.%s", job.JobID, ext)
-	outPath := path.Join(outDir, filename)
 
-	// helper update fail
-	failJob := func(em string) {
-		config.DB.Model(&job).Updates(map[string]interface{}{
-			"status":    "failed",
-			"error_msg": em,
-		})
+	st, err := services.ExportStorage()
+	if err != nil {
+		return err
+	}
+
+	// File được ghi ở thư mục tạm rồi mới đưa lên kho file xuất;
+	// có đính kèm thì file dữ liệu đóng gói vào ZIP
+	workDir := filepath.Join(os.TempDir(), "survey-exports")
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return err
+	}
+	key := fmt.Sprintf("export_%s.%s", job.JobID, format.Ext)
+	if job.IncludeAttachments {
+		key = fmt.Sprintf("export_%s.zip", job.JobID)
 	}
+	outPath := filepath.Join(workDir, key)
+	dataPath := outPath
+	if job.IncludeAttachments {
+		dataPath = outPath + "." + format.Ext + ".part"
+		defer os.Remove(dataPath)
+	}
+	defer os.Remove(outPath)
 
-	// 1. Lấy danh sách câu hỏi
+	// 1. Lấy danh sách câu hỏi (kèm lựa chọn cho nhãn giá trị)
 	var questions []models.CauHoi
 	if err := config.DB.Where("khao_sat_id = ?", job.KhaoSatID).
+		Preload("LuaChons", func(db *gorm.DB) *gorm.DB { return db.Order("thu_tu ASC, id ASC") }).
 		Order("id asc").Find(&questions).Error; err != nil {
-		failJob(err.Error())
-		return
+		return err
 	}
 
-	// 2. Lấy danh sách phản hồi
-	var responses []models.PhanHoi
-	q := config.DB.Preload("CauTraLois").Where("khao_sat_id = ?", job.KhaoSatID)
-	if job.RangeFrom != nil {
-		q = q.Where("ngay_gui >= ?", job.RangeFrom)
-	}
-	if job.RangeTo != nil {
-		q = q.Where("ngay_gui <= ?", job.RangeTo)
-	}
-	if err := q.Find(&responses).Error; err != nil {
-		failJob(err.Error())
-		return
+	shape, err := newExportShape(job, questions)
+	if err != nil {
+		return services.PermanentJobError(err)
 	}
 
-	// 3. Chuẩn bị header
-	header := []string{"Dấu thời gian"}
-	for _, q := range questions {
-		if q.NoiDung != "" {
-			header = append(header, q.NoiDung)
-		} else {
-			header = append(header, "Câu hỏi không có tiêu đề")
+	// 2. Đếm phản hồi để báo tiến độ
+	base := func() *gorm.DB {
+		q := config.DB.WithContext(ctx).Model(&models.PhanHoi{}).Where("khao_sat_id = ?", job.KhaoSatID)
+		if job.RangeFrom != nil {
+			q = q.Where("ngay_gui >= ?", job.RangeFrom)
+		}
+		if job.RangeTo != nil {
+			q = q.Where("ngay_gui <= ?", job.RangeTo)
 		}
+		if job.ExcludeSpam {
+			q = q.Where("is_spam = ?", false)
+		}
+		return q
 	}
-
-	// --- Nếu CSV ---
-	if ext == "csv" {
-		f, err := os.Create(outPath)
-		if err != nil {
-			failJob(err.Error())
+	var total int64
+	if err := base().Count(&total).Error; err != nil {
+		return err
+	}
+	// Tiến độ: ghi dữ liệu chiếm [0, dataShare]%, phần còn lại cho file đính kèm
+	dataShare := 100
+	if job.IncludeAttachments {
+		dataShare = 50
+	}
+	progress := 0
+	report := func(done int, from, span int) {
+		if total == 0 {
 			return
 		}
-		defer f.Close()
-
-		// BOM UTF-8
-		if _, err := f.Write([]byte{0xEF, 0xBB, 0xBF}); err != nil {
-			failJob(err.Error())
-			return
+		if p := from + int(int64(done)*int64(span)/total); p > progress && p < 100 {
+			progress = p
+			config.DB.Model(job).Update("progress", progress)
 		}
+	}
 
-		w := csv.NewWriter(f)
-		defer w.Flush()
+	// 3. Ghi file qua exporter của định dạng
+	written, err := writeExportData(ctx, shape, format, base, dataPath, func(n int) { report(n, 0, dataShare) })
+	if err != nil {
+		return err
+	}
 
-		// Ghi header
-		if err := w.Write(header); err != nil {
-			failJob(err.Error())
-			return
+	// 4. Đóng gói ZIP: file dữ liệu + file đính kèm + manifest
+	if job.IncludeAttachments {
+		err := writeExportBundle(ctx, shape, base, dataPath, services.BundleDataName(format.Ext), outPath,
+			func(n int) { report(n, dataShare, 100-dataShare) })
+		if err != nil {
+			return err
 		}
+	}
 
-		// Ghi dữ liệu
-		for _, r := range responses {
-			row := []string{r.NgayGui.Format("02/01/2006 15:04:05")}
+	// 5. Đưa file lên kho file xuất
+	f, err := os.Open(outPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	contentType := format.ContentType
+	if job.IncludeAttachments {
+		contentType = "application/zip"
+	}
+	if err := st.Put(ctx, key, f, contentType); err != nil {
+		return err
+	}
 
-			answerMap := make(map[uint]models.CauTraLoi)
-			for _, a := range r.CauTraLois {
-				answerMap[a.CauHoiID] = a
-			}
+	return finishExportJob(job, key, written)
+}
 
-			for _, q := range questions {
-				val := ""
-				if ans, ok := answerMap[q.ID]; ok {
-					switch strings.ToUpper(q.LoaiCauHoi) {
-					case "FILL_BLANK", "RATING":
-						val = ans.NoiDung
-
-					case "UPLOAD_FILE", "FILE_UPLOAD":
-						if job.IncludeAttachments {
-							val = ans.NoiDung
-						} else if ans.NoiDung != "" {
-							val = "[đã đính kèm]"
-						}
-
-					case "MULTIPLE_CHOICE", "TRUE_FALSE":
-						if ans.LuaChon != "" {
-							var opts []string
-							if err := json.Unmarshal([]byte(ans.LuaChon), &opts); err == nil {
-								val = strings.Join(opts, ", ")
-							} else {
-								val = ans.LuaChon
-							}
-						}
-					}
-				}
-				row = append(row, val)
-			}
+// writeExportData ghi toàn bộ phản hồi ra dataPath, đọc theo lô (keyset theo id) để chỉ giữ một lô trong bộ nhớ
+func writeExportData(ctx context.Context, shape *exportShape, format services.ExportFormat,
+	base func() *gorm.DB, dataPath string, onProgress func(int)) (int, error) {
+	f, err := os.Create(dataPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
 
-			if err := w.Write(row); err != nil {
-				failJob(err.Error())
-				return
+	ex := format.New()
+	if err := ex.Begin(f, shape.Columns()); err != nil {
+		return 0, err
+	}
+	written := 0
+	var lastID uint
+	for {
+		var batch []models.PhanHoi
+		if err := base().Preload("CauTraLois").
+			Where("id > ?", lastID).Order("id asc").Limit(exportBatchSize).
+			Find(&batch).Error; err != nil {
+			return written, err
+		}
+		for _, r := range batch {
+			for _, row := range shape.Rows(r) {
+				if err := ex.WriteRow(row); err != nil {
+					return written, err
+				}
 			}
 		}
-		w.Flush()
-		if err := w.Error(); err != nil {
-			failJob(err.Error())
-			return
+		written += len(batch)
+		onProgress(written)
+		if len(batch) < exportBatchSize {
+			break
 		}
+		lastID = batch[len(batch)-1].ID
+	}
+	if err := ex.Close(); err != nil {
+		return written, err
+	}
+	return written, f.Close()
+}
 
-		// done
-		config.DB.Model(&job).Updates(map[string]interface{}{
-			"status":    "done",
-			"file_path": outPath,
-		})
-
-	} else { // --- Nếu XLSX ---
-		f := excelize.NewFile()
-		sheet := f.GetSheetName(f.GetActiveSheetIndex())
-
-		// header
-		for i, h := range header {
-			col, _ := excelize.ColumnNumberToName(i + 1)
-			cell := fmt.Sprintf("%s1", col)
-			f.SetCellValue(sheet, cell, h)
+// writeExportBundle tạo ZIP: file dữ liệu, rồi duyệt lại phản hồi (cùng bộ lọc, cùng thứ tự)
+// để tải file đính kèm qua Storage; với bố cục wide số dòng trong manifest khớp với file dữ liệu
+func writeExportBundle(ctx context.Context, shape *exportShape, base func() *gorm.DB,
+	dataPath, dataName, outPath string, onProgress func(int)) error {
+	job := shape.job
+	var uploadIDs []uint
+	for _, q := range shape.questions {
+		switch strings.ToUpper(q.LoaiCauHoi) {
+		case "UPLOAD_FILE", "FILE_UPLOAD":
+			uploadIDs = append(uploadIDs, q.ID)
 		}
+	}
+
+	out, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
 
-		// data
-		for ri, r := range responses {
-			rowIdx := ri + 2
-			f.SetCellValue(sheet, fmt.Sprintf("A%d", rowIdx),
-				r.NgayGui.Format("02/01/2006 15:04:05"))
+	bundle := services.NewExportBundle(out, job.JobID, job.KhaoSatID)
+	data, err := os.Open(dataPath)
+	if err != nil {
+		return err
+	}
+	err = bundle.AddData(dataName, data)
+	data.Close()
+	if err != nil {
+		return err
+	}
 
-			answerMap := make(map[uint]models.CauTraLoi)
-			for _, a := range r.CauTraLois {
-				answerMap[a.CauHoiID] = a
+	if len(uploadIDs) > 0 {
+		done, row := 0, 0
+		var lastID uint
+		for {
+			var batch []models.PhanHoi
+			if err := base().Select("id").
+				Preload("CauTraLois", "cau_hoi_id IN ? AND noi_dung <> ''", uploadIDs).
+				Where("id > ?", lastID).Order("id asc").Limit(exportBatchSize).
+				Find(&batch).Error; err != nil {
+				return err
 			}
-
-			for qi, q := range questions {
-				col, _ := excelize.ColumnNumberToName(qi + 2)
-				cell := fmt.Sprintf("%s%d", col, rowIdx)
-
-				val := ""
-				if ans, ok := answerMap[q.ID]; ok {
-					switch strings.ToUpper(q.LoaiCauHoi) {
-					case "FILL_BLANK", "RATING":
-						val = ans.NoiDung
-
-					case "UPLOAD_FILE", "FILE_UPLOAD":
-						if job.IncludeAttachments {
-							val = ans.NoiDung
-						} else if ans.NoiDung != "" {
-							val = "[đã đính kèm]"
-						}
-
-					case "MULTIPLE_CHOICE", "TRUE_FALSE":
-						if ans.LuaChon != "" {
-							var opts []string
-							if err := json.Unmarshal([]byte(ans.LuaChon), &opts); err == nil {
-								val = strings.Join(opts, ", ")
-							} else {
-								val = ans.LuaChon
-							}
-						}
+			for _, r := range batch {
+				done++
+				if shape.wide() {
+					row = done
+				}
+				for _, a := range r.CauTraLois {
+					if err := bundle.AddAttachment(ctx, row, r.ID, a.CauHoiID, a.NoiDung); err != nil {
+						return err
 					}
-					f.SetCellValue(sheet, cell, val)
 				}
 			}
+			onProgress(done)
+			if len(batch) < exportBatchSize {
+				break
+			}
+			lastID = batch[len(batch)-1].ID
 		}
+	}
 
-		if err := f.SaveAs(outPath); err != nil {
-			failJob(err.Error())
-			return
-		}
-
-		config.DB.Model(&job).Updates(map[string]interface{}{
-			"status":    "done",
-			"file_path": outPath,
-		})
+	if err := bundle.Close(); err != nil {
+		return err
+	}
+	if n := bundle.Failed(); n > 0 {
+		log.Printf("[export] job %s: %d attachments could not be fetched", job.JobID, n)
 	}
+	return out.Close()
 }
@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vnkhanh/survey-server/config"
+	"github.com/vnkhanh/survey-server/middleware"
+	"github.com/vnkhanh/survey-server/models"
+	"github.com/vnkhanh/survey-server/services"
+	"gorm.io/gorm"
+)
+
+type exportPresetReq struct {
+	Ten     string                 `json:"ten" binding:"required"`
+	Options services.ExportOptions `json:"options"`
+}
+
+func exportPresetDTO(p models.ExportPreset) gin.H {
+	var opts services.ExportOptions
+	json.Unmarshal([]byte(p.OptionsJSON), &opts)
+	return gin.H{
+		"id":         p.ID,
+		"form_id":    p.KhaoSatID,
+		"ten":        p.Ten,
+		"options":    opts,
+		"created_at": p.CreatedAt,
+		"updated_at": p.UpdatedAt,
+	}
+}
+
+// bindExportPreset đọc & kiểm tra payload (đã trả lỗi nếu không hợp lệ)
+func bindExportPreset(c *gin.Context, formID uint) (exportPresetReq, string, bool) {
+	var req exportPresetReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Payload không hợp lệ"})
+		return req, "", false
+	}
+	req.Ten = strings.TrimSpace(req.Ten)
+	if req.Ten == "" || len(req.Ten) > 100 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "Tên preset phải từ 1 đến 100 ký tự"})
+		return req, "", false
+	}
+	if err := validateExportOptions(formID, &req.Options); err != nil {
+		exportOptionsError(c, err)
+		return req, "", false
+	}
+	b, _ := json.Marshal(req.Options)
+	return req, string(b), true
+}
+
+// findExportPreset lấy preset :preset_id của form trong context (đã trả 404 nếu không có)
+func findExportPreset(c *gin.Context, form models.KhaoSat) (models.ExportPreset, bool) {
+	var p models.ExportPreset
+	if err := config.DB.Where("id = ? AND khao_sat_id = ?", c.Param("preset_id"), form.ID).First(&p).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Preset không tồn tại"})
+		return p, false
+	}
+	return p, true
+}
+
+// GET /api/forms/:id/export-presets
+func ListExportPresets(c *gin.Context) {
+	form := c.MustGet("formObj").(models.KhaoSat)
+	var presets []models.ExportPreset
+	if err := config.DB.Where("khao_sat_id = ?", form.ID).Order("ten ASC").Find(&presets).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Lỗi DB"})
+		return
+	}
+	out := make([]gin.H, 0, len(presets))
+	for _, p := range presets {
+		out = append(out, exportPresetDTO(p))
+	}
+	c.JSON(http.StatusOK, gin.H{"presets": out})
+}
+
+// POST /api/forms/:id/export-presets
+func CreateExportPreset(c *gin.Context) {
+	u := c.MustGet(middleware.CtxUser).(models.NguoiDung)
+	form := c.MustGet("formObj").(models.KhaoSat)
+	req, opts, ok := bindExportPreset(c, form.ID)
+	if !ok {
+		return
+	}
+	p := models.ExportPreset{KhaoSatID: form.ID, NguoiDungID: u.ID, Ten: req.Ten, OptionsJSON: opts}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&p).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "export_preset.create", "form", form.ID, gin.H{"preset_id": p.ID, "ten": p.Ten})
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể lưu preset"})
+		return
+	}
+	c.JSON(http.StatusCreated, exportPresetDTO(p))
+}
+
+// PUT /api/forms/:id/export-presets/:preset_id
+func UpdateExportPreset(c *gin.Context) {
+	form := c.MustGet("formObj").(models.KhaoSat)
+	p, ok := findExportPreset(c, form)
+	if !ok {
+		return
+	}
+	req, opts, ok := bindExportPreset(c, form.ID)
+	if !ok {
+		return
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&p).Updates(map[string]interface{}{"ten": req.Ten, "options_json": opts}).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&p, p.ID).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "export_preset.update", "form", form.ID, gin.H{"preset_id": p.ID, "ten": p.Ten})
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể cập nhật preset"})
+		return
+	}
+	c.JSON(http.StatusOK, exportPresetDTO(p))
+}
+
+// DELETE /api/forms/:id/export-presets/:preset_id
+func DeleteExportPreset(c *gin.Context) {
+	form := c.MustGet("formObj").(models.KhaoSat)
+	p, ok := findExportPreset(c, form)
+	if !ok {
+		return
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&p).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "export_preset.delete", "form", form.ID, gin.H{"preset_id": p.ID})
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể xoá preset"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Đã xoá preset"})
+}
@@ -0,0 +1,376 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/vnkhanh/survey-server/config"
+	"github.com/vnkhanh/survey-server/middleware"
+	"github.com/vnkhanh/survey-server/models"
+	"github.com/vnkhanh/survey-server/services"
+)
+
+// exportScheduleReq: payload tạo (POST) và cập nhật một phần (PATCH) lịch xuất
+type exportScheduleReq struct {
+	Ten                *string                 `json:"ten"`
+	Spec               *string                 `json:"spec"`     // cron 5 trường, vd. "0 7 * * 1" = 7h sáng thứ Hai
+	Timezone           *string                 `json:"timezone"` // IANA, vd. "Asia/Ho_Chi_Minh"
+	Format             *string                 `json:"format"`
+	PresetID           *uint                   `json:"preset_id"` // 0 = bỏ preset
+	Options            *services.ExportOptions `json:"options"`   // ghi đè preset
+	Incremental        *bool                   `json:"incremental"`
+	ExcludeSpam        *bool                   `json:"exclude_spam"`
+	IncludeAttachments *bool                   `json:"include_attachments"`
+	DestType           *string                 `json:"dest_type"`   // local, sftp, s3, webhook
+	DestConfig         json.RawMessage         `json:"dest_config"` // theo dest_type; khoá bí mật bỏ trống = giữ nguyên
+	Active             *bool                   `json:"active"`
+}
+
+func exportScheduleDTO(s models.ExportSchedule) gin.H {
+	var opts services.ExportOptions
+	if s.OptionsJSON != "" {
+		json.Unmarshal([]byte(s.OptionsJSON), &opts)
+	}
+	return gin.H{
+		"id":                   s.ID,
+		"form_id":              s.KhaoSatID,
+		"ten":                  s.Ten,
+		"spec":                 s.Spec,
+		"timezone":             s.Timezone,
+		"format":               s.Format,
+		"preset_id":            s.PresetID,
+		"options":              opts,
+		"incremental":          s.Incremental,
+		"exclude_spam":         s.ExcludeSpam,
+		"include_attachments":  s.IncludeAttachments,
+		"dest_type":            s.DestType,
+		"dest_config":          services.RedactDestination(s.DestConfig),
+		"active":               s.Active,
+		"next_run_at":          s.NextRunAt,
+		"cursor_at":            s.CursorAt,
+		"last_run_at":          s.LastRunAt,
+		"last_status":          s.LastStatus,
+		"consecutive_failures": s.ConsecutiveFailures,
+		"created_at":           s.CreatedAt,
+		"updated_at":           s.UpdatedAt,
+	}
+}
+
+// applyExportSchedule kiểm tra payload và ghi vào s (đã trả lỗi nếu không hợp lệ)
+func applyExportSchedule(c *gin.Context, form models.KhaoSat, s *models.ExportSchedule, req exportScheduleReq) bool {
+	fail := func(msg string) bool {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": msg})
+		return false
+	}
+	if req.Ten != nil {
+		s.Ten = strings.TrimSpace(*req.Ten)
+	}
+	if s.Ten == "" || len(s.Ten) > 100 {
+		return fail("Tên lịch phải từ 1 đến 100 ký tự")
+	}
+	if req.Spec != nil {
+		s.Spec = strings.TrimSpace(*req.Spec)
+	}
+	if _, err := services.ParseCron(s.Spec); err != nil {
+		return fail("spec không hợp lệ: " + err.Error())
+	}
+	if req.Timezone != nil {
+		s.Timezone = strings.TrimSpace(*req.Timezone)
+	}
+	if s.Timezone != "" {
+		if _, err := time.LoadLocation(s.Timezone); err != nil {
+			return fail("timezone không hợp lệ: " + s.Timezone)
+		}
+	}
+	if req.Format != nil {
+		s.Format = *req.Format
+	}
+	if s.Format == "" {
+		s.Format = "csv"
+	}
+	format, ok := services.ExportFormatByName(s.Format)
+	if !ok {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"message":   "Định dạng xuất không được hỗ trợ",
+			"supported": services.ExportFormatNames(),
+		})
+		return false
+	}
+	s.Format = format.Name
+
+	if req.PresetID != nil {
+		s.PresetID = req.PresetID
+		if *req.PresetID == 0 {
+			s.PresetID = nil
+		}
+	}
+	if req.Options != nil {
+		b, _ := json.Marshal(req.Options)
+		s.OptionsJSON = string(b)
+	}
+	// kiểm tra tuỳ chọn thực tế của lần chạy: preset + tuỳ chọn riêng
+	var base, own services.ExportOptions
+	if s.PresetID != nil {
+		var p models.ExportPreset
+		if err := config.DB.Where("id = ? AND khao_sat_id = ?", *s.PresetID, form.ID).First(&p).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Preset không tồn tại"})
+			return false
+		}
+		json.Unmarshal([]byte(p.OptionsJSON), &base)
+	}
+	json.Unmarshal([]byte(s.OptionsJSON), &own)
+	merged := base.Merge(own)
+	if err := validateExportOptions(form.ID, &merged); err != nil {
+		exportOptionsError(c, err)
+		return false
+	}
+
+	if req.Incremental != nil {
+		s.Incremental = *req.Incremental
+	}
+	if req.ExcludeSpam != nil {
+		s.ExcludeSpam = *req.ExcludeSpam
+	}
+	if req.IncludeAttachments != nil {
+		s.IncludeAttachments = *req.IncludeAttachments
+	}
+
+	sameDest := true
+	if req.DestType != nil {
+		kind := strings.ToLower(strings.TrimSpace(*req.DestType))
+		if kind != s.DestType {
+			if req.DestConfig == nil {
+				return fail("Đổi dest_type phải gửi kèm dest_config")
+			}
+			sameDest = false
+		}
+		s.DestType = kind
+	}
+	if req.DestConfig != nil {
+		raw := req.DestConfig
+		if sameDest && s.DestConfig != "" {
+			raw = services.KeepDestinationSecrets(s.DestConfig, raw)
+		}
+		cfg, err := services.NormalizeDestination(c.Request.Context(), s.DestType, raw)
+		if err != nil {
+			return fail(err.Error())
+		}
+		s.DestConfig = cfg
+	}
+	if s.DestType == "" || s.DestConfig == "" {
+		return fail("Thiếu dest_type hoặc dest_config")
+	}
+
+	if req.Active != nil {
+		s.Active = *req.Active
+	}
+	s.NextRunAt = nil
+	if s.Active {
+		next, _ := nextScheduleRun(s.Spec, s.Timezone, time.Now())
+		s.NextRunAt = &next
+	}
+	return true
+}
+
+// findExportSchedule lấy lịch :schedule_id của form trong context (đã trả 404 nếu không có)
+func findExportSchedule(c *gin.Context, form models.KhaoSat) (models.ExportSchedule, bool) {
+	var s models.ExportSchedule
+	if err := config.DB.Where("id = ? AND khao_sat_id = ?", c.Param("schedule_id"), form.ID).First(&s).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Lịch xuất không tồn tại"})
+		return s, false
+	}
+	return s, true
+}
+
+// GET /api/forms/:id/export-schedules
+func ListExportSchedules(c *gin.Context) {
+	form := c.MustGet("formObj").(models.KhaoSat)
+	var list []models.ExportSchedule
+	if err := config.DB.Where("khao_sat_id = ?", form.ID).Order("id ASC").Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Lỗi DB"})
+		return
+	}
+	out := make([]gin.H, 0, len(list))
+	for _, s := range list {
+		out = append(out, exportScheduleDTO(s))
+	}
+	c.JSON(http.StatusOK, gin.H{"schedules": out, "dest_types": services.DestinationTypes})
+}
+
+// POST /api/forms/:id/export-schedules — secret của đích webhook chỉ trả về đúng 1 lần
+func CreateExportSchedule(c *gin.Context) {
+	u := c.MustGet(middleware.CtxUser).(models.NguoiDung)
+	form := c.MustGet("formObj").(models.KhaoSat)
+	var req exportScheduleReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Payload không hợp lệ"})
+		return
+	}
+	s := models.ExportSchedule{KhaoSatID: form.ID, NguoiDungID: u.ID, Active: true}
+	if req.DestType == nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "Thiếu dest_type hoặc dest_config"})
+		return
+	}
+	if !applyExportSchedule(c, form, &s, req) {
+		return
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&s).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "export_schedule.create", "form", form.ID, gin.H{
+			"schedule_id": s.ID, "ten": s.Ten, "spec": s.Spec, "dest_type": s.DestType,
+		})
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể lưu lịch xuất"})
+		return
+	}
+	dto := exportScheduleDTO(s)
+	if secret := scheduleWebhookSecret(s); secret != "" {
+		dto["webhook_secret"] = secret
+	}
+	c.JSON(http.StatusCreated, dto)
+}
+
+// scheduleWebhookSecret: secret ký của lịch có đích webhook (rỗng với đích khác)
+func scheduleWebhookSecret(s models.ExportSchedule) string {
+	if s.DestType != services.DestWebhook {
+		return ""
+	}
+	var cfg struct {
+		Secret string `json:"secret"`
+	}
+	if opened, err := services.OpenDestination(s.DestConfig); err == nil {
+		json.Unmarshal([]byte(opened), &cfg)
+	}
+	return cfg.Secret
+}
+
+// GET /api/forms/:id/export-schedules/:schedule_id
+func GetExportSchedule(c *gin.Context) {
+	form := c.MustGet("formObj").(models.KhaoSat)
+	s, ok := findExportSchedule(c, form)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, exportScheduleDTO(s))
+}
+
+// PATCH /api/forms/:id/export-schedules/:schedule_id — secret webhook mới sinh (đổi sang đích webhook,
+// đổi secret) trả về đúng 1 lần trong webhook_secret
+func UpdateExportSchedule(c *gin.Context) {
+	form := c.MustGet("formObj").(models.KhaoSat)
+	s, ok := findExportSchedule(c, form)
+	if !ok {
+		return
+	}
+	oldSecret := scheduleWebhookSecret(s)
+	var req exportScheduleReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Payload không hợp lệ"})
+		return
+	}
+	if !applyExportSchedule(c, form, &s, req) {
+		return
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&s).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "export_schedule.update", "form", form.ID, gin.H{
+			"schedule_id": s.ID, "ten": s.Ten, "spec": s.Spec, "dest_type": s.DestType, "active": s.Active,
+		})
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể cập nhật lịch xuất"})
+		return
+	}
+	dto := exportScheduleDTO(s)
+	if secret := scheduleWebhookSecret(s); secret != "" && secret != oldSecret {
+		dto["webhook_secret"] = secret
+	}
+	c.JSON(http.StatusOK, dto)
+}
+
+// DELETE /api/forms/:id/export-schedules/:schedule_id — xoá lịch và lịch sử chạy
+func DeleteExportSchedule(c *gin.Context) {
+	form := c.MustGet("formObj").(models.KhaoSat)
+	s, ok := findExportSchedule(c, form)
+	if !ok {
+		return
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("schedule_id = ?", s.ID).Delete(&models.ExportScheduleRun{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&s).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "export_schedule.delete", "form", form.ID, gin.H{"schedule_id": s.ID})
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể xoá lịch xuất"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Đã xoá lịch xuất"})
+}
+
+// GET /api/forms/:id/export-schedules/:schedule_id/runs — lịch sử chạy (mới nhất trước), lọc ?status=
+func ListExportScheduleRuns(c *gin.Context) {
+	form := c.MustGet("formObj").(models.KhaoSat)
+	s, ok := findExportSchedule(c, form)
+	if !ok {
+		return
+	}
+	page, limit, offset := adminPaging(c)
+	q := config.DB.Model(&models.ExportScheduleRun{}).Where("schedule_id = ?", s.ID)
+	if st := c.Query("status"); st != "" {
+		q = q.Where("status = ?", st)
+	}
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Lỗi DB"})
+		return
+	}
+	var runs []models.ExportScheduleRun
+	if err := q.Order("id DESC").Limit(limit).Offset(offset).Find(&runs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Lỗi DB"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"runs": runs, "page": page, "limit": limit, "total": total})
+}
+
+// POST /api/forms/:id/export-schedules/:schedule_id/run — chạy ngay (không đổi lịch kế tiếp)
+func RunExportScheduleNow(c *gin.Context) {
+	form := c.MustGet("formObj").(models.KhaoSat)
+	s, ok := findExportSchedule(c, form)
+	if !ok {
+		return
+	}
+	var run models.ExportScheduleRun
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// khoá lịch: không chạy trùng với tác vụ định kỳ hoặc lần bấm khác
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&s, s.ID).Error; err != nil {
+			return err
+		}
+		var err error
+		if run, err = startScheduleRun(tx, &s, "manual", time.Now()); err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "export_schedule.run", "form", form.ID, gin.H{"schedule_id": s.ID, "run_id": run.ID, "job_id": run.ExportJobID})
+	})
+	if errors.Is(err, errScheduleRunInFlight) {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể chạy lịch xuất"})
+		return
+	}
+	c.JSON(http.StatusAccepted, run)
+}
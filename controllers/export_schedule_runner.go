@@ -0,0 +1,371 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/vnkhanh/survey-server/config"
+	"github.com/vnkhanh/survey-server/models"
+	"github.com/vnkhanh/survey-server/services"
+)
+
+const jobKindExportDelivery = "export_delivery"
+
+type exportDeliveryPayload struct {
+	RunID uint `json:"run_id"`
+}
+
+var errScheduleRunInFlight = errors.New("lịch xuất đang có lần chạy chưa kết thúc")
+
+// scheduleLocation: múi giờ của biểu thức cron (rỗng/không hợp lệ = giờ server)
+func scheduleLocation(tz string) *time.Location {
+	if tz != "" {
+		if loc, err := time.LoadLocation(tz); err == nil {
+			return loc
+		}
+	}
+	return time.Local
+}
+
+// nextScheduleRun: lần chạy kế tiếp sau t theo cron của lịch, tính trong múi giờ của lịch
+func nextScheduleRun(spec, tz string, t time.Time) (time.Time, error) {
+	cs, err := services.ParseCron(spec)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cs.Next(t.In(scheduleLocation(tz))), nil
+}
+
+// runExportSchedules: tác vụ định kỳ, khởi chạy các lịch xuất đã đến hạn
+func runExportSchedules(ctx context.Context) error {
+	now := time.Now()
+	var ids []uint
+	if err := config.DB.WithContext(ctx).Model(&models.ExportSchedule{}).
+		Where("active = ? AND next_run_at <= ?", true, now).
+		Order("next_run_at").Limit(100).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	started := 0
+	for _, id := range ids {
+		err := config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			// replica khác đang giữ lịch này thì bỏ qua
+			var s models.ExportSchedule
+			res := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("id = ? AND active = ? AND next_run_at <= ?", id, true, now).Limit(1).Find(&s)
+			if res.Error != nil || res.RowsAffected == 0 {
+				return res.Error
+			}
+			next, err := nextScheduleRun(s.Spec, s.Timezone, now)
+			if err != nil {
+				return tx.Model(&s).Updates(map[string]interface{}{"active": false, "next_run_at": nil}).Error
+			}
+			if err := tx.Model(&s).Update("next_run_at", next).Error; err != nil {
+				return err
+			}
+			_, err = startScheduleRun(tx, &s, "schedule", now)
+			if errors.Is(err, errScheduleRunInFlight) {
+				log.Printf("[export-schedule] %d: previous run still in progress, skipped", s.ID)
+				return nil
+			}
+			if err == nil {
+				started++
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if started > 0 {
+		log.Printf("[scheduler] started %d scheduled exports", started)
+	}
+	return nil
+}
+
+// startScheduleRun tạo ExportJob + lần chạy cho lịch s trong tx (s đã được khoá hoặc do chủ form gọi).
+// Incremental: chỉ lấy phản hồi sau mốc của lần giao thành công gần nhất.
+func startScheduleRun(tx *gorm.DB, s *models.ExportSchedule, trigger string, now time.Time) (models.ExportScheduleRun, error) {
+	// lần chạy trước mà job xuất đã huỷ/hỏng thì coi như thất bại
+	if err := tx.Model(&models.ExportScheduleRun{}).
+		Where("schedule_id = ? AND status = ?", s.ID, models.ScheduleRunExporting).
+		Where("export_job_id IN (?)", tx.Model(&models.ExportJob{}).Select("job_id").
+			Where("status IN ?", []string{"failed", "cancelled", "expired"})).
+		Updates(map[string]interface{}{
+			"status": models.ScheduleRunFailed, "error": "job xuất không hoàn tất", "finished_at": now,
+		}).Error; err != nil {
+		return models.ExportScheduleRun{}, err
+	}
+	var busy int64
+	if err := tx.Model(&models.ExportScheduleRun{}).
+		Where("schedule_id = ? AND status IN ?", s.ID, []string{models.ScheduleRunExporting, models.ScheduleRunDelivering}).
+		Count(&busy).Error; err != nil {
+		return models.ExportScheduleRun{}, err
+	}
+	if busy > 0 {
+		return models.ExportScheduleRun{}, errScheduleRunInFlight
+	}
+
+	opts, err := scheduleExportOptions(tx, *s)
+	if err != nil {
+		return models.ExportScheduleRun{}, err
+	}
+	optsJSON, _ := json.Marshal(opts)
+
+	to := now.Truncate(time.Microsecond)
+	var from *time.Time
+	if s.Incremental && s.CursorAt != nil {
+		t := s.CursorAt.Add(time.Microsecond) // mốc trước đã nằm trong lần giao trước
+		from = &t
+	}
+
+	job := models.ExportJob{
+		JobID:              uuid.New().String(),
+		KhaoSatID:          s.KhaoSatID,
+		Format:             s.Format,
+		RangeFrom:          from,
+		RangeTo:            &to,
+		IncludeAttachments: s.IncludeAttachments,
+		ExcludeSpam:        s.ExcludeSpam,
+		OptionsJSON:        string(optsJSON),
+		Status:             "queued",
+	}
+	qj, err := services.EnqueueJob(tx, jobKindExport, exportJobPayload{JobID: job.JobID})
+	if err != nil {
+		return models.ExportScheduleRun{}, err
+	}
+	job.QueueJobID = &qj.ID
+	if err := tx.Create(&job).Error; err != nil {
+		return models.ExportScheduleRun{}, err
+	}
+	run := models.ExportScheduleRun{
+		ScheduleID:  s.ID,
+		ExportJobID: job.JobID,
+		Trigger:     trigger,
+		Status:      models.ScheduleRunExporting,
+		RangeFrom:   from,
+		RangeTo:     &to,
+		StartedAt:   now,
+	}
+	if err := tx.Create(&run).Error; err != nil {
+		return run, err
+	}
+	return run, tx.Model(s).Updates(map[string]interface{}{"last_run_at": now, "last_status": run.Status}).Error
+}
+
+// scheduleExportOptions: tuỳ chọn của preset (nếu còn) ghi đè bởi tuỳ chọn riêng của lịch
+func scheduleExportOptions(tx *gorm.DB, s models.ExportSchedule) (services.ExportOptions, error) {
+	var opts, own services.ExportOptions
+	if s.PresetID != nil {
+		var p models.ExportPreset
+		if err := tx.Where("id = ? AND khao_sat_id = ?", *s.PresetID, s.KhaoSatID).Limit(1).Find(&p).Error; err != nil {
+			return opts, err
+		}
+		json.Unmarshal([]byte(p.OptionsJSON), &opts)
+	}
+	if s.OptionsJSON != "" {
+		json.Unmarshal([]byte(s.OptionsJSON), &own)
+	}
+	opts = opts.Merge(own)
+	return opts, opts.Normalize()
+}
+
+// queueScheduleDelivery: job xuất của một lần chạy lịch đã xong → chuyển sang giao file (trong tx của finishExportJob)
+func queueScheduleDelivery(tx *gorm.DB, job *models.ExportJob, rows int) error {
+	var run models.ExportScheduleRun
+	res := tx.Where("export_job_id = ? AND status = ?", job.JobID, models.ScheduleRunExporting).Limit(1).Find(&run)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return res.Error
+	}
+	if err := tx.Model(&run).Updates(map[string]interface{}{
+		"status": models.ScheduleRunDelivering, "rows": rows,
+	}).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.ExportSchedule{}).Where("id = ?", run.ScheduleID).
+		Update("last_status", models.ScheduleRunDelivering).Error; err != nil {
+		return err
+	}
+	_, err := services.EnqueueJob(tx, jobKindExportDelivery, exportDeliveryPayload{RunID: run.ID})
+	return err
+}
+
+// runExportDelivery: handler của hàng đợi, giao file xuất của lần chạy tới đích của lịch
+func runExportDelivery(ctx context.Context, qj models.Job) error {
+	var p exportDeliveryPayload
+	if err := json.Unmarshal([]byte(qj.Payload), &p); err != nil {
+		return services.PermanentJobError(err)
+	}
+	var run models.ExportScheduleRun
+	if err := config.DB.First(&run, p.RunID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return services.PermanentJobError(err)
+		}
+		return err
+	}
+	if run.Status != models.ScheduleRunDelivering {
+		return nil
+	}
+
+	loc, err := deliverScheduleRun(ctx, run)
+	if err != nil {
+		em := err.Error()
+		if services.IsFinalAttempt(qj, err) {
+			failScheduleRun(run.ID, em)
+		} else {
+			config.DB.Model(&run).Update("error", em)
+		}
+		return err
+	}
+
+	now := time.Now()
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&run).Updates(map[string]interface{}{
+			"status": models.ScheduleRunSuccess, "location": loc, "error": nil, "finished_at": now,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.ExportSchedule{}).Where("id = ?", run.ScheduleID).Updates(map[string]interface{}{
+			"last_status": models.ScheduleRunSuccess, "consecutive_failures": 0,
+		}).Error; err != nil {
+			return err
+		}
+		// mốc incremental chỉ tiến lên (lần chạy tay có thể kết thúc sau lần chạy mới hơn)
+		return tx.Model(&models.ExportSchedule{}).
+			Where("id = ? AND (cursor_at IS NULL OR cursor_at < ?)", run.ScheduleID, run.RangeTo).
+			Update("cursor_at", run.RangeTo).Error
+	})
+}
+
+// deliverScheduleRun tải file xuất về thư mục tạm rồi giao tới đích của lịch
+func deliverScheduleRun(ctx context.Context, run models.ExportScheduleRun) (string, error) {
+	var s models.ExportSchedule
+	if err := config.DB.First(&s, run.ScheduleID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", services.PermanentJobError(err)
+		}
+		return "", err
+	}
+	var job models.ExportJob
+	if err := config.DB.First(&job, "job_id = ?", run.ExportJobID).Error; err != nil {
+		return "", err
+	}
+	if job.Status != "done" || job.FilePath == nil {
+		return "", services.PermanentJobError(fmt.Errorf("file xuất không còn (trạng thái %s)", job.Status))
+	}
+	dest, err := services.NewDestination(s.DestType, s.DestConfig)
+	if err != nil {
+		return "", services.PermanentJobError(err)
+	}
+
+	st, err := services.ExportStorage()
+	if err != nil {
+		return "", err
+	}
+	key := services.ExportFileKey(*job.FilePath)
+	rc, err := st.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp("", "export-delivery-*")
+	if err != nil {
+		rc.Close()
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, rc)
+	rc.Close()
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	ext := strings.TrimPrefix(path.Ext(key), ".")
+	contentType := "application/zip"
+	if f, ok := services.ExportFormatByName(job.Format); ok && ext != "zip" {
+		contentType = f.ContentType
+	}
+	return dest.Deliver(ctx, services.DeliveryFile{
+		Path:        tmp.Name(),
+		Name:        services.DeliveryFileName(s.ID, run.StartedAt, ext),
+		ContentType: contentType,
+		ScheduleID:  s.ID,
+		JobID:       job.JobID,
+		OwnerID:     s.NguoiDungID,
+	})
+}
+
+// failScheduleRunForJob: job xuất của một lần chạy lịch thất bại hẳn
+func failScheduleRunForJob(jobID, msg string) {
+	var run models.ExportScheduleRun
+	if res := config.DB.Where("export_job_id = ?", jobID).Limit(1).Find(&run); res.Error != nil || res.RowsAffected == 0 {
+		return
+	}
+	failScheduleRun(run.ID, msg)
+}
+
+// failScheduleRun đánh dấu lần chạy thất bại, tăng số lần lỗi liên tiếp và phát cảnh báo
+// export.schedule_failed (giao qua webhook) cùng nhật ký hệ thống
+func failScheduleRun(runID uint, msg string) {
+	now := time.Now()
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var run models.ExportScheduleRun
+		res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND status IN ?", runID, []string{models.ScheduleRunExporting, models.ScheduleRunDelivering}).
+			Limit(1).Find(&run)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		if err := tx.Model(&run).Updates(map[string]interface{}{
+			"status": models.ScheduleRunFailed, "error": msg, "finished_at": now,
+		}).Error; err != nil {
+			return err
+		}
+		var s models.ExportSchedule
+		if err := tx.First(&s, run.ScheduleID).Error; err != nil {
+			return err
+		}
+		s.ConsecutiveFailures++
+		if err := tx.Model(&s).Updates(map[string]interface{}{
+			"last_status":          models.ScheduleRunFailed,
+			"consecutive_failures": s.ConsecutiveFailures,
+		}).Error; err != nil {
+			return err
+		}
+		data := map[string]interface{}{
+			"schedule_id":          s.ID,
+			"ten":                  s.Ten,
+			"run_id":               run.ID,
+			"job_id":               run.ExportJobID,
+			"dest_type":            s.DestType,
+			"error":                msg,
+			"consecutive_failures": s.ConsecutiveFailures,
+		}
+		if err := services.PublishEvent(tx, services.EventExportScheduleFailed, s.KhaoSatID, data); err != nil {
+			return err
+		}
+		return services.RecordAudit(tx, services.AuditEntry{
+			ActorType:  models.ActorSystem,
+			Action:     "export_schedule.run_failed",
+			TargetType: "form",
+			TargetID:   s.KhaoSatID,
+			Metadata:   data,
+		})
+	})
+	if err != nil {
+		log.Printf("[export-schedule] mark run %d failed: %v", runID, err)
+	}
+}
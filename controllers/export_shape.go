@@ -0,0 +1,313 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vnkhanh/survey-server/config"
+	"github.com/vnkhanh/survey-server/models"
+	"github.com/vnkhanh/survey-server/services"
+)
+
+// exportShape dựng cột và dòng của file xuất theo ExportOptions của job
+type exportShape struct {
+	job       *models.ExportJob
+	opts      services.ExportOptions
+	loc       *time.Location
+	layout    string // layout Go của cột thời gian
+	questions []models.CauHoi
+}
+
+// newExportShape đọc tuỳ chọn của job và lọc câu hỏi được chọn (giữ thứ tự của form)
+func newExportShape(job *models.ExportJob, questions []models.CauHoi) (*exportShape, error) {
+	var opts services.ExportOptions
+	if job.OptionsJSON != "" {
+		if err := json.Unmarshal([]byte(job.OptionsJSON), &opts); err != nil {
+			return nil, err
+		}
+	}
+	if err := opts.Normalize(); err != nil {
+		return nil, err
+	}
+	if len(opts.QuestionIDs) > 0 {
+		want := make(map[uint]bool, len(opts.QuestionIDs))
+		for _, id := range opts.QuestionIDs {
+			want[id] = true
+		}
+		picked := make([]models.CauHoi, 0, len(opts.QuestionIDs))
+		for _, q := range questions {
+			if want[q.ID] {
+				picked = append(picked, q)
+			}
+		}
+		questions = picked
+	}
+	return &exportShape{job: job, opts: opts, loc: opts.Location(), layout: opts.DateLayout(), questions: questions}, nil
+}
+
+func (s *exportShape) wide() bool { return s.opts.Layout == services.ExportLayoutWide }
+
+// metaColumns: cột metadata theo thứ tự cố định
+func (s *exportShape) metaColumns(skipID bool) []services.ExportColumn {
+	var cols []services.ExportColumn
+	if s.opts.HasMeta(services.ExportMetaSubmissionID) && !skipID {
+		cols = append(cols, services.ExportColumn{Key: "submission_id", Label: "Mã phản hồi", Type: services.ExportNumber})
+	}
+	if s.opts.HasMeta(services.ExportMetaUser) {
+		cols = append(cols, services.ExportColumn{Key: "user_id", Label: "Người dùng", Type: services.ExportNumber})
+	}
+	if s.opts.HasMeta(services.ExportMetaEmail) {
+		cols = append(cols, services.ExportColumn{Key: "email", Label: "Email"})
+	}
+	if s.opts.HasMeta(services.ExportMetaLanGui) {
+		cols = append(cols, services.ExportColumn{Key: "lan_gui", Label: "Lần gửi", Type: services.ExportNumber})
+	}
+	return cols
+}
+
+func (s *exportShape) metaValues(r models.PhanHoi, skipID bool) []interface{} {
+	var vals []interface{}
+	if s.opts.HasMeta(services.ExportMetaSubmissionID) && !skipID {
+		vals = append(vals, float64(r.ID))
+	}
+	if s.opts.HasMeta(services.ExportMetaUser) {
+		if r.NguoiDungID != nil {
+			vals = append(vals, float64(*r.NguoiDungID))
+		} else {
+			vals = append(vals, nil)
+		}
+	}
+	if s.opts.HasMeta(services.ExportMetaEmail) {
+		if r.Email != nil {
+			vals = append(vals, *r.Email)
+		} else {
+			vals = append(vals, nil)
+		}
+	}
+	if s.opts.HasMeta(services.ExportMetaLanGui) {
+		vals = append(vals, float64(r.LanGui))
+	}
+	return vals
+}
+
+func (s *exportShape) splitMulti(q models.CauHoi) bool {
+	return s.opts.SplitMultiColumns() && strings.ToUpper(q.LoaiCauHoi) == "MULTIPLE_CHOICE" && len(q.LuaChons) > 0
+}
+
+// Columns: wide = dấu thời gian, metadata, mỗi câu hỏi một cột (hoặc mỗi lựa chọn một cột 0/1);
+// long = mã phản hồi, dấu thời gian, metadata, câu hỏi, giá trị
+func (s *exportShape) Columns() []services.ExportColumn {
+	ts := services.ExportColumn{Key: "submitted_at", Label: "Dấu thời gian", Type: services.ExportTime, DateLayout: s.layout}
+	if !s.wide() {
+		cols := []services.ExportColumn{{Key: "submission_id", Label: "Mã phản hồi", Type: services.ExportNumber}, ts}
+		cols = append(cols, s.metaColumns(true)...)
+		return append(cols,
+			services.ExportColumn{Key: "question_id", Label: "Mã câu hỏi", Type: services.ExportNumber},
+			services.ExportColumn{Key: "question", Label: "Câu hỏi"},
+			services.ExportColumn{Key: "value", Label: "Giá trị"},
+		)
+	}
+
+	cols := append([]services.ExportColumn{ts}, s.metaColumns(false)...)
+	for _, q := range s.questions {
+		label := q.NoiDung
+		if label == "" {
+			label = "Câu hỏi không có tiêu đề"
+		}
+		if s.splitMulti(q) {
+			for _, o := range q.LuaChons {
+				cols = append(cols, services.ExportColumn{
+					Key:   fmt.Sprintf("q%d_o%d", q.ID, o.ID),
+					Label: label + ": " + o.NoiDung,
+					Type:  services.ExportNumber,
+				})
+			}
+			continue
+		}
+		col := services.ExportColumn{Key: fmt.Sprintf("q%d", q.ID), Label: label}
+		switch strings.ToUpper(q.LoaiCauHoi) {
+		case "RATING":
+			col.Type = services.ExportNumber
+		case "MULTIPLE_CHOICE":
+			col.Multi = true
+			fallthrough
+		case "SINGLE_CHOICE", "TRUE_FALSE":
+			for _, o := range q.LuaChons {
+				if s.opts.Values == services.ExportValuesIDs {
+					col.Options = append(col.Options, strconv.FormatUint(uint64(o.ID), 10))
+					col.OptionLabels = append(col.OptionLabels, o.NoiDung)
+				} else {
+					col.Options = append(col.Options, o.NoiDung)
+				}
+			}
+		}
+		cols = append(cols, col)
+	}
+	return cols
+}
+
+// Rows: các dòng của một phản hồi (wide: đúng 1 dòng; long: mỗi câu trả lời 1 dòng)
+func (s *exportShape) Rows(r models.PhanHoi) [][]interface{} {
+	answerMap := make(map[uint]models.CauTraLoi)
+	for _, a := range r.CauTraLois {
+		answerMap[a.CauHoiID] = a
+	}
+	submitted := r.NgayGui.In(s.loc)
+
+	if !s.wide() {
+		var rows [][]interface{}
+		for _, q := range s.questions {
+			ans, ok := answerMap[q.ID]
+			if !ok {
+				continue
+			}
+			row := []interface{}{float64(r.ID), submitted}
+			row = append(row, s.metaValues(r, true)...)
+			row = append(row, float64(q.ID), q.NoiDung,
+				services.ExportCellText(s.answerValue(q, ans, r), services.ExportColumn{DateLayout: s.layout}))
+			rows = append(rows, row)
+		}
+		return rows
+	}
+
+	row := append([]interface{}{submitted}, s.metaValues(r, false)...)
+	for _, q := range s.questions {
+		ans, ok := answerMap[q.ID]
+		if s.splitMulti(q) {
+			var picked map[string]bool
+			if ok {
+				picked = map[string]bool{}
+				for _, v := range answerLabels(ans) {
+					picked[v] = true
+				}
+			}
+			for _, o := range q.LuaChons {
+				switch {
+				case !ok:
+					row = append(row, nil)
+				case picked[o.NoiDung]:
+					row = append(row, 1.0)
+				default:
+					row = append(row, 0.0)
+				}
+			}
+			continue
+		}
+		if !ok {
+			row = append(row, nil)
+			continue
+		}
+		row = append(row, s.answerValue(q, ans, r))
+	}
+	return [][]interface{}{row}
+}
+
+// answerValue: giá trị ô của một câu trả lời (string, float64 hoặc []string)
+func (s *exportShape) answerValue(q models.CauHoi, ans models.CauTraLoi, r models.PhanHoi) interface{} {
+	switch strings.ToUpper(q.LoaiCauHoi) {
+	case "FILL_BLANK":
+		return ans.NoiDung
+
+	case "RATING":
+		if n, err := strconv.ParseFloat(strings.TrimSpace(ans.NoiDung), 64); err == nil {
+			return n
+		}
+		return ans.NoiDung
+
+	case "UPLOAD_FILE", "FILE_UPLOAD":
+		if ans.NoiDung == "" {
+			return ""
+		}
+		if s.job.IncludeAttachments {
+			if services.IsExternalRef(ans.NoiDung) {
+				// URL ngoài không được tải vào ZIP
+				return ans.NoiDung
+			}
+			// đường dẫn của file trong ZIP
+			return services.AttachmentPath(r.ID, q.ID, ans.NoiDung)
+		}
+		return "[đã đính kèm]"
+
+	case "MULTIPLE_CHOICE":
+		return s.optionValues(q, answerLabels(ans))
+
+	case "SINGLE_CHOICE", "TRUE_FALSE":
+		labels := answerLabels(ans)
+		if len(labels) == 0 && strings.TrimSpace(ans.NoiDung) != "" {
+			// SubmitSurvey lưu SINGLE_CHOICE ở NoiDung (chuỗi nhãn), không phải LuaChon
+			labels = []string{strings.TrimSpace(ans.NoiDung)}
+		}
+		if len(labels) == 0 {
+			return ""
+		}
+		return strings.Join(s.optionValues(q, labels), ", ")
+	}
+	return ans.NoiDung
+}
+
+// optionValues: nhãn lựa chọn → id khi values = ids (nhãn không khớp lựa chọn nào giữ nguyên)
+func (s *exportShape) optionValues(q models.CauHoi, labels []string) []string {
+	if s.opts.Values != services.ExportValuesIDs {
+		return labels
+	}
+	out := make([]string, len(labels))
+	for i, l := range labels {
+		out[i] = l
+		for _, o := range q.LuaChons {
+			if o.NoiDung == l {
+				out[i] = strconv.FormatUint(uint64(o.ID), 10)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// answerLabels: các lựa chọn đã chọn (CauTraLoi.LuaChon là JSON array, dữ liệu cũ có thể là chuỗi thường)
+func answerLabels(ans models.CauTraLoi) []string {
+	opts := []string{}
+	if ans.LuaChon != "" {
+		if err := json.Unmarshal([]byte(ans.LuaChon), &opts); err != nil {
+			opts = []string{ans.LuaChon}
+		}
+	}
+	return opts
+}
+
+// exportOptionsError trả lỗi của tuỳ chọn xuất: date_format sai → 400, còn lại 422
+func exportOptionsError(c *gin.Context, err error) {
+	status := http.StatusUnprocessableEntity
+	if errors.Is(err, services.ErrInvalidDateFormat) {
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, gin.H{"message": err.Error()})
+}
+
+// validateExportOptions chuẩn hoá tuỳ chọn và kiểm tra câu hỏi được chọn thuộc form
+func validateExportOptions(formID uint, opts *services.ExportOptions) error {
+	if err := opts.Normalize(); err != nil {
+		return err
+	}
+	if len(opts.QuestionIDs) == 0 {
+		return nil
+	}
+	var n int64
+	if err := config.DB.Model(&models.CauHoi{}).
+		Where("khao_sat_id = ? AND id IN ?", formID, opts.QuestionIDs).Count(&n).Error; err != nil {
+		return err
+	}
+	seen := map[uint]bool{}
+	for _, id := range opts.QuestionIDs {
+		seen[id] = true
+	}
+	if int(n) != len(seen) {
+		return fmt.Errorf("question_ids có câu hỏi không thuộc form")
+	}
+	return nil
+}
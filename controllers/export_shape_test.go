@@ -0,0 +1,234 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vnkhanh/survey-server/models"
+	"github.com/vnkhanh/survey-server/services"
+)
+
+// shapeFixture: form có một câu chọn một, một câu đúng/sai và một câu chọn nhiều
+func shapeFixture() []models.CauHoi {
+	return []models.CauHoi{
+		{ID: 1, NoiDung: "Màu yêu thích", LoaiCauHoi: "single_choice", LuaChons: []models.LuaChon{
+			{ID: 11, CauHoiID: 1, NoiDung: "Đỏ"}, {ID: 12, CauHoiID: 1, NoiDung: "Xanh"},
+		}},
+		{ID: 2, NoiDung: "Đồng ý", LoaiCauHoi: "TRUE_FALSE", LuaChons: []models.LuaChon{
+			{ID: 21, CauHoiID: 2, NoiDung: "Đúng"}, {ID: 22, CauHoiID: 2, NoiDung: "Sai"},
+		}},
+		{ID: 3, NoiDung: "Sở thích", LoaiCauHoi: "MULTIPLE_CHOICE", LuaChons: []models.LuaChon{
+			{ID: 31, CauHoiID: 3, NoiDung: "Đọc"}, {ID: 32, CauHoiID: 3, NoiDung: "Chạy"},
+		}},
+	}
+}
+
+// submitFixture: phản hồi dựng như SubmitSurvey (newAnswerRow cho từng câu trả lời)
+func submitFixture(questions []models.CauHoi) models.PhanHoi {
+	reqs := []AnswerReq{
+		{CauHoiID: 1, LoaiCauHoi: "SINGLE_CHOICE", NoiDung: "Xanh"},
+		{CauHoiID: 2, LoaiCauHoi: "TRUE_FALSE", LuaChon: `["Đúng"]`},
+		{CauHoiID: 3, LoaiCauHoi: "MULTIPLE_CHOICE", LuaChon: `["Đọc","Chạy"]`},
+	}
+	r := models.PhanHoi{ID: 7, NgayGui: time.Date(2026, 3, 1, 8, 30, 0, 0, time.UTC)}
+	for i, a := range reqs {
+		r.CauTraLois = append(r.CauTraLois, newAnswerRow(r.ID, questions[i], a))
+	}
+	return r
+}
+
+func newTestShape(t *testing.T, opts services.ExportOptions) *exportShape {
+	t.Helper()
+	b, _ := json.Marshal(opts)
+	s, err := newExportShape(&models.ExportJob{OptionsJSON: string(b)}, shapeFixture())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestAnswerValueSingleChoiceFromSubmit(t *testing.T) {
+	questions := shapeFixture()
+	r := submitFixture(questions)
+	if r.CauTraLois[0].NoiDung != "Xanh" || r.CauTraLois[0].LuaChon != "" {
+		t.Fatalf("SubmitSurvey lưu SINGLE_CHOICE khác giả định: %+v", r.CauTraLois[0])
+	}
+
+	cases := []struct {
+		values string
+		want   []interface{}
+	}{
+		{services.ExportValuesLabels, []interface{}{"Xanh", "Đúng", []string{"Đọc", "Chạy"}}},
+		{services.ExportValuesIDs, []interface{}{"12", "21", []string{"31", "32"}}},
+	}
+	for _, tc := range cases {
+		s := newTestShape(t, services.ExportOptions{Values: tc.values})
+		for i, q := range questions {
+			got := s.answerValue(q, r.CauTraLois[i], r)
+			gb, _ := json.Marshal(got)
+			wb, _ := json.Marshal(tc.want[i])
+			if string(gb) != string(wb) {
+				t.Errorf("values=%s câu %d: answerValue = %s, muốn %s", tc.values, q.ID, gb, wb)
+			}
+		}
+
+		// dòng wide: cột 0 là dấu thời gian, sau đó theo thứ tự câu hỏi
+		row := s.Rows(r)[0]
+		if row[1] != tc.want[0] {
+			t.Errorf("values=%s: ô câu chọn một trong dòng = %v", tc.values, row[1])
+		}
+	}
+}
+
+// savFile: phần đọc lại của file .sav (không nén, little-endian) đủ để kiểm tra biến, nhãn giá trị và dữ liệu
+type savFile struct {
+	labels []string                   // nhãn biến, theo thứ tự biến
+	width  []int                      // 0 = số, >0 = chuỗi
+	values map[int]map[float64]string // chỉ số biến → mã → nhãn giá trị
+	cases  [][]interface{}            // float64 hoặc string
+}
+
+func readSav(t *testing.T, data []byte) savFile {
+	t.Helper()
+	r := bytes.NewReader(data)
+	i32 := func() int32 {
+		var n int32
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			t.Fatalf("sav: %v", err)
+		}
+		return n
+	}
+	f64 := func() float64 {
+		var b [8]byte
+		io.ReadFull(r, b[:])
+		return math.Float64frombits(binary.LittleEndian.Uint64(b[:]))
+	}
+	skip := func(n int) { r.Seek(int64(n), io.SeekCurrent) }
+
+	if string(data[:4]) != "$FL2" {
+		t.Fatalf("sav: sai chữ ký %q", data[:4])
+	}
+	skip(176)
+
+	f := savFile{values: map[int]map[float64]string{}}
+	segVar := []int{} // ô 8 byte → chỉ số biến (-1 = ô nối tiếp)
+	var pending []map[float64]string
+	for done := false; !done; {
+		switch rec := i32(); rec {
+		case 2:
+			typ, hasLabel, nMissing := i32(), i32(), i32()
+			skip(8 + 8) // print/write format + tên
+			label := ""
+			if hasLabel == 1 {
+				n := int(i32())
+				b := make([]byte, (n+3)/4*4)
+				io.ReadFull(r, b)
+				label = string(b[:n])
+			}
+			skip(int(math.Abs(float64(nMissing))) * 8)
+			if typ == -1 {
+				segVar = append(segVar, -1)
+				continue
+			}
+			segVar = append(segVar, len(f.labels))
+			f.labels = append(f.labels, label)
+			f.width = append(f.width, int(typ))
+		case 3:
+			m := map[float64]string{}
+			for n := i32(); n > 0; n-- {
+				v := f64()
+				l, _ := r.ReadByte()
+				b := make([]byte, (int(l)+1+7)/8*8-1)
+				io.ReadFull(r, b)
+				m[v] = string(b[:l])
+			}
+			pending = append(pending, m)
+		case 4:
+			m := pending[len(pending)-1]
+			for n := i32(); n > 0; n-- {
+				f.values[segVar[i32()-1]] = m
+			}
+		case 7:
+			i32()
+			size, count := i32(), i32()
+			skip(int(size * count))
+		case 999:
+			i32()
+			done = true
+		default:
+			t.Fatalf("sav: bản ghi lạ %d", rec)
+		}
+	}
+
+	for r.Len() > 0 {
+		row := make([]interface{}, len(f.labels))
+		for seg := 0; seg < len(segVar); seg++ {
+			v := segVar[seg]
+			if f.width[v] == 0 {
+				row[v] = f64()
+				continue
+			}
+			n := (f.width[v] + 7) / 8
+			b := make([]byte, n*8)
+			io.ReadFull(r, b)
+			row[v] = strings.TrimRight(string(b), " ")
+			seg += n - 1
+		}
+		f.cases = append(f.cases, row)
+	}
+	return f
+}
+
+func TestSavSingleChoiceFromSubmit(t *testing.T) {
+	questions := shapeFixture()
+	r := submitFixture(questions)
+	format, _ := services.ExportFormatByName("sav")
+
+	for _, values := range []string{services.ExportValuesLabels, services.ExportValuesIDs} {
+		s := newTestShape(t, services.ExportOptions{Values: values})
+		var buf bytes.Buffer
+		e := format.New()
+		if err := e.Begin(&buf, s.Columns()); err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range s.Rows(r) {
+			if err := e.WriteRow(row); err != nil {
+				t.Fatal(err)
+			}
+		}
+		e.Close()
+
+		sav := readSav(t, buf.Bytes())
+		if len(sav.cases) != 1 {
+			t.Fatalf("values=%s: %d case, muốn 1", values, len(sav.cases))
+		}
+		for _, want := range []struct{ label, option string }{
+			{"Màu yêu thích", "Xanh"},
+			{"Đồng ý", "Đúng"},
+		} {
+			idx := -1
+			for i, l := range sav.labels {
+				if l == want.label {
+					idx = i
+				}
+			}
+			if idx < 0 {
+				t.Fatalf("values=%s: không có biến %q trong %v", values, want.label, sav.labels)
+			}
+			code, _ := sav.cases[0][idx].(float64)
+			if code == -math.MaxFloat64 {
+				t.Errorf("values=%s %q: giá trị là sysmis", values, want.label)
+				continue
+			}
+			if got := sav.values[idx][code]; got != want.option {
+				t.Errorf("values=%s %q: mã %v có nhãn %q, muốn %q (nhãn: %v)", values, want.label, code, got, want.option, sav.values[idx])
+			}
+		}
+	}
+}
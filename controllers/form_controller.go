@@ -15,8 +15,10 @@ import (
 	"github.com/vnkhanh/survey-server/config"
 	"github.com/vnkhanh/survey-server/middleware"
 	"github.com/vnkhanh/survey-server/models"
+	"github.com/vnkhanh/survey-server/services"
 	"github.com/vnkhanh/survey-server/utils"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 /* ========== BE-01: Tạo biểu mẫu khảo sát ========== */
@@ -88,7 +90,15 @@ func CreateForm(c *gin.Context) {
 		}
 	}
 
-	if err := config.DB.Create(&form).Error; err != nil {
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&form).Error; err != nil {
+			return err
+		}
+		if err := services.PublishEvent(tx, services.EventFormPublished, form.ID, formEventData(form.ID, form.TieuDe, form.TrangThai)); err != nil {
+			return err
+		}
+		return auditForm(c, tx, "form.create", form.ID, nil)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể tạo form"})
 		return
 	}
@@ -226,9 +236,16 @@ func UpdateForm(c *gin.Context) {
 		return
 	}
 
-	if err := config.DB.Model(&models.KhaoSat{}).
-		Where("id = ?", f.ID).
-		Updates(updates).Error; err != nil {
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		before, err := lockForm(tx, f.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&models.KhaoSat{}).Where("id = ?", f.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		return auditForm(c, tx, "form.update", f.ID, before)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Cập nhật thất bại"})
 		return
 	}
@@ -239,9 +256,9 @@ func UpdateForm(c *gin.Context) {
 
 func DeleteForm(c *gin.Context) {
 	f := c.MustGet("formObj").(models.KhaoSat)
-	if err := config.DB.Model(&models.KhaoSat{}).
-		Where("id = ?", f.ID).
-		Update("trang_thai", "deleted").Error; err != nil {
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return setFormStatusAudited(c, tx, f, "form.delete", map[string]interface{}{"trang_thai": "deleted"}, services.EventFormClosed)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Xoá (mềm) thất bại"})
 		return
 	}
@@ -250,9 +267,9 @@ func DeleteForm(c *gin.Context) {
 
 func ArchiveForm(c *gin.Context) {
 	f := c.MustGet("formObj").(models.KhaoSat)
-	if err := config.DB.Model(&models.KhaoSat{}).
-		Where("id = ?", f.ID).
-		Update("trang_thai", "archived").Error; err != nil {
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return setFormStatusAudited(c, tx, f, "form.archive", map[string]interface{}{"trang_thai": "archived"}, services.EventFormClosed)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Archive thất bại"})
 		return
 	}
@@ -261,9 +278,13 @@ func ArchiveForm(c *gin.Context) {
 
 func RestoreForm(c *gin.Context) {
 	f := c.MustGet("formObj").(models.KhaoSat)
-	if err := config.DB.Model(&models.KhaoSat{}).
-		Where("id = ?", f.ID).
-		Update("trang_thai", "active").Error; err != nil {
+	if f.ForceArchivedAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Form đã bị quản trị viên lưu trữ, không thể tự khôi phục"})
+		return
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return setFormStatusAudited(c, tx, f, "form.restore", map[string]interface{}{"trang_thai": "active"}, services.EventFormPublished)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Restore thất bại"})
 		return
 	}
@@ -299,6 +320,16 @@ func ReorderQuestions(c *gin.Context) {
 	}
 
 	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockForm(tx, f.ID); err != nil {
+			return err
+		}
+		var beforeOrder []uint
+		if err := tx.Model(&models.CauHoi{}).
+			Where("khao_sat_id = ?", f.ID).
+			Order("thu_tu ASC, id ASC").
+			Pluck("id", &beforeOrder).Error; err != nil {
+			return err
+		}
 		for idx, qID := range req.Order {
 			if err := tx.Model(&models.CauHoi{}).
 				Where("id = ? AND khao_sat_id = ?", qID, f.ID).
@@ -306,7 +337,7 @@ func ReorderQuestions(c *gin.Context) {
 				return err
 			}
 		}
-		return nil
+		return recordChange(c, tx, "form.questions.reorder", "form", f.ID, gin.H{"order": beforeOrder}, gin.H{"order": req.Order})
 	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Cập nhật thứ tự thất bại"})
@@ -366,9 +397,16 @@ func UpdateFormSettings(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể lưu settings"})
 		return
 	}
-	if err := config.DB.Model(&models.KhaoSat{}).
-		Where("id = ?", f.ID).
-		Update("settings_json", norm).Error; err != nil {
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		before, err := lockForm(tx, f.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&models.KhaoSat{}).Where("id = ?", f.ID).Update("settings_json", norm).Error; err != nil {
+			return err
+		}
+		return auditForm(c, tx, "form.settings.update", f.ID, before)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Lưu settings thất bại"})
 		return
 	}
@@ -423,9 +461,16 @@ func UpdateFormTheme(c *gin.Context) {
 		return
 	}
 
-	if err := config.DB.Model(&models.KhaoSat{}).
-		Where("id = ?", f.ID).
-		Update("theme_json", string(req.Theme)).Error; err != nil {
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		before, err := lockForm(tx, f.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&models.KhaoSat{}).Where("id = ?", f.ID).Update("theme_json", string(req.Theme)).Error; err != nil {
+			return err
+		}
+		return auditForm(c, tx, "form.theme.update", f.ID, before)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Lưu theme thất bại"})
 		return
 	}
@@ -468,6 +513,7 @@ func ShareForm(c *gin.Context) {
 		return
 	}
 
+	before := form
 	token := uuid.NewString()
 	// lấy base URL từ biến môi trường, fallback localhost nếu chưa có
 	baseURL := os.Getenv("API_BASE_URL")
@@ -481,7 +527,12 @@ func ShareForm(c *gin.Context) {
 	form.PublicLink = &publicLink
 	form.EmbedCode = &embedCode
 
-	if err := config.DB.Save(&form).Error; err != nil {
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&form).Error; err != nil {
+			return err
+		}
+		return auditForm(c, tx, "form.share", form.ID, &before)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không tạo được share link"})
 		return
 	}
@@ -506,6 +557,10 @@ func GetPublicForm(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"message": "Form không tồn tại"})
 		return
 	}
+	if form.TrangThai == "archived" || form.TrangThai == "deleted" || form.TrangThai == "closed" {
+		c.JSON(http.StatusGone, gin.H{"message": "Form không còn nhận phản hồi"})
+		return
+	}
 
 	if form.GioiHanTL != nil && form.SoLanTraLoi >= *form.GioiHanTL {
 		c.JSON(http.StatusForbidden, gin.H{"message": "Đã đạt giới hạn số lần trả lời"})
@@ -541,6 +596,16 @@ func GetPublicForm(c *gin.Context) {
 		})
 	}
 
+	// Cấp cookie định danh trình duyệt ngay khi mở form (dùng cho chống gửi trùng)
+	respondentID(c)
+
+	// Challenge chống bot: client giải proof-of-work và gửi lại token khi nộp phản hồi
+	challenge, err := services.IssueFormChallenge(form.ID, formAntiSpam(form))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không tạo được challenge"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"id":             form.ID,
 		"tieu_de":        form.TieuDe,
@@ -550,6 +615,7 @@ func GetPublicForm(c *gin.Context) {
 		"settings":       settings,
 		"theme":          theme,
 		"questions":      out,
+		"challenge":      challenge,
 	})
 }
 
@@ -569,9 +635,16 @@ func UpdatePublicLink(c *gin.Context) {
 		return
 	}
 
-	if err := config.DB.Model(&models.KhaoSat{}).
-		Where("id = ?", f.ID).
-		Update("public_link", req.PublicLink).Error; err != nil {
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		before, err := lockForm(tx, f.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&models.KhaoSat{}).Where("id = ?", f.ID).Update("public_link", req.PublicLink).Error; err != nil {
+			return err
+		}
+		return auditForm(c, tx, "form.public_link.update", f.ID, before)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Lưu link thất bại"})
 		return
 	}
@@ -600,8 +673,16 @@ func UpdateFormLimit(c *gin.Context) {
 		return
 	}
 
-	form.GioiHanTL = &req.GioiHanTL
-	if err := config.DB.Save(&form).Error; err != nil {
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		before, err := lockForm(tx, form.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&models.KhaoSat{}).Where("id = ?", form.ID).Update("gioi_han_tra_loi", req.GioiHanTL).Error; err != nil {
+			return err
+		}
+		return auditForm(c, tx, "form.limit.update", form.ID, before)
+	}); err != nil {
 		c.JSON(500, gin.H{"message": "Không thể cập nhật giới hạn"})
 		return
 	}
@@ -680,6 +761,16 @@ func CloneForm(c *gin.Context) {
 		}
 	}
 
+	if err := recordChange(c, tx, "form.clone", "form", newForm.ID, nil, gin.H{
+		"source_form_id": original.ID,
+		"form":           formAuditView(&newForm),
+		"so_cau_hoi":     len(original.CauHois),
+	}); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể ghi nhật ký", "detail": err.Error()})
+		return
+	}
+
 	// Commit transaction
 	if err := tx.Commit().Error; err != nil {
 		tx.Rollback()
@@ -769,6 +860,12 @@ func UpdateFormWithQuestions(c *gin.Context) {
 	}
 
 	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// Trạng thái trước khi sửa (khoá form để nhật ký before/after không lẫn với request khác)
+		var before models.KhaoSat
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("CauHois").First(&before, f.ID).Error; err != nil {
+			return err
+		}
+
 		// --- Update form ---
 		updates := map[string]interface{}{}
 		if req.Title != nil {
@@ -868,7 +965,11 @@ func UpdateFormWithQuestions(c *gin.Context) {
 			}
 		}
 
-		return nil
+		var after models.KhaoSat
+		if err := tx.Preload("CauHois").First(&after, f.ID).Error; err != nil {
+			return err
+		}
+		return recordChange(c, tx, "form.update_with_questions", "form", f.ID, formWithQuestionsAuditView(&before), formWithQuestionsAuditView(&after))
 	})
 
 	if err != nil {
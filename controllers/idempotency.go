@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/vnkhanh/survey-server/config"
+	"github.com/vnkhanh/survey-server/models"
+)
+
+const (
+	idempotencyHeader    = "Idempotency-Key"
+	idempotencyScopeSub  = "submission"
+	idempotencyMaxKeyLen = 255
+)
+
+// errIdempotentReplay: key đã được một request khác ghi nhận (trong transaction) → trả kết quả cũ
+var errIdempotentReplay = errors.New("idempotent replay")
+
+// idempotencyTTL: thời gian giữ key, cấu hình qua IDEMPOTENCY_TTL (duration Go, mặc định 24h)
+func idempotencyTTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("IDEMPOTENCY_TTL")); err == nil && d > 0 {
+		return d
+	}
+	return 24 * time.Hour
+}
+
+// idempotencyKey đọc header; ok = false (đã trả lỗi) nếu key không hợp lệ
+func idempotencyKey(c *gin.Context) (string, bool) {
+	key := strings.TrimSpace(c.GetHeader(idempotencyHeader))
+	if len(key) > idempotencyMaxKeyLen {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key tối đa 255 ký tự"})
+		return "", false
+	}
+	return key, true
+}
+
+// requestHash băm nội dung request đã parse (JSON) để phát hiện dùng lại key cho dữ liệu khác
+func requestHash(v interface{}) string {
+	b, _ := json.Marshal(v)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// findIdempotencyKey trả bản ghi còn hạn (nil nếu chưa có)
+func findIdempotencyKey(scope string, formID uint, key string) (*models.IdempotencyKey, error) {
+	var row models.IdempotencyKey
+	err := config.DB.Where("scope = ? AND khao_sat_id = ? AND key = ? AND expires_at > ?", scope, formID, key, time.Now()).
+		First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// replayIdempotent trả lại kết quả đã lưu; key trùng nhưng nội dung khác → 422
+func replayIdempotent(c *gin.Context, row *models.IdempotencyKey, hash string) {
+	if row.RequestHash != hash {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key đã được dùng cho một request khác"})
+		return
+	}
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(row.StatusCode, "application/json; charset=utf-8", []byte(row.ResponseBody))
+}
+
+// claimIdempotencyKey giữ key trong transaction tx. Request song song cùng key sẽ chờ transaction
+// đầu tiên kết thúc rồi nhận errIdempotentReplay.
+func claimIdempotencyKey(tx *gorm.DB, scope string, formID uint, key, hash string) (*models.IdempotencyKey, error) {
+	now := time.Now()
+	// Key hết hạn thì cho dùng lại
+	if err := tx.Where("scope = ? AND khao_sat_id = ? AND key = ? AND expires_at <= ?", scope, formID, key, now).
+		Delete(&models.IdempotencyKey{}).Error; err != nil {
+		return nil, err
+	}
+	row := models.IdempotencyKey{
+		Scope:       scope,
+		KhaoSatID:   formID,
+		Key:         key,
+		RequestHash: hash,
+		ExpiresAt:   now.Add(idempotencyTTL()),
+	}
+	res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&row)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, errIdempotentReplay
+	}
+	return &row, nil
+}
+
+// completeIdempotencyKey lưu kết quả (cùng transaction với bản ghi được tạo)
+func completeIdempotencyKey(tx *gorm.DB, row *models.IdempotencyKey, phanHoiID uint, status int, body interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return tx.Model(row).Updates(map[string]interface{}{
+		"phan_hoi_id":   phanHoiID,
+		"status_code":   status,
+		"response_body": string(b),
+	}).Error
+}
@@ -0,0 +1,31 @@
+package controllers
+
+import "testing"
+
+func TestSubmitIdempotencyHashIgnoresChallenge(t *testing.T) {
+	email := "a@example.com"
+	base := SubmitSurveyReq{
+		KhaoSatID: 3,
+		Email:     &email,
+		Answers:   []AnswerReq{{CauHoiID: 1, LoaiCauHoi: "SINGLE_CHOICE", NoiDung: "Xanh"}},
+		Challenge: &ChallengeAnswer{Token: "t1", Nonce: "1"},
+	}
+	retry := base
+	retry.Challenge = &ChallengeAnswer{Token: "t2", Nonce: "42"}
+	retry.Website = "x"
+	if requestHash(base.idempotencyPayload()) != requestHash(retry.idempotencyPayload()) {
+		t.Error("gửi lại với challenge mới bị coi là request khác")
+	}
+
+	changed := base
+	changed.Answers = []AnswerReq{{CauHoiID: 1, LoaiCauHoi: "SINGLE_CHOICE", NoiDung: "Đỏ"}}
+	if requestHash(base.idempotencyPayload()) == requestHash(changed.idempotencyPayload()) {
+		t.Error("đổi câu trả lời nhưng hash không đổi")
+	}
+	other := "b@example.com"
+	changed = base
+	changed.Email = &other
+	if requestHash(base.idempotencyPayload()) == requestHash(changed.idempotencyPayload()) {
+		t.Error("đổi email nhưng hash không đổi")
+	}
+}
@@ -0,0 +1,756 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/vnkhanh/survey-server/config"
+	"github.com/vnkhanh/survey-server/middleware"
+	"github.com/vnkhanh/survey-server/models"
+	"github.com/vnkhanh/survey-server/services"
+)
+
+const (
+	jobKindImport   = "import"
+	importMaxSize   = 50 << 20 // 50MB
+	importBatchSize = 500
+	importMaxIssues = 200 // số lỗi/cảnh báo tối đa giữ trong báo cáo
+)
+
+type importJobPayload struct {
+	ImportID uint `json:"import_id"`
+	Commit   bool `json:"commit"` // false = chạy thử (chỉ kiểm tra, không ghi)
+}
+
+// importReport: báo cáo của lần chạy thử hoặc lần nhập
+type importReport struct {
+	Mode       string         `json:"mode"`   // dry_run | commit
+	Layout     string         `json:"layout"` // wide | long
+	Columns    []importColumn `json:"columns"`
+	Unmapped   []string       `json:"unmapped"`
+	Rows       int            `json:"rows"`           // số dòng dữ liệu
+	Responses  int            `json:"responses"`      // số phản hồi đọc được
+	Valid      int            `json:"valid"`          // phản hồi hợp lệ (sẽ nhập / đã nhập)
+	Invalid    int            `json:"invalid"`        // phản hồi có lỗi
+	Duplicates int            `json:"duplicates"`     // mã phản hồi đã được nhập trước đó, bỏ qua
+	Answers    int            `json:"answers"`        // số câu trả lời của các phản hồi hợp lệ
+	Imported   int            `json:"imported"`       // commit: số phản hồi đã ghi
+	MapErrors  int            `json:"mapping_errors"` // lỗi ánh xạ cột (chặn nhập)
+	ErrorCount int            `json:"error_count"`    // tổng số lỗi (Errors chỉ giữ importMaxIssues lỗi đầu)
+	Errors     []importIssue  `json:"errors"`
+	WarnCount  int            `json:"warning_count"`
+	Warnings   []importIssue  `json:"warnings"`
+}
+
+func (r *importReport) addErrors(issues ...importIssue) {
+	r.ErrorCount += len(issues)
+	for _, i := range issues {
+		if len(r.Errors) < importMaxIssues {
+			r.Errors = append(r.Errors, i)
+		}
+	}
+}
+
+func (r *importReport) addWarnings(issues ...importIssue) {
+	r.WarnCount += len(issues)
+	for _, i := range issues {
+		if len(r.Warnings) < importMaxIssues {
+			r.Warnings = append(r.Warnings, i)
+		}
+	}
+}
+
+func importJobDTO(j models.ImportJob) gin.H {
+	var opts importOptions
+	var mapping map[string]string
+	var report *importReport
+	json.Unmarshal([]byte(j.OptionsJSON), &opts)
+	json.Unmarshal([]byte(j.MappingJSON), &mapping)
+	if j.ReportJSON != "" {
+		report = &importReport{}
+		json.Unmarshal([]byte(j.ReportJSON), report)
+	}
+	return gin.H{
+		"id":           j.ID,
+		"form_id":      j.KhaoSatID,
+		"file_name":    j.FileName,
+		"format":       j.Format,
+		"status":       j.Status,
+		"progress":     j.Progress,
+		"mapping":      mapping,
+		"options":      opts,
+		"report":       report,
+		"imported":     j.Imported,
+		"error":        j.ErrorMsg,
+		"committed_at": j.CommittedAt,
+		"created_at":   j.CreatedAt,
+		"updated_at":   j.UpdatedAt,
+	}
+}
+
+// bindImportSettings đọc mapping/options (JSON) từ form multipart hoặc body (đã trả lỗi nếu không hợp lệ)
+func bindImportSettings(c *gin.Context, mappingRaw, optionsRaw string) (string, string, bool) {
+	mapping := map[string]string{}
+	if mappingRaw != "" {
+		if err := json.Unmarshal([]byte(mappingRaw), &mapping); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "mapping phải là object JSON {header: đích}"})
+			return "", "", false
+		}
+	}
+	var opts importOptions
+	if optionsRaw != "" {
+		if err := json.Unmarshal([]byte(optionsRaw), &opts); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "options không hợp lệ"})
+			return "", "", false
+		}
+	}
+	if _, err := opts.normalize(); err != nil {
+		exportOptionsError(c, err)
+		return "", "", false
+	}
+	m, _ := json.Marshal(mapping)
+	o, _ := json.Marshal(opts)
+	return string(m), string(o), true
+}
+
+// findImportJob lấy job nhập :import_id của form trong context (đã trả 404 nếu không có)
+func findImportJob(c *gin.Context, form models.KhaoSat) (models.ImportJob, bool) {
+	var j models.ImportJob
+	if err := config.DB.Where("id = ? AND khao_sat_id = ?", c.Param("import_id"), form.ID).First(&j).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Job nhập không tồn tại"})
+		return j, false
+	}
+	return j, true
+}
+
+// queueImport đưa job nhập vào hàng đợi (chạy thử hoặc ghi thật) và đặt trạng thái tương ứng
+func queueImport(tx *gorm.DB, j *models.ImportJob, commit bool, updates map[string]interface{}) error {
+	qj, err := services.EnqueueJob(tx, jobKindImport, importJobPayload{ImportID: j.ID, Commit: commit})
+	if err != nil {
+		return err
+	}
+	updates["queue_job_id"] = qj.ID
+	updates["progress"] = 0
+	updates["error_msg"] = nil
+	updates["status"] = models.ImportQueued
+	if commit {
+		updates["status"] = models.ImportImporting
+	}
+	return tx.Model(j).Updates(updates).Error
+}
+
+// POST /api/forms/:id/imports — multipart: file (CSV/XLSX như file xuất), mapping, options (JSON).
+// File được chạy thử ngay; xem báo cáo rồi gọi /commit để ghi.
+func CreateImport(c *gin.Context) {
+	u := c.MustGet(middleware.CtxUser).(models.NguoiDung)
+	form := c.MustGet("formObj").(models.KhaoSat)
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Thiếu file"})
+		return
+	}
+	format := services.ImportFormatOf(fh.Filename)
+	if format == "" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"message":   "Định dạng nhập không được hỗ trợ",
+			"supported": services.ImportFormats,
+		})
+		return
+	}
+	if fh.Size > importMaxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"message": "File vượt quá 50MB"})
+		return
+	}
+	mapping, opts, ok := bindImportSettings(c, c.PostForm("mapping"), c.PostForm("options"))
+	if !ok {
+		return
+	}
+
+	st, err := services.ExportStorage()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Kho file chưa được cấu hình"})
+		return
+	}
+	f, err := fh.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Không đọc được file"})
+		return
+	}
+	defer f.Close()
+	key := fmt.Sprintf("import_%s.%s", uuid.New().String(), format)
+	h := sha256.New()
+	if err := st.Put(c.Request.Context(), key, io.TeeReader(f, h), "application/octet-stream"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể lưu file"})
+		return
+	}
+
+	j := models.ImportJob{
+		KhaoSatID:   form.ID,
+		NguoiDungID: u.ID,
+		FileName:    fh.Filename,
+		Format:      format,
+		FileKey:     &key,
+		FileHash:    hex.EncodeToString(h.Sum(nil)),
+		MappingJSON: mapping,
+		OptionsJSON: opts,
+		Status:      models.ImportQueued,
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&j).Error; err != nil {
+			return err
+		}
+		if err := queueImport(tx, &j, false, map[string]interface{}{}); err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "import.create", "form", form.ID, gin.H{"import_id": j.ID, "file_name": j.FileName, "format": format})
+	}); err != nil {
+		st.Delete(context.Background(), key)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể tạo job nhập"})
+		return
+	}
+	config.DB.First(&j, j.ID)
+	c.JSON(http.StatusAccepted, importJobDTO(j))
+}
+
+// GET /api/forms/:id/imports
+func ListImports(c *gin.Context) {
+	form := c.MustGet("formObj").(models.KhaoSat)
+	page, limit, offset := adminPaging(c)
+	q := config.DB.Model(&models.ImportJob{}).Where("khao_sat_id = ?", form.ID)
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Lỗi DB"})
+		return
+	}
+	var jobs []models.ImportJob
+	if err := q.Order("id DESC").Limit(limit).Offset(offset).Find(&jobs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Lỗi DB"})
+		return
+	}
+	out := make([]gin.H, 0, len(jobs))
+	for _, j := range jobs {
+		dto := importJobDTO(j)
+		delete(dto, "report") // báo cáo đầy đủ xem ở GET /imports/:import_id
+		out = append(out, dto)
+	}
+	c.JSON(http.StatusOK, gin.H{"imports": out, "page": page, "limit": limit, "total": total})
+}
+
+// GET /api/forms/:id/imports/:import_id — trạng thái và báo cáo
+func GetImport(c *gin.Context) {
+	form := c.MustGet("formObj").(models.KhaoSat)
+	j, ok := findImportJob(c, form)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, importJobDTO(j))
+}
+
+// PATCH /api/forms/:id/imports/:import_id — đổi mapping/options rồi chạy thử lại
+func UpdateImport(c *gin.Context) {
+	form := c.MustGet("formObj").(models.KhaoSat)
+	j, ok := findImportJob(c, form)
+	if !ok {
+		return
+	}
+	if j.Status != models.ImportValidated && j.Status != models.ImportFailed {
+		c.JSON(http.StatusConflict, gin.H{"message": "Job nhập đang chạy hoặc đã hoàn tất", "status": j.Status})
+		return
+	}
+	var req struct {
+		Mapping map[string]string `json:"mapping"`
+		Options *importOptions    `json:"options"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Payload không hợp lệ"})
+		return
+	}
+	mappingRaw, optionsRaw := j.MappingJSON, j.OptionsJSON
+	if req.Mapping != nil {
+		b, _ := json.Marshal(req.Mapping)
+		mappingRaw = string(b)
+	}
+	if req.Options != nil {
+		b, _ := json.Marshal(req.Options)
+		optionsRaw = string(b)
+	}
+	mapping, opts, ok := bindImportSettings(c, mappingRaw, optionsRaw)
+	if !ok {
+		return
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := queueImport(tx, &j, false, map[string]interface{}{"mapping_json": mapping, "options_json": opts}); err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "import.update", "form", form.ID, gin.H{"import_id": j.ID})
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể chạy thử lại"})
+		return
+	}
+	config.DB.First(&j, j.ID)
+	c.JSON(http.StatusAccepted, importJobDTO(j))
+}
+
+// POST /api/forms/:id/imports/:import_id/commit — ghi các phản hồi vào form trong một transaction.
+// Báo cáo chạy thử còn lỗi thì từ chối, trừ khi gửi {"skip_invalid": true} để bỏ các phản hồi lỗi.
+func CommitImport(c *gin.Context) {
+	form := c.MustGet("formObj").(models.KhaoSat)
+	j, ok := findImportJob(c, form)
+	if !ok {
+		return
+	}
+	var req struct {
+		SkipInvalid bool `json:"skip_invalid"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Payload không hợp lệ"})
+			return
+		}
+	}
+	if j.Status != models.ImportValidated {
+		c.JSON(http.StatusConflict, gin.H{"message": "Chỉ nhập được sau khi chạy thử thành công", "status": j.Status})
+		return
+	}
+	var rep importReport
+	json.Unmarshal([]byte(j.ReportJSON), &rep)
+	if rep.Invalid > 0 && !req.SkipInvalid {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"message": "File còn phản hồi lỗi; sửa file/mapping hoặc gửi skip_invalid để bỏ qua",
+			"invalid": rep.Invalid,
+		})
+		return
+	}
+	if rep.MapErrors > 0 || rep.Valid == 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "Không có phản hồi hợp lệ để nhập hoặc ánh xạ cột còn lỗi"})
+		return
+	}
+
+	var opts importOptions
+	json.Unmarshal([]byte(j.OptionsJSON), &opts)
+	opts.SkipInvalid = req.SkipInvalid
+	b, _ := json.Marshal(opts)
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := queueImport(tx, &j, true, map[string]interface{}{"options_json": string(b)}); err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "import.commit", "form", form.ID, gin.H{
+			"import_id": j.ID, "file_name": j.FileName, "responses": rep.Valid, "skip_invalid": req.SkipInvalid,
+		})
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể bắt đầu nhập"})
+		return
+	}
+	config.DB.First(&j, j.ID)
+	c.JSON(http.StatusAccepted, importJobDTO(j))
+}
+
+// DELETE /api/forms/:id/imports/:import_id — xoá job nhập và file (phản hồi đã nhập được giữ lại)
+func DeleteImport(c *gin.Context) {
+	form := c.MustGet("formObj").(models.KhaoSat)
+	j, ok := findImportJob(c, form)
+	if !ok {
+		return
+	}
+	if j.Status == models.ImportImporting || j.Status == models.ImportValidating {
+		c.JSON(http.StatusConflict, gin.H{"message": "Job nhập đang chạy", "status": j.Status})
+		return
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&j).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "import.delete", "form", form.ID, gin.H{"import_id": j.ID})
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể xoá job nhập"})
+		return
+	}
+	if j.FileKey != nil {
+		if st, err := services.ExportStorage(); err == nil {
+			st.Delete(c.Request.Context(), *j.FileKey)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Đã xoá job nhập"})
+}
+
+var errImportInvalid = errors.New("file có phản hồi lỗi")
+
+// runImportJob: handler của hàng đợi cho job nhập (chạy thử hoặc ghi)
+func runImportJob(ctx context.Context, qj models.Job) error {
+	var p importJobPayload
+	if err := json.Unmarshal([]byte(qj.Payload), &p); err != nil {
+		return services.PermanentJobError(err)
+	}
+	var j models.ImportJob
+	if err := config.DB.First(&j, p.ImportID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return services.PermanentJobError(err)
+		}
+		return err
+	}
+	if j.QueueJobID == nil || *j.QueueJobID != qj.ID {
+		return nil // đã có lần chạy mới hơn
+	}
+
+	err := processImportJob(ctx, &j, p.Commit)
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, errImportInvalid) {
+		err = services.PermanentJobError(err)
+	}
+	if ctx.Err() == nil && !services.IsFinalAttempt(qj, err) {
+		return err // sẽ được thử lại
+	}
+	config.DB.Model(&j).Updates(map[string]interface{}{"status": models.ImportFailed, "error_msg": err.Error()})
+	return err
+}
+
+// processImportJob đọc file theo ánh xạ; chạy thử chỉ lập báo cáo, commit ghi mọi phản hồi hợp lệ trong một transaction
+func processImportJob(ctx context.Context, j *models.ImportJob, commit bool) error {
+	status := models.ImportValidating
+	if commit {
+		status = models.ImportImporting
+	}
+	config.DB.Model(j).Updates(map[string]interface{}{"status": status, "progress": 0})
+	if j.FileKey == nil {
+		return services.PermanentJobError(errors.New("file nhập không còn"))
+	}
+
+	var mapping map[string]string
+	var opts importOptions
+	json.Unmarshal([]byte(j.MappingJSON), &mapping)
+	json.Unmarshal([]byte(j.OptionsJSON), &opts)
+	var prev importReport
+	json.Unmarshal([]byte(j.ReportJSON), &prev)
+
+	// 1. Lấy file từ kho về thư mục tạm
+	st, err := services.ExportStorage()
+	if err != nil {
+		return err
+	}
+	rc, err := st.Get(ctx, *j.FileKey)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp("", "survey-import-*")
+	if err != nil {
+		rc.Close()
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, rc)
+	rc.Close()
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	reader, err := services.OpenImportFile(tmp.Name(), j.Format)
+	if err != nil {
+		return services.PermanentJobError(err)
+	}
+	defer reader.Close()
+
+	// 2. Ánh xạ cột theo câu hỏi hiện tại của form
+	var questions []models.CauHoi
+	if err := config.DB.Where("khao_sat_id = ?", j.KhaoSatID).
+		Preload("LuaChons", func(db *gorm.DB) *gorm.DB { return db.Order("thu_tu ASC, id ASC") }).
+		Order("id asc").Find(&questions).Error; err != nil {
+		return err
+	}
+	plan, mapIssues, err := newImportPlan(reader.Header(), questions, mapping, opts)
+	if err != nil {
+		return services.PermanentJobError(err)
+	}
+	rep := &importReport{Mode: "dry_run", Layout: services.ExportLayoutWide, Columns: plan.cols, Unmapped: plan.unmapped()}
+	if commit {
+		rep.Mode = "commit"
+	}
+	if plan.long {
+		rep.Layout = services.ExportLayoutLong
+	}
+	rep.MapErrors = len(mapIssues)
+	rep.addErrors(mapIssues...)
+	if !commit {
+		var n int64
+		config.DB.Model(&models.ImportJob{}).
+			Where("khao_sat_id = ? AND file_hash = ? AND status = ? AND id <> ?", j.KhaoSatID, j.FileHash, models.ImportDone, j.ID).
+			Count(&n)
+		if n > 0 {
+			rep.addWarnings(importIssue{Message: "file này đã được nhập vào form trước đó"})
+		}
+	}
+
+	scanner := newImportScanner(plan, reader)
+	scan := func(db *gorm.DB) error {
+		if len(mapIssues) > 0 && commit {
+			return errImportInvalid
+		}
+		for {
+			batch, err := readImportBatch(ctx, scanner)
+			if len(batch) > 0 {
+				valid, verr := checkImportBatch(db, j.KhaoSatID, batch, rep)
+				if verr != nil {
+					return verr
+				}
+				if commit {
+					if rep.Invalid > 0 && !opts.SkipInvalid {
+						return errImportInvalid
+					}
+					skipped, err := insertImportBatch(db, j, valid)
+					if err != nil {
+						return err
+					}
+					rep.Imported += len(valid) - skipped
+					rep.Valid -= skipped
+					rep.Duplicates += skipped
+					if prev.Rows > 0 {
+						config.DB.Model(j).Update("progress", min(99, scanner.Rows*100/prev.Rows))
+					}
+				}
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+		rep.Rows = scanner.Rows
+		return nil
+	}
+
+	saveReport := func(db *gorm.DB, updates map[string]interface{}) error {
+		b, _ := json.Marshal(rep)
+		updates["report_json"] = string(b)
+		return db.Model(j).Updates(updates).Error
+	}
+
+	if !commit {
+		if err := scan(config.DB.WithContext(ctx)); err != nil {
+			return err
+		}
+		return saveReport(config.DB, map[string]interface{}{"status": models.ImportValidated, "progress": 100})
+	}
+
+	// 3. Ghi: toàn bộ trong một transaction, lỗi ở bất kỳ lô nào thì không phản hồi nào được ghi
+	err = config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := scan(tx); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.KhaoSat{}).Where("id = ?", j.KhaoSatID).
+			UpdateColumn("so_phan_hoi", gorm.Expr("so_phan_hoi + ?", rep.Imported)).Error; err != nil {
+			return err
+		}
+		if err := services.RecordAudit(tx, services.AuditEntry{
+			ActorType:  models.ActorSystem,
+			Action:     "import.done",
+			TargetType: "form",
+			TargetID:   j.KhaoSatID,
+			Metadata: map[string]interface{}{
+				"import_id": j.ID, "imported": rep.Imported, "invalid": rep.Invalid, "duplicates": rep.Duplicates,
+			},
+		}); err != nil {
+			return err
+		}
+		return saveReport(tx, map[string]interface{}{
+			"status": models.ImportDone, "progress": 100, "imported": rep.Imported, "committed_at": time.Now(),
+		})
+	})
+	if err != nil {
+		if errors.Is(err, errImportInvalid) {
+			saveReport(config.DB, map[string]interface{}{})
+		}
+		return err
+	}
+
+	// file không còn cần sau khi nhập xong
+	if err := st.Delete(context.Background(), *j.FileKey); err != nil {
+		log.Printf("[import] delete %s: %v", *j.FileKey, err)
+	}
+	config.DB.Model(j).Update("file_key", nil)
+	return nil
+}
+
+// readImportBatch đọc tối đa importBatchSize phản hồi; trả lỗi của reader (io.EOF khi hết) kèm lô đã đọc
+func readImportBatch(ctx context.Context, s *importScanner) ([]*importRecord, error) {
+	batch := make([]*importRecord, 0, importBatchSize)
+	for len(batch) < importBatchSize {
+		if err := ctx.Err(); err != nil {
+			return batch, err
+		}
+		r, err := s.Next()
+		if err != nil {
+			return batch, err
+		}
+		batch = append(batch, r)
+	}
+	return batch, nil
+}
+
+// checkImportBatch bỏ phản hồi đã nhập trước đó (theo mã phản hồi gốc), bỏ user_id không thuộc form
+// (phản hồi vẫn được nhập, không gắn người dùng), ghi lỗi/cảnh báo vào báo cáo và trả các phản hồi hợp lệ
+func checkImportBatch(db *gorm.DB, formID uint, batch []*importRecord, rep *importReport) ([]*importRecord, error) {
+	var refs []string
+	var userIDs []uint
+	for _, r := range batch {
+		if r.Ref != "" {
+			refs = append(refs, r.Ref)
+		}
+		if r.UserID != nil {
+			userIDs = append(userIDs, *r.UserID)
+		}
+	}
+	done := map[string]bool{}
+	if len(refs) > 0 {
+		var existing []string
+		if err := db.Model(&models.PhanHoi{}).
+			Where("khao_sat_id = ? AND source = ? AND source_ref IN ?", formID, "import", refs).
+			Pluck("source_ref", &existing).Error; err != nil {
+			return nil, err
+		}
+		for _, r := range existing {
+			done[r] = true
+		}
+	}
+	users := map[uint]bool{}
+	if len(userIDs) > 0 {
+		// chỉ gắn phản hồi cho người có liên quan tới form: chủ form, chủ/thành viên đang hoạt động
+		// của room gắn với form — không cho giả mạo phản hồi của tài khoản bất kỳ
+		var ids []uint
+		if err := db.Raw(`SELECT nguoi_tao_id FROM khao_sat WHERE id = ? AND nguoi_tao_id IN ?
+			UNION SELECT nguoi_tao_id FROM room WHERE khao_sat_id = ? AND nguoi_tao_id IN ?
+			UNION SELECT m.nguoi_dung_id FROM room_nguoi_tham_gia m JOIN room r ON r.id = m.room_id
+				WHERE r.khao_sat_id = ? AND m.trang_thai = 'active' AND m.nguoi_dung_id IN ?`,
+			formID, userIDs, formID, userIDs, formID, userIDs).Scan(&ids).Error; err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			users[id] = true
+		}
+	}
+
+	valid := make([]*importRecord, 0, len(batch))
+	for _, r := range batch {
+		rep.Responses++
+		if r.UserID != nil && !users[*r.UserID] {
+			r.warn("", fmt.Sprintf("người dùng %d không phải chủ form hoặc thành viên room của form, bỏ qua", *r.UserID))
+			r.UserID = nil
+		}
+		rep.addWarnings(r.Warnings...)
+		if done[r.Ref] {
+			rep.Duplicates++
+			continue
+		}
+		if len(r.Errors) > 0 {
+			rep.Invalid++
+			rep.addErrors(r.Errors...)
+			continue
+		}
+		if r.Ref != "" {
+			// mã trùng trong cùng lô cũng chỉ nhập một lần
+			done[r.Ref] = true
+		}
+		rep.Valid++
+		rep.Answers += len(r.Answers)
+		valid = append(valid, r)
+	}
+	return valid, nil
+}
+
+// insertImportBatch ghi phản hồi và câu trả lời, đánh dấu nguồn "import"; trả số phản hồi bị bỏ vì mã gốc
+// vừa được một lần nhập khác (song song) ghi trước (unique index ux_phan_hoi_source_ref).
+// Không phát submission.created: đây là dữ liệu lịch sử, không phải phản hồi mới.
+func insertImportBatch(tx *gorm.DB, j *models.ImportJob, batch []*importRecord) (int, error) {
+	if len(batch) == 0 {
+		return 0, nil
+	}
+	var plain, withRef []models.PhanHoi
+	var plainRecs, refRecs []*importRecord
+	for _, r := range batch {
+		sub := models.PhanHoi{
+			KhaoSatID:   j.KhaoSatID,
+			NguoiDungID: r.UserID,
+			Email:       r.Email,
+			NgayGui:     r.SubmittedAt,
+			LanGui:      r.LanGui,
+			Source:      "import",
+			ImportJobID: &j.ID,
+			SourceRef:   r.Ref,
+		}
+		if r.Ref == "" {
+			plain, plainRecs = append(plain, sub), append(plainRecs, r)
+		} else {
+			withRef, refRecs = append(withRef, sub), append(refRecs, r)
+		}
+	}
+
+	var answers []models.CauTraLoi
+	addAnswers := func(id uint, r *importRecord) {
+		for _, a := range r.Answers {
+			a.PhanHoiID = id
+			answers = append(answers, a)
+		}
+	}
+	if len(plain) > 0 {
+		if err := tx.CreateInBatches(&plain, importBatchSize).Error; err != nil {
+			return 0, err
+		}
+		for i, r := range plainRecs {
+			addAnswers(plain[i].ID, r)
+		}
+	}
+
+	skipped := 0
+	if len(withRef) > 0 {
+		// ON CONFLICT DO NOTHING: id trả về không còn khớp thứ tự khi có dòng bị bỏ → đọc lại theo mã gốc
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&withRef, importBatchSize).Error; err != nil {
+			return 0, err
+		}
+		refs := make([]string, len(refRecs))
+		for i, r := range refRecs {
+			refs[i] = r.Ref
+		}
+		var inserted []models.PhanHoi
+		if err := tx.Select("id", "source_ref").
+			Where("import_job_id = ? AND khao_sat_id = ? AND source_ref IN ?", j.ID, j.KhaoSatID, refs).
+			Find(&inserted).Error; err != nil {
+			return 0, err
+		}
+		ids := make(map[string]uint, len(inserted))
+		for _, p := range inserted {
+			ids[p.SourceRef] = p.ID
+		}
+		for _, r := range refRecs {
+			id, ok := ids[r.Ref]
+			if !ok {
+				skipped++
+				continue
+			}
+			addAnswers(id, r)
+		}
+	}
+
+	if len(answers) == 0 {
+		return skipped, nil
+	}
+	return skipped, tx.CreateInBatches(&answers, 1000).Error
+}
@@ -0,0 +1,613 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vnkhanh/survey-server/models"
+	"github.com/vnkhanh/survey-server/services"
+)
+
+// importOptions: cách đọc file nhập
+type importOptions struct {
+	DateFormat  string `json:"date_format,omitempty"`  // như ExportOptions.DateFormat; mặc định định dạng của file xuất
+	Timezone    string `json:"timezone,omitempty"`     // múi giờ của cột thời gian; rỗng = giờ server
+	Values      string `json:"values,omitempty"`       // labels | ids: cột lựa chọn chứa nhãn hay id (ưu tiên khi so khớp)
+	SkipInvalid bool   `json:"skip_invalid,omitempty"` // khi nhập: bỏ phản hồi lỗi thay vì huỷ cả file
+}
+
+// normalize kiểm tra tuỳ chọn, trả ExportOptions tương ứng để dùng chung layout ngày/múi giờ
+func (o *importOptions) normalize() (services.ExportOptions, error) {
+	eo := services.ExportOptions{DateFormat: o.DateFormat, Timezone: o.Timezone, Values: o.Values}
+	if err := eo.Normalize(); err != nil {
+		return eo, err
+	}
+	o.DateFormat, o.Timezone, o.Values = eo.DateFormat, eo.Timezone, eo.Values
+	return eo, nil
+}
+
+// Đích của một cột trong file nhập (ngoài "q<ID>" và "q<ID>_o<ID>")
+const (
+	importSkip         = "skip"
+	importSubmittedAt  = "submitted_at"
+	importSubmissionID = "submission_id" // mã phản hồi gốc: chống nhập trùng, nhóm dòng của bố cục long
+	importUserID       = "user_id"
+	importEmail        = "email"
+	importLanGui       = "lan_gui"
+	importQuestionID   = "question_id" // bố cục long
+	importQuestion     = "question"    // bố cục long
+	importValue        = "value"       // bố cục long
+)
+
+// Header mặc định của file xuất (xem exportShape.Columns) → đích
+var importHeaderTargets = map[string]string{
+	"dấu thời gian": importSubmittedAt,
+	"mã phản hồi":   importSubmissionID,
+	"người dùng":    importUserID,
+	"email":         importEmail,
+	"lần gửi":       importLanGui,
+	"mã câu hỏi":    importQuestionID,
+	"câu hỏi":       importQuestion,
+	"giá trị":       importValue,
+}
+
+// importIssue: lỗi/cảnh báo của báo cáo nhập; Row = số dòng trong file (header là dòng 1), 0 = lỗi ánh xạ
+type importIssue struct {
+	Row     int    `json:"row"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// importColumn: ánh xạ của một cột
+type importColumn struct {
+	Index    int    `json:"column"` // 1-based
+	Header   string `json:"header"`
+	Target   string `json:"target"`
+	Auto     bool   `json:"auto"` // ánh xạ tự động (không có trong mapping gửi lên)
+	question *models.CauHoi
+	option   *models.LuaChon
+}
+
+// importPlan: ánh xạ cột → câu hỏi/metadata và cách chuyển giá trị ô thành câu trả lời
+type importPlan struct {
+	cols      []importColumn
+	long      bool
+	meta      map[string]int // đích metadata → vị trí cột
+	questions map[uint]*models.CauHoi
+	byLabel   map[string]*models.CauHoi // nhãn câu hỏi (chuẩn hoá) → câu hỏi, chỉ nhãn không trùng
+	order     map[uint]int              // thứ tự câu hỏi trong form
+	layout    string
+	loc       *time.Location
+	values    string
+}
+
+func normalizeLabel(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+func questionLabel(q models.CauHoi) string {
+	if q.NoiDung == "" {
+		return "Câu hỏi không có tiêu đề"
+	}
+	return q.NoiDung
+}
+
+// newImportPlan dựng ánh xạ: mapping (header hoặc "#<cột>" → đích) ghi đè ánh xạ tự động theo header của file xuất
+func newImportPlan(header []string, questions []models.CauHoi, mapping map[string]string, opts importOptions) (*importPlan, []importIssue, error) {
+	eo, err := opts.normalize()
+	if err != nil {
+		return nil, nil, err
+	}
+	p := &importPlan{
+		meta:      map[string]int{},
+		questions: map[uint]*models.CauHoi{},
+		byLabel:   map[string]*models.CauHoi{},
+		order:     map[uint]int{},
+		layout:    eo.DateLayout(),
+		loc:       eo.Location(),
+		values:    eo.Values,
+	}
+	type qo struct {
+		q *models.CauHoi
+		o *models.LuaChon
+	}
+	splitLabels := map[string]qo{}
+	dupLabels := map[string]bool{}
+	for i := range questions {
+		q := &questions[i]
+		p.questions[q.ID] = q
+		p.order[q.ID] = i
+		l := normalizeLabel(questionLabel(*q))
+		if _, ok := p.byLabel[l]; ok {
+			dupLabels[l] = true
+		}
+		p.byLabel[l] = q
+		for j := range q.LuaChons {
+			splitLabels[normalizeLabel(questionLabel(*q)+": "+q.LuaChons[j].NoiDung)] = qo{q, &q.LuaChons[j]}
+		}
+	}
+	for l := range dupLabels {
+		delete(p.byLabel, l)
+	}
+
+	var issues []importIssue
+	used := map[string]int{}
+	for i, h := range header {
+		col := importColumn{Index: i + 1, Header: strings.TrimSpace(h)}
+		target, manual := mapping["#"+strconv.Itoa(i+1)]
+		if !manual {
+			target, manual = mapping[col.Header]
+		}
+		if manual {
+			target = strings.TrimSpace(target)
+		} else {
+			col.Auto = true
+			l := normalizeLabel(col.Header)
+			switch {
+			case importHeaderTargets[l] != "":
+				target = importHeaderTargets[l]
+			case p.byLabel[l] != nil:
+				target = fmt.Sprintf("q%d", p.byLabel[l].ID)
+			case splitLabels[l].q != nil:
+				target = fmt.Sprintf("q%d_o%d", splitLabels[l].q.ID, splitLabels[l].o.ID)
+			default:
+				// khoá cột của file JSON/Parquet (submitted_at, q12, q12_o3, ...)
+				target = l
+			}
+		}
+		if target == "" {
+			target = importSkip
+		}
+
+		switch target {
+		case importSkip:
+		case importSubmittedAt, importSubmissionID, importUserID, importEmail, importLanGui,
+			importQuestionID, importQuestion, importValue:
+			if prev, ok := used[target]; ok {
+				issues = append(issues, importIssue{Column: col.Header,
+					Message: fmt.Sprintf("đích %s đã được gán cho cột %d", target, prev)})
+				target = importSkip
+				break
+			}
+			used[target] = col.Index
+			p.meta[target] = i
+		default:
+			var qid, oid uint
+			if n, _ := fmt.Sscanf(target, "q%d_o%d", &qid, &oid); n == 2 {
+				q := p.questions[qid]
+				if q != nil {
+					for j := range q.LuaChons {
+						if q.LuaChons[j].ID == oid {
+							col.question, col.option = q, &q.LuaChons[j]
+						}
+					}
+				}
+			} else if n, _ := fmt.Sscanf(target, "q%d", &qid); n == 1 && target == fmt.Sprintf("q%d", qid) {
+				col.question = p.questions[qid]
+			}
+			if col.question == nil {
+				if manual {
+					issues = append(issues, importIssue{Column: col.Header, Message: "đích không hợp lệ: " + target})
+				}
+				target = importSkip
+				break
+			}
+			if col.option == nil {
+				if prev, ok := used[target]; ok {
+					issues = append(issues, importIssue{Column: col.Header,
+						Message: fmt.Sprintf("câu hỏi %s đã được gán cho cột %d", target, prev)})
+					target = importSkip
+					break
+				}
+				used[target] = col.Index
+			}
+		}
+		col.Target = target
+		p.cols = append(p.cols, col)
+	}
+
+	_, hasValue := p.meta[importValue]
+	_, hasQID := p.meta[importQuestionID]
+	_, hasQ := p.meta[importQuestion]
+	p.long = hasValue
+	if _, ok := p.meta[importSubmittedAt]; !ok {
+		issues = append(issues, importIssue{Message: "thiếu cột thời gian gửi (submitted_at)"})
+	}
+	if p.long {
+		if _, ok := p.meta[importSubmissionID]; !ok {
+			issues = append(issues, importIssue{Message: "bố cục long cần cột mã phản hồi (submission_id)"})
+		}
+		if !hasQID && !hasQ {
+			issues = append(issues, importIssue{Message: "bố cục long cần cột mã câu hỏi hoặc câu hỏi"})
+		}
+	}
+	return p, issues, nil
+}
+
+// unmapped: header của các cột bị bỏ qua
+func (p *importPlan) unmapped() []string {
+	out := []string{}
+	for _, c := range p.cols {
+		if c.Target == importSkip {
+			out = append(out, c.Header)
+		}
+	}
+	return out
+}
+
+// importRecord: một phản hồi đọc từ file
+type importRecord struct {
+	Row         int // dòng đầu tiên của phản hồi
+	cur         int // dòng đang đọc (bố cục long: mỗi câu trả lời một dòng)
+	Ref         string
+	SubmittedAt time.Time
+	UserID      *uint
+	Email       *string
+	LanGui      int
+	Answers     []models.CauTraLoi
+	Errors      []importIssue
+	Warnings    []importIssue
+
+	multi map[uint][]string // câu chọn nhiều ghi theo cột 0/1
+}
+
+func (r *importRecord) line() int {
+	if r.cur > 0 {
+		return r.cur
+	}
+	return r.Row
+}
+
+func (r *importRecord) fail(col, msg string) {
+	r.Errors = append(r.Errors, importIssue{Row: r.line(), Column: col, Message: msg})
+}
+
+func (r *importRecord) warn(col, msg string) {
+	r.Warnings = append(r.Warnings, importIssue{Row: r.line(), Column: col, Message: msg})
+}
+
+func cell(cells []string, i int) string {
+	if i < len(cells) {
+		return strings.TrimSpace(cells[i])
+	}
+	return ""
+}
+
+// readMeta đọc các cột metadata của dòng vào r
+func (p *importPlan) readMeta(r *importRecord, cells []string) {
+	if i, ok := p.meta[importSubmittedAt]; ok {
+		h := p.cols[i].Header
+		if v := cell(cells, i); v == "" {
+			r.fail(h, "thiếu thời gian gửi")
+		} else if t, err := services.ParseImportTime(v, p.layout, p.loc); err != nil {
+			r.fail(h, err.Error())
+		} else {
+			r.SubmittedAt = t
+		}
+	}
+	if i, ok := p.meta[importSubmissionID]; ok {
+		r.Ref = cell(cells, i)
+		if len(r.Ref) > 64 {
+			r.fail(p.cols[i].Header, "mã phản hồi dài quá 64 ký tự")
+		}
+	}
+	if i, ok := p.meta[importUserID]; ok {
+		if v := cell(cells, i); v != "" {
+			if n, err := strconv.ParseUint(v, 10, 64); err == nil && n > 0 {
+				id := uint(n)
+				r.UserID = &id
+			} else {
+				r.warn(p.cols[i].Header, "mã người dùng không hợp lệ, bỏ qua")
+			}
+		}
+	}
+	if i, ok := p.meta[importEmail]; ok {
+		if v := cell(cells, i); v != "" {
+			if len(v) > 100 || !strings.Contains(v, "@") {
+				r.warn(p.cols[i].Header, "email không hợp lệ, bỏ qua")
+			} else {
+				r.Email = &v
+			}
+		}
+	}
+	r.LanGui = 1
+	if i, ok := p.meta[importLanGui]; ok {
+		if v := cell(cells, i); v != "" {
+			if n, err := strconv.ParseFloat(v, 64); err == nil && n >= 1 && n == float64(int(n)) {
+				r.LanGui = int(n)
+			} else {
+				r.warn(p.cols[i].Header, "lần gửi không hợp lệ, dùng 1")
+			}
+		}
+	}
+}
+
+// wideRecord: bố cục wide, một dòng là một phản hồi
+func (p *importPlan) wideRecord(row int, cells []string) *importRecord {
+	r := &importRecord{Row: row}
+	p.readMeta(r, cells)
+	for i, c := range p.cols {
+		if c.question == nil {
+			continue
+		}
+		v := cell(cells, i)
+		if c.option != nil {
+			switch strings.ToLower(v) {
+			case "", "0", "false":
+			case "1", "true", "x":
+				if r.multi == nil {
+					r.multi = map[uint][]string{}
+				}
+				r.multi[c.question.ID] = append(r.multi[c.question.ID], c.option.NoiDung)
+			default:
+				r.fail(c.Header, fmt.Sprintf("giá trị %q không phải 0/1", v))
+			}
+			continue
+		}
+		p.addAnswer(r, c.Header, c.question, v)
+	}
+	p.finish(r)
+	return r
+}
+
+// finish gộp các cột 0/1 của câu chọn nhiều và sắp câu trả lời theo thứ tự câu hỏi
+func (p *importPlan) finish(r *importRecord) {
+	for qid, labels := range r.multi {
+		if r.hasAnswer(qid) {
+			r.fail("", fmt.Sprintf("câu hỏi %d có cả cột gộp và cột theo lựa chọn", qid))
+			continue
+		}
+		b, _ := json.Marshal(labels)
+		r.Answers = append(r.Answers, models.CauTraLoi{CauHoiID: qid, LuaChon: string(b)})
+	}
+	r.multi = nil
+	for i := 1; i < len(r.Answers); i++ {
+		for j := i; j > 0 && p.order[r.Answers[j].CauHoiID] < p.order[r.Answers[j-1].CauHoiID]; j-- {
+			r.Answers[j], r.Answers[j-1] = r.Answers[j-1], r.Answers[j]
+		}
+	}
+}
+
+func (r *importRecord) hasAnswer(qid uint) bool {
+	for _, a := range r.Answers {
+		if a.CauHoiID == qid {
+			return true
+		}
+	}
+	return false
+}
+
+// addAnswer chuyển giá trị ô thành câu trả lời theo loại câu hỏi (ô trống = không trả lời)
+func (p *importPlan) addAnswer(r *importRecord, col string, q *models.CauHoi, v string) {
+	if v == "" {
+		return
+	}
+	if r.hasAnswer(q.ID) {
+		r.fail(col, fmt.Sprintf("câu hỏi %d có nhiều hơn một câu trả lời", q.ID))
+		return
+	}
+	a := models.CauTraLoi{CauHoiID: q.ID}
+	switch strings.ToUpper(q.LoaiCauHoi) {
+	case "RATING":
+		if _, err := strconv.ParseFloat(v, 64); err != nil {
+			r.fail(col, fmt.Sprintf("điểm %q không phải số", v))
+			return
+		}
+		a.NoiDung = v
+
+	case "UPLOAD_FILE", "FILE_UPLOAD":
+		// chỉ giữ được link file; "[đã đính kèm]" hay đường dẫn trong ZIP thì không có file để nhập
+		if u, err := url.Parse(v); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			r.warn(col, "file đính kèm không nhập được, bỏ qua")
+			return
+		}
+		a.NoiDung = v
+
+	case "MULTIPLE_CHOICE":
+		labels, bad := p.matchOptions(q, v)
+		if bad != "" {
+			r.fail(col, fmt.Sprintf("lựa chọn %q không có trong câu hỏi", bad))
+			return
+		}
+		b, _ := json.Marshal(labels)
+		a.LuaChon = string(b)
+
+	case "SINGLE_CHOICE", "TRUE_FALSE":
+		label, ok := p.matchOption(q, v)
+		if !ok {
+			r.fail(col, fmt.Sprintf("lựa chọn %q không có trong câu hỏi", v))
+			return
+		}
+		// LuaChon (JSON array) là nơi file xuất đọc; SINGLE_CHOICE gửi qua form lưu ở NoiDung nên ghi cả hai
+		b, _ := json.Marshal([]string{label})
+		a.LuaChon = string(b)
+		if strings.ToUpper(q.LoaiCauHoi) == "SINGLE_CHOICE" {
+			a.NoiDung = label
+		}
+
+	default:
+		a.NoiDung = v
+	}
+	r.Answers = append(r.Answers, a)
+}
+
+// matchOption tìm lựa chọn theo nhãn (chính xác, rồi không phân biệt hoa thường/khoảng trắng) hoặc id.
+// Câu hỏi không có lựa chọn nào thì giữ nguyên giá trị.
+func (p *importPlan) matchOption(q *models.CauHoi, v string) (string, bool) {
+	if len(q.LuaChons) == 0 {
+		return v, true
+	}
+	byID := func() (string, bool) {
+		if id, err := strconv.ParseUint(v, 10, 64); err == nil {
+			for _, o := range q.LuaChons {
+				if uint64(o.ID) == id {
+					return o.NoiDung, true
+				}
+			}
+		}
+		return "", false
+	}
+	if p.values == services.ExportValuesIDs {
+		if l, ok := byID(); ok {
+			return l, true
+		}
+	}
+	for _, o := range q.LuaChons {
+		if o.NoiDung == v {
+			return o.NoiDung, true
+		}
+	}
+	n := normalizeLabel(v)
+	for _, o := range q.LuaChons {
+		if normalizeLabel(o.NoiDung) == n {
+			return o.NoiDung, true
+		}
+	}
+	return byID()
+}
+
+// matchOptions tách ô câu chọn nhiều (file xuất nối bằng ", "). Nhãn có thể chứa dấu phẩy
+// nên ghép dần các mảnh liền nhau cho tới khi khớp một lựa chọn; trả mảnh không khớp nếu có.
+func (p *importPlan) matchOptions(q *models.CauHoi, v string) ([]string, string) {
+	if l, ok := p.matchOption(q, v); ok {
+		return []string{l}, ""
+	}
+	parts := strings.Split(v, ",")
+	var out []string
+	for i := 0; i < len(parts); {
+		matched := false
+		for j := len(parts); j > i; j-- {
+			cand := strings.TrimSpace(strings.Join(parts[i:j], ","))
+			if cand == "" {
+				continue
+			}
+			if l, ok := p.matchOption(q, cand); ok {
+				out = append(out, l)
+				i, matched = j, true
+				break
+			}
+		}
+		if !matched {
+			if s := strings.TrimSpace(parts[i]); s != "" {
+				return nil, s
+			}
+			i++
+		}
+	}
+	return out, ""
+}
+
+// longQuestion: câu hỏi của một dòng bố cục long (theo mã câu hỏi, không có trong form thì theo nội dung)
+func (p *importPlan) longQuestion(cells []string) *models.CauHoi {
+	if i, ok := p.meta[importQuestionID]; ok {
+		if id, err := strconv.ParseFloat(cell(cells, i), 64); err == nil {
+			if q := p.questions[uint(id)]; q != nil {
+				return q
+			}
+		}
+	}
+	if i, ok := p.meta[importQuestion]; ok {
+		return p.byLabel[normalizeLabel(cell(cells, i))]
+	}
+	return nil
+}
+
+// importScanner đọc file thành từng phản hồi theo bố cục của plan
+type importScanner struct {
+	plan    *importPlan
+	r       services.ImportReader
+	row     int      // số dòng đã đọc (header = 1)
+	pending []string // dòng đã đọc trước (bố cục long)
+	pendRow int
+	seen    map[string]int // mã phản hồi → dòng đầu tiên
+	Rows    int            // số dòng dữ liệu
+}
+
+func newImportScanner(plan *importPlan, r services.ImportReader) *importScanner {
+	return &importScanner{plan: plan, r: r, row: 1, seen: map[string]int{}}
+}
+
+func (s *importScanner) read() ([]string, int, error) {
+	if s.pending != nil {
+		c, n := s.pending, s.pendRow
+		s.pending = nil
+		return c, n, nil
+	}
+	for {
+		c, err := s.r.Next()
+		if err != nil {
+			return nil, 0, err
+		}
+		s.row++
+		if blankRow(c) {
+			continue
+		}
+		s.Rows++
+		return c, s.row, nil
+	}
+}
+
+func blankRow(c []string) bool {
+	for _, v := range c {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Next trả phản hồi kế tiếp, io.EOF khi hết file
+func (s *importScanner) Next() (*importRecord, error) {
+	cells, row, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	p := s.plan
+	var r *importRecord
+	if !p.long {
+		r = p.wideRecord(row, cells)
+	} else {
+		// các dòng liền nhau cùng mã phản hồi thuộc một phản hồi
+		r = &importRecord{Row: row}
+		p.readMeta(r, cells)
+		valueCol := p.cols[p.meta[importValue]].Header
+		for {
+			r.cur = row
+			if q := p.longQuestion(cells); q == nil {
+				r.warn(valueCol, "không xác định được câu hỏi, bỏ qua")
+			} else {
+				p.addAnswer(r, valueCol, q, cell(cells, p.meta[importValue]))
+			}
+			next, nrow, err := s.read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if cell(next, p.meta[importSubmissionID]) != r.Ref {
+				s.pending, s.pendRow = next, nrow
+				break
+			}
+			cells, row = next, nrow
+		}
+		r.cur = 0
+		p.finish(r)
+		if r.Ref == "" {
+			r.fail("", "thiếu mã phản hồi")
+		}
+	}
+	if r.Ref != "" {
+		if first, ok := s.seen[r.Ref]; ok {
+			r.fail("", fmt.Sprintf("mã phản hồi %s trùng với dòng %d", r.Ref, first))
+		} else {
+			s.seen[r.Ref] = r.Row
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vnkhanh/survey-server/config"
+	"github.com/vnkhanh/survey-server/models"
+	"github.com/vnkhanh/survey-server/services"
+	"gorm.io/gorm"
+)
+
+// RegisterJobHandlers đăng ký các loại job nền và tác vụ định kỳ của controllers
+// (gọi trước services.StartJobWorkers và services.StartScheduler)
+func RegisterJobHandlers() {
+	services.RegisterJobHandler(jobKindExport, runExportJob, services.JobOptions{
+		Timeout:     2 * time.Minute,
+		MaxAttempts: 3,
+	})
+	services.RegisterJobHandler(jobKindExportDelivery, runExportDelivery, services.JobOptions{
+		Timeout:     5 * time.Minute,
+		MaxAttempts: 5,
+	})
+	services.RegisterJobHandler(jobKindImport, runImportJob, services.JobOptions{
+		Timeout:     5 * time.Minute,
+		MaxAttempts: 3,
+	})
+	services.RegisterTask("export_schedules", "* * * * *", runExportSchedules)
+}
+
+func parseJobID(c *gin.Context) (uint, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID không hợp lệ"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// GET /api/admin/jobs?kind=&status=
+func AdminListJobs(c *gin.Context) {
+	page, limit, offset := adminPaging(c)
+
+	q := config.DB.Model(&models.Job{})
+	if kind := c.Query("kind"); kind != "" {
+		q = q.Where("kind = ?", kind)
+	}
+	if st := c.Query("status"); st != "" {
+		q = q.Where("status = ?", st)
+	}
+	var total int64
+	q.Count(&total)
+
+	var jobs []models.Job
+	if err := q.Order("id DESC").Limit(limit).Offset(offset).Find(&jobs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể lấy danh sách job"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"jobs": jobs, "page": page, "limit": limit, "total": total})
+}
+
+// POST /api/admin/jobs/:id/cancel
+func AdminCancelJob(c *gin.Context) {
+	id, ok := parseJobID(c)
+	if !ok {
+		return
+	}
+	var job models.Job
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if job, err = services.CancelJob(tx, id); err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "job.cancel", "job", job.ID, gin.H{"kind": job.Kind, "status": job.Status})
+	}); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Job không tồn tại"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// POST /api/admin/jobs/:id/retry — chạy lại job đã thất bại/đã huỷ
+func AdminRetryJob(c *gin.Context) {
+	id, ok := parseJobID(c)
+	if !ok {
+		return
+	}
+	var job models.Job
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if job, err = services.RetryJob(tx, id); err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "job.retry", "job", job.ID, gin.H{"kind": job.Kind})
+	}); err != nil {
+		if job.ID == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Job không tồn tại"})
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// GET /api/admin/scheduled-tasks — lịch và kết quả lần chạy gần nhất của các tác vụ định kỳ
+func AdminListScheduledTasks(c *gin.Context) {
+	tasks, err := services.ScheduledTasks()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể lấy danh sách tác vụ"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tasks": tasks})
+}
+
+// POST /api/admin/scheduled-tasks/:name/run — chạy ngay, không chờ lịch
+func AdminRunScheduledTask(c *gin.Context) {
+	name := c.Param("name")
+	st, err := services.RunTaskNow(name)
+	switch {
+	case errors.Is(err, services.ErrTaskNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"message": "Tác vụ không tồn tại"})
+		return
+	case errors.Is(err, services.ErrTaskBusy):
+		c.JSON(http.StatusConflict, gin.H{"message": "Tác vụ đang chạy ở instance khác"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể chạy tác vụ"})
+		return
+	}
+	auditEvent(c, "task.run", "scheduled_task", name, gin.H{"last_error": st.LastError})
+	c.JSON(http.StatusOK, st)
+}
@@ -57,7 +57,12 @@ func AddQuestion(c *gin.Context) {
     q.PropsJSON = string(req.Props) // <-- LƯU
 	}
 
-	if err := config.DB.Create(&q).Error; err != nil {
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&q).Error; err != nil {
+			return err
+		}
+		return auditQuestion(c, tx, "question.create", q.ID, nil)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể thêm câu hỏi"})
 		return
 	}
@@ -98,7 +103,18 @@ func UpdateQuestion(c *gin.Context) {
         return
     }
 
-    if err := config.DB.Model(&q).Updates(updates).Error; err != nil {
+    // CheckQuestionEditor chỉ nạp vài cột → khoá và đọc đủ bản ghi trong transaction để ghi nhật ký
+    err := config.DB.Transaction(func(tx *gorm.DB) error {
+        before, err := lockQuestion(tx, q.ID)
+        if err != nil {
+            return err
+        }
+        if err := tx.Model(&q).Updates(updates).Error; err != nil {
+            return err
+        }
+        return auditQuestion(c, tx, "question.update", q.ID, before)
+    })
+    if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"message": "Cập nhật thất bại"})
         return
     }
@@ -112,6 +128,10 @@ func DeleteQuestion(c *gin.Context) {
     q := c.MustGet(middleware.CtxQuestion).(models.CauHoi)
 
     err := config.DB.Transaction(func(tx *gorm.DB) error {
+        before, err := lockQuestion(tx, q.ID)
+        if err != nil {
+            return err
+        }
         if err := tx.Delete(&q).Error; err != nil {
             return err
         }
@@ -121,7 +141,7 @@ func DeleteQuestion(c *gin.Context) {
             Update("thu_tu", gorm.Expr("thu_tu - 1")).Error; err != nil {
             return err
         }
-        return nil
+        return auditQuestion(c, tx, "question.delete", q.ID, before)
     })
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"message": "Xoá thất bại"})
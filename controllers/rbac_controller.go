@@ -0,0 +1,306 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vnkhanh/survey-server/config"
+	"github.com/vnkhanh/survey-server/models"
+	"github.com/vnkhanh/survey-server/services"
+	"gorm.io/gorm"
+)
+
+var roleNameRe = regexp.MustCompile(`^[a-z0-9_-]{2,50}$`)
+
+type roleReq struct {
+	Ten         string   `json:"ten"`
+	MoTa        *string  `json:"mo_ta"`
+	Permissions []string `json:"permissions"`
+}
+
+type userRolesReq struct {
+	Roles []string `json:"roles"`
+}
+
+// loadPermissions đổi danh sách mã quyền sang bản ghi, báo lỗi nếu có mã lạ
+func loadPermissions(tx *gorm.DB, codes []string) ([]models.Permission, error) {
+	perms := []models.Permission{}
+	if len(codes) == 0 {
+		return perms, nil
+	}
+	if err := tx.Where("ma IN ?", codes).Find(&perms).Error; err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool, len(perms))
+	for _, p := range perms {
+		found[p.Ma] = true
+	}
+	for _, code := range codes {
+		if !found[code] {
+			return nil, roleInputError("Quyền không tồn tại: " + code)
+		}
+	}
+	return perms, nil
+}
+
+// GET /api/admin/permissions
+func ListPermissions(c *gin.Context) {
+	var perms []models.Permission
+	if err := config.DB.Order("ma").Find(&perms).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể lấy danh sách quyền"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"permissions": perms})
+}
+
+// GET /api/admin/roles
+func ListRoles(c *gin.Context) {
+	var roles []models.Role
+	if err := config.DB.Preload("Permissions").Order("id").Find(&roles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể lấy danh sách vai trò"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+// POST /api/admin/roles — tạo vai trò tuỳ chỉnh
+func CreateRole(c *gin.Context) {
+	var req roleReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "Payload không hợp lệ", "error": err.Error()})
+		return
+	}
+	req.Ten = strings.ToLower(strings.TrimSpace(req.Ten))
+	if !roleNameRe.MatchString(req.Ten) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "Tên vai trò chỉ gồm a-z, 0-9, _ và - (2-50 ký tự)"})
+		return
+	}
+
+	role := models.Role{Ten: req.Ten}
+	if req.MoTa != nil {
+		role.MoTa = strings.TrimSpace(*req.MoTa)
+	}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var n int64
+		if err := tx.Model(&models.Role{}).Where("ten = ?", role.Ten).Count(&n).Error; err != nil {
+			return err
+		}
+		if n > 0 {
+			return errRoleExists
+		}
+		perms, err := loadPermissions(tx, req.Permissions)
+		if err != nil {
+			return err
+		}
+		role.Permissions = perms
+		if err := tx.Create(&role).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "role.create", "role", role.ID, gin.H{"ten": role.Ten, "permissions": req.Permissions})
+	})
+	if err != nil {
+		respondRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, role)
+}
+
+// PUT /api/admin/roles/:id — sửa mô tả/tập quyền (vai trò admin luôn có toàn bộ quyền)
+func UpdateRole(c *gin.Context) {
+	role, ok := findRole(c)
+	if !ok {
+		return
+	}
+	var req roleReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "Payload không hợp lệ", "error": err.Error()})
+		return
+	}
+	if role.Ten == models.RoleAdmin && req.Permissions != nil {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Không thể thay đổi quyền của vai trò admin"})
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if req.MoTa != nil {
+			if err := tx.Model(&role).Update("mo_ta", strings.TrimSpace(*req.MoTa)).Error; err != nil {
+				return err
+			}
+		}
+		if req.Permissions != nil {
+			perms, err := loadPermissions(tx, req.Permissions)
+			if err != nil {
+				return err
+			}
+			if err := services.GuardLastAdmin(tx, func() error {
+				return tx.Model(&role).Association("Permissions").Replace(perms)
+			}); err != nil {
+				return err
+			}
+		}
+		if err := recordAudit(c, tx, "role.update", "role", role.ID, gin.H{"mo_ta": req.MoTa, "permissions": req.Permissions}); err != nil {
+			return err
+		}
+		return tx.Preload("Permissions").First(&role, role.ID).Error
+	})
+	if err != nil {
+		respondRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, role)
+}
+
+// DELETE /api/admin/roles/:id — chỉ xoá được vai trò tuỳ chỉnh
+func DeleteRole(c *gin.Context) {
+	role, ok := findRole(c)
+	if !ok {
+		return
+	}
+	if role.HeThong {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Không thể xoá vai trò hệ thống"})
+		return
+	}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		err := services.GuardLastAdmin(tx, func() error {
+			if err := tx.Exec("DELETE FROM user_roles WHERE role_id = ?", role.ID).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&role).Association("Permissions").Clear(); err != nil {
+				return err
+			}
+			return tx.Delete(&role).Error
+		})
+		if err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "role.delete", "role", role.ID, gin.H{"ten": role.Ten})
+	})
+	if errors.Is(err, services.ErrLastAdmin) {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể xoá vai trò"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Đã xoá vai trò"})
+}
+
+// GET /api/admin/users/:id/roles
+func GetUserRoles(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+	var roles []models.Role
+	if err := config.DB.Model(&user).Association("Roles").Find(&roles); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể lấy vai trò"})
+		return
+	}
+	perms, err := services.UserPermissions(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể lấy quyền"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user_id": user.ID, "roles": roles, "permissions": perms})
+}
+
+// PUT /api/admin/users/:id/roles — gán lại toàn bộ vai trò cho user ({"roles": ["support"]})
+func SetUserRoles(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+	var req userRolesReq
+	if err := c.ShouldBindJSON(&req); err != nil || req.Roles == nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "Thiếu danh sách roles"})
+		return
+	}
+
+	var roles []models.Role
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if len(req.Roles) > 0 {
+			if err := tx.Where("ten IN ?", req.Roles).Find(&roles).Error; err != nil {
+				return err
+			}
+		}
+		found := make(map[string]bool, len(roles))
+		for _, r := range roles {
+			found[r.Ten] = true
+		}
+		for _, name := range req.Roles {
+			if !found[name] {
+				return roleInputError("Vai trò không tồn tại: " + name)
+			}
+		}
+		if err := services.GuardLastAdmin(tx, func() error {
+			return services.SetUserRoles(tx, user.ID, roles)
+		}); err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "user.set_roles", "user", user.ID, gin.H{"roles": req.Roles})
+	})
+	if err != nil {
+		respondRoleError(c, err)
+		return
+	}
+
+	names := make([]string, 0, len(roles))
+	for _, r := range roles {
+		names = append(names, r.Ten)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Đã cập nhật vai trò", "user_id": user.ID, "roles": names})
+}
+
+var errRoleExists = errors.New("Vai trò đã tồn tại")
+
+// roleInputError: lỗi do dữ liệu gửi lên (quyền/vai trò không tồn tại) → 422
+type roleInputError string
+
+func (e roleInputError) Error() string { return string(e) }
+
+func respondRoleError(c *gin.Context, err error) {
+	var inputErr roleInputError
+	switch {
+	case errors.Is(err, errRoleExists):
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+	case errors.Is(err, services.ErrLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+	case errors.As(err, &inputErr):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể cập nhật vai trò"})
+	}
+}
+
+func findRole(c *gin.Context) (models.Role, bool) {
+	var role models.Role
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID không hợp lệ"})
+		return role, false
+	}
+	if err := config.DB.First(&role, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Vai trò không tồn tại"})
+		return role, false
+	}
+	return role, true
+}
+
+func findUserParam(c *gin.Context) (models.NguoiDung, bool) {
+	var user models.NguoiDung
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID không hợp lệ"})
+		return user, false
+	}
+	if err := config.DB.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Người dùng không tồn tại"})
+		return user, false
+	}
+	return user, true
+}
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/vnkhanh/survey-server/models"
+	"github.com/vnkhanh/survey-server/utils"
+)
+
+// Khoá advisory (pg_advisory_xact_lock) dùng khi kiểm tra gửi trùng: (namespace, form id)
+const duplicateLockNamespace = 36
+
+// respondentID đọc cookie định danh trình duyệt; chưa có/không hợp lệ thì cấp cookie mới
+func respondentID(c *gin.Context) string {
+	if v, err := c.Cookie(utils.RespondentCookie); err == nil {
+		if id, ok := utils.VerifyRespondentCookie(v); ok {
+			return id
+		}
+	}
+	id, value, err := utils.NewRespondentCookie()
+	if err != nil {
+		return ""
+	}
+	// FE chạy khác domain với API → cần SameSite=None + Secure để trình duyệt gửi lại cookie
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     utils.RespondentCookie,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   365 * 24 * 3600,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteNoneMode,
+	})
+	return id
+}
+
+// duplicateError: phản hồi bị chặn vì đã gửi trước đó
+type duplicateError struct {
+	Code    string
+	Message string
+}
+
+func (e *duplicateError) Error() string { return e.Message }
+
+// checkDuplicate kiểm tra các cơ chế chống gửi trùng đang bật của form.
+// Gọi trong transaction: khoá theo form để hai request song song không cùng lọt qua.
+func checkDuplicate(tx *gorm.DB, formID uint, cfg utils.DuplicateConfig, rid, ipHash string, email *string) error {
+	if !cfg.OnePerBrowser && !cfg.OnePerIP && !cfg.OnePerEmail {
+		return nil
+	}
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?, ?)", duplicateLockNamespace, formID).Error; err != nil {
+		return err
+	}
+
+	exists := func(q *gorm.DB) (bool, error) {
+		var n int64
+		err := q.Model(&models.PhanHoi{}).Where("khao_sat_id = ?", formID).Limit(1).Count(&n).Error
+		return n > 0, err
+	}
+
+	if cfg.OnePerBrowser && rid != "" {
+		dup, err := exists(tx.Where("respondent_id = ?", rid))
+		if err != nil {
+			return err
+		}
+		if dup {
+			return &duplicateError{Code: "duplicate_browser", Message: "Bạn đã trả lời khảo sát này"}
+		}
+	}
+	if cfg.OnePerIP {
+		dup, err := exists(tx.Where("ip_hash = ? AND ngay_gui > ?", ipHash, time.Now().Add(-cfg.IPWindow)))
+		if err != nil {
+			return err
+		}
+		if dup {
+			return &duplicateError{Code: "duplicate_ip", Message: "Đã có phản hồi từ mạng của bạn, vui lòng thử lại sau"}
+		}
+	}
+	if cfg.OnePerEmail && email != nil {
+		dup, err := exists(tx.Where("LOWER(email) = ?", strings.ToLower(strings.TrimSpace(*email))))
+		if err != nil {
+			return err
+		}
+		if dup {
+			return &duplicateError{Code: "duplicate_email", Message: "Email này đã trả lời khảo sát"}
+		}
+	}
+	return nil
+}
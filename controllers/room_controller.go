@@ -16,6 +16,7 @@ import (
 	"github.com/vnkhanh/survey-server/utils"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // BE-12: tạo room
@@ -66,7 +67,12 @@ func CreateRoom(c *gin.Context) {
 		ShareURL:   shareURL,
 	}
 
-	if err := config.DB.Create(&room).Error; err != nil {
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&room).Error; err != nil {
+			return err
+		}
+		return auditRoom(c, tx, "room.create", room.ID, nil)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không tạo được room"})
 		return
 	}
@@ -270,6 +276,7 @@ func UpdateRoom(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Dữ liệu không hợp lệ"})
 		return
 	}
+	before := room
 
 	// update từng field nếu có
 	if req.TenRoom != nil {
@@ -294,7 +301,12 @@ func UpdateRoom(c *gin.Context) {
 		room.KhaoSatID = *req.KhaoSatID
 	}
 
-	if err := config.DB.Save(&room).Error; err != nil {
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&room).Error; err != nil {
+			return err
+		}
+		return auditRoom(c, tx, "room.update", room.ID, &before)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không cập nhật được room"})
 		return
 	}
@@ -348,6 +360,12 @@ func DeleteRoom(c *gin.Context) {
 		return
 	}
 
+	if err := auditRoom(c, tx, "room.delete", room.ID, &room); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể ghi nhật ký"})
+		return
+	}
+
 	// Commit transaction
 	if err := tx.Commit().Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -373,12 +391,19 @@ func ArchiveRoom(c *gin.Context) {
 		return
 	}
 
+	before := room
+
 	// Đánh dấu archived (archived)
 	room.TrangThai = "archived"
 	falseVal := false
 	room.IsPublic = &falseVal
 
-	if err := config.DB.Save(&room).Error; err != nil {
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&room).Error; err != nil {
+			return err
+		}
+		return auditRoom(c, tx, "room.archive", room.ID, &before)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Đã lưu trữ room"})
 		return
 	}
@@ -396,11 +421,22 @@ func RestoreRoom(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Room đã được khôi phục rồi"})
 		return
 	}
+	if room.ForceArchivedAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Room đã bị quản trị viên lưu trữ, không thể tự khôi phục"})
+		return
+	}
+
+	before := room
 
 	// Đánh dấu restored (restored)
 	room.TrangThai = "active"
 
-	if err := config.DB.Save(&room).Error; err != nil {
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&room).Error; err != nil {
+			return err
+		}
+		return auditRoom(c, tx, "room.restore", room.ID, &before)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Đã khôi phục room"})
 		return
 	}
@@ -488,10 +524,16 @@ func SetRoomPassword(c *gin.Context) {
 	pwd := string(hash)
 
 	// Cập nhật room
+	before := room
 	room.MatKhau = &pwd
 	room.Khoa = false
 
-	if err := config.DB.Save(&room).Error; err != nil {
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&room).Error; err != nil {
+			return err
+		}
+		return auditRoom(c, tx, "room.password.set", room.ID, &before)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không đặt được mật khẩu"})
 		return
 	}
@@ -502,14 +544,19 @@ func SetRoomPassword(c *gin.Context) {
 // BE-18: gỡ mật khẩu room
 func RemoveRoomPassword(c *gin.Context) {
 	room := c.MustGet("roomObj").(models.Room)
+	before := room
 
 	room.MatKhau = nil
 	room.Khoa = false
 	if room.TrangThai == "locked" {
 		room.TrangThai = "active"
 	}
-	config.DB.Save(&room)
-	if err := config.DB.Save(&room).Error; err != nil {
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&room).Error; err != nil {
+			return err
+		}
+		return auditRoom(c, tx, "room.password.remove", room.ID, &before)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không gỡ được mật khẩu"})
 		return
 	}
@@ -544,8 +591,14 @@ func ShareRoom(c *gin.Context) {
 
 	// tạo shareURL nếu chưa có
 	if room.ShareURL == "" {
+		before := room
 		room.ShareURL = uuid.NewString()
-		if err := config.DB.Save(&room).Error; err != nil {
+		if err := config.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(&room).Error; err != nil {
+				return err
+			}
+			return auditRoom(c, tx, "room.share", room.ID, &before)
+		}); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"message": "Không tạo được share link"})
 			return
 		}
@@ -623,10 +676,15 @@ func EnterRoomByShareURL(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Vui lòng nhập mật khẩu"})
 			return
 		}
+		keys := roomThrottleKeys(c, room.ID, user.ID)
+		if throttleBlocked(c, "room", room.ID, msgRoomLocked, keys...) {
+			return
+		}
 		if !utils.CheckPassword(*room.MatKhau, body.Password) {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Sai mật khẩu"})
 			return
 		}
+		throttlePassed(keys[:1], keys[1:]...)
 	}
 
 	// Kiểm tra user đã là thành viên chưa
@@ -831,6 +889,12 @@ func EnterRoom(c *gin.Context) {
 			return
 		}
 		
+		// Chống dò mật khẩu room
+		keys := roomThrottleKeys(c, room.ID, user.ID)
+		if throttleBlocked(c, "room", room.ID, msgRoomLocked, keys...) {
+			return
+		}
+
 		// Kiểm tra mật khẩu
 		if !utils.CheckPassword(*room.MatKhau, body.Password) {
 			c.JSON(http.StatusUnauthorized, gin.H{
@@ -839,6 +903,7 @@ func EnterRoom(c *gin.Context) {
 			})
 			return
 		}
+		throttlePassed(keys[:1], keys[1:]...)
 	}
 
 	// Kiểm tra user đã là thành viên chưa
@@ -959,7 +1024,12 @@ func InviteUserToRoom(c *gin.Context) {
 		CreatedAt: time.Now(),
 	}
 
-	if err := config.DB.Create(&invite).Error; err != nil {
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&invite).Error; err != nil {
+			return err
+		}
+		return recordChange(c, tx, "invite.create", "room_invite", invite.ID, nil, invite)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":    "Không thể gửi lời mời",
 			"db_error": err.Error(),
@@ -1031,20 +1101,36 @@ func RespondToInvite(c *gin.Context) {
 		return
 	}
 
+	if invite.Status == "expired" {
+		c.JSON(http.StatusGone, gin.H{"error": "Lời mời đã hết hạn"})
+		return
+	}
+
+	before := invite
 	invite.Status = body.Status
-	config.DB.Save(&invite)
-
-	// Nếu user chấp nhận thì thêm vào RoomNguoiThamGia
-	if body.Status == "accepted" {
-		member := models.RoomNguoiThamGia{
-			RoomID:       invite.RoomID,
-			NguoiDungID:  invite.UserID,
-			TenNguoiDung: invite.Email, // hoặc lấy từ bảng NguoiDung
-			TrangThai:    "active",
-			IP:           c.ClientIP(),
-			NgayVao:      time.Now(),
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&invite).Error; err != nil {
+			return err
 		}
-		config.DB.Create(&member)
+
+		// Nếu user chấp nhận thì thêm vào RoomNguoiThamGia
+		if body.Status == "accepted" {
+			member := models.RoomNguoiThamGia{
+				RoomID:       invite.RoomID,
+				NguoiDungID:  invite.UserID,
+				TenNguoiDung: invite.Email, // hoặc lấy từ bảng NguoiDung
+				TrangThai:    "active",
+				IP:           c.ClientIP(),
+				NgayVao:      time.Now(),
+			}
+			if err := tx.Create(&member).Error; err != nil {
+				return err
+			}
+		}
+		return recordChange(c, tx, "invite.respond", "room_invite", invite.ID, before, invite)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể phản hồi lời mời"})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -1057,7 +1143,19 @@ func RespondToInvite(c *gin.Context) {
 func DeleteInvite(c *gin.Context) {
 	inviteID := c.Param("inviteID")
 
-	if err := config.DB.Delete(&models.RoomInvite{}, inviteID).Error; err != nil {
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var before models.RoomInvite
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&before, inviteID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		if err := tx.Delete(&before).Error; err != nil {
+			return err
+		}
+		return recordChange(c, tx, "invite.delete", "room_invite", before.ID, before, nil)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể xóa lời mời"})
 		return
 	}
@@ -1111,17 +1209,22 @@ func RemoveMemberFromRoom(c *gin.Context) {
 		return
 	}
 
-	// Thử xóa theo record ID trước
-	result := config.DB.Where("id = ? AND room_id = ?", memberIDUint, roomIDUint).
-		Delete(&models.RoomNguoiThamGia{})
-
-	// Nếu không tìm thấy theo record ID, thử xóa theo user_id
-	if result.RowsAffected == 0 {
-		result = config.DB.Where("nguoi_dung_id = ? AND room_id = ?", memberIDUint, roomIDUint).
+	var result *gorm.DB
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// Thử xóa theo record ID trước
+		result = tx.Where("id = ? AND room_id = ?", memberIDUint, roomIDUint).
 			Delete(&models.RoomNguoiThamGia{})
-	}
 
-	if result.Error != nil {
+		// Nếu không tìm thấy theo record ID, thử xóa theo user_id
+		if result.Error == nil && result.RowsAffected == 0 {
+			result = tx.Where("nguoi_dung_id = ? AND room_id = ?", memberIDUint, roomIDUint).
+				Delete(&models.RoomNguoiThamGia{})
+		}
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return recordAudit(c, tx, "room.member.remove", "room", roomIDUint, gin.H{"member_id": memberIDUint})
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không xóa được thành viên"})
 		return
 	}
@@ -1290,8 +1393,14 @@ func LockRoom(c *gin.Context) {
 	}
 
 	// ✅ Thực hiện khóa
+	before := room
 	room.IsLocked = true
-	if err := config.DB.Save(&room).Error; err != nil {
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&room).Error; err != nil {
+			return err
+		}
+		return auditRoom(c, tx, "room.lock", room.ID, &before)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể khóa room"})
 		return
 	}
@@ -1335,8 +1444,14 @@ func UnlockRoom(c *gin.Context) {
 	}
 
 	// Cập nhật trạng thái
+	before := room
 	room.IsLocked = false
-	if err := config.DB.Save(&room).Error; err != nil {
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&room).Error; err != nil {
+			return err
+		}
+		return auditRoom(c, tx, "room.unlock", room.ID, &before)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể mở khóa room"})
 		return
 	}
@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/vnkhanh/survey-server/config"
+	"github.com/vnkhanh/survey-server/models"
+	"github.com/vnkhanh/survey-server/services"
+	"github.com/vnkhanh/survey-server/utils"
+)
+
+// formAntiSpam đọc cấu hình chống spam của form (settings lỗi → mặc định)
+func formAntiSpam(f models.KhaoSat) utils.AntiSpamConfig {
+	if s, err := utils.ParseSettings([]byte(f.SettingsJSON)); err == nil {
+		return s.AntiSpam.Resolve()
+	}
+	var def *utils.AntiSpamSettings
+	return def.Resolve()
+}
+
+// PATCH /api/forms/:id/submissions/:sub_id/spam — owner đánh dấu / bỏ đánh dấu spam
+func MarkSubmissionSpam(c *gin.Context) {
+	f := c.MustGet("formObj").(models.KhaoSat)
+
+	var req struct {
+		IsSpam *bool `json:"is_spam" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "Thiếu is_spam"})
+		return
+	}
+
+	var sub models.PhanHoi
+	if err := config.DB.Where("id = ? AND khao_sat_id = ?", c.Param("sub_id"), f.ID).First(&sub).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Phản hồi không tồn tại"})
+		return
+	}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&sub).Update("is_spam", *req.IsSpam).Error; err != nil {
+			return err
+		}
+		return recordChange(c, tx, "submission.spam.update", "submission", sub.ID,
+			gin.H{"is_spam": sub.IsSpam}, gin.H{"is_spam": *req.IsSpam})
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Cập nhật thất bại"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": sub.ID, "is_spam": *req.IsSpam})
+}
+
+// DELETE /api/forms/:id/submissions/spam?min_score= — xoá các phản hồi bị đánh dấu spam
+// (hoặc có điểm >= min_score) cùng câu trả lời và file đính kèm, trừ lại so_phan_hoi
+func PurgeSpamSubmissions(c *gin.Context) {
+	f := c.MustGet("formObj").(models.KhaoSat)
+
+	q := config.DB.Model(&models.PhanHoi{}).Where("khao_sat_id = ?", f.ID)
+	if v := c.Query("min_score"); v != "" {
+		score, err := strconv.Atoi(v)
+		if err != nil || score < 1 || score > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "min_score phải trong khoảng 1-100"})
+			return
+		}
+		q = q.Where("spam_score >= ?", score)
+	} else {
+		q = q.Where("is_spam = ?", true)
+	}
+
+	var ids []uint
+	if err := q.Pluck("id", &ids).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể lấy danh sách phản hồi"})
+		return
+	}
+	if len(ids) == 0 {
+		c.JSON(http.StatusOK, gin.H{"deleted": 0})
+		return
+	}
+
+	var uploads []string // file đính kèm của các phản hồi bị xoá, xoá khỏi kho sau khi commit
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table("cau_tra_loi AS ctl").
+			Joins("JOIN cau_hoi ch ON ch.id = ctl.cau_hoi_id").
+			Where("ctl.phan_hoi_id IN ? AND ctl.noi_dung <> ''", ids).
+			Where("UPPER(ch.loai_cau_hoi) IN ?", []string{"UPLOAD_FILE", "FILE_UPLOAD"}).
+			Pluck("ctl.noi_dung", &uploads).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("phan_hoi_id IN ?", ids).Delete(&models.CauTraLoi{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id IN ?", ids).Delete(&models.PhanHoi{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.KhaoSat{}).Where("id = ?", f.ID).
+			UpdateColumn("so_phan_hoi", gorm.Expr("GREATEST(so_phan_hoi - ?, 0)", len(ids))).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "submission.spam.purge", "form", f.ID, gin.H{
+			"deleted":   len(ids),
+			"min_score": c.Query("min_score"),
+		})
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Xoá thất bại"})
+		return
+	}
+	services.DeleteAnswerUploads(context.WithoutCancel(c.Request.Context()), uploads)
+	c.JSON(http.StatusOK, gin.H{"deleted": len(ids)})
+}
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vnkhanh/survey-server/config"
+	"github.com/vnkhanh/survey-server/models"
+	"github.com/vnkhanh/survey-server/services"
+)
+
+// submissionFileURL: endpoint tải file của câu trả lời upload (thay cho URL công khai)
+func submissionFileURL(formID, submissionID, questionID uint) string {
+	return fmt.Sprintf("/api/forms/%d/submissions/%d/files/%d", formID, submissionID, questionID)
+}
+
+// uploadQuestionIDs: các câu hỏi upload của form
+func uploadQuestionIDs(formID uint) map[uint]bool {
+	var ids []uint
+	config.DB.Model(&models.CauHoi{}).
+		Where("khao_sat_id = ? AND UPPER(loai_cau_hoi) IN ?", formID, []string{"UPLOAD_FILE", "FILE_UPLOAD"}).
+		Pluck("id", &ids)
+	out := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		out[id] = true
+	}
+	return out
+}
+
+// answerJSON: câu trả lời trong danh sách/chi tiết phản hồi; câu upload không trả key trong kho,
+// chỉ kèm file_url tải qua DownloadSubmissionFile
+func answerJSON(formID, submissionID uint, a models.CauTraLoi, uploads map[uint]bool) gin.H {
+	h := gin.H{
+		"cau_hoi_id": a.CauHoiID,
+		"noi_dung":   a.NoiDung,
+		"lua_chon":   a.LuaChon,
+	}
+	if uploads[a.CauHoiID] && a.NoiDung != "" {
+		h["noi_dung"] = services.UploadRefForClient(a.NoiDung)
+		h["file_url"] = submissionFileURL(formID, submissionID, a.CauHoiID)
+	}
+	return h
+}
+
+// GET /api/forms/:id/submissions/:sub_id/files/:question_id
+// Kiểm tra quyền xem phản hồi rồi chuyển hướng tới link ký ngắn hạn (FILE_LINK_TTL) của file đã nộp
+func DownloadSubmissionFile(c *gin.Context) {
+	formID, err1 := strconv.ParseUint(c.Param("id"), 10, 64)
+	subID, err2 := strconv.ParseUint(c.Param("sub_id"), 10, 64)
+	questionID, err3 := strconv.ParseUint(c.Param("question_id"), 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID không hợp lệ"})
+		return
+	}
+
+	var ks models.KhaoSat
+	if err := config.DB.Where("id = ? AND trang_thai <> 'deleted'", formID).First(&ks).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Form không tồn tại"})
+		return
+	}
+	var sub models.PhanHoi
+	if err := config.DB.Where("id = ? AND khao_sat_id = ?", subID, formID).First(&sub).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Phản hồi không tồn tại"})
+		return
+	}
+	if !checkViewSubmission(c, ks, sub) {
+		return
+	}
+
+	var q models.CauHoi
+	if err := config.DB.Where("id = ? AND khao_sat_id = ?", questionID, formID).First(&q).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Câu hỏi không tồn tại"})
+		return
+	}
+	switch strings.ToUpper(q.LoaiCauHoi) {
+	case "UPLOAD_FILE", "FILE_UPLOAD":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Câu hỏi không phải dạng tải file"})
+		return
+	}
+	var ans models.CauTraLoi
+	if err := config.DB.Where("phan_hoi_id = ? AND cau_hoi_id = ?", subID, questionID).First(&ans).Error; err != nil ||
+		strings.TrimSpace(ans.NoiDung) == "" {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Không có file"})
+		return
+	}
+
+	link, err := services.UploadDownloadURL(c.Request.Context(), ans.NoiDung)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không tạo được link tải file"})
+		return
+	}
+	auditEvent(c, "submission.file_download", "form", ks.ID, gin.H{
+		"submission_id": sub.ID,
+		"question_id":   q.ID,
+	})
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, link)
+}
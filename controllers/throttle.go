@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vnkhanh/survey-server/models"
+	"github.com/vnkhanh/survey-server/services"
+)
+
+// respondLocked trả 429 kèm Retry-After (giây, làm tròn lên)
+func respondLocked(c *gin.Context, wait time.Duration, message string) {
+	secs := int(math.Ceil(wait.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(secs))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"message":     message,
+		"retry_after": secs,
+	})
+}
+
+// throttleBlocked tính trước lần thử này cho các key (services.ThrottleAttempt); nếu bị từ chối
+// thì ghi nhật ký cho các key vừa bị khoá, trả 429 và báo true
+func throttleBlocked(c *gin.Context, targetType string, targetID interface{}, message string, keys ...services.ThrottleKey) bool {
+	wait, locks, err := services.ThrottleAttempt(keys...)
+	if err != nil {
+		// Không đọc được bộ đếm thì không chặn người dùng hợp lệ
+		log.Printf("[throttle] attempt: %v", err)
+		return false
+	}
+	for _, l := range locks {
+		auditEvent(c, l.Policy.AuditAction, targetType, targetID, gin.H{
+			"scope":        l.Policy.Scope,
+			"key":          l.Key,
+			"lockouts":     l.Lockouts,
+			"locked_until": l.LockedUntil,
+		})
+	}
+	if wait > 0 {
+		respondLocked(c, wait, message)
+		return true
+	}
+	return false
+}
+
+// throttlePassed: lần thử đúng → xoá bộ đếm của reset, trả lại lượt đã tính cho refund
+func throttlePassed(reset []services.ThrottleKey, refund ...services.ThrottleKey) {
+	if err := services.ThrottleReset(reset...); err != nil {
+		log.Printf("[throttle] reset: %v", err)
+	}
+	if err := services.ThrottleRefund(refund...); err != nil {
+		log.Printf("[throttle] refund: %v", err)
+	}
+}
+
+// Key cho đăng nhập bằng mật khẩu: khoá chặt theo email+IP, giới hạn mềm theo email và theo IP
+func loginThrottleKeys(c *gin.Context, email string) (accountIP, account, ip services.ThrottleKey) {
+	pair := c.ClientIP() + "|" + email
+	if len(pair) > 255 {
+		pair = pair[:255]
+	}
+	return services.NewThrottleKey(models.ThrottleLoginAccountIP, pair),
+		services.NewThrottleKey(models.ThrottleLoginAccount, email),
+		services.NewThrottleKey(models.ThrottleLoginIP, c.ClientIP())
+}
+
+// Key cho mật khẩu room: theo (room, user) và (room, IP)
+func roomThrottleKeys(c *gin.Context, roomID, userID uint) []services.ThrottleKey {
+	rid := strconv.FormatUint(uint64(roomID), 10)
+	return []services.ThrottleKey{
+		services.NewThrottleKey(models.ThrottleRoomUser, rid+":"+strconv.FormatUint(uint64(userID), 10)),
+		services.NewThrottleKey(models.ThrottleRoomIP, rid+":"+c.ClientIP()),
+	}
+}
+
+const (
+	msgLoginLocked = "Bạn đã thử sai quá nhiều lần, vui lòng thử lại sau"
+	msgRoomLocked  = "Nhập sai mật khẩu quá nhiều lần, vui lòng thử lại sau"
+)
@@ -0,0 +1,259 @@
+package controllers
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/vnkhanh/survey-server/config"
+	"github.com/vnkhanh/survey-server/middleware"
+	"github.com/vnkhanh/survey-server/models"
+	"github.com/vnkhanh/survey-server/services"
+	"github.com/vnkhanh/survey-server/utils"
+)
+
+const (
+	twoFactorChallengeTTL = 5 * time.Minute
+	recoveryCodeCount     = 10
+)
+
+type twoFactorCodeReq struct {
+	Code         string `json:"code"`          // mã 6 số từ ứng dụng authenticator
+	RecoveryCode string `json:"recovery_code"` // hoặc mã khôi phục
+}
+
+type twoFactorVerifyReq struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	twoFactorCodeReq
+}
+
+// POST /api/auth/2fa/setup — sinh secret mới (chưa bật cho đến khi xác nhận bằng mã)
+func SetupTwoFactor(c *gin.Context) {
+	u := c.MustGet(middleware.CtxUser).(models.NguoiDung)
+	if u.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"message": "Tài khoản đã bật xác thực 2 lớp"})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể sinh secret"})
+		return
+	}
+	if err := config.DB.Model(&models.NguoiDung{}).Where("id = ?", u.ID).
+		Updates(map[string]interface{}{"totp_secret": secret, "totp_last_step": 0}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể lưu secret"})
+		return
+	}
+
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = "Survey"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"secret":           secret,
+		"provisioning_uri": utils.TOTPProvisioningURI(issuer, u.Email, secret),
+	})
+}
+
+// POST /api/auth/2fa/enable — xác nhận mã đầu tiên, bật 2FA và trả về bộ mã khôi phục
+func EnableTwoFactor(c *gin.Context) {
+	u := c.MustGet(middleware.CtxUser).(models.NguoiDung)
+	if u.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"message": "Tài khoản đã bật xác thực 2 lớp"})
+		return
+	}
+	if u.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Chưa khởi tạo 2FA, gọi /api/auth/2fa/setup trước"})
+		return
+	}
+
+	var req twoFactorCodeReq
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "Thiếu mã xác thực"})
+		return
+	}
+	step, ok := utils.VerifyTOTP(u.TOTPSecret, req.Code, u.TOTPLastStep, time.Now())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Mã xác thực không đúng"})
+		return
+	}
+
+	var codes []string
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.NguoiDung{}).Where("id = ?", u.ID).
+			Updates(map[string]interface{}{"totp_enabled": true, "totp_last_step": step}).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, u.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể bật 2FA"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Đã bật xác thực 2 lớp",
+		"recovery_codes": codes,
+	})
+}
+
+// POST /api/auth/2fa/disable — tắt 2FA (cần mã hiện tại hoặc mã khôi phục)
+func DisableTwoFactor(c *gin.Context) {
+	u := c.MustGet(middleware.CtxUser).(models.NguoiDung)
+	if !u.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Tài khoản chưa bật xác thực 2 lớp"})
+		return
+	}
+	perms, err := services.UserPermissions(u.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể đọc quyền"})
+		return
+	}
+	if middleware.PrivilegedUser(u, perms) && middleware.AdminRequires2FA() {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Tài khoản có quyền quản trị bắt buộc bật xác thực 2 lớp"})
+		return
+	}
+
+	var req twoFactorCodeReq
+	_ = c.ShouldBindJSON(&req)
+	if !checkSecondFactor(u, req) {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Mã xác thực không đúng"})
+		return
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.NguoiDung{}).Where("id = ?", u.ID).
+			Updates(map[string]interface{}{"totp_enabled": false, "totp_secret": "", "totp_last_step": 0}).Error; err != nil {
+			return err
+		}
+		return tx.Where("nguoi_dung_id = ?", u.ID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể tắt 2FA"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Đã tắt xác thực 2 lớp"})
+}
+
+// POST /api/auth/2fa/recovery-codes — sinh lại bộ mã khôi phục (mã cũ bị vô hiệu)
+func RegenerateRecoveryCodes(c *gin.Context) {
+	u := c.MustGet(middleware.CtxUser).(models.NguoiDung)
+	if !u.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Tài khoản chưa bật xác thực 2 lớp"})
+		return
+	}
+
+	var req twoFactorCodeReq
+	_ = c.ShouldBindJSON(&req)
+	if req.Code == "" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "Thiếu mã xác thực"})
+		return
+	}
+	if !checkSecondFactor(u, twoFactorCodeReq{Code: req.Code}) {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Mã xác thực không đúng"})
+		return
+	}
+
+	var codes []string
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, u.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể sinh mã khôi phục"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// POST /api/auth/2fa/verify — bước 2 của đăng nhập: đổi challenge_token + mã lấy JWT
+func VerifyTwoFactorLogin(c *gin.Context) {
+	var req twoFactorVerifyReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "Thiếu challenge_token"})
+		return
+	}
+
+	claims, err := utils.VerifyChallengeToken(req.ChallengeToken, utils.PurposeTwoFactor)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Phiên xác thực đã hết hạn, vui lòng đăng nhập lại"})
+		return
+	}
+	uid, err := strconv.ParseUint(claims.UserID, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid subject"})
+		return
+	}
+
+	var u models.NguoiDung
+	if err := config.DB.First(&u, uid).Error; err != nil || !u.TOTPEnabled || claims.Version != u.TokenVersion {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Phiên xác thực không hợp lệ"})
+		return
+	}
+	if u.DisabledAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Tài khoản đã bị khoá"})
+		return
+	}
+
+	// Mã 6 số dễ bị dò → đếm lần sai theo user
+	key := services.NewThrottleKey(models.ThrottleTwoFactor, claims.UserID)
+	if throttleBlocked(c, "user", u.ID, msgLoginLocked, key) {
+		return
+	}
+	if !checkSecondFactor(u, req.twoFactorCodeReq) {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Mã xác thực không đúng"})
+		return
+	}
+	throttlePassed([]services.ThrottleKey{key})
+
+	issueSession(c, u)
+}
+
+// checkSecondFactor kiểm tra mã TOTP (ghi lại bước đã dùng) hoặc tiêu thụ một mã khôi phục
+func checkSecondFactor(u models.NguoiDung, req twoFactorCodeReq) bool {
+	if req.Code != "" {
+		step, ok := utils.VerifyTOTP(u.TOTPSecret, req.Code, u.TOTPLastStep, time.Now())
+		if !ok {
+			return false
+		}
+		// Điều kiện totp_last_step < step để 2 request song song không dùng chung một mã
+		res := config.DB.Model(&models.NguoiDung{}).
+			Where("id = ? AND totp_last_step < ?", u.ID, step).
+			Update("totp_last_step", step)
+		return res.Error == nil && res.RowsAffected == 1
+	}
+
+	if req.RecoveryCode != "" {
+		res := config.DB.Model(&models.RecoveryCode{}).
+			Where("nguoi_dung_id = ? AND code_hash = ? AND used_at IS NULL", u.ID, utils.HashRecoveryCode(req.RecoveryCode)).
+			Update("used_at", time.Now())
+		return res.Error == nil && res.RowsAffected == 1
+	}
+	return false
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Where("nguoi_dung_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	rows := make([]models.RecoveryCode, 0, len(codes))
+	for _, code := range codes {
+		rows = append(rows, models.RecoveryCode{NguoiDungID: userID, CodeHash: utils.HashRecoveryCode(code)})
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
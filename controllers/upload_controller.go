@@ -2,36 +2,100 @@ package controllers
 
 import (
 	"fmt"
+	"log"
+	"mime/multipart"
 	"net/http"
+	"os"
+	"path"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/vnkhanh/survey-server/utils"
+	"github.com/vnkhanh/survey-server/services"
 )
 
 func UploadFile(c *gin.Context) {
-	fmt.Println("===> Nhận request upload")
-
 	fileHeader, err := c.FormFile("file")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Không nhận được file"})
 		return
 	}
-	fmt.Println("===> Nhận file:", fileHeader.Filename)
 
 	fileID := fmt.Sprintf("%d", time.Now().UnixNano())
-	fmt.Println("===> Gọi UploadToSupabase...")
-
-	publicURL, err := utils.UploadToSupabase(fileHeader, fileHeader.Filename, fileID, "", "")
+	publicURL, err := saveAndLinkUpload(c, fileHeader, services.UploadKey("", fileID, fileHeader.Filename))
 	if err != nil {
-		fmt.Println("===> Upload lỗi:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		log.Printf("[upload] %s: %v", fileHeader.Filename, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lưu file"})
 		return
 	}
 
-	fmt.Println("===> Upload xong:", publicURL)
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Upload thành công",
 		"url":     publicURL,
 	})
 }
+
+// saveAndLinkUpload lưu file công khai (ảnh, tài liệu của form) và trả URL công khai
+func saveAndLinkUpload(c *gin.Context, fh *multipart.FileHeader, key string) (string, error) {
+	if err := services.SaveUpload(c.Request.Context(), fh, key); err != nil {
+		return "", err
+	}
+	st, err := services.FileStorage()
+	if err != nil {
+		return "", err
+	}
+	return services.FileURL(st, key)
+}
+
+// localFileStorage: kho file tải lên khi FILE_STORAGE=local, nil nếu dùng kho khác
+func localFileStorage() *services.LocalStorage {
+	st, err := services.FileStorage()
+	if err != nil {
+		return nil
+	}
+	local, _ := st.(*services.LocalStorage)
+	return local
+}
+
+// ServeUploadedFile phục vụ URL công khai của file tải lên (chỉ kho local);
+// file người trả lời nộp chỉ tải qua DownloadSubmissionFile
+func ServeUploadedFile(c *gin.Context) {
+	local := localFileStorage()
+	key := c.Param("key")[1:]
+	if local == nil || services.IsPrivateUploadKey(key) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Không tìm thấy"})
+		return
+	}
+	serveLocalFile(c, local, key, false)
+}
+
+// DownloadUploadedFile phục vụ link ký (SignedURL) của file tải lên (chỉ kho local)
+func DownloadUploadedFile(c *gin.Context) {
+	local := localFileStorage()
+	if local == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Không tìm thấy"})
+		return
+	}
+	key := c.Query("key")
+	if !local.VerifySignedURL(key, c.Query("exp"), c.Query("sig")) {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Link tải không hợp lệ hoặc đã hết hạn"})
+		return
+	}
+	serveLocalFile(c, local, key, true)
+}
+
+func serveLocalFile(c *gin.Context, local *services.LocalStorage, key string, attachment bool) {
+	p, err := local.FilePath(key)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Key không hợp lệ"})
+		return
+	}
+	if fi, err := os.Stat(p); err != nil || fi.IsDir() {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Không tìm thấy file"})
+		return
+	}
+	if attachment {
+		c.FileAttachment(p, path.Base(key))
+		return
+	}
+	c.File(p)
+}
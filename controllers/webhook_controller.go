@@ -0,0 +1,315 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vnkhanh/survey-server/config"
+	"github.com/vnkhanh/survey-server/middleware"
+	"github.com/vnkhanh/survey-server/models"
+	"github.com/vnkhanh/survey-server/services"
+	"github.com/vnkhanh/survey-server/utils"
+	"gorm.io/gorm"
+)
+
+type webhookReq struct {
+	URL    string   `json:"url" binding:"required"`
+	FormID *uint    `json:"form_id"` // nil = mọi form của mình
+	Events []string `json:"events" binding:"required,min=1"`
+}
+
+type updateWebhookReq struct {
+	URL    *string  `json:"url"`
+	Events []string `json:"events"`
+	Active *bool    `json:"active"`
+}
+
+func webhookDTO(s models.WebhookSubscription) gin.H {
+	return gin.H{
+		"id":         s.ID,
+		"url":        s.URL,
+		"form_id":    s.KhaoSatID,
+		"events":     strings.Split(s.Events, ","),
+		"active":     s.Active,
+		"created_at": s.CreatedAt,
+		"updated_at": s.UpdatedAt,
+	}
+}
+
+// normalizeWebhookEvents kiểm tra và bỏ trùng; "*" = mọi sự kiện
+func normalizeWebhookEvents(events []string) (string, string) {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, e := range events {
+		e = strings.TrimSpace(e)
+		if e != "*" && !services.IsWebhookEvent(e) {
+			return "", e
+		}
+		if !seen[e] {
+			seen[e] = true
+			out = append(out, e)
+		}
+	}
+	if seen["*"] {
+		return "*", ""
+	}
+	return strings.Join(out, ","), ""
+}
+
+// checkWebhookURL trả 422 và false nếu url không phải http(s) công khai (chặn SSRF vào mạng nội bộ)
+func checkWebhookURL(c *gin.Context, raw string) bool {
+	if err := services.CheckOutboundURL(c.Request.Context(), raw); err != nil {
+		msg := err.Error()
+		if errors.Is(err, services.ErrBlockedAddress) {
+			msg = "url không được trỏ vào mạng nội bộ"
+		}
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": msg})
+		return false
+	}
+	return true
+}
+
+// findMyWebhook lấy subscription theo :id của user hiện tại (đã trả 404 nếu không có)
+func findMyWebhook(c *gin.Context) (models.WebhookSubscription, bool) {
+	u := c.MustGet(middleware.CtxUser).(models.NguoiDung)
+	var s models.WebhookSubscription
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID không hợp lệ"})
+		return s, false
+	}
+	if err := config.DB.Where("id = ? AND nguoi_dung_id = ?", id, u.ID).First(&s).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Webhook không tồn tại"})
+		return s, false
+	}
+	return s, true
+}
+
+// GET /api/webhooks
+func ListWebhooks(c *gin.Context) {
+	u := c.MustGet(middleware.CtxUser).(models.NguoiDung)
+
+	q := config.DB.Where("nguoi_dung_id = ?", u.ID)
+	if fid := c.Query("form_id"); fid != "" {
+		q = q.Where("khao_sat_id = ?", fid)
+	}
+	var subs []models.WebhookSubscription
+	if err := q.Order("created_at DESC").Find(&subs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể lấy danh sách webhook"})
+		return
+	}
+	out := make([]gin.H, 0, len(subs))
+	for _, s := range subs {
+		out = append(out, webhookDTO(s))
+	}
+	c.JSON(http.StatusOK, gin.H{"webhooks": out, "events": services.WebhookEvents})
+}
+
+// POST /api/webhooks — secret chỉ trả về đúng 1 lần
+func CreateWebhook(c *gin.Context) {
+	u := c.MustGet(middleware.CtxUser).(models.NguoiDung)
+
+	var req webhookReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "Payload không hợp lệ", "error": err.Error()})
+		return
+	}
+	if !checkWebhookURL(c, req.URL) {
+		return
+	}
+	events, bad := normalizeWebhookEvents(req.Events)
+	if bad != "" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "Sự kiện không hợp lệ: " + bad})
+		return
+	}
+	if req.FormID != nil {
+		var n int64
+		config.DB.Model(&models.KhaoSat{}).Where("id = ? AND nguoi_tao_id = ?", *req.FormID, u.ID).Count(&n)
+		if n == 0 {
+			c.JSON(http.StatusForbidden, gin.H{"message": "Bạn không sở hữu form này"})
+			return
+		}
+	}
+
+	secret, sealed, err := newWebhookSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể sinh secret"})
+		return
+	}
+	sub := models.WebhookSubscription{
+		NguoiDungID: u.ID,
+		KhaoSatID:   req.FormID,
+		URL:         strings.TrimSpace(req.URL),
+		Secret:      sealed,
+		Events:      events,
+		Active:      true,
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&sub).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "webhook.create", "webhook", sub.ID, gin.H{"url": sub.URL, "form_id": sub.KhaoSatID, "events": sub.Events})
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể tạo webhook"})
+		return
+	}
+
+	resp := webhookDTO(sub)
+	resp["secret"] = secret
+	c.JSON(http.StatusCreated, resp)
+}
+
+// PATCH /api/webhooks/:id
+func UpdateWebhook(c *gin.Context) {
+	sub, ok := findMyWebhook(c)
+	if !ok {
+		return
+	}
+	var req updateWebhookReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "Payload không hợp lệ", "error": err.Error()})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.URL != nil {
+		if !checkWebhookURL(c, *req.URL) {
+			return
+		}
+		updates["url"] = strings.TrimSpace(*req.URL)
+	}
+	if req.Events != nil {
+		events, bad := normalizeWebhookEvents(req.Events)
+		if bad != "" || events == "" {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "Sự kiện không hợp lệ: " + bad})
+			return
+		}
+		updates["events"] = events
+	}
+	if req.Active != nil {
+		updates["active"] = *req.Active
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Không có gì để cập nhật"})
+		return
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&sub).Updates(updates).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "webhook.update", "webhook", sub.ID, updates)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Cập nhật thất bại"})
+		return
+	}
+	config.DB.First(&sub, sub.ID)
+	c.JSON(http.StatusOK, webhookDTO(sub))
+}
+
+// DELETE /api/webhooks/:id — xoá kèm lịch sử gửi
+func DeleteWebhook(c *gin.Context) {
+	sub, ok := findMyWebhook(c)
+	if !ok {
+		return
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&sub).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "webhook.delete", "webhook", sub.ID, gin.H{"url": sub.URL})
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể xoá webhook"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
+
+// newWebhookSecret: secret mới (trả cho client đúng 1 lần) và bản mã hoá để lưu DB
+func newWebhookSecret() (secret, sealed string, err error) {
+	if secret, err = services.GenerateWebhookSecret(); err != nil {
+		return "", "", err
+	}
+	sealed, err = utils.SealSecret(secret)
+	return secret, sealed, err
+}
+
+// POST /api/webhooks/:id/rotate-secret — secret cũ hết hiệu lực ngay
+func RotateWebhookSecret(c *gin.Context) {
+	sub, ok := findMyWebhook(c)
+	if !ok {
+		return
+	}
+	secret, sealed, err := newWebhookSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể sinh secret"})
+		return
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&sub).Update("secret", sealed).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "webhook.rotate_secret", "webhook", sub.ID, nil)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể đổi secret"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": sub.ID, "secret": secret})
+}
+
+// GET /api/webhooks/:id/deliveries?status=pending|success|dead
+func ListWebhookDeliveries(c *gin.Context) {
+	sub, ok := findMyWebhook(c)
+	if !ok {
+		return
+	}
+	page, limit, offset := adminPaging(c)
+
+	q := config.DB.Model(&models.WebhookDelivery{}).Where("subscription_id = ?", sub.ID)
+	if st := c.Query("status"); st != "" {
+		q = q.Where("status = ?", st)
+	}
+	if ev := c.Query("event"); ev != "" {
+		q = q.Where("event = ?", ev)
+	}
+	var total int64
+	q.Count(&total)
+
+	var rows []models.WebhookDelivery
+	if err := q.Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể lấy lịch sử gửi"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deliveries": rows, "page": page, "limit": limit, "total": total})
+}
+
+// POST /api/webhooks/:id/deliveries/:delivery_id/redeliver — gửi lại thủ công (kể cả từ dead-letter)
+func RedeliverWebhook(c *gin.Context) {
+	sub, ok := findMyWebhook(c)
+	if !ok {
+		return
+	}
+	var d models.WebhookDelivery
+	if err := config.DB.Where("id = ? AND subscription_id = ?", c.Param("delivery_id"), sub.ID).First(&d).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Delivery không tồn tại"})
+		return
+	}
+	if !sub.Active {
+		c.JSON(http.StatusConflict, gin.H{"message": "Webhook đang tắt"})
+		return
+	}
+	var nd models.WebhookDelivery
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if nd, err = services.Redeliver(tx, d); err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "webhook.redeliver", "webhook", sub.ID, gin.H{"delivery_id": d.ID, "new_delivery_id": nd.ID})
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Không thể gửi lại"})
+		return
+	}
+	c.JSON(http.StatusAccepted, nd)
+}
@@ -1,43 +1,81 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/vnkhanh/survey-server/config"
 	"github.com/vnkhanh/survey-server/models"
+	"github.com/vnkhanh/survey-server/services"
 	"github.com/vnkhanh/survey-server/utils"
 )
 
 // AuthJWT kiểm tra Authorization: Bearer <token>, validate JWT, lấy user và inject vào context.
 func AuthJWT() gin.HandlerFunc {
+	return authenticate(false)
+}
+
+// AuthJWTOrAPIKey giống AuthJWT nhưng chấp nhận thêm Authorization: ApiKey <key> cho script tự động.
+// Dùng kèm RequireScope để giới hạn quyền của key.
+func AuthJWTOrAPIKey() gin.HandlerFunc {
+	return authenticate(true)
+}
+
+func authenticate(allowAPIKey bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" || !strings.HasPrefix(strings.ToLower(authHeader), "bearer ") {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Missing or invalid Authorization header"})
-			return
-		}
-		rawToken := strings.TrimSpace(authHeader[7:])
+		lower := strings.ToLower(authHeader)
 
-		claims, err := utils.VerifyToken(rawToken)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Invalid token"})
-			return
-		}
+		var user models.NguoiDung
+		switch {
+		case allowAPIKey && strings.HasPrefix(lower, "apikey "):
+			key, u, err := authenticateAPIKey(strings.TrimSpace(authHeader[7:]))
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+				return
+			}
+			user = u
+			c.Set(CtxAPIKey, key)
 
-		// UserID trong claims là string → parse ra uint64 để tìm DB theo primary key
-		uid, err := strconv.ParseUint(claims.UserID, 10, 64)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Invalid subject"})
+		case strings.HasPrefix(lower, "bearer "):
+			rawToken := strings.TrimSpace(authHeader[7:])
+
+			claims, err := utils.VerifyToken(rawToken)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Invalid token"})
+				return
+			}
+
+			// UserID trong claims là string → parse ra uint64 để tìm DB theo primary key
+			uid, err := strconv.ParseUint(claims.UserID, 10, 64)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Invalid subject"})
+				return
+			}
+
+			if err := config.DB.First(&user, uid).Error; err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "User not found"})
+				return
+			}
+			// Mật khẩu bị đặt lại / tài khoản bị khoá sau khi cấp token → phiên cũ hết hiệu lực
+			if claims.Version != user.TokenVersion {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Phiên đăng nhập đã bị thu hồi"})
+				return
+			}
+
+		default:
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Missing or invalid Authorization header"})
 			return
 		}
 
-		var user models.NguoiDung
-		if err := config.DB.First(&user, uid).Error; err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "User not found"})
+		if user.DisabledAt != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Tài khoản đã bị khoá"})
 			return
 		}
 
@@ -55,23 +93,129 @@ func AuthJWT() gin.HandlerFunc {
 	}
 }
 
-// RequireAdmin chặn các route chỉ dành cho admin
-func RequireAdmin() gin.HandlerFunc {
+// authenticateAPIKey tra key theo hash, kiểm tra thu hồi/hết hạn và cập nhật last_used_at
+func authenticateAPIKey(raw string) (models.ApiKey, models.NguoiDung, error) {
+	var key models.ApiKey
+	var user models.NguoiDung
+	if raw == "" {
+		return key, user, errors.New("Invalid API key")
+	}
+	if err := config.DB.Where("key_hash = ?", utils.HashAPIKey(raw)).First(&key).Error; err != nil {
+		return key, user, errors.New("Invalid API key")
+	}
+	now := time.Now()
+	if key.RevokedAt != nil {
+		return key, user, errors.New("API key has been revoked")
+	}
+	if key.ExpiresAt != nil && now.After(*key.ExpiresAt) {
+		return key, user, errors.New("API key has expired")
+	}
+	if err := config.DB.First(&user, key.NguoiDungID).Error; err != nil {
+		return key, user, errors.New("User not found")
+	}
+
+	// Không cần chính xác từng request → chỉ ghi lại tối đa mỗi phút một lần
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > time.Minute {
+		config.DB.Model(&models.ApiKey{}).Where("id = ?", key.ID).Update("last_used_at", now)
+		key.LastUsedAt = &now
+	}
+	return key, user, nil
+}
+
+// RequireScope: nếu request dùng API key thì key phải có scope tương ứng; JWT thường thì cho qua
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		v, ok := c.Get(CtxAPIKey)
+		if !ok {
+			c.Next()
+			return
+		}
+		if key, ok2 := v.(models.ApiKey); !ok2 || !utils.HasScope(key.Scopes, scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "API key thiếu scope " + scope})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequirePermission chặn route nếu user không có đủ mọi quyền được liệt kê (hợp quyền của các vai trò).
+// Quyền luôn tra từ DB nên thay đổi vai trò có hiệu lực ngay, không phụ thuộc claim trong JWT.
+func RequirePermission(perms ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		v, ok := c.Get("user")
+		v, ok := c.Get(CtxUser)
 		if !ok {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Unauthorized"})
 			return
 		}
 		u := v.(models.NguoiDung)
-		if !u.VaiTro {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Forbidden"})
+
+		granted, err := userPermissions(c, u.ID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Không thể kiểm tra quyền"})
+			return
+		}
+		for _, p := range perms {
+			if !granted[p] {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Forbidden", "missing_permission": p})
+				return
+			}
+		}
+
+		// Chính sách: admin/user có quyền trên dữ liệu của mọi người bắt buộc bật 2FA mới được dùng các route quản trị
+		if MustEnroll2FA(u, granted) {
+			abortEnroll2FA(c)
 			return
 		}
 		c.Next()
 	}
 }
 
+// userPermissions nạp quyền của user một lần cho mỗi request
+func userPermissions(c *gin.Context, userID uint) (map[string]bool, error) {
+	if v, ok := c.Get(CtxPermissions); ok {
+		if m, ok2 := v.(map[string]bool); ok2 {
+			return m, nil
+		}
+	}
+	m, err := services.UserPermissions(userID)
+	if err != nil {
+		return nil, err
+	}
+	c.Set(CtxPermissions, m)
+	return m, nil
+}
+
+// PrivilegedUser: admin (vai_tro) hoặc có quyền trên dữ liệu của mọi người (*.read_all, *.manage_all)
+func PrivilegedUser(u models.NguoiDung, perms map[string]bool) bool {
+	if u.VaiTro {
+		return true
+	}
+	for p, ok := range perms {
+		if ok && (strings.HasSuffix(p, ".read_all") || strings.HasSuffix(p, ".manage_all")) {
+			return true
+		}
+	}
+	return false
+}
+
+// MustEnroll2FA: chính sách 2FA áp dụng cho user (PrivilegedUser) nhưng user chưa bật
+func MustEnroll2FA(u models.NguoiDung, perms map[string]bool) bool {
+	return PrivilegedUser(u, perms) && AdminRequires2FA() && !u.TOTPEnabled
+}
+
+func abortEnroll2FA(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+		"message":                "Tài khoản có quyền quản trị cần bật xác thực 2 lớp",
+		"require_2fa_enrollment": true,
+	})
+}
+
+// AdminRequires2FA: chính sách bắt buộc 2FA cho admin, mặc định bật (ADMIN_REQUIRE_2FA=false để tắt)
+func AdminRequires2FA() bool {
+	v := strings.ToLower(strings.TrimSpace(os.Getenv("ADMIN_REQUIRE_2FA")))
+	return v != "false" && v != "0"
+}
+
 // OptionalAuth: nếu có JWT thì inject user, nếu không thì cho qua
 func OptionalAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -97,7 +241,7 @@ func OptionalAuth() gin.HandlerFunc {
 		}
 
 		var user models.NguoiDung
-		if err := config.DB.First(&user, uid).Error; err == nil {
+		if err := config.DB.First(&user, uid).Error; err == nil && user.DisabledAt == nil && claims.Version == user.TokenVersion {
 			c.Set(CtxUser, user)
 		}
 		c.Next()
@@ -3,4 +3,6 @@ package middleware
 const (
     CtxUser       = "user"
     CtxUserPublic = "userPublic"
+    CtxAPIKey     = "apiKey" // models.ApiKey khi request xác thực bằng API key
+    CtxPermissions = "permissions" // map[string]bool quyền của user (RequirePermission nạp)
 )
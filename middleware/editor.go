@@ -14,8 +14,9 @@ import (
 
 const (
 	HeaderEditToken = "X-Form-Edit-Token"
-	CtxForm         = "formObj"     // form đã nạp sẵn
-	CtxQuestion     = "questionObj" // question đã nạp sẵn
+	CtxForm         = "formObj"      // form đã nạp sẵn
+	CtxQuestion     = "questionObj"  // question đã nạp sẵn
+	CtxEditToken    = "viaEditToken" // true khi quyền sửa đến từ edit token (không phải owner)
 )
 
 // helper: kiểm tra owner an toàn với con trỏ *uint
@@ -54,6 +55,7 @@ func CheckFormEditor() gin.HandlerFunc {
 		// 2) Kiểm tra edit token
 		token := c.GetHeader(HeaderEditToken)
 		if token != "" && utils.VerifyEditToken(f.EditTokenHash, token) {
+			c.Set(CtxEditToken, true)
 			c.Set(CtxForm, f)
 			c.Next()
 			return
@@ -107,6 +109,7 @@ func CheckQuestionEditor() gin.HandlerFunc {
 		// 2) Edit token
 		token := c.GetHeader(HeaderEditToken)
 		if token != "" && utils.VerifyEditToken(f.EditTokenHash, token) {
+			c.Set(CtxEditToken, true)
 			c.Set(CtxQuestion, q)
 			c.Next()
 			return
@@ -1,98 +1,238 @@
 package middleware
 
 import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/time/rate"
+	"github.com/vnkhanh/survey-server/models"
+	"github.com/vnkhanh/survey-server/services"
 )
 
-// Mỗi IP có một limiter riêng + lastSeen để dọn dẹp
-type visitor struct {
-	limiter  *rate.Limiter
-	lastSeen time.Time
-}
+// Cách xác định "ai" bị giới hạn
+const (
+	RateKeyIP     = "ip"      // IP client
+	RateKeyUser   = "user"    // user đăng nhập, khách → IP
+	RateKeyAPIKey = "api_key" // API key, không dùng key → user → IP
+	RateKeyForm   = "form"    // form :id trên route (tổng cho mọi người gửi)
+)
 
-// IPRateLimiter quản lý map<ip, limiter>
-type IPRateLimiter struct {
-	mu       sync.Mutex
-	visitors map[string]*visitor
+// Tên các chính sách dùng trong routes
+const (
+	PolicyFormsCreate    = "forms_create"
+	PolicyLogin          = "login"
+	PolicySubmission     = "submission"
+	PolicySubmissionForm = "submission_form"
+	PolicyUpload         = "upload"
+	PolicyExport         = "export"
+)
 
-	// cấu hình chung cho tất cả IP
-	reqPerMin int // số request/phút
-	burst     int // số burst cho phép
-	ttl       time.Duration
+// RateLimitPolicy: tối đa Limit request mỗi Window cho mỗi key (Limit = 0 → tắt)
+type RateLimitPolicy struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+	Key    string
 }
 
-// reqPerMin: ví dụ 10, burst: 5, ttl: 5 phút (IP không hoạt động sẽ bị dọn)
-func NewIPRateLimiter(reqPerMin, burst int, ttl time.Duration) *IPRateLimiter {
-	rl := &IPRateLimiter{
-		visitors:  make(map[string]*visitor),
-		reqPerMin: reqPerMin,
-		burst:     burst,
-		ttl:       ttl,
-	}
-	// chạy nền dọn IP cũ
-	go rl.cleanupVisitors()
-	return rl
+// Dạng JSON của một chính sách, vd. {"limit": 10, "window": "1m", "key": "ip"}
+type rateLimitPolicyJSON struct {
+	Limit  int    `json:"limit"`
+	Window string `json:"window"`
+	Key    string `json:"key"`
 }
 
-func (rl *IPRateLimiter) getLimiter(ip string) *rate.Limiter {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
+// Giá trị mặc định khi không cấu hình
+var defaultRatePolicies = map[string]rateLimitPolicyJSON{
+	PolicyFormsCreate:    {Limit: 10, Window: "1m", Key: RateKeyIP},
+	PolicyLogin:          {Limit: 10, Window: "1m", Key: RateKeyIP},
+	PolicySubmission:     {Limit: 20, Window: "1m", Key: RateKeyIP},
+	PolicySubmissionForm: {Limit: 300, Window: "1m", Key: RateKeyForm},
+	PolicyUpload:         {Limit: 20, Window: "1m", Key: RateKeyIP},
+	PolicyExport:         {Limit: 20, Window: "1h", Key: RateKeyAPIKey},
+}
 
-	if v, ok := rl.visitors[ip]; ok {
-		v.lastSeen = time.Now()
-		return v.limiter
+var (
+	ratePoliciesOnce sync.Once
+	ratePolicies     map[string]RateLimitPolicy
+)
+
+// loadRatePolicies: mặc định → file JSON RATE_LIMIT_FILE → JSON trong RATE_LIMIT_POLICIES.
+// Mỗi nguồn là object {tên: chính sách}; chỉ cần ghi các trường muốn đổi.
+func loadRatePolicies() (map[string]RateLimitPolicy, error) {
+	raw := make(map[string]rateLimitPolicyJSON, len(defaultRatePolicies))
+	for name, p := range defaultRatePolicies {
+		raw[name] = p
+	}
+
+	merge := func(source string, data []byte) error {
+		var overrides map[string]json.RawMessage
+		if err := json.Unmarshal(data, &overrides); err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+		for name, o := range overrides {
+			p := raw[name]
+			if err := json.Unmarshal(o, &p); err != nil {
+				return fmt.Errorf("%s: policy %q: %w", source, name, err)
+			}
+			raw[name] = p
+		}
+		return nil
+	}
+	if path := os.Getenv("RATE_LIMIT_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := merge(path, data); err != nil {
+			return nil, err
+		}
+	}
+	if v := strings.TrimSpace(os.Getenv("RATE_LIMIT_POLICIES")); v != "" {
+		if err := merge("RATE_LIMIT_POLICIES", []byte(v)); err != nil {
+			return nil, err
+		}
 	}
 
-	// chuyển req/phút -> rate.Limit (req/giây)
-	rps := float64(rl.reqPerMin) / 60.0
-	limiter := rate.NewLimiter(rate.Limit(rps), rl.burst)
-	rl.visitors[ip] = &visitor{limiter: limiter, lastSeen: time.Now()}
-	return limiter
+	out := make(map[string]RateLimitPolicy, len(raw))
+	for name, p := range raw {
+		window, err := time.ParseDuration(p.Window)
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("policy %q: window không hợp lệ %q", name, p.Window)
+		}
+		switch p.Key {
+		case RateKeyIP, RateKeyUser, RateKeyAPIKey, RateKeyForm:
+		default:
+			return nil, fmt.Errorf("policy %q: key không hợp lệ %q", name, p.Key)
+		}
+		if p.Limit < 0 {
+			return nil, fmt.Errorf("policy %q: limit không được âm", name)
+		}
+		out[name] = RateLimitPolicy{Name: name, Limit: p.Limit, Window: window, Key: p.Key}
+	}
+	return out, nil
 }
 
-func (rl *IPRateLimiter) cleanupVisitors() {
-	ticker := time.NewTicker(time.Minute)
-	defer ticker.Stop()
+// RatePolicy trả chính sách theo tên (nạp cấu hình ở lần gọi đầu, sai cấu hình thì dừng server)
+func RatePolicy(name string) RateLimitPolicy {
+	ratePoliciesOnce.Do(func() {
+		var err error
+		if ratePolicies, err = loadRatePolicies(); err != nil {
+			log.Fatalf("Invalid rate limit config: %v", err)
+		}
+	})
+	p, ok := ratePolicies[name]
+	if !ok {
+		log.Fatalf("Unknown rate limit policy %q", name)
+	}
+	return p
+}
 
-	for range ticker.C {
-		rl.mu.Lock()
-		for ip, v := range rl.visitors {
-			if time.Since(v.lastSeen) > rl.ttl {
-				delete(rl.visitors, ip)
+// rateLimitKey xác định key đếm theo loại; "" = bỏ qua chính sách cho request này
+func rateLimitKey(c *gin.Context, kind string) string {
+	switch kind {
+	case RateKeyForm:
+		if id := c.Param("id"); id != "" {
+			return "form:" + id
+		}
+		return ""
+	case RateKeyAPIKey:
+		if v, ok := c.Get(CtxAPIKey); ok {
+			if k, ok2 := v.(models.ApiKey); ok2 {
+				return "key:" + strconv.FormatUint(uint64(k.ID), 10)
+			}
+		}
+		fallthrough
+	case RateKeyUser:
+		if v, ok := c.Get(CtxUser); ok {
+			if u, ok2 := v.(models.NguoiDung); ok2 {
+				return "user:" + strconv.FormatUint(uint64(u.ID), 10)
 			}
 		}
-		rl.mu.Unlock()
 	}
+	return "ip:" + c.ClientIP() // Gin sẽ xét X-Forwarded-For nếu đã cấu hình TrustedProxies
 }
 
-// ====== Middleware dùng cho 1 endpoint cụ thể ======
+// ====== Middleware ======
+
+// RateLimit áp dụng một hoặc nhiều chính sách cho route. Header RateLimit-Limit/Remaining/Reset
+// phản ánh chính sách còn ít lượt nhất; khi vượt giới hạn trả 429 kèm Retry-After.
+// Gắn sau middleware xác thực nếu chính sách đếm theo user/API key.
+func RateLimit(names ...string) gin.HandlerFunc {
+	policies := make([]RateLimitPolicy, 0, len(names))
+	for _, name := range names {
+		policies = append(policies, RatePolicy(name))
+	}
 
-func RateLimitByIP(rl *IPRateLimiter) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ip := c.ClientIP() // Gin sẽ xét X-Forwarded-For nếu đã cấu hình TrustedProxies
-		limiter := rl.getLimiter(ip)
-		if !limiter.Allow() {
+		var (
+			tightest  *RateLimitPolicy
+			remaining = math.MaxInt
+			resetAt   time.Time
+			exceeded  bool
+			policyHdr []string
+		)
+		for i := range policies {
+			p := &policies[i]
+			if p.Limit == 0 {
+				continue
+			}
+			key := rateLimitKey(c, p.Key)
+			if key == "" {
+				continue
+			}
+			// Bộ đếm cửa sổ cố định trong store dùng chung (Redis khi chạy nhiều instance)
+			count, reset, err := services.SharedStore().Incr(c.Request.Context(), "ratelimit:"+p.Name+":"+key, p.Window)
+			if err != nil {
+				// Store lỗi thì cho qua, không chặn người dùng
+				log.Printf("[ratelimit] %s: %v", p.Name, err)
+				continue
+			}
+			left := p.Limit - int(count)
+			if left < 0 {
+				left = 0
+			}
+			if left < remaining || (left == remaining && reset.After(resetAt)) {
+				tightest, remaining, resetAt = p, left, reset
+			}
+			if int(count) > p.Limit {
+				exceeded = true
+			}
+			policyHdr = append(policyHdr, fmt.Sprintf("%d;w=%d", p.Limit, int(p.Window.Seconds())))
+		}
+		if tightest == nil {
+			c.Next()
+			return
+		}
+
+		resetSecs := int(math.Ceil(time.Until(resetAt).Seconds()))
+		if resetSecs < 1 {
+			resetSecs = 1
+		}
+		h := c.Writer.Header()
+		h.Set("RateLimit-Limit", strconv.Itoa(tightest.Limit))
+		h.Set("RateLimit-Remaining", strconv.Itoa(remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(resetSecs))
+		h.Set("RateLimit-Policy", strings.Join(policyHdr, ", "))
+
+		if exceeded {
+			// tightest lúc này có remaining = 0 và cửa sổ kết thúc muộn nhất
+			h.Set("Retry-After", strconv.Itoa(resetSecs))
 			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
 				"message": "Too Many Requests",
 				"hint":    "Vui lòng thử lại sau ít phút.",
+				"policy":  tightest.Name,
 			})
 			return
 		}
 		c.Next()
 	}
 }
-
-// ====== Một instance dùng riêng cho POST /api/forms ======
-
-// 10 requests/phút/IP, burst 5, TTL giữ limiter tối đa 5 phút
-var FormsCreateLimiter = NewIPRateLimiter(10, 5, 5*time.Minute)
-
-// RateLimitFormsCreate: gắn vào route POST /api/forms
-func RateLimitFormsCreate() gin.HandlerFunc {
-	return RateLimitByIP(FormsCreateLimiter)
-}
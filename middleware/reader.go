@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vnkhanh/survey-server/config"
+	"github.com/vnkhanh/survey-server/models"
+	"github.com/vnkhanh/survey-server/utils"
+	"gorm.io/gorm"
+)
+
+// ErrMustEnroll2FA: quyền đọc đến từ *.read_all nhưng user chưa bật 2FA theo chính sách
+var ErrMustEnroll2FA = errors.New("must enroll 2fa")
+
+// CanReadForm: owner, edit token hợp lệ, user có quyền perm (forms.read_all, responses.read_all)
+// hoặc — với perm = forms.read_all — thành viên của room gắn với form
+func CanReadForm(c *gin.Context, f *models.KhaoSat, perm string) (bool, error) {
+	v, hasUser := c.Get(CtxUser)
+	u, _ := v.(models.NguoiDung)
+	if hasUser && isOwner(u, f) {
+		return true, nil
+	}
+	if token := c.GetHeader(HeaderEditToken); token != "" && utils.VerifyEditToken(f.EditTokenHash, token) {
+		c.Set(CtxEditToken, true)
+		return true, nil
+	}
+	if !hasUser {
+		return false, nil
+	}
+
+	granted, err := userPermissions(c, u.ID)
+	if err != nil {
+		return false, err
+	}
+	if granted[perm] {
+		if MustEnroll2FA(u, granted) {
+			return false, ErrMustEnroll2FA
+		}
+		return true, nil
+	}
+
+	if perm == models.PermFormsReadAll {
+		var n int64
+		if err := config.DB.Table("room_nguoi_tham_gia AS m").
+			Joins("JOIN room r ON r.id = m.room_id").
+			Where("r.khao_sat_id = ? AND m.nguoi_dung_id = ? AND m.trang_thai = 'active'", f.ID, u.ID).
+			Count(&n).Error; err != nil {
+			return false, err
+		}
+		return n > 0, nil
+	}
+	return false, nil
+}
+
+// CheckFormReader: cho phép đọc form (và phản hồi) theo CanReadForm với quyền perm
+func CheckFormReader(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil || id <= 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "ID không hợp lệ"})
+			return
+		}
+
+		var f models.KhaoSat
+		if e := config.DB.Where("id = ? AND trang_thai <> 'deleted'", id).First(&f).Error; e != nil {
+			if errors.Is(e, gorm.ErrRecordNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": "Form không tồn tại"})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Không thể đọc form"})
+			return
+		}
+
+		ok, err := CanReadForm(c, &f, perm)
+		switch {
+		case errors.Is(err, ErrMustEnroll2FA):
+			abortEnroll2FA(c)
+			return
+		case err != nil:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Không thể kiểm tra quyền"})
+			return
+		case !ok:
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Bạn không có quyền xem form này"})
+			return
+		}
+		c.Set(CtxForm, f)
+		c.Next()
+	}
+}
+
+// CtxExportJob: models.ExportJob đã nạp sẵn theo :job_id (CheckExportJob)
+const CtxExportJob = "exportJobObj"
+
+// CheckExportJob: nạp job xuất theo :job_id và chỉ cho người đọc được phản hồi của form
+// (CanReadForm với responses.read_all — cùng quyền tạo job) thao tác trên job
+func CheckExportJob() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var job models.ExportJob
+		if e := config.DB.First(&job, "job_id = ?", c.Param("job_id")).Error; e != nil {
+			if errors.Is(e, gorm.ErrRecordNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": "Job không tìm thấy"})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Lỗi DB"})
+			return
+		}
+
+		var f models.KhaoSat
+		if e := config.DB.Where("id = ? AND trang_thai <> 'deleted'", job.KhaoSatID).First(&f).Error; e != nil {
+			// không lộ job của form đã xoá/không đọc được
+			if errors.Is(e, gorm.ErrRecordNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": "Job không tìm thấy"})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Không thể đọc form"})
+			return
+		}
+
+		ok, err := CanReadForm(c, &f, models.PermResponsesReadAll)
+		switch {
+		case errors.Is(err, ErrMustEnroll2FA):
+			abortEnroll2FA(c)
+			return
+		case err != nil:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Không thể kiểm tra quyền"})
+			return
+		case !ok:
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": "Job không tìm thấy"})
+			return
+		}
+		c.Set(CtxForm, f)
+		c.Set(CtxExportJob, job)
+		c.Next()
+	}
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// ApiKey: khoá truy cập cá nhân cho script tự động (ETL...). Chỉ lưu hash, không lưu key gốc.
+type ApiKey struct {
+	ID          uint       `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	NguoiDungID uint       `gorm:"column:nguoi_dung_id;not null;index" json:"nguoi_dung_id"`
+	Ten         string     `gorm:"column:ten;size:100;not null" json:"ten"`
+	Prefix      string     `gorm:"column:prefix;size:16;not null" json:"prefix"`          // phần đầu key để người dùng nhận diện
+	KeyHash     string     `gorm:"column:key_hash;size:64;not null;uniqueIndex" json:"-"` // sha256(key) dạng hex
+	Scopes      string     `gorm:"column:scopes;type:text;not null" json:"-"`             // danh sách scope, ngăn cách bởi dấu phẩy
+	ExpiresAt   *time.Time `gorm:"column:expires_at" json:"expires_at"`                   // nil = không hết hạn
+	LastUsedAt  *time.Time `gorm:"column:last_used_at" json:"last_used_at"`               // lần dùng gần nhất
+	RevokedAt   *time.Time `gorm:"column:revoked_at" json:"revoked_at"`                   // khác nil = đã thu hồi
+	CreatedAt   time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+
+	NguoiDung *NguoiDung `gorm:"foreignKey:NguoiDungID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+}
+
+func (ApiKey) TableName() string {
+	return "api_keys"
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Loại tác nhân thực hiện thao tác
+const (
+	ActorUser      = "user"
+	ActorEditToken = "edit_token"
+	ActorAPIKey    = "api_key"
+	ActorSystem    = "system"
+	ActorAnonymous = "anonymous"
+)
+
+// AuditLog: một dòng nhật ký thao tác ghi dữ liệu. Bảng chỉ cho INSERT (trigger chặn UPDATE/DELETE).
+type AuditLog struct {
+	ID         uint64    `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	CreatedAt  time.Time `gorm:"column:created_at;autoCreateTime;index" json:"created_at"`
+	ActorType  string    `gorm:"column:actor_type;size:20;not null" json:"actor_type"`
+	ActorID    *uint     `gorm:"column:actor_id;index" json:"actor_id"`              // user thực hiện (nếu có)
+	APIKeyID   *uint     `gorm:"column:api_key_id" json:"api_key_id"`                // key được dùng (actor_type = api_key)
+	Action     string    `gorm:"column:action;size:64;not null;index" json:"action"` // vd. user.disable, form.transfer
+	TargetType string    `gorm:"column:target_type;size:32;not null;index:idx_audit_target" json:"target_type"`
+	TargetID   string    `gorm:"column:target_id;size:64;index:idx_audit_target" json:"target_id"`
+	Metadata   string    `gorm:"column:metadata;type:text" json:"metadata"` // JSON chi tiết (lý do, giá trị mới...)
+	Before     string    `gorm:"column:before;type:text" json:"before"`     // JSON trạng thái trước khi ghi
+	After      string    `gorm:"column:after;type:text" json:"after"`       // JSON trạng thái sau khi ghi
+	Changes    string    `gorm:"column:changes;type:text" json:"changes"`   // JSON {trường: {from, to}} tính từ before/after
+	IP         string    `gorm:"column:ip;size:64" json:"ip"`
+}
+
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Phạm vi đếm số lần thử sai
+const (
+	ThrottleLoginAccount   = "login_account"    // key = email (giới hạn mềm)
+	ThrottleLoginAccountIP = "login_account_ip" // key = email|IP
+	ThrottleLoginIP        = "login_ip"         // key = IP
+	ThrottleTwoFactor      = "two_factor"       // key = user id
+	ThrottleRoomUser       = "room_user"        // key = room id:user id
+	ThrottleRoomIP         = "room_ip"          // key = room id:IP
+)
+
+// AuthThrottle: số lần thử chưa đúng liên tiếp của một (phạm vi, key) và thời điểm hết khoá.
+// Lưu trong DB để mọi instance dùng chung trạng thái.
+type AuthThrottle struct {
+	ID            uint       `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Scope         string     `gorm:"column:scope;size:20;not null;uniqueIndex:ux_auth_throttle" json:"scope"`
+	Key           string     `gorm:"column:key;size:255;not null;uniqueIndex:ux_auth_throttle" json:"key"`
+	Failures      int        `gorm:"column:failures;not null;default:0" json:"failures"` // số lần thử chưa đúng kể từ lần khoá gần nhất
+	Lockouts      int        `gorm:"column:lockouts;not null;default:0" json:"lockouts"` // số lần đã bị khoá (tính thời gian khoá luỹ thừa)
+	LastFailureAt time.Time  `gorm:"column:last_failure_at" json:"last_failure_at"`
+	LockedUntil   *time.Time `gorm:"column:locked_until;index" json:"locked_until"`
+	CreatedAt     time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+func (AuthThrottle) TableName() string {
+	return "auth_throttles"
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// DataMigration: đánh dấu một lần chuyển đổi dữ liệu đã hoàn tất (chạy một lần, không lặp lại mỗi lần khởi động)
+type DataMigration struct {
+	Name   string    `gorm:"column:name;primaryKey;size:64" json:"name"`
+	DoneAt time.Time `gorm:"column:done_at;not null" json:"done_at"`
+	Note   string    `gorm:"column:note;type:text" json:"note"`
+}
+
+func (DataMigration) TableName() string {
+	return "data_migrations"
+}
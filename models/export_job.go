@@ -5,12 +5,17 @@ import "time"
 type ExportJob struct {
     JobID              string     `gorm:"column:job_id;primaryKey;size:36" json:"job_id"`
     KhaoSatID          uint       `gorm:"column:khao_sat_id;index" json:"khao_sat_id"`
-    Format             string     `gorm:"column:format;size:10" json:"format"` // csv, xlsx
+    Format             string     `gorm:"column:format;size:10" json:"format"` // csv, xlsx, json, ndjson, sav, parquet
     RangeFrom          *time.Time `gorm:"column:range_from" json:"range_from,omitempty"`
     RangeTo            *time.Time `gorm:"column:range_to" json:"range_to,omitempty"`
     IncludeAttachments bool       `gorm:"column:include_attachments" json:"include_attachments"`
-    Status             string     `gorm:"column:status;size:20;default:'queued'" json:"status"`
-    FilePath           *string    `gorm:"column:file_path;type:text" json:"file_path,omitempty"`
+    ExcludeSpam        bool       `gorm:"column:exclude_spam" json:"exclude_spam"`
+    OptionsJSON        string     `gorm:"column:options_json;type:text" json:"-"` // services.ExportOptions; rỗng = mặc định
+    Status             string     `gorm:"column:status;size:20;default:'queued'" json:"status"` // queued, processing, done, failed, cancelled, expired
+    Progress           int        `gorm:"column:progress;not null;default:0" json:"progress"` // phần trăm đã ghi (0-100)
+    QueueJobID         *uint      `gorm:"column:queue_job_id;index" json:"queue_job_id,omitempty"` // job trong hàng đợi nền
+    FilePath           *string    `gorm:"column:file_path;type:text" json:"file_path,omitempty"` // key trong kho file xuất
+    ExpiresAt          *time.Time `gorm:"column:expires_at;index" json:"expires_at,omitempty"` // sau thời điểm này file bị xoá, job chuyển "expired"
     ErrorMsg           *string    `gorm:"column:error_msg;type:text" json:"error_msg,omitempty"`
     CreatedAt          time.Time  `gorm:"autoCreateTime" json:"created_at"`
     UpdatedAt          time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
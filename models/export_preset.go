@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// ExportPreset: cấu hình xuất đã lưu của form (services.ExportOptions dạng JSON)
+type ExportPreset struct {
+	ID          uint      `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	KhaoSatID   uint      `gorm:"column:khao_sat_id;not null;index" json:"khao_sat_id"`
+	NguoiDungID uint      `gorm:"column:nguoi_dung_id;not null" json:"nguoi_dung_id"` // người tạo
+	Ten         string    `gorm:"column:ten;size:100;not null" json:"ten"`
+	OptionsJSON string    `gorm:"column:options_json;type:text;not null" json:"-"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (ExportPreset) TableName() string {
+	return "export_presets"
+}
@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// ExportSchedule: lịch xuất định kỳ của form, mỗi lần chạy tạo một ExportJob rồi giao file tới đích
+type ExportSchedule struct {
+	ID                  uint       `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	KhaoSatID           uint       `gorm:"column:khao_sat_id;not null;index" json:"khao_sat_id"`
+	NguoiDungID         uint       `gorm:"column:nguoi_dung_id;not null" json:"nguoi_dung_id"` // người tạo
+	Ten                 string     `gorm:"column:ten;size:100;not null" json:"ten"`
+	Spec                string     `gorm:"column:spec;size:100;not null" json:"spec"`    // biểu thức cron 5 trường
+	Timezone            string     `gorm:"column:timezone;size:64" json:"timezone"`      // múi giờ của Spec; rỗng = giờ server
+	Format              string     `gorm:"column:format;size:10;not null" json:"format"` // csv, xlsx, ...
+	PresetID            *uint      `gorm:"column:preset_id" json:"preset_id,omitempty"`
+	OptionsJSON         string     `gorm:"column:options_json;type:text" json:"-"` // services.ExportOptions, ghi đè preset
+	Incremental         bool       `gorm:"column:incremental" json:"incremental"`  // chỉ xuất phản hồi từ lần giao thành công trước
+	ExcludeSpam         bool       `gorm:"column:exclude_spam" json:"exclude_spam"`
+	IncludeAttachments  bool       `gorm:"column:include_attachments" json:"include_attachments"`
+	DestType            string     `gorm:"column:dest_type;size:20;not null" json:"dest_type"` // local, sftp, s3, webhook
+	DestConfig          string     `gorm:"column:dest_config;type:text" json:"-"`              // JSON, có thể chứa mật khẩu/khoá
+	Active              bool       `gorm:"column:active;not null" json:"active"`
+	NextRunAt           *time.Time `gorm:"column:next_run_at;index" json:"next_run_at,omitempty"`
+	CursorAt            *time.Time `gorm:"column:cursor_at" json:"cursor_at,omitempty"` // mốc range_to của lần giao thành công gần nhất
+	LastRunAt           *time.Time `gorm:"column:last_run_at" json:"last_run_at,omitempty"`
+	LastStatus          string     `gorm:"column:last_status;size:20" json:"last_status,omitempty"`
+	ConsecutiveFailures int        `gorm:"column:consecutive_failures;not null;default:0" json:"consecutive_failures"`
+	CreatedAt           time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt           time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (ExportSchedule) TableName() string {
+	return "export_schedules"
+}
+
+// Trạng thái một lần chạy lịch xuất
+const (
+	ScheduleRunExporting  = "exporting"
+	ScheduleRunDelivering = "delivering"
+	ScheduleRunSuccess    = "success"
+	ScheduleRunFailed     = "failed"
+)
+
+// ExportScheduleRun: lịch sử một lần chạy của ExportSchedule
+type ExportScheduleRun struct {
+	ID          uint       `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	ScheduleID  uint       `gorm:"column:schedule_id;not null;index" json:"schedule_id"`
+	ExportJobID string     `gorm:"column:export_job_id;size:36;index" json:"export_job_id"`
+	Trigger     string     `gorm:"column:trigger;size:10" json:"trigger"` // schedule | manual
+	Status      string     `gorm:"column:status;size:20;not null" json:"status"`
+	RangeFrom   *time.Time `gorm:"column:range_from" json:"range_from,omitempty"`
+	RangeTo     *time.Time `gorm:"column:range_to" json:"range_to,omitempty"`
+	Rows        int        `gorm:"column:rows" json:"rows"`
+	Location    string     `gorm:"column:location;type:text" json:"location,omitempty"` // nơi file được giao (đường dẫn, URL)
+	Error       *string    `gorm:"column:error;type:text" json:"error,omitempty"`
+	StartedAt   time.Time  `gorm:"column:started_at" json:"started_at"`
+	FinishedAt  *time.Time `gorm:"column:finished_at" json:"finished_at,omitempty"`
+}
+
+func (ExportScheduleRun) TableName() string {
+	return "export_schedule_runs"
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// IdempotencyKey: kết quả của một request ghi gắn với Idempotency-Key do client gửi,
+// để request gửi lại (mạng chập chờn) nhận đúng kết quả cũ thay vì tạo bản ghi mới
+type IdempotencyKey struct {
+	ID           uint      `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Scope        string    `gorm:"column:scope;size:32;not null;uniqueIndex:ux_idempotency" json:"scope"` // vd. "submission"
+	KhaoSatID    uint      `gorm:"column:khao_sat_id;not null;uniqueIndex:ux_idempotency" json:"khao_sat_id"`
+	Key          string    `gorm:"column:key;size:255;not null;uniqueIndex:ux_idempotency" json:"key"`
+	RequestHash  string    `gorm:"column:request_hash;size:64;not null" json:"-"` // sha256 nội dung request, chặn dùng lại key cho request khác
+	PhanHoiID    *uint     `gorm:"column:phan_hoi_id;index" json:"phan_hoi_id"`
+	StatusCode   int       `gorm:"column:status_code" json:"status_code"`
+	ResponseBody string    `gorm:"column:response_body;type:text" json:"-"`
+	CreatedAt    time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	ExpiresAt    time.Time `gorm:"column:expires_at;not null;index" json:"expires_at"`
+
+	PhanHoi *PhanHoi `gorm:"foreignKey:PhanHoiID;constraint:OnDelete:SET NULL" json:"-"`
+}
+
+func (IdempotencyKey) TableName() string {
+	return "idempotency_keys"
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// Trạng thái job nhập phản hồi
+const (
+	ImportQueued     = "queued"     // chờ kiểm tra
+	ImportValidating = "validating" // đang chạy thử
+	ImportValidated  = "validated"  // đã có báo cáo chạy thử, chờ xác nhận
+	ImportImporting  = "importing"  // đang ghi vào DB
+	ImportDone       = "done"
+	ImportFailed     = "failed"
+)
+
+// ImportJob: nhập phản hồi lịch sử từ file CSV/XLSX (bố cục như file xuất) vào một form
+type ImportJob struct {
+	ID          uint       `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	KhaoSatID   uint       `gorm:"column:khao_sat_id;not null;index" json:"khao_sat_id"`
+	NguoiDungID uint       `gorm:"column:nguoi_dung_id;not null" json:"nguoi_dung_id"` // người tải file
+	FileName    string     `gorm:"column:file_name;size:255" json:"file_name"`
+	Format      string     `gorm:"column:format;size:10;not null" json:"format"` // csv, xlsx
+	FileKey     *string    `gorm:"column:file_key;type:text" json:"-"`           // key trong kho file xuất; xoá sau khi nhập xong
+	FileHash    string     `gorm:"column:file_hash;size:64;index" json:"file_hash"`
+	MappingJSON string     `gorm:"column:mapping_json;type:text" json:"-"` // header (hoặc "#<cột>") → đích, ghi đè ánh xạ tự động
+	OptionsJSON string     `gorm:"column:options_json;type:text" json:"-"`
+	Status      string     `gorm:"column:status;size:20;not null" json:"status"`
+	Progress    int        `gorm:"column:progress;not null;default:0" json:"progress"`
+	ReportJSON  string     `gorm:"column:report_json;type:text" json:"-"` // báo cáo của lần kiểm tra / nhập gần nhất
+	Imported    int        `gorm:"column:imported;not null;default:0" json:"imported"`
+	QueueJobID  *uint      `gorm:"column:queue_job_id;index" json:"queue_job_id,omitempty"`
+	ErrorMsg    *string    `gorm:"column:error_msg;type:text" json:"error_msg,omitempty"`
+	CommittedAt *time.Time `gorm:"column:committed_at" json:"committed_at,omitempty"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (ImportJob) TableName() string {
+	return "import_jobs"
+}
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// Trạng thái job nền
+const (
+	JobQueued    = "queued"  // chờ chạy (kể cả chờ thử lại)
+	JobRunning   = "running" // đang được một worker giữ (locked_until)
+	JobDone      = "done"
+	JobFailed    = "failed" // hết số lần thử
+	JobCancelled = "cancelled"
+)
+
+// Job: việc chạy nền trong hàng đợi Postgres. Worker giữ job bằng lease (locked_until);
+// hết hạn mà không gia hạn (worker chết) thì job được worker khác nhận lại.
+type Job struct {
+	ID              uint       `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Kind            string     `gorm:"column:kind;size:64;not null;index" json:"kind"` // vd. "export"
+	Payload         string     `gorm:"column:payload;type:text;not null" json:"payload"`
+	Status          string     `gorm:"column:status;size:16;not null;index:idx_jobs_due" json:"status"`
+	Attempts        int        `gorm:"column:attempts;not null;default:0" json:"attempts"`
+	MaxAttempts     int        `gorm:"column:max_attempts;not null;default:3" json:"max_attempts"`
+	RunAt           time.Time  `gorm:"column:run_at;not null;index:idx_jobs_due" json:"run_at"`
+	LockedBy        string     `gorm:"column:locked_by;size:100" json:"locked_by"`
+	LockedUntil     *time.Time `gorm:"column:locked_until" json:"locked_until"`
+	CancelRequested bool       `gorm:"column:cancel_requested;not null;default:false" json:"cancel_requested"`
+	LastError       string     `gorm:"column:last_error;type:text" json:"last_error"`
+	StartedAt       *time.Time `gorm:"column:started_at" json:"started_at"`
+	FinishedAt      *time.Time `gorm:"column:finished_at" json:"finished_at"`
+	CreatedAt       time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt       time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+func (Job) TableName() string {
+	return "jobs"
+}
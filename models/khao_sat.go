@@ -15,6 +15,8 @@ type KhaoSat struct {
 	SettingsJSON  string     `gorm:"column:settings_json;type:text" json:"settings_json"`
 	ThemeJSON     string     `gorm:"column:theme_json;type:text" json:"theme_json"`
 	EditTokenHash string     `gorm:"column:edit_token_hash;type:text" json:"-"`
+	// Admin lưu trữ cưỡng chế (form vi phạm): owner không tự khôi phục được
+	ForceArchivedAt *time.Time `gorm:"column:force_archived_at" json:"force_archived_at,omitempty"`
 
 	// Thêm trường để share form
 	ShareToken  *string `gorm:"column:share_token;uniqueIndex" json:"share_token"`
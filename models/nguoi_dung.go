@@ -10,6 +10,21 @@ type NguoiDung struct {
 	NgayTao time.Time `gorm:"column:ngay_tao;autoCreateTime" json:"ngay_tao"`
 	VaiTro  bool      `gorm:"column:vai_tro;not null;default:false" json:"vai_tro"`
 
+	// Xác thực 2 lớp (TOTP)
+	TOTPSecret   string `gorm:"column:totp_secret;size:64" json:"-"`                            // secret (đang chờ kích hoạt hoặc đã bật)
+	TOTPEnabled  bool   `gorm:"column:totp_enabled;not null;default:false" json:"totp_enabled"` // đã bật 2FA
+	TOTPLastStep int64  `gorm:"column:totp_last_step;not null;default:0" json:"-"`              // bước thời gian của mã dùng gần nhất (chống dùng lại)
+
+	// Khoá tài khoản bởi admin: khác nil = không đăng nhập/gọi API được
+	DisabledAt     *time.Time `gorm:"column:disabled_at" json:"disabled_at"`
+	DisabledReason string     `gorm:"column:disabled_reason;type:text" json:"disabled_reason,omitempty"`
+
+	// Phiên bản token: JWT mang giá trị lúc cấp, tăng lên (đặt lại mật khẩu, khoá tài khoản) thì mọi JWT cũ bị từ chối
+	TokenVersion int `gorm:"column:token_version;not null;default:0" json:"-"`
+
+	// Phân quyền: vai_tro được giữ đồng bộ với việc có vai trò "admin" (tương thích dữ liệu cũ)
+	Roles []Role `gorm:"many2many:user_roles;constraint:OnDelete:CASCADE" json:"-"`
+
 	// Quan hệ
 	KhaoSats     []KhaoSat          `gorm:"foreignKey:NguoiTaoID" json:"-"`
 	PhanHois     []PhanHoi          `gorm:"foreignKey:NguoiDungID" json:"-"`
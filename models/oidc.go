@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// OIDCProvider: nhà cung cấp OpenID Connect cấu hình trong DB (ngoài các provider khai báo qua env)
+type OIDCProvider struct {
+	ID        uint      `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Ten       string    `gorm:"column:ten;size:50;not null;uniqueIndex" json:"ten"` // slug dùng trong URL: keycloak, azure, gitlab...
+	HienThi   string    `gorm:"column:hien_thi;size:100" json:"hien_thi"`           // tên hiển thị trên nút đăng nhập
+	Issuer    string    `gorm:"column:issuer;size:255;not null" json:"issuer"`
+	ClientID  string    `gorm:"column:client_id;size:255;not null" json:"client_id"`
+	Enabled   bool      `gorm:"column:enabled;not null;default:true" json:"enabled"`
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+func (OIDCProvider) TableName() string {
+	return "oidc_providers"
+}
+
+// UserIdentity: liên kết tài khoản nội bộ với (provider, subject) của nhà cung cấp OIDC
+type UserIdentity struct {
+	ID          uint      `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	NguoiDungID uint      `gorm:"column:nguoi_dung_id;not null;index" json:"nguoi_dung_id"`
+	Provider    string    `gorm:"column:provider;size:50;not null;uniqueIndex:idx_identity_provider_subject" json:"provider"`
+	Subject     string    `gorm:"column:subject;size:255;not null;uniqueIndex:idx_identity_provider_subject" json:"subject"`
+	Email       string    `gorm:"column:email;size:100" json:"email"`
+	CreatedAt   time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+
+	NguoiDung *NguoiDung `gorm:"foreignKey:NguoiDungID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+}
+
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
+
+// OIDCNonce: nonce cấp cho một lần đăng nhập OIDC; dùng một lần (UsedAt) và hết hạn sau ExpiresAt
+type OIDCNonce struct {
+	Nonce     string     `gorm:"column:nonce;size:64;primaryKey" json:"-"`
+	ExpiresAt time.Time  `gorm:"column:expires_at;not null;index" json:"expires_at"`
+	UsedAt    *time.Time `gorm:"column:used_at" json:"used_at"`
+}
+
+func (OIDCNonce) TableName() string {
+	return "oidc_nonces"
+}
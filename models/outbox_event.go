@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// OutboxEvent: sự kiện nghiệp vụ được ghi cùng transaction với thay đổi dữ liệu,
+// dispatcher đọc lại và giao cho các subscriber trong tiến trình (ít nhất một lần)
+type OutboxEvent struct {
+	ID            uint       `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	EventID       string     `gorm:"column:event_id;size:36;not null;uniqueIndex" json:"event_id"`
+	Type          string     `gorm:"column:type;size:64;not null;index" json:"type"`
+	KhaoSatID     *uint      `gorm:"column:khao_sat_id;index" json:"khao_sat_id"`
+	Payload       string     `gorm:"column:payload;type:text;not null" json:"payload"`
+	Attempts      int        `gorm:"column:attempts;not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"column:next_attempt_at;not null;index:idx_outbox_due" json:"next_attempt_at"`
+	DoneHandlers  string     `gorm:"column:done_handlers;type:text" json:"done_handlers"` // subscriber đã xử lý xong, cách nhau bởi dấu phẩy
+	LastError     string     `gorm:"column:last_error;type:text" json:"last_error"`
+	DispatchedAt  *time.Time `gorm:"column:dispatched_at;index:idx_outbox_due" json:"dispatched_at"` // nil = còn subscriber chưa xử lý
+	CreatedAt     time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+func (OutboxEvent) TableName() string {
+	return "outbox_events"
+}
@@ -10,6 +10,20 @@ type PhanHoi struct {
 	LanGui      int       `gorm:"column:lan_gui;default:1" json:"lan_gui"`
 	Email       *string   `gorm:"column:email;size:100" json:"email"`
 
+	// Chống spam: điểm 0-100 từ các cơ chế kiểm tra, lý do (JSON array) và cờ spam theo ngưỡng của form
+	SpamScore   int    `gorm:"column:spam_score;not null;default:0" json:"spam_score"`
+	SpamReasons string `gorm:"column:spam_reasons;type:text" json:"-"`
+	IsSpam      bool   `gorm:"column:is_spam;not null;default:false;index" json:"is_spam"`
+
+	// Chống gửi trùng: id trình duyệt (cookie đã ký) và hash IP người gửi
+	RespondentID string `gorm:"column:respondent_id;size:32;index" json:"-"`
+	IPHash       string `gorm:"column:ip_hash;size:64;index" json:"-"`
+
+	// Nguồn: "web" (gửi qua form) hoặc "import" (nhập từ file); phản hồi nhập giữ job nhập và mã gốc trong file
+	Source      string `gorm:"column:source;size:20;not null;default:'web'" json:"source"`
+	ImportJobID *uint  `gorm:"column:import_job_id;index" json:"import_job_id,omitempty"`
+	SourceRef   string `gorm:"column:source_ref;size:64;index" json:"-"` // unique theo form khi khác rỗng (ux_phan_hoi_source_ref)
+
 	// Quan hệ
 	KhaoSat    *KhaoSat    `gorm:"foreignKey:KhaoSatID" json:"-"`
 	NguoiDung  *NguoiDung  `gorm:"foreignKey:NguoiDungID" json:"-"`
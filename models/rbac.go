@@ -0,0 +1,48 @@
+package models
+
+// Mã quyền (permission) dùng trong middleware.RequirePermission
+const (
+	PermAdminAccess      = "admin.access"       // vào được khu vực /api/admin
+	PermUsersManage      = "users.manage"       // quản lý tài khoản người dùng
+	PermRolesManage      = "roles.manage"       // tạo/sửa vai trò, gán vai trò cho user
+	PermFormsReadAll     = "forms.read_all"     // xem mọi form (chỉ đọc)
+	PermFormsManageAll   = "forms.manage_all"   // thao tác quản trị trên mọi form
+	PermRoomsReadAll     = "rooms.read_all"     // xem mọi room (chỉ đọc)
+	PermRoomsManageAll   = "rooms.manage_all"   // thao tác quản trị trên mọi room
+	PermResponsesReadAll = "responses.read_all" // xem phản hồi của mọi form
+	PermAuditRead        = "audit.read"         // xem nhật ký hệ thống
+	PermStatsRead        = "stats.read"         // xem thống kê toàn hệ thống
+	PermJobsManage       = "jobs.manage"        // xem/huỷ/chạy lại job nền
+)
+
+// Tên các vai trò hệ thống (được seed khi khởi động)
+const (
+	RoleAdmin   = "admin"
+	RoleSupport = "support"
+	RoleAuditor = "auditor"
+)
+
+// Role: vai trò, gồm tập quyền; một user có thể có nhiều vai trò
+type Role struct {
+	ID      uint   `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Ten     string `gorm:"column:ten;size:50;not null;uniqueIndex" json:"ten"`
+	MoTa    string `gorm:"column:mo_ta;type:text" json:"mo_ta"`
+	HeThong bool   `gorm:"column:he_thong;not null;default:false" json:"he_thong"` // vai trò hệ thống, không xoá được
+
+	Permissions []Permission `gorm:"many2many:role_permissions;constraint:OnDelete:CASCADE" json:"permissions"`
+}
+
+func (Role) TableName() string {
+	return "roles"
+}
+
+// Permission: một quyền cụ thể, mã dạng <nhóm>.<hành động>
+type Permission struct {
+	ID   uint   `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Ma   string `gorm:"column:ma;size:50;not null;uniqueIndex" json:"ma"`
+	MoTa string `gorm:"column:mo_ta;type:text" json:"mo_ta"`
+}
+
+func (Permission) TableName() string {
+	return "permissions"
+}
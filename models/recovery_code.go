@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// RecoveryCode: mã khôi phục dùng một lần khi mất thiết bị 2FA (chỉ lưu hash)
+type RecoveryCode struct {
+	ID          uint       `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	NguoiDungID uint       `gorm:"column:nguoi_dung_id;not null;index" json:"nguoi_dung_id"`
+	CodeHash    string     `gorm:"column:code_hash;size:64;not null" json:"-"`
+	UsedAt      *time.Time `gorm:"column:used_at" json:"used_at"`
+	CreatedAt   time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+
+	NguoiDung *NguoiDung `gorm:"foreignKey:NguoiDungID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+}
+
+func (RecoveryCode) TableName() string {
+	return "recovery_codes"
+}
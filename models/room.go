@@ -20,6 +20,9 @@ type Room struct {
 	ThamGias    []RoomNguoiThamGia `gorm:"foreignKey:RoomID" json:"-"`
 	IsLocked    bool               `gorm:"column:is_locked;default:false" json:"is_locked"`
 	KhaoSat     KhaoSat            `gorm:"foreignKey:KhaoSatID;references:ID" json:"khao_sat"`
+
+	// Admin lưu trữ cưỡng chế (room vi phạm): owner không tự khôi phục được
+	ForceArchivedAt *time.Time `gorm:"column:force_archived_at" json:"force_archived_at,omitempty"`
 }
 
 func (Room) TableName() string {
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// ScheduledTask: trạng thái của một tác vụ định kỳ, dùng chung giữa các instance
+// để mỗi lần chạy theo lịch chỉ được thực hiện một lần
+type ScheduledTask struct {
+	Name           string     `gorm:"column:name;primaryKey;size:64" json:"name"`
+	Spec           string     `gorm:"column:spec;size:100;not null" json:"spec"` // biểu thức cron
+	NextRunAt      time.Time  `gorm:"column:next_run_at;not null" json:"next_run_at"`
+	LastRunAt      *time.Time `gorm:"column:last_run_at" json:"last_run_at"`
+	LastDurationMs int64      `gorm:"column:last_duration_ms" json:"last_duration_ms"`
+	LastError      string     `gorm:"column:last_error;type:text" json:"last_error"`
+	LastRunBy      string     `gorm:"column:last_run_by;size:100" json:"last_run_by"`
+	UpdatedAt      time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+func (ScheduledTask) TableName() string {
+	return "scheduled_tasks"
+}
@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// Trạng thái một lần gửi webhook
+const (
+	WebhookPending = "pending" // chờ gửi / chờ thử lại
+	WebhookSuccess = "success"
+	WebhookDead    = "dead" // hết số lần thử (dead-letter), chỉ gửi lại thủ công
+)
+
+// WebhookSubscription: đăng ký nhận sự kiện của một form, hoặc mọi form của user khi KhaoSatID = nil
+type WebhookSubscription struct {
+	ID          uint      `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	NguoiDungID uint      `gorm:"column:nguoi_dung_id;not null;index" json:"nguoi_dung_id"`
+	KhaoSatID   *uint     `gorm:"column:khao_sat_id;index" json:"khao_sat_id"`
+	URL         string    `gorm:"column:url;type:text;not null" json:"url"`
+	Secret      string    `gorm:"column:secret;type:text;not null" json:"-"`      // khoá ký HMAC-SHA256, mã hoá bằng utils.SealSecret
+	Events      string    `gorm:"column:events;type:text;not null" json:"events"` // danh sách cách nhau bởi dấu phẩy, "*" = tất cả
+	Active      bool      `gorm:"column:active;not null;default:true" json:"active"`
+	CreatedAt   time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+
+	NguoiDung *NguoiDung `gorm:"foreignKey:NguoiDungID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+	KhaoSat   *KhaoSat   `gorm:"foreignKey:KhaoSatID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+}
+
+func (WebhookSubscription) TableName() string {
+	return "webhook_subscriptions"
+}
+
+// WebhookDelivery: một sự kiện gửi tới một subscription, kèm lịch sử thử lại
+type WebhookDelivery struct {
+	ID             uint       `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	SubscriptionID uint       `gorm:"column:subscription_id;not null;index" json:"subscription_id"`
+	EventID        string     `gorm:"column:event_id;size:36;not null;index" json:"event_id"` // giống nhau giữa các lần gửi lại → bên nhận chống trùng
+	Event          string     `gorm:"column:event;size:64;not null" json:"event"`
+	Payload        string     `gorm:"column:payload;type:text;not null" json:"-"`
+	Status         string     `gorm:"column:status;size:16;not null;index:idx_webhook_due" json:"status"`
+	Attempts       int        `gorm:"column:attempts;not null;default:0" json:"attempts"`
+	NextAttemptAt  time.Time  `gorm:"column:next_attempt_at;index:idx_webhook_due" json:"next_attempt_at"`
+	LastStatusCode int        `gorm:"column:last_status_code" json:"last_status_code"`
+	LastError      string     `gorm:"column:last_error;type:text" json:"last_error"`
+	DeliveredAt    *time.Time `gorm:"column:delivered_at" json:"delivered_at"`
+	RedeliveryOf   *uint      `gorm:"column:redelivery_of" json:"redelivery_of"` // gửi lại thủ công từ delivery nào
+	CreatedAt      time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+
+	Subscription *WebhookSubscription `gorm:"foreignKey:SubscriptionID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+}
+
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
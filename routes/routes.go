@@ -4,6 +4,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/vnkhanh/survey-server/controllers"
 	"github.com/vnkhanh/survey-server/middleware"
+	"github.com/vnkhanh/survey-server/models"
+	"github.com/vnkhanh/survey-server/utils"
 )
 
 func SetupRoutes(r *gin.Engine) {
@@ -22,8 +24,17 @@ func SetupRoutes(r *gin.Engine) {
 		}
 		auth := api.Group("/auth")
 		{
-			auth.POST("/login", controllers.Login)
-			auth.POST("/google/login", controllers.GoogleLoginHandler)
+			auth.POST("/login", middleware.RateLimit(middleware.PolicyLogin), controllers.Login)
+			auth.POST("/google/login", middleware.RateLimit(middleware.PolicyLogin), controllers.GoogleLoginHandler)
+			auth.GET("/oidc/providers", controllers.ListOIDCProviders)
+			auth.POST("/oidc/nonce", controllers.IssueOIDCNonce)
+			auth.POST("/oidc/:provider/login", middleware.RateLimit(middleware.PolicyLogin), controllers.OIDCLoginHandler)
+			// Xác thực 2 lớp (TOTP)
+			auth.POST("/2fa/verify", middleware.RateLimit(middleware.PolicyLogin), controllers.VerifyTwoFactorLogin) // bước 2 của đăng nhập
+			auth.POST("/2fa/setup", middleware.AuthJWT(), controllers.SetupTwoFactor)
+			auth.POST("/2fa/enable", middleware.AuthJWT(), controllers.EnableTwoFactor)
+			auth.POST("/2fa/disable", middleware.AuthJWT(), controllers.DisableTwoFactor)
+			auth.POST("/2fa/recovery-codes", middleware.AuthJWT(), controllers.RegenerateRecoveryCodes)
 		}
 		protected := api.Group("/")
 		protected.Use(middleware.AuthJWT())
@@ -31,19 +42,77 @@ func SetupRoutes(r *gin.Engine) {
 			protected.GET("/me", controllers.Me)
 		}
 
+		// API key cá nhân cho script tự động (chỉ quản lý được bằng phiên đăng nhập JWT)
+		apiKeys := api.Group("/api-keys")
+		apiKeys.Use(middleware.AuthJWT())
+		{
+			apiKeys.GET("", controllers.ListAPIKeys)
+			apiKeys.POST("", controllers.CreateAPIKey)
+			apiKeys.DELETE("/:id", controllers.RevokeAPIKey)
+		}
+
+		// Webhook gửi sự kiện form/phản hồi ra hệ thống ngoài
+		webhooks := api.Group("/webhooks")
+		webhooks.Use(middleware.AuthJWT())
+		{
+			webhooks.GET("", controllers.ListWebhooks)
+			webhooks.POST("", controllers.CreateWebhook)
+			webhooks.PATCH("/:id", controllers.UpdateWebhook)
+			webhooks.DELETE("/:id", controllers.DeleteWebhook)
+			webhooks.POST("/:id/rotate-secret", controllers.RotateWebhookSecret)
+			webhooks.GET("/:id/deliveries", controllers.ListWebhookDeliveries)
+			webhooks.POST("/:id/deliveries/:delivery_id/redeliver", controllers.RedeliverWebhook)
+		}
+
 		admin := protected.Group("/admin")
-		admin.Use(middleware.RequireAdmin())
+		admin.Use(middleware.RequirePermission(models.PermAdminAccess))
 		{
-			admin.GET("/only", func(c *gin.Context) {
-				c.JSON(200, gin.H{"ok": true})
-			})
+			admin.GET("/stats", middleware.RequirePermission(models.PermStatsRead), controllers.AdminStats)
+
+			// Người dùng
+			admin.GET("/users", middleware.RequirePermission(models.PermUsersManage), controllers.AdminListUsers)
+			admin.GET("/users/:id", middleware.RequirePermission(models.PermUsersManage), controllers.AdminGetUser)
+			admin.POST("/users/:id/disable", middleware.RequirePermission(models.PermUsersManage), controllers.AdminDisableUser)
+			admin.POST("/users/:id/enable", middleware.RequirePermission(models.PermUsersManage), controllers.AdminEnableUser)
+			admin.POST("/users/:id/reset-password", middleware.RequirePermission(models.PermUsersManage), controllers.AdminResetPassword)
+			admin.POST("/users/:id/unlock", middleware.RequirePermission(models.PermUsersManage), controllers.AdminUnlockUser)
+			admin.GET("/lockouts", middleware.RequirePermission(models.PermUsersManage), controllers.AdminListLockouts)
+			admin.DELETE("/lockouts/:id", middleware.RequirePermission(models.PermUsersManage), controllers.AdminClearLockout)
+
+			// Form & room
+			admin.GET("/forms", middleware.RequirePermission(models.PermFormsReadAll), controllers.AdminListForms)
+			admin.POST("/forms/:id/transfer", middleware.RequirePermission(models.PermFormsManageAll), controllers.AdminTransferForm)
+			admin.POST("/forms/:id/archive", middleware.RequirePermission(models.PermFormsManageAll), controllers.AdminArchiveForm)
+			admin.POST("/forms/:id/restore", middleware.RequirePermission(models.PermFormsManageAll), controllers.AdminRestoreForm)
+			admin.GET("/rooms", middleware.RequirePermission(models.PermRoomsReadAll), controllers.AdminListRooms)
+			admin.POST("/rooms/:id/transfer", middleware.RequirePermission(models.PermRoomsManageAll), controllers.AdminTransferRoom)
+			admin.POST("/rooms/:id/archive", middleware.RequirePermission(models.PermRoomsManageAll), controllers.AdminArchiveRoom)
+			admin.POST("/rooms/:id/restore", middleware.RequirePermission(models.PermRoomsManageAll), controllers.AdminRestoreRoom)
+
+			// Job chạy nền
+			admin.GET("/jobs", middleware.RequirePermission(models.PermJobsManage), controllers.AdminListJobs)
+			admin.POST("/jobs/:id/cancel", middleware.RequirePermission(models.PermJobsManage), controllers.AdminCancelJob)
+			admin.POST("/jobs/:id/retry", middleware.RequirePermission(models.PermJobsManage), controllers.AdminRetryJob)
+			admin.GET("/scheduled-tasks", middleware.RequirePermission(models.PermJobsManage), controllers.AdminListScheduledTasks)
+			admin.POST("/scheduled-tasks/:name/run", middleware.RequirePermission(models.PermJobsManage), controllers.AdminRunScheduledTask)
+
+			// Nhật ký hệ thống
+			admin.GET("/audit-logs", middleware.RequirePermission(models.PermAuditRead), controllers.ListAuditLogs)
+			admin.GET("/audit-logs/export", middleware.RequirePermission(models.PermAuditRead), controllers.ExportAuditLogs)
+
+			// Phân quyền (RBAC)
+			admin.GET("/permissions", middleware.RequirePermission(models.PermRolesManage), controllers.ListPermissions)
+			admin.GET("/roles", middleware.RequirePermission(models.PermRolesManage), controllers.ListRoles)
+			admin.POST("/roles", middleware.RequirePermission(models.PermRolesManage), controllers.CreateRole)
+			admin.PUT("/roles/:id", middleware.RequirePermission(models.PermRolesManage), controllers.UpdateRole)
+			admin.DELETE("/roles/:id", middleware.RequirePermission(models.PermRolesManage), controllers.DeleteRole)
+			admin.GET("/users/:id/roles", middleware.RequirePermission(models.PermRolesManage), controllers.GetUserRoles)
+			admin.PUT("/users/:id/roles", middleware.RequirePermission(models.PermRolesManage), controllers.SetUserRoles)
 		}
 		forms := api.Group("/forms")
 		{
 			forms.Use(middleware.AuthJWT())
-			forms.POST("", middleware.RateLimitFormsCreate(), controllers.CreateForm) // BE-01
-			forms.GET("/:id", controllers.GetFormDetail)                              // BE-02
-			forms.GET("/:id/settings", controllers.GetFormSettings)                   // BE-10
+			forms.POST("", middleware.RateLimit(middleware.PolicyFormsCreate), controllers.CreateForm) // BE-01
 			// Ghi: cần quyền editor (JWT owner hoặc Edit Token)
 			forms.PUT("/:id", middleware.CheckFormEditor(), controllers.UpdateForm)                         // BE-03
 			forms.DELETE("/:id", middleware.CheckFormEditor(), controllers.DeleteForm)                      // BE-04
@@ -52,22 +121,57 @@ func SetupRoutes(r *gin.Engine) {
 			forms.POST("/:id/questions", middleware.CheckFormEditor(), controllers.AddQuestion)             // BE-05
 			forms.PUT("/:id/questions/reorder", middleware.CheckFormEditor(), controllers.ReorderQuestions) // BE-08
 			forms.PUT("/:id/settings", middleware.CheckFormEditor(), controllers.UpdateFormSettings)        // BE-09
+			// Spam: đánh dấu thủ công / xoá hàng loạt phản hồi spam
+			forms.PATCH("/:id/submissions/:sub_id/spam", middleware.CheckFormEditor(), controllers.MarkSubmissionSpam)
+			forms.DELETE("/:id/submissions/spam", middleware.CheckFormEditor(), controllers.PurgeSpamSubmissions)
 			// API cập nhật giới hạn trả lời (chỉ owner/admin)
 			//forms.PATCH("/:id/limit", middleware.CheckFormOwner(), controllers.UpdateFormLimit)
-			forms.POST("/:id/clone", controllers.CloneForm)           // Clone form (bao gồm câu hỏi + lựa chọn) // BE-32
-			forms.GET("/my", controllers.GetMyForms)                  // mới thêm - Lấy form của chính user
-			forms.GET("/:id/submissions", controllers.GetSubmissions) //BE-25
-			forms.GET("/:id/submissions/:sub_id", controllers.GetSubmissionDetail)
-			forms.GET("/:id/dashboard", controllers.GetFormDashboard)
-			forms.POST("/:id/export", middleware.CheckFormEditor(), controllers.CreateExport)
+			forms.POST("/:id/clone", controllers.CloneForm) // Clone form (bao gồm câu hỏi + lựa chọn) // BE-32
 			forms.POST("/:id/share", middleware.CheckFormOwner(), controllers.ShareForm)
 			forms.PUT("/:id/updateform", middleware.CheckFormOwner(), controllers.UpdateFormWithQuestions)
 
 			forms.PUT("/:id/update-publiclink", middleware.CheckFormOwner(), controllers.UpdatePublicLink)
+
+			// Preset xuất dữ liệu của form (chỉ owner)
+			forms.GET("/:id/export-presets", middleware.CheckFormOwner(), controllers.ListExportPresets)
+			forms.POST("/:id/export-presets", middleware.CheckFormOwner(), controllers.CreateExportPreset)
+			forms.PUT("/:id/export-presets/:preset_id", middleware.CheckFormOwner(), controllers.UpdateExportPreset)
+			forms.DELETE("/:id/export-presets/:preset_id", middleware.CheckFormOwner(), controllers.DeleteExportPreset)
+			forms.GET("/:id/export-schedules", middleware.CheckFormOwner(), controllers.ListExportSchedules)
+			forms.POST("/:id/export-schedules", middleware.CheckFormOwner(), controllers.CreateExportSchedule)
+			forms.GET("/:id/export-schedules/:schedule_id", middleware.CheckFormOwner(), controllers.GetExportSchedule)
+			forms.PATCH("/:id/export-schedules/:schedule_id", middleware.CheckFormOwner(), controllers.UpdateExportSchedule)
+			forms.DELETE("/:id/export-schedules/:schedule_id", middleware.CheckFormOwner(), controllers.DeleteExportSchedule)
+			forms.GET("/:id/export-schedules/:schedule_id/runs", middleware.CheckFormOwner(), controllers.ListExportScheduleRuns)
+			forms.POST("/:id/export-schedules/:schedule_id/run", middleware.CheckFormOwner(), controllers.RunExportScheduleNow)
+			forms.GET("/:id/imports", middleware.CheckFormOwner(), controllers.ListImports)
+			forms.POST("/:id/imports", middleware.CheckFormOwner(), controllers.CreateImport)
+			forms.GET("/:id/imports/:import_id", middleware.CheckFormOwner(), controllers.GetImport)
+			forms.PATCH("/:id/imports/:import_id", middleware.CheckFormOwner(), controllers.UpdateImport)
+			forms.DELETE("/:id/imports/:import_id", middleware.CheckFormOwner(), controllers.DeleteImport)
+			forms.POST("/:id/imports/:import_id/commit", middleware.CheckFormOwner(), controllers.CommitImport)
+		}
+		// Các route đọc dữ liệu/xuất file: chấp nhận cả JWT lẫn API key (giới hạn theo scope)
+		formsAPI := api.Group("/forms")
+		formsAPI.Use(middleware.AuthJWTOrAPIKey())
+		{
+			formsAPI.GET("/:id", middleware.RequireScope(utils.ScopeFormsRead), middleware.CheckFormReader(models.PermFormsReadAll), controllers.GetFormDetail)                      // BE-02
+			formsAPI.GET("/:id/settings", middleware.RequireScope(utils.ScopeFormsRead), middleware.CheckFormReader(models.PermFormsReadAll), controllers.GetFormSettings)           // BE-10
+			formsAPI.GET("/my", middleware.RequireScope(utils.ScopeFormsRead), controllers.GetMyForms)                                                                               // mới thêm - Lấy form của chính user
+			formsAPI.GET("/:id/submissions", middleware.RequireScope(utils.ScopeResponsesRead), middleware.CheckFormReader(models.PermResponsesReadAll), controllers.GetSubmissions) //BE-25
+			formsAPI.GET("/:id/submissions/:sub_id", middleware.RequireScope(utils.ScopeResponsesRead), controllers.GetSubmissionDetail)
+			formsAPI.GET("/:id/submissions/:sub_id/files/:question_id", middleware.RequireScope(utils.ScopeResponsesRead), controllers.DownloadSubmissionFile)
+			formsAPI.GET("/:id/dashboard", middleware.RequireScope(utils.ScopeResponsesRead), middleware.CheckFormReader(models.PermResponsesReadAll), controllers.GetFormDashboard)
+			formsAPI.POST("/:id/export", middleware.RequireScope(utils.ScopeExportsWrite), middleware.CheckFormReader(models.PermResponsesReadAll), middleware.RateLimit(middleware.PolicyExport), controllers.CreateExport)
+			formsAPI.GET("/:id/exports", middleware.RequireScope(utils.ScopeExportsWrite), middleware.CheckFormReader(models.PermResponsesReadAll), controllers.ListFormExports)
 		}
 		api.GET("/forms/public/:shareToken", controllers.GetPublicForm) // BE-20  ĐỂ YÊN ROUTE NÀY NHA KHÔNG ĐỔI GÌ HẾT
-		api.POST("/uploads", controllers.UploadFile)
-		api.GET("/exports/:job_id", middleware.AuthJWT(), controllers.GetExport)
+		api.POST("/uploads", middleware.RateLimit(middleware.PolicyUpload), controllers.UploadFile)
+		api.GET("/files/*key", controllers.ServeUploadedFile)        // kho local: URL công khai của file tải lên
+		api.GET("/file-downloads", controllers.DownloadUploadedFile) // kho local: link ký HMAC
+		api.GET("/exports/:job_id", middleware.AuthJWTOrAPIKey(), middleware.RequireScope(utils.ScopeExportsWrite), middleware.CheckExportJob(), controllers.GetExport)
+		api.DELETE("/exports/:job_id", middleware.AuthJWTOrAPIKey(), middleware.RequireScope(utils.ScopeExportsWrite), middleware.CheckExportJob(), controllers.CancelExport)
+		api.GET("/export-downloads", controllers.DownloadExportFile) // link ký HMAC, không cần đăng nhập
 
 		api.PUT("/questions/:id", middleware.AuthJWT(), middleware.CheckQuestionEditor(), controllers.UpdateQuestion)    // BE-06
 		api.DELETE("/questions/:id", middleware.AuthJWT(), middleware.CheckQuestionEditor(), controllers.DeleteQuestion) // BE-07
@@ -115,7 +219,7 @@ func SetupRoutes(r *gin.Engine) {
 
 		}
 		api.GET("/lobby", controllers.GetLobbyRooms) //BE21 Lấy danh sách room public (lobby)
-		api.POST("/forms/:id/submissions", middleware.OptionalAuth(), controllers.SubmitSurvey)
+		api.POST("/forms/:id/submissions", middleware.OptionalAuth(), middleware.RateLimit(middleware.PolicySubmission, middleware.PolicySubmissionForm), controllers.SubmitSurvey)
 		// routes/room_routes.go
 		r.POST("/api/rooms/:id/share", middleware.AuthJWT(), controllers.ShareRoom) // tạo/lấy ShareURL
 		r.GET("/api/rooms/share/:shareURL", controllers.GetRoomByShareURL)          // truy cập room qua ShareURL (public)
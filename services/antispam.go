@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vnkhanh/survey-server/utils"
+)
+
+// Thời hạn challenge phát kèm form public
+const formChallengeTTL = 2 * time.Hour
+
+// HoneypotField: tên trường ẩn; người thật không thấy nên luôn để trống
+const HoneypotField = "website"
+
+// SpamSignals: dữ liệu của một lần gửi phản hồi dùng để chấm điểm spam
+type SpamSignals struct {
+	FormID         uint
+	ChallengeToken string
+	ChallengeNonce string
+	Honeypot       string
+	Challenge      *utils.FormChallengeClaims // challenge đã xác minh (nil nếu thiếu/sai)
+	IP             string
+	UserAgent      string
+	Now            time.Time
+}
+
+// ChallengeVerifier: một cơ chế chống bot. Issue trả dữ liệu gửi kèm form (nil = không cần),
+// Verify trả điểm spam (0-100) và lý do khi có dấu hiệu bất thường.
+type ChallengeVerifier interface {
+	Name() string
+	Issue(claims *utils.FormChallengeClaims, cfg utils.AntiSpamConfig) map[string]interface{}
+	Verify(ctx context.Context, s SpamSignals, cfg utils.AntiSpamConfig) (score int, reason string)
+}
+
+var (
+	verifiersMu sync.RWMutex
+	verifiers   = []ChallengeVerifier{powVerifier{}, honeypotVerifier{}, fillTimeVerifier{}}
+)
+
+// RegisterChallengeVerifier thêm một cơ chế kiểm tra (vd. captcha bên thứ ba)
+func RegisterChallengeVerifier(v ChallengeVerifier) {
+	verifiersMu.Lock()
+	defer verifiersMu.Unlock()
+	verifiers = append(verifiers, v)
+}
+
+func currentVerifiers() []ChallengeVerifier {
+	verifiersMu.RLock()
+	defer verifiersMu.RUnlock()
+	return append([]ChallengeVerifier(nil), verifiers...)
+}
+
+// IssueFormChallenge tạo challenge phát kèm GetPublicForm (nil nếu form tắt chống spam)
+func IssueFormChallenge(formID uint, cfg utils.AntiSpamConfig) (map[string]interface{}, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	token, claims, err := utils.GenerateFormChallenge(formID, cfg.PowDifficulty, formChallengeTTL)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]interface{}{
+		"token":      token,
+		"expires_at": claims.ExpiresAt.Time,
+	}
+	for _, v := range currentVerifiers() {
+		if data := v.Issue(claims, cfg); data != nil {
+			out[v.Name()] = data
+		}
+	}
+	return out, nil
+}
+
+// SpamResult: tổng điểm (tối đa 100) và lý do của từng cơ chế
+type SpamResult struct {
+	Score   int
+	Reasons []string
+	IsSpam  bool
+
+	challenge *utils.FormChallengeClaims // challenge proof-of-work hợp lệ, chờ ConsumeFormChallenge
+}
+
+// ScoreSubmission chạy mọi verifier và cộng điểm
+func ScoreSubmission(ctx context.Context, s SpamSignals, cfg utils.AntiSpamConfig) SpamResult {
+	var res SpamResult
+	if !cfg.Enabled {
+		return res
+	}
+	if s.Now.IsZero() {
+		s.Now = time.Now()
+	}
+	if s.ChallengeToken != "" {
+		if claims, err := utils.VerifyFormChallenge(s.ChallengeToken, s.FormID); err == nil {
+			s.Challenge = claims
+		}
+	}
+	if cfg.PowDifficulty > 0 {
+		res.challenge = s.Challenge
+	}
+
+	for _, v := range currentVerifiers() {
+		score, reason := v.Verify(ctx, s, cfg)
+		if score <= 0 {
+			continue
+		}
+		res.Score += score
+		res.Reasons = append(res.Reasons, v.Name()+": "+reason)
+	}
+	if res.Score > 100 {
+		res.Score = 100
+	}
+	res.IsSpam = res.Score >= cfg.SpamThreshold
+	return res
+}
+
+// ====== Proof-of-work ======
+
+type powVerifier struct{}
+
+func (powVerifier) Name() string { return "pow" }
+
+func (powVerifier) Issue(claims *utils.FormChallengeClaims, cfg utils.AntiSpamConfig) map[string]interface{} {
+	if cfg.PowDifficulty <= 0 {
+		return nil
+	}
+	return map[string]interface{}{
+		"algorithm":  "sha256",
+		"salt":       claims.Salt,
+		"difficulty": claims.Difficulty, // client tìm nonce sao cho sha256(salt + ":" + nonce) có đủ số bit 0 ở đầu
+	}
+}
+
+func (powVerifier) Verify(ctx context.Context, s SpamSignals, cfg utils.AntiSpamConfig) (int, string) {
+	if cfg.PowDifficulty <= 0 {
+		return 0, ""
+	}
+	if s.ChallengeToken == "" {
+		return 50, "thiếu challenge"
+	}
+	if s.Challenge == nil {
+		return 60, "challenge không hợp lệ hoặc đã hết hạn"
+	}
+	if !utils.CheckProofOfWork(s.Challenge.Salt, s.ChallengeNonce, s.Challenge.Difficulty) {
+		return 60, "proof-of-work sai"
+	}
+	// Mỗi challenge chỉ dùng được một lần (đánh dấu trong transaction lưu phản hồi: ConsumeFormChallenge)
+	if _, used, err := SharedStore().Get(ctx, powUsedKey(s.Challenge.Salt)); err == nil && used {
+		return 60, "challenge đã được dùng"
+	}
+	return 0, ""
+}
+
+func powUsedKey(salt string) string { return "antispam:pow:" + salt }
+
+// ErrChallengeUsed: challenge đã được một phản hồi khác dùng
+var ErrChallengeUsed = errors.New("challenge đã được dùng")
+
+// ConsumeFormChallenge đánh dấu challenge proof-of-work của res đã dùng; gọi trong transaction lưu phản hồi.
+// release xoá dấu, gọi khi transaction rollback để người gửi thử lại được với challenge cũ
+func ConsumeFormChallenge(ctx context.Context, res SpamResult) (release func(), err error) {
+	release = func() {}
+	if res.challenge == nil {
+		return release, nil
+	}
+	key := powUsedKey(res.challenge.Salt)
+	ok, err := SharedStore().SetNX(ctx, key, "1", time.Until(res.challenge.ExpiresAt.Time))
+	if err != nil {
+		return release, err
+	}
+	if !ok {
+		return release, ErrChallengeUsed
+	}
+	return func() {
+		if err := SharedStore().Del(context.Background(), key); err != nil {
+			log.Printf("[antispam] release challenge: %v", err)
+		}
+	}, nil
+}
+
+// ====== Honeypot ======
+
+type honeypotVerifier struct{}
+
+func (honeypotVerifier) Name() string { return "honeypot" }
+
+func (honeypotVerifier) Issue(*utils.FormChallengeClaims, utils.AntiSpamConfig) map[string]interface{} {
+	return map[string]interface{}{"field": HoneypotField}
+}
+
+func (honeypotVerifier) Verify(_ context.Context, s SpamSignals, _ utils.AntiSpamConfig) (int, string) {
+	if strings.TrimSpace(s.Honeypot) != "" {
+		return 100, "trường ẩn có dữ liệu"
+	}
+	return 0, ""
+}
+
+// ====== Thời gian điền tối thiểu ======
+
+type fillTimeVerifier struct{}
+
+func (fillTimeVerifier) Name() string { return "fill_time" }
+
+func (fillTimeVerifier) Issue(_ *utils.FormChallengeClaims, cfg utils.AntiSpamConfig) map[string]interface{} {
+	if cfg.MinFillSeconds <= 0 {
+		return nil
+	}
+	return map[string]interface{}{"min_seconds": cfg.MinFillSeconds}
+}
+
+func (fillTimeVerifier) Verify(_ context.Context, s SpamSignals, cfg utils.AntiSpamConfig) (int, string) {
+	if cfg.MinFillSeconds <= 0 || s.Challenge == nil {
+		// không có thời điểm mở form đáng tin cậy → phần thiếu challenge đã được pow tính điểm
+		return 0, ""
+	}
+	elapsed := s.Now.Sub(s.Challenge.IssuedAt.Time)
+	if elapsed < time.Duration(cfg.MinFillSeconds)*time.Second {
+		return 40, fmt.Sprintf("điền trong %.1fs", elapsed.Seconds())
+	}
+	return 0, ""
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/vnkhanh/survey-server/utils"
+)
+
+// solvePow: tìm nonce thoả proof-of-work của challenge (độ khó nhỏ trong test)
+func solvePow(claims *utils.FormChallengeClaims) string {
+	for i := 0; ; i++ {
+		if n := strconv.Itoa(i); utils.CheckProofOfWork(claims.Salt, n, claims.Difficulty) {
+			return n
+		}
+	}
+}
+
+func TestFormChallengeReleasedOnRollback(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	prev := SharedStore()
+	SetStore(NewMemoryStore())
+	t.Cleanup(func() { SetStore(prev) })
+
+	ctx := context.Background()
+	cfg := utils.AntiSpamConfig{Enabled: true, PowDifficulty: 4, SpamThreshold: 50}
+	token, claims, err := utils.GenerateFormChallenge(9, cfg.PowDifficulty, formChallengeTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signals := SpamSignals{FormID: 9, ChallengeToken: token, ChallengeNonce: solvePow(claims)}
+
+	res := ScoreSubmission(ctx, signals, cfg)
+	if res.Score != 0 {
+		t.Fatalf("challenge hợp lệ bị chấm %d: %v", res.Score, res.Reasons)
+	}
+	// chấm điểm không tiêu challenge
+	if again := ScoreSubmission(ctx, signals, cfg); again.Score != 0 {
+		t.Fatalf("chấm lần hai: %d %v", again.Score, again.Reasons)
+	}
+
+	// transaction rollback → trả challenge lại
+	release, err := ConsumeFormChallenge(ctx, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ConsumeFormChallenge(ctx, res); !errors.Is(err, ErrChallengeUsed) {
+		t.Fatalf("dùng song song: %v, muốn ErrChallengeUsed", err)
+	}
+	release()
+
+	// gửi lại sau rollback: challenge vẫn dùng được, sau khi commit thì bị đánh dấu
+	if _, err := ConsumeFormChallenge(ctx, ScoreSubmission(ctx, signals, cfg)); err != nil {
+		t.Fatalf("sau rollback: %v", err)
+	}
+	if used := ScoreSubmission(ctx, signals, cfg); used.Score == 0 {
+		t.Error("challenge đã dùng vẫn được chấm 0 điểm")
+	}
+}
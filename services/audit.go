@@ -0,0 +1,106 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/vnkhanh/survey-server/models"
+	"gorm.io/gorm"
+)
+
+// AuditEntry: dữ liệu một dòng nhật ký trước khi ghi
+type AuditEntry struct {
+	ActorType  string
+	ActorID    *uint
+	APIKeyID   *uint
+	Action     string
+	TargetType string
+	TargetID   interface{}
+	Metadata   interface{} // được marshal thành JSON
+	Before     interface{} // trạng thái trước (nil khi tạo mới)
+	After      interface{} // trạng thái sau (nil khi xoá)
+	IP         string
+}
+
+// AuditChange: thay đổi của một trường
+type AuditChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// RecordAudit ghi một dòng nhật ký; truyền tx để nhật ký cùng commit/rollback với thao tác
+func RecordAudit(db *gorm.DB, e AuditEntry) error {
+	row := models.AuditLog{
+		ActorType:  e.ActorType,
+		ActorID:    e.ActorID,
+		APIKeyID:   e.APIKeyID,
+		Action:     e.Action,
+		TargetType: e.TargetType,
+		IP:         e.IP,
+	}
+	if row.ActorType == "" {
+		row.ActorType = models.ActorSystem
+	}
+	if e.TargetID != nil {
+		row.TargetID = fmt.Sprint(e.TargetID)
+	}
+
+	var err error
+	if row.Metadata, err = marshalAudit(e.Metadata); err != nil {
+		return err
+	}
+	if row.Before, err = marshalAudit(e.Before); err != nil {
+		return err
+	}
+	if row.After, err = marshalAudit(e.After); err != nil {
+		return err
+	}
+	if changes := AuditDiff(row.Before, row.After); len(changes) > 0 {
+		b, err := json.Marshal(changes)
+		if err != nil {
+			return err
+		}
+		row.Changes = string(b)
+	}
+	return db.Create(&row).Error
+}
+
+// AuditDiff so sánh hai JSON object ở mức trường đầu tiên; phía rỗng coi như object trống
+func AuditDiff(beforeJSON, afterJSON string) map[string]AuditChange {
+	before := map[string]interface{}{}
+	after := map[string]interface{}{}
+	if beforeJSON != "" && json.Unmarshal([]byte(beforeJSON), &before) != nil {
+		return nil
+	}
+	if afterJSON != "" && json.Unmarshal([]byte(afterJSON), &after) != nil {
+		return nil
+	}
+
+	out := map[string]AuditChange{}
+	for k, v := range before {
+		if !reflect.DeepEqual(v, after[k]) {
+			out[k] = AuditChange{From: v, To: after[k]}
+		}
+	}
+	for k, v := range after {
+		if _, ok := before[k]; !ok {
+			out[k] = AuditChange{From: nil, To: v}
+		}
+	}
+	return out
+}
+
+func marshalAudit(v interface{}) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return "", nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
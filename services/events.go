@@ -0,0 +1,219 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vnkhanh/survey-server/config"
+	"github.com/vnkhanh/survey-server/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Các sự kiện nghiệp vụ phát qua outbox
+const (
+	EventSubmissionCreated = "submission.created"
+	EventFormPublished     = "form.published"
+	EventFormClosed        = "form.closed"
+	EventExportDone        = "export.done"
+
+	EventExportScheduleFailed = "export.schedule_failed" // lần chạy lịch xuất thất bại (xuất hoặc giao file)
+)
+
+const (
+	outboxBatch       = 50
+	outboxPoll        = time.Second
+	outboxLease       = time.Minute // giữ event khi đang xử lý; instance chết thì event tự được nhận lại
+	outboxBaseBackoff = 5 * time.Second
+	outboxMaxBackoff  = time.Hour
+	eventHandlerLimit = 30 * time.Second
+)
+
+// Event: sự kiện giao cho subscriber. ID giữ nguyên giữa các lần giao lại → subscriber dùng để chống trùng.
+type Event struct {
+	ID         string
+	Type       string
+	FormID     uint
+	OccurredAt time.Time
+	Data       json.RawMessage
+}
+
+// EventHandler xử lý một sự kiện. Có thể được gọi nhiều lần cho cùng một sự kiện
+// (giao ít nhất một lần) nên phải idempotent; trả lỗi để được thử lại sau.
+type EventHandler func(ctx context.Context, e Event) error
+
+type eventSubscriber struct {
+	name    string
+	types   map[string]bool // rỗng = mọi sự kiện
+	handler EventHandler
+}
+
+var (
+	eventMu          sync.RWMutex
+	eventSubscribers []eventSubscriber
+)
+
+// SubscribeEvent đăng ký subscriber trong tiến trình. name phải cố định giữa các lần chạy
+// vì được lưu lại để biết subscriber nào đã xử lý xong sự kiện.
+func SubscribeEvent(name string, handler EventHandler, types ...string) {
+	s := eventSubscriber{name: name, types: map[string]bool{}, handler: handler}
+	for _, t := range types {
+		s.types[t] = true
+	}
+	eventMu.Lock()
+	eventSubscribers = append(eventSubscribers, s)
+	eventMu.Unlock()
+}
+
+// PublishEvent ghi sự kiện vào outbox trong transaction tx của thao tác:
+// thao tác rollback thì sự kiện cũng mất, commit thì chắc chắn sẽ được giao
+func PublishEvent(tx *gorm.DB, eventType string, formID uint, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	ev := models.OutboxEvent{
+		EventID:       uuid.New().String(),
+		Type:          eventType,
+		Payload:       string(b),
+		NextAttemptAt: now,
+	}
+	if formID != 0 {
+		ev.KhaoSatID = &formID
+	}
+	return tx.Create(&ev).Error
+}
+
+// StartEventDispatcher chạy nền: đọc outbox và giao sự kiện cho subscriber.
+// Nhiều instance chạy song song an toàn nhờ FOR UPDATE SKIP LOCKED + lease.
+func StartEventDispatcher() {
+	go func() {
+		ticker := time.NewTicker(outboxPoll)
+		defer ticker.Stop()
+		for range ticker.C {
+			for {
+				n, err := dispatchOutboxBatch()
+				if err != nil {
+					log.Printf("[outbox] %v", err)
+					break
+				}
+				if n < outboxBatch {
+					break
+				}
+			}
+		}
+	}()
+}
+
+func dispatchOutboxBatch() (int, error) {
+	var batch []models.OutboxEvent
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("dispatched_at IS NULL AND next_attempt_at <= ?", now).
+			Order("id").Limit(outboxBatch).Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		ids := make([]uint, len(batch))
+		for i, e := range batch {
+			ids[i] = e.ID
+		}
+		return tx.Model(&models.OutboxEvent{}).Where("id IN ?", ids).
+			Update("next_attempt_at", now.Add(outboxLease)).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, e := range batch {
+		dispatchEvent(e)
+	}
+	return len(batch), nil
+}
+
+// dispatchEvent gọi các subscriber chưa xử lý xong; subscriber lỗi được thử lại với backoff,
+// subscriber đã thành công không bị gọi lại
+func dispatchEvent(row models.OutboxEvent) {
+	done := map[string]bool{}
+	for _, n := range strings.Split(row.DoneHandlers, ",") {
+		if n != "" {
+			done[n] = true
+		}
+	}
+	ev := Event{
+		ID:         row.EventID,
+		Type:       row.Type,
+		OccurredAt: row.CreatedAt,
+		Data:       json.RawMessage(row.Payload),
+	}
+	if row.KhaoSatID != nil {
+		ev.FormID = *row.KhaoSatID
+	}
+
+	eventMu.RLock()
+	subs := append([]eventSubscriber(nil), eventSubscribers...)
+	eventMu.RUnlock()
+
+	var errs []string
+	for _, s := range subs {
+		if done[s.name] || (len(s.types) > 0 && !s.types[row.Type]) {
+			continue
+		}
+		if err := runEventHandler(s, ev); err != nil {
+			errs = append(errs, s.name+": "+err.Error())
+			continue
+		}
+		done[s.name] = true
+	}
+
+	names := make([]string, 0, len(done))
+	for n := range done {
+		names = append(names, n)
+	}
+	updates := map[string]interface{}{
+		"attempts":      row.Attempts + 1,
+		"done_handlers": strings.Join(names, ","),
+		"last_error":    strings.Join(errs, "; "),
+	}
+	if len(errs) == 0 {
+		updates["dispatched_at"] = time.Now()
+	} else {
+		updates["next_attempt_at"] = time.Now().Add(outboxBackoff(row.Attempts + 1))
+	}
+	if err := config.DB.Model(&models.OutboxEvent{}).Where("id = ?", row.ID).Updates(updates).Error; err != nil {
+		log.Printf("[outbox] update event %d: %v", row.ID, err)
+	}
+}
+
+func runEventHandler(s eventSubscriber, ev Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), eventHandlerLimit)
+	defer cancel()
+	return s.handler(ctx, ev)
+}
+
+// outboxBackoff = 5s * 2^(n-1), tối đa 1 giờ. Sự kiện không bao giờ bị bỏ.
+func outboxBackoff(n int) time.Duration {
+	d := outboxBaseBackoff
+	for i := 1; i < n && d < outboxMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > outboxMaxBackoff {
+		d = outboxMaxBackoff
+	}
+	return d
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// ExportBundle ghi file ZIP gồm file dữ liệu, các file đính kèm (attachments/<submission>/q<câu hỏi>/<tên>)
+// và manifest.json liên kết dòng dữ liệu với đường dẫn file
+type ExportBundle struct {
+	zw       *zip.Writer
+	manifest BundleManifest
+}
+
+// BundleManifest: nội dung manifest.json
+type BundleManifest struct {
+	JobID       string             `json:"job_id"`
+	FormID      uint               `json:"form_id"`
+	DataFile    string             `json:"data_file"`
+	CreatedAt   time.Time          `json:"created_at"`
+	Attachments []BundleAttachment `json:"attachments"`
+}
+
+// BundleAttachment: một file đính kèm; Row là số thứ tự dòng trong file dữ liệu (từ 1, không tính header),
+// 0 khi bố cục long (liên kết qua submission_id + question_id)
+type BundleAttachment struct {
+	Row          int    `json:"row,omitempty"`
+	SubmissionID uint   `json:"submission_id"`
+	QuestionID   uint   `json:"question_id"`
+	Path         string `json:"path,omitempty"`
+	Source       string `json:"source"`
+	Size         int64  `json:"size"`
+	External     bool   `json:"external,omitempty"` // URL ngoài: không tải về, file không có trong ZIP
+	Error        string `json:"error,omitempty"`    // không tải được: file không có trong ZIP
+}
+
+// NewExportBundle bắt đầu ghi ZIP vào w
+func NewExportBundle(w io.Writer, jobID string, formID uint) *ExportBundle {
+	return &ExportBundle{
+		zw:       zip.NewWriter(w),
+		manifest: BundleManifest{JobID: jobID, FormID: formID, CreatedAt: time.Now(), Attachments: []BundleAttachment{}},
+	}
+}
+
+// AttachmentPath: đường dẫn của file đính kèm trong ZIP (dùng cả trong ô dữ liệu)
+func AttachmentPath(submissionID, questionID uint, ref string) string {
+	name := path.Base(StorageKey(ref))
+	if name == "." || name == "/" || name == "" {
+		name = "file"
+	}
+	return fmt.Sprintf("attachments/%d/q%d/%s", submissionID, questionID, name)
+}
+
+// AddData chép file dữ liệu vào ZIP
+func (b *ExportBundle) AddData(name string, r io.Reader) error {
+	w, err := b.zw.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		return err
+	}
+	b.manifest.DataFile = name
+	return nil
+}
+
+// AddAttachment tải file qua Storage và thêm vào ZIP. URL ngoài chỉ được ghi vào manifest
+// (external), không tải về; lỗi tải file chỉ ghi vào manifest; lỗi trả về là lỗi ghi ZIP hoặc ctx bị huỷ.
+func (b *ExportBundle) AddAttachment(ctx context.Context, row int, submissionID, questionID uint, ref string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	a := BundleAttachment{Row: row, SubmissionID: submissionID, QuestionID: questionID, Source: ref}
+	defer func() { b.manifest.Attachments = append(b.manifest.Attachments, a) }()
+
+	if IsExternalRef(ref) {
+		a.External = true
+		return nil
+	}
+
+	st, err := AnswerStorage()
+	if err != nil {
+		a.Error = err.Error()
+		return nil
+	}
+	rc, err := st.Get(ctx, StorageKey(ref))
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		a.Error = err.Error()
+		return nil
+	}
+	defer rc.Close()
+
+	p := AttachmentPath(submissionID, questionID, ref)
+	w, err := b.zw.Create(p)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(w, rc)
+	if err != nil {
+		return err
+	}
+	a.Path, a.Size = p, n
+	return nil
+}
+
+// Close ghi manifest.json và kết thúc ZIP
+func (b *ExportBundle) Close() error {
+	w, err := b.zw.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(b.manifest); err != nil {
+		return err
+	}
+	return b.zw.Close()
+}
+
+// Failed: số file đính kèm không tải được
+func (b *ExportBundle) Failed() int {
+	n := 0
+	for _, a := range b.manifest.Attachments {
+		if a.Error != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// BundleDataName: tên file dữ liệu trong ZIP
+func BundleDataName(ext string) string {
+	return "responses." + strings.TrimPrefix(ext, ".")
+}
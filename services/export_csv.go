@@ -0,0 +1,87 @@
+package services
+
+import (
+	"encoding/csv"
+	"io"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// csvExporter: CSV UTF-8 có BOM (Excel mở đúng tiếng Việt)
+type csvExporter struct {
+	w    *csv.Writer
+	cols []ExportColumn
+}
+
+func (e *csvExporter) Begin(w io.Writer, cols []ExportColumn) error {
+	if _, err := w.Write([]byte{0xEF, 0xBB, 0xBF}); err != nil {
+		return err
+	}
+	e.w = csv.NewWriter(w)
+	e.cols = cols
+	header := make([]string, len(cols))
+	for i, c := range cols {
+		header[i] = c.Label
+	}
+	return e.w.Write(header)
+}
+
+func (e *csvExporter) WriteRow(vals []interface{}) error {
+	row := make([]string, len(vals))
+	for i, v := range vals {
+		row[i] = ExportCellText(v, e.cols[i])
+	}
+	return e.w.Write(row)
+}
+
+func (e *csvExporter) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// xlsxExporter: một sheet, dòng 1 là header. Ghi qua StreamWriter: excelize chuyển dữ liệu
+// ra file tạm khi vượt ngưỡng nên bộ nhớ không tăng theo số dòng.
+type xlsxExporter struct {
+	f    *excelize.File
+	sw   *excelize.StreamWriter
+	out  io.Writer
+	cols []ExportColumn
+	row  int
+}
+
+func (e *xlsxExporter) Begin(w io.Writer, cols []ExportColumn) error {
+	e.f = excelize.NewFile()
+	e.out = w
+	e.cols = cols
+	sw, err := e.f.NewStreamWriter(e.f.GetSheetName(e.f.GetActiveSheetIndex()))
+	if err != nil {
+		return err
+	}
+	e.sw = sw
+	header := make([]interface{}, len(cols))
+	for i, c := range cols {
+		header[i] = c.Label
+	}
+	e.row = 1
+	return e.sw.SetRow("A1", header)
+}
+
+func (e *xlsxExporter) WriteRow(vals []interface{}) error {
+	e.row++
+	row := make([]interface{}, len(vals))
+	for i, v := range vals {
+		if v != nil {
+			row[i] = ExportCellText(v, e.cols[i])
+		}
+	}
+	cell, _ := excelize.CoordinatesToCellName(1, e.row)
+	return e.sw.SetRow(cell, row)
+}
+
+func (e *xlsxExporter) Close() error {
+	defer e.f.Close()
+	if err := e.sw.Flush(); err != nil {
+		return err
+	}
+	return e.f.Write(e.out)
+}
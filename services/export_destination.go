@@ -0,0 +1,500 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/vnkhanh/survey-server/config"
+	"github.com/vnkhanh/survey-server/models"
+	"github.com/vnkhanh/survey-server/utils"
+	"golang.org/x/crypto/ssh"
+)
+
+// Loại đích giao file của lịch xuất
+const (
+	DestLocal   = "local"
+	DestSFTP    = "sftp"
+	DestS3      = "s3"
+	DestWebhook = "webhook"
+)
+
+// DestinationTypes: các loại đích hỗ trợ
+var DestinationTypes = []string{DestLocal, DestSFTP, DestS3, DestWebhook}
+
+// DeliveryFile: file xuất cần giao (đã nằm trên đĩa)
+type DeliveryFile struct {
+	Path        string // file tạm trên đĩa
+	Name        string // tên file tại đích
+	ContentType string
+	ScheduleID  uint
+	JobID       string
+	OwnerID     uint // người tạo lịch; đích local giao vào thư mục riêng của người này
+}
+
+// Destination giao file xuất của lịch tới nơi nhận; trả vị trí file tại đích (đường dẫn, URL)
+type Destination interface {
+	Deliver(ctx context.Context, f DeliveryFile) (string, error)
+}
+
+// Các khoá cấu hình bí mật: lưu DB ở dạng mã hoá (utils.SealSecret), không trả về qua API,
+// giữ nguyên khi cập nhật mà không gửi lại
+var destSecretKeys = []string{"password", "private_key", "secret_key", "secret"}
+
+const destTimeout = 5 * time.Minute
+
+// destHTTPClient: client cho đích webhook, chặn kết nối vào mạng nội bộ
+var destHTTPClient = NewOutboundHTTPClient(destTimeout)
+
+// NormalizeDestination kiểm tra cấu hình đích và trả JSON đã chuẩn hoá, khoá bí mật đã mã hoá, để lưu
+// (đích webhook chưa có secret thì được sinh mới). Host đích không được thuộc mạng nội bộ.
+func NormalizeDestination(ctx context.Context, kind string, raw json.RawMessage) (string, error) {
+	var cfg interface{}
+	switch kind {
+	case DestLocal:
+		var c localDestConfig
+		if err := strictDecode(raw, &c); err != nil {
+			return "", err
+		}
+		c.Dir = strings.Trim(filepath.ToSlash(filepath.Clean("/"+c.Dir)), "/")
+		cfg = c
+	case DestSFTP:
+		var c sftpDestConfig
+		if err := strictDecode(raw, &c); err != nil {
+			return "", err
+		}
+		if c.Host == "" || c.User == "" {
+			return "", errors.New("sftp: thiếu host hoặc user")
+		}
+		if c.Password == "" && c.PrivateKey == "" {
+			return "", errors.New("sftp: cần password hoặc private_key")
+		}
+		if c.PrivateKey != "" {
+			if _, err := ssh.ParsePrivateKey([]byte(c.PrivateKey)); err != nil {
+				return "", errors.New("sftp: private_key không hợp lệ")
+			}
+		}
+		if !strings.HasPrefix(c.HostKey, "SHA256:") {
+			return "", errors.New("sftp: host_key phải là fingerprint dạng SHA256:...")
+		}
+		if err := CheckOutboundHost(ctx, c.Host); err != nil {
+			return "", fmt.Errorf("sftp: %v", err)
+		}
+		if c.Port == 0 {
+			c.Port = 22
+		}
+		cfg = c
+	case DestS3:
+		var c S3Config
+		if err := strictDecode(raw, &c); err != nil {
+			return "", err
+		}
+		st, err := NewS3Storage(c)
+		if err != nil {
+			return "", err
+		}
+		// kiểm tra host thật sẽ gọi tới (virtual-host style ghép bucket vào host)
+		if err := CheckOutboundHost(ctx, st.objectURL("").Hostname()); err != nil {
+			return "", fmt.Errorf("s3: %v", err)
+		}
+		cfg = c
+	case DestWebhook:
+		var c webhookDestConfig
+		if err := strictDecode(raw, &c); err != nil {
+			return "", err
+		}
+		u, err := url.Parse(strings.TrimSpace(c.URL))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "", errors.New("webhook: url phải là địa chỉ http(s) hợp lệ")
+		}
+		if err := CheckOutboundHost(ctx, u.Hostname()); err != nil {
+			return "", fmt.Errorf("webhook: %v", err)
+		}
+		c.URL = u.String()
+		if c.Secret == "" {
+			if c.Secret, err = GenerateWebhookSecret(); err != nil {
+				return "", err
+			}
+		}
+		cfg = c
+	default:
+		return "", fmt.Errorf("dest_type không hỗ trợ: %s (%s)", kind, strings.Join(DestinationTypes, ", "))
+	}
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	return mapDestSecrets(string(b), utils.SealSecret)
+}
+
+// mapDestSecrets áp fn lên từng khoá bí mật (khác rỗng) của cấu hình đích
+func mapDestSecrets(cfg string, fn func(string) (string, error)) (string, error) {
+	m := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(cfg), &m); err != nil {
+		return "", err
+	}
+	for _, k := range destSecretKeys {
+		v, _ := m[k].(string)
+		if v == "" {
+			continue
+		}
+		out, err := fn(v)
+		if err != nil {
+			return "", err
+		}
+		m[k] = out
+	}
+	b, err := json.Marshal(m)
+	return string(b), err
+}
+
+// OpenDestination giải mã khoá bí mật của cấu hình đích đã lưu (giá trị cũ chưa mã hoá giữ nguyên)
+func OpenDestination(cfg string) (string, error) {
+	return mapDestSecrets(cfg, utils.OpenSecret)
+}
+
+// KeepDestinationSecrets điền các khoá bí mật mà raw bỏ trống (hoặc gửi lại "***") từ cấu hình cũ (đã giải mã)
+func KeepDestinationSecrets(old string, raw json.RawMessage) json.RawMessage {
+	var prev, next map[string]interface{}
+	if opened, err := OpenDestination(old); err == nil {
+		old = opened
+	}
+	if json.Unmarshal([]byte(old), &prev) != nil || json.Unmarshal(raw, &next) != nil || next == nil {
+		return raw
+	}
+	for _, k := range destSecretKeys {
+		if v, _ := next[k].(string); (v == "" || v == "***") && prev[k] != nil {
+			next[k] = prev[k]
+		}
+	}
+	b, _ := json.Marshal(next)
+	return b
+}
+
+// SealStoredDestinations mã hoá khoá bí mật còn lưu dạng rõ trong cấu hình đích của lịch xuất (dữ liệu cũ)
+func SealStoredDestinations() error {
+	var rows []models.ExportSchedule
+	if err := config.DB.Select("id", "dest_config").Where("dest_config <> ''").Find(&rows).Error; err != nil {
+		return err
+	}
+	n := 0
+	for _, r := range rows {
+		plain := false
+		sealed, err := mapDestSecrets(r.DestConfig, func(v string) (string, error) {
+			if utils.IsSealedSecret(v) {
+				return v, nil
+			}
+			plain = true
+			return utils.SealSecret(v)
+		})
+		if err != nil || !plain {
+			continue
+		}
+		if err := config.DB.Model(&models.ExportSchedule{}).Where("id = ?", r.ID).
+			Update("dest_config", sealed).Error; err != nil {
+			return err
+		}
+		n++
+	}
+	if n > 0 {
+		log.Printf("[export] sealed secrets of %d export destinations", n)
+	}
+	return nil
+}
+
+// RedactDestination: cấu hình đích để trả qua API (che khoá bí mật)
+func RedactDestination(cfg string) map[string]interface{} {
+	m := map[string]interface{}{}
+	json.Unmarshal([]byte(cfg), &m)
+	for _, k := range destSecretKeys {
+		if v, _ := m[k].(string); v != "" {
+			m[k] = "***"
+		}
+	}
+	return m
+}
+
+// NewDestination dựng đích từ cấu hình đã lưu (giải mã khoá bí mật)
+func NewDestination(kind, cfg string) (Destination, error) {
+	cfg, err := OpenDestination(cfg)
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case DestLocal:
+		var c localDestConfig
+		err := json.Unmarshal([]byte(cfg), &c)
+		return c, err
+	case DestSFTP:
+		var c sftpDestConfig
+		err := json.Unmarshal([]byte(cfg), &c)
+		return c, err
+	case DestS3:
+		var c S3Config
+		if err := json.Unmarshal([]byte(cfg), &c); err != nil {
+			return nil, err
+		}
+		st, err := NewS3Storage(c)
+		if err != nil {
+			return nil, err
+		}
+		// endpoint do người dùng nhập: chặn kết nối vào mạng nội bộ
+		st.client = NewOutboundHTTPClient(destTimeout)
+		return s3Dest{st}, nil
+	case DestWebhook:
+		var c webhookDestConfig
+		err := json.Unmarshal([]byte(cfg), &c)
+		return c, err
+	}
+	return nil, fmt.Errorf("dest_type không hỗ trợ: %s", kind)
+}
+
+// DeliveryFileName = export_<lịch>_<thời điểm UTC>.<ext>
+func DeliveryFileName(scheduleID uint, at time.Time, ext string) string {
+	return fmt.Sprintf("export_%d_%s.%s", scheduleID, at.UTC().Format("20060102T150405Z"), ext)
+}
+
+func strictDecode(raw json.RawMessage, v interface{}) error {
+	if len(raw) == 0 {
+		raw = json.RawMessage("{}")
+	}
+	dec := json.NewDecoder(strings.NewReader(string(raw)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("dest_config không hợp lệ: %v", err)
+	}
+	return nil
+}
+
+// --- local: thư mục con của EXPORT_DELIVERY_DIR/user_<người tạo lịch> (mặc định ./deliveries) ---
+
+type localDestConfig struct {
+	Dir string `json:"dir,omitempty"` // đường dẫn tương đối trong thư mục riêng của người tạo lịch
+}
+
+// localDeliveryDir: thư mục giao file của đích local, luôn nằm trong EXPORT_DELIVERY_DIR/user_<ownerID>
+func localDeliveryDir(ownerID uint, dir string) (string, error) {
+	if ownerID == 0 {
+		return "", errors.New("local: lịch không có người tạo")
+	}
+	root := os.Getenv("EXPORT_DELIVERY_DIR")
+	if root == "" {
+		root = "./deliveries"
+	}
+	ownerRoot := filepath.Join(root, fmt.Sprintf("user_%d", ownerID))
+	out := filepath.Join(ownerRoot, filepath.FromSlash(strings.Trim(path.Clean("/"+dir), "/")))
+	rel, err := filepath.Rel(ownerRoot, out)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return "", fmt.Errorf("local: thư mục %q nằm ngoài thư mục giao file", dir)
+	}
+	return out, nil
+}
+
+func (c localDestConfig) Deliver(ctx context.Context, f DeliveryFile) (string, error) {
+	dir, err := localDeliveryDir(f.OwnerID, c.Dir)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	dst := filepath.Join(dir, f.Name)
+	in, err := os.Open(f.Path)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	tmp, err := os.CreateTemp(dir, ".delivery-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	return dst, os.Rename(tmp.Name(), dst)
+}
+
+// --- sftp: xác thực bằng mật khẩu hoặc khoá, bắt buộc ghim fingerprint host key ---
+
+type sftpDestConfig struct {
+	Host       string `json:"host"`
+	Port       int    `json:"port,omitempty"`
+	User       string `json:"user"`
+	Password   string `json:"password,omitempty"`
+	PrivateKey string `json:"private_key,omitempty"` // PEM/OpenSSH, không passphrase
+	HostKey    string `json:"host_key"`              // fingerprint "SHA256:..." (ssh-keygen -lf)
+	Dir        string `json:"dir,omitempty"`
+}
+
+func (c sftpDestConfig) Deliver(ctx context.Context, f DeliveryFile) (string, error) {
+	var auth []ssh.AuthMethod
+	if c.PrivateKey != "" {
+		signer, err := ssh.ParsePrivateKey([]byte(c.PrivateKey))
+		if err != nil {
+			return "", err
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if c.Password != "" {
+		auth = append(auth, ssh.Password(c.Password))
+	}
+	addr := net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+	conf := &ssh.ClientConfig{
+		User: c.User,
+		Auth: auth,
+		HostKeyCallback: func(_ string, _ net.Addr, key ssh.PublicKey) error {
+			if fp := ssh.FingerprintSHA256(key); fp != c.HostKey {
+				return fmt.Errorf("sftp: host key %s không khớp", fp)
+			}
+			return nil
+		},
+		Timeout: 30 * time.Second,
+	}
+
+	conn, err := guardedDialer(conf.Timeout).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	// đóng kết nối khi ctx bị huỷ để không treo ở thao tác mạng
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	sc, chans, reqs, err := ssh.NewClientConn(conn, addr, conf)
+	if err != nil {
+		conn.Close()
+		return "", err
+	}
+	client := ssh.NewClient(sc, chans, reqs)
+	defer client.Close()
+	s, err := sftp.NewClient(client)
+	if err != nil {
+		return "", err
+	}
+	defer s.Close()
+
+	dir := c.Dir
+	if dir == "" {
+		dir = "."
+	}
+	if err := s.MkdirAll(dir); err != nil {
+		return "", err
+	}
+	dst := path.Join(dir, f.Name)
+	tmp := dst + ".part"
+	in, err := os.Open(f.Path)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	out, err := s.Create(tmp)
+	if err != nil {
+		return "", err
+	}
+	if _, err := out.ReadFrom(in); err != nil {
+		out.Close()
+		s.Remove(tmp)
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		s.Remove(tmp)
+		return "", err
+	}
+	// đổi tên sau khi ghi xong: bên nhận không thấy file dở dang
+	if err := s.PosixRename(tmp, dst); err != nil {
+		if err := s.Rename(tmp, dst); err != nil {
+			s.Remove(tmp)
+			return "", err
+		}
+	}
+	return "sftp://" + addr + "/" + strings.TrimPrefix(dst, "/"), nil
+}
+
+// --- s3: bucket tương thích S3 ---
+
+type s3Dest struct{ st *S3Storage }
+
+func (d s3Dest) Deliver(ctx context.Context, f DeliveryFile) (string, error) {
+	in, err := os.Open(f.Path)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	if err := d.st.Put(ctx, f.Name, in, f.ContentType); err != nil {
+		return "", err
+	}
+	return "s3://" + d.st.cfg.Bucket + "/" + strings.TrimLeft(d.st.cfg.Prefix+f.Name, "/"), nil
+}
+
+// --- webhook: POST nội dung file, ký như webhook sự kiện ---
+
+type webhookDestConfig struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret,omitempty"`
+}
+
+// Deliver gửi file làm body; X-Webhook-Signature = "sha256=" + HMAC(secret, timestamp + "." + body)
+func (c webhookDestConfig) Deliver(ctx context.Context, f DeliveryFile) (string, error) {
+	in, err := os.Open(f.Path)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	// ký trước (đọc file một lượt) rồi gửi từ đầu file, không nạp cả file vào bộ nhớ
+	ts := time.Now().Unix()
+	m := hmac.New(sha256.New, []byte(c.Secret))
+	m.Write([]byte(strconv.FormatInt(ts, 10) + "."))
+	size, err := io.Copy(m, in)
+	if err != nil {
+		return "", err
+	}
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, destTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, in)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", f.ContentType)
+	req.Header.Set("User-Agent", "survey-server-webhooks/1.0")
+	req.Header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", f.Name))
+	req.Header.Set("X-Export-Schedule-Id", strconv.FormatUint(uint64(f.ScheduleID), 10))
+	req.Header.Set("X-Export-Job-Id", f.JobID)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(ts, 10))
+	req.Header.Set("X-Webhook-Signature", "sha256="+hex.EncodeToString(m.Sum(nil)))
+
+	res, err := destHTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	// không lưu nội dung phản hồi vào lịch sử chạy
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	if res.StatusCode/100 != 2 {
+		return "", fmt.Errorf("webhook: HTTP %d", res.StatusCode)
+	}
+	return c.URL, nil
+}
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalDeliveryDir(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("EXPORT_DELIVERY_DIR", root)
+	cases := []struct {
+		owner uint
+		dir   string
+		want  string // rỗng = phải bị từ chối
+	}{
+		{7, "", "user_7"},
+		{7, "bao-cao/thang", "user_7/bao-cao/thang"},
+		{7, "../user_8", "user_7/user_8"},
+		{7, "/etc", "user_7/etc"},
+		{7, "a/../../..", "user_7"},
+		{0, "bao-cao", ""},
+	}
+	for _, tc := range cases {
+		got, err := localDeliveryDir(tc.owner, tc.dir)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("owner=%d dir=%q: %q, muốn lỗi", tc.owner, tc.dir, got)
+			}
+			continue
+		}
+		if want := filepath.Join(root, filepath.FromSlash(tc.want)); err != nil || got != want {
+			t.Errorf("owner=%d dir=%q: %q, %v; muốn %q", tc.owner, tc.dir, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ExportColumnType: kiểu dữ liệu của một cột xuất
+type ExportColumnType int
+
+const (
+	ExportString ExportColumnType = iota
+	ExportNumber
+	ExportTime
+)
+
+// ExportColumn mô tả một cột của file xuất
+type ExportColumn struct {
+	Key     string // định danh ổn định (tên trường JSON/Parquet), vd. "submitted_at", "q12"
+	Label   string // tiêu đề hiển thị (header CSV/XLSX, nhãn biến SPSS)
+	Type    ExportColumnType
+	Options []string // giá trị lựa chọn (LuaChon) theo thứ tự, với câu hỏi chọn đáp án
+	Multi   bool     // chọn nhiều: giá trị là []string
+
+	OptionLabels []string // nhãn hiển thị của Options khi Options là id lựa chọn; rỗng = Options là nhãn
+	DateLayout   string   // layout Go khi ghi cột thời gian dạng chữ; rỗng = "02/01/2006 15:04:05"
+}
+
+// OptionLabel: nhãn hiển thị của lựa chọn thứ i
+func (c ExportColumn) OptionLabel(i int) string {
+	if i < len(c.OptionLabels) {
+		return c.OptionLabels[i]
+	}
+	return c.Options[i]
+}
+
+// Exporter ghi từng dòng ra một định dạng file.
+// Giá trị ô: nil (trống), string, float64, time.Time hoặc []string (cột Multi).
+// Cột ExportNumber có thể nhận string khi dữ liệu gốc không phải số.
+type Exporter interface {
+	Begin(w io.Writer, cols []ExportColumn) error
+	WriteRow(vals []interface{}) error
+	Close() error // ghi phần kết thúc file, không đóng w
+}
+
+// ExportFormat: một định dạng xuất đã đăng ký
+type ExportFormat struct {
+	Name        string
+	Ext         string
+	ContentType string
+	New         func() Exporter
+}
+
+var (
+	exportFormatMu sync.RWMutex
+	exportFormats  = map[string]ExportFormat{
+		"csv":     {Name: "csv", Ext: "csv", ContentType: "text/csv; charset=utf-8", New: func() Exporter { return &csvExporter{} }},
+		"xlsx":    {Name: "xlsx", Ext: "xlsx", ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", New: func() Exporter { return &xlsxExporter{} }},
+		"json":    {Name: "json", Ext: "json", ContentType: "application/json", New: func() Exporter { return &jsonExporter{} }},
+		"ndjson":  {Name: "ndjson", Ext: "ndjson", ContentType: "application/x-ndjson", New: func() Exporter { return &jsonExporter{lines: true} }},
+		"sav":     {Name: "sav", Ext: "sav", ContentType: "application/x-spss-sav", New: func() Exporter { return &savExporter{} }},
+		"parquet": {Name: "parquet", Ext: "parquet", ContentType: "application/vnd.apache.parquet", New: func() Exporter { return &parquetExporter{} }},
+	}
+)
+
+// RegisterExportFormat thêm (hoặc thay) một định dạng xuất
+func RegisterExportFormat(f ExportFormat) {
+	exportFormatMu.Lock()
+	exportFormats[strings.ToLower(f.Name)] = f
+	exportFormatMu.Unlock()
+}
+
+// ExportFormatByName tra định dạng theo tên (không phân biệt hoa thường)
+func ExportFormatByName(name string) (ExportFormat, bool) {
+	exportFormatMu.RLock()
+	defer exportFormatMu.RUnlock()
+	f, ok := exportFormats[strings.ToLower(strings.TrimSpace(name))]
+	return f, ok
+}
+
+// ExportFormatNames: tên các định dạng hỗ trợ (đã sắp xếp)
+func ExportFormatNames() []string {
+	exportFormatMu.RLock()
+	defer exportFormatMu.RUnlock()
+	names := make([]string, 0, len(exportFormats))
+	for n := range exportFormats {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+const defaultExportDateLayout = "02/01/2006 15:04:05"
+
+// ExportCellText: giá trị ô dạng chữ (CSV, XLSX, bố cục long)
+func ExportCellText(v interface{}, col ExportColumn) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case time.Time:
+		if col.DateLayout != "" {
+			return x.Format(col.DateLayout)
+		}
+		return x.Format(defaultExportDateLayout)
+	case []string:
+		return strings.Join(x, ", ")
+	default:
+		return ""
+	}
+}
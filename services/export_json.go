@@ -0,0 +1,88 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// jsonExporter: "json" = {"columns": [...], "responses": [...]}; "ndjson" (lines) = mỗi dòng một phản hồi.
+// Khoá của mỗi phản hồi là ExportColumn.Key, giữ thứ tự cột.
+type jsonExporter struct {
+	lines bool
+	w     *bufio.Writer
+	cols  []ExportColumn
+	n     int
+}
+
+type jsonColumn struct {
+	Key     string   `json:"key"`
+	Label   string   `json:"label"`
+	Type    string   `json:"type"`
+	Options []string `json:"options,omitempty"`
+	Multi   bool     `json:"multi,omitempty"`
+
+	OptionLabels []string `json:"option_labels,omitempty"`
+}
+
+func (e *jsonExporter) Begin(w io.Writer, cols []ExportColumn) error {
+	e.w = bufio.NewWriter(w)
+	e.cols = cols
+	if e.lines {
+		return nil
+	}
+	meta := make([]jsonColumn, len(cols))
+	for i, c := range cols {
+		t := "string"
+		switch c.Type {
+		case ExportNumber:
+			t = "number"
+		case ExportTime:
+			t = "datetime"
+		}
+		meta[i] = jsonColumn{Key: c.Key, Label: c.Label, Type: t, Options: c.Options, Multi: c.Multi, OptionLabels: c.OptionLabels}
+	}
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	_, err = e.w.WriteString(`{"columns":` + string(b) + `,"responses":[`)
+	return err
+}
+
+func (e *jsonExporter) WriteRow(vals []interface{}) error {
+	if !e.lines && e.n > 0 {
+		e.w.WriteByte(',')
+	}
+	e.n++
+	e.w.WriteByte('{')
+	for i, v := range vals {
+		if i > 0 {
+			e.w.WriteByte(',')
+		}
+		k, _ := json.Marshal(e.cols[i].Key)
+		e.w.Write(k)
+		e.w.WriteByte(':')
+		if t, ok := v.(time.Time); ok {
+			v = t.Format(time.RFC3339)
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		e.w.Write(b)
+	}
+	e.w.WriteByte('}')
+	if e.lines {
+		e.w.WriteByte('\n')
+	}
+	return nil
+}
+
+func (e *jsonExporter) Close() error {
+	if !e.lines {
+		e.w.WriteString("]}")
+	}
+	return e.w.Flush()
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Cột metadata của phản hồi có thể thêm vào file xuất
+const (
+	ExportMetaSubmissionID = "submission_id"
+	ExportMetaUser         = "user"
+	ExportMetaEmail        = "email"
+	ExportMetaLanGui       = "lan_gui"
+)
+
+// Bố cục file xuất
+const (
+	ExportLayoutWide = "wide" // mỗi phản hồi một dòng, mỗi câu hỏi một cột
+	ExportLayoutLong = "long" // mỗi câu trả lời một dòng
+)
+
+// Giá trị của câu hỏi chọn đáp án
+const (
+	ExportValuesLabels = "labels" // nội dung lựa chọn
+	ExportValuesIDs    = "ids"    // id lựa chọn (LuaChon.ID)
+)
+
+// ErrInvalidDateFormat: DateFormat có ký tự ngoài token/phân cách cho phép
+var ErrInvalidDateFormat = errors.New("date_format không hợp lệ")
+
+// Định dạng ngày mặc định (giữ như file xuất trước đây)
+const DefaultExportDateFormat = "DD/MM/YYYY HH:mm:ss"
+
+// ExportOptions: cấu hình hình dạng file xuất (lưu theo ExportJob và preset)
+type ExportOptions struct {
+	QuestionIDs []uint   `json:"question_ids,omitempty"` // rỗng = tất cả câu hỏi
+	Metadata    []string `json:"metadata,omitempty"`     // submission_id, user, email, lan_gui
+	Layout      string   `json:"layout,omitempty"`       // wide (mặc định) | long
+	Values      string   `json:"values,omitempty"`       // labels (mặc định) | ids
+	DateFormat  string   `json:"date_format,omitempty"`  // token YYYY, YY, MM, DD, HH, mm, ss hoặc "iso8601"; áp dụng cho CSV/XLSX
+	Timezone    string   `json:"timezone,omitempty"`     // IANA, vd. "Asia/Ho_Chi_Minh"; rỗng = giờ server
+	SplitMulti  *bool    `json:"split_multi,omitempty"`  // câu chọn nhiều: mỗi lựa chọn một cột 0/1 (bố cục wide); nil = không
+}
+
+// Normalize chuẩn hoá và kiểm tra tuỳ chọn, điền giá trị mặc định
+func (o *ExportOptions) Normalize() error {
+	o.Layout = strings.ToLower(strings.TrimSpace(o.Layout))
+	switch o.Layout {
+	case "":
+		o.Layout = ExportLayoutWide
+	case ExportLayoutWide, ExportLayoutLong:
+	default:
+		return fmt.Errorf("layout không hợp lệ: %s (wide, long)", o.Layout)
+	}
+
+	o.Values = strings.ToLower(strings.TrimSpace(o.Values))
+	switch o.Values {
+	case "":
+		o.Values = ExportValuesLabels
+	case ExportValuesLabels, ExportValuesIDs:
+	default:
+		return fmt.Errorf("values không hợp lệ: %s (labels, ids)", o.Values)
+	}
+
+	seen := map[string]bool{}
+	meta := make([]string, 0, len(o.Metadata))
+	for _, m := range o.Metadata {
+		m = strings.ToLower(strings.TrimSpace(m))
+		switch m {
+		case ExportMetaSubmissionID, ExportMetaUser, ExportMetaEmail, ExportMetaLanGui:
+		default:
+			return fmt.Errorf("metadata không hợp lệ: %s", m)
+		}
+		if !seen[m] {
+			seen[m] = true
+			meta = append(meta, m)
+		}
+	}
+	o.Metadata = meta
+
+	o.Timezone = strings.TrimSpace(o.Timezone)
+	if o.Timezone != "" {
+		if _, err := time.LoadLocation(o.Timezone); err != nil {
+			return fmt.Errorf("timezone không hợp lệ: %s", o.Timezone)
+		}
+	}
+	o.DateFormat = strings.TrimSpace(o.DateFormat)
+	if o.DateFormat == "" {
+		o.DateFormat = DefaultExportDateFormat
+	}
+	if _, err := exportDateLayout(o.DateFormat); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Merge: các trường đã đặt trong over ghi đè lên o (dùng khi request kèm preset)
+func (o ExportOptions) Merge(over ExportOptions) ExportOptions {
+	if len(over.QuestionIDs) > 0 {
+		o.QuestionIDs = over.QuestionIDs
+	}
+	if len(over.Metadata) > 0 {
+		o.Metadata = over.Metadata
+	}
+	if over.Layout != "" {
+		o.Layout = over.Layout
+	}
+	if over.Values != "" {
+		o.Values = over.Values
+	}
+	if over.DateFormat != "" {
+		o.DateFormat = over.DateFormat
+	}
+	if over.Timezone != "" {
+		o.Timezone = over.Timezone
+	}
+	if over.SplitMulti != nil {
+		o.SplitMulti = over.SplitMulti
+	}
+	return o
+}
+
+// SplitMultiColumns: câu chọn nhiều tách mỗi lựa chọn một cột 0/1
+func (o ExportOptions) SplitMultiColumns() bool {
+	return o.SplitMulti != nil && *o.SplitMulti
+}
+
+// HasMeta: có chọn cột metadata m không
+func (o ExportOptions) HasMeta(m string) bool {
+	for _, x := range o.Metadata {
+		if x == m {
+			return true
+		}
+	}
+	return false
+}
+
+// Location: múi giờ xuất (mặc định giờ server)
+func (o ExportOptions) Location() *time.Location {
+	if o.Timezone != "" {
+		if loc, err := time.LoadLocation(o.Timezone); err == nil {
+			return loc
+		}
+	}
+	return time.Local
+}
+
+// Token của DateFormat (thử token dài trước) và layout Go tương ứng
+var exportDateTokens = []struct{ token, layout string }{
+	{"YYYY", "2006"}, {"YY", "06"}, {"MM", "01"}, {"DD", "02"}, {"HH", "15"}, {"mm", "04"}, {"ss", "05"},
+}
+
+// Ký tự được dùng làm phân cách trong DateFormat; không ký tự nào trong số này (đứng cạnh token)
+// tạo thành token layout của Go như "1", "Jan", "Mon", "PM", "-07", "MST", ".000"
+const exportDateLiterals = " /-.:,Th"
+
+// exportDateLayout chuyển DateFormat sang layout Go; ký tự ngoài token và exportDateLiterals bị từ chối
+// để không bị time.Format hiểu nhầm thành token của Go
+func exportDateLayout(format string) (string, error) {
+	switch strings.ToLower(format) {
+	case "":
+		format = DefaultExportDateFormat
+	case "iso8601", "rfc3339":
+		return time.RFC3339, nil
+	}
+	var b strings.Builder
+next:
+	for i := 0; i < len(format); {
+		for _, t := range exportDateTokens {
+			if strings.HasPrefix(format[i:], t.token) {
+				b.WriteString(t.layout)
+				i += len(t.token)
+				continue next
+			}
+		}
+		if !strings.ContainsRune(exportDateLiterals, rune(format[i])) {
+			r, _ := utf8.DecodeRuneInString(format[i:])
+			return "", fmt.Errorf("%w: ký tự %q (dùng YYYY, YY, MM, DD, HH, mm, ss, phân cách %q hoặc iso8601)", ErrInvalidDateFormat, r, exportDateLiterals)
+		}
+		b.WriteByte(format[i])
+		i++
+	}
+	return b.String(), nil
+}
+
+// DateLayout: layout Go tương ứng DateFormat (DateFormat không hợp lệ → định dạng mặc định)
+func (o ExportOptions) DateLayout() string {
+	layout, err := exportDateLayout(o.DateFormat)
+	if err != nil {
+		layout, _ = exportDateLayout(DefaultExportDateFormat)
+	}
+	return layout
+}
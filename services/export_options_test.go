@@ -0,0 +1,62 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestExportDateFormat(t *testing.T) {
+	at := time.Date(2026, 3, 7, 9, 5, 4, 0, time.UTC)
+	cases := []struct {
+		format string
+		want   string // rỗng = phải bị từ chối
+	}{
+		{"", "07/03/2026 09:05:04"},
+		{"DD/MM/YYYY HH:mm:ss", "07/03/2026 09:05:04"},
+		{"YYYY-MM-DDTHH:mm", "2026-03-07T09:05"},
+		{"DD.MM.YY", "07.03.26"},
+		{"HHhmm, DD/MM", "09h05, 07/03"},
+		{"iso8601", "2026-03-07T09:05:04Z"},
+		// ký tự còn lại là token của Go nếu chỉ thay thế token
+		{"DD Mon YYYY", ""},
+		{"D/M/YYYY", ""},
+		{"YYYY-MM-DD PM", ""},
+		{"HH:mm -07", ""},
+		{"HH:mm MST", ""},
+		{"DD/MM/YYYY 1", ""},
+		{"dd/mm/yyyy", ""},
+	}
+	for _, tc := range cases {
+		o := ExportOptions{DateFormat: tc.format}
+		err := o.Normalize()
+		if tc.want == "" {
+			if !errors.Is(err, ErrInvalidDateFormat) {
+				t.Errorf("%q: Normalize = %v, muốn ErrInvalidDateFormat", tc.format, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tc.format, err)
+			continue
+		}
+		if got := at.Format(o.DateLayout()); got != tc.want {
+			t.Errorf("%q: %q, muốn %q", tc.format, got, tc.want)
+		}
+	}
+}
+
+func TestExportOptionsMergeSplitMulti(t *testing.T) {
+	on, off := true, false
+	preset := ExportOptions{SplitMulti: &on, Layout: ExportLayoutWide}
+
+	if !preset.Merge(ExportOptions{}).SplitMultiColumns() {
+		t.Error("request không đặt split_multi phải giữ giá trị của preset")
+	}
+	if preset.Merge(ExportOptions{SplitMulti: &off}).SplitMultiColumns() {
+		t.Error("request split_multi=false không tắt được preset")
+	}
+	if !(ExportOptions{}).Merge(ExportOptions{SplitMulti: &on}).SplitMultiColumns() {
+		t.Error("request split_multi=true không bật được")
+	}
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"io"
+	"sort"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetExporter ghi Parquet (nén Snappy), mỗi cột một trường theo ExportColumn.Key:
+// chuỗi = optional STRING, số = optional DOUBLE (giá trị không phải số để null),
+// thời gian = optional TIMESTAMP(MILLIS, UTC), chọn nhiều = repeated STRING.
+type parquetExporter struct {
+	w     *parquet.Writer
+	order []int // chỉ số cột ExportColumn theo thứ tự cột lá của schema
+	leaf  []int // chỉ số cột lá tương ứng
+	cols  []ExportColumn
+}
+
+const parquetRowGroupRows = 10000
+
+func (e *parquetExporter) Begin(w io.Writer, cols []ExportColumn) error {
+	group := parquet.Group{}
+	for _, c := range cols {
+		var node parquet.Node
+		switch {
+		case c.Multi:
+			node = parquet.Repeated(parquet.String())
+		case c.Type == ExportNumber:
+			node = parquet.Optional(parquet.Leaf(parquet.DoubleType))
+		case c.Type == ExportTime:
+			node = parquet.Optional(parquet.Timestamp(parquet.Millisecond))
+		default:
+			node = parquet.Optional(parquet.String())
+		}
+		group[c.Key] = node
+	}
+	schema := parquet.NewSchema("export", group)
+
+	// Group sắp xếp trường theo tên: giá trị trong Row phải theo thứ tự cột lá
+	e.cols = cols
+	e.order = make([]int, len(cols))
+	leafOf := make(map[int]int, len(cols))
+	for i, c := range cols {
+		e.order[i] = i
+		lc, _ := schema.Lookup(c.Key)
+		leafOf[i] = lc.ColumnIndex
+	}
+	sort.Slice(e.order, func(a, b int) bool { return leafOf[e.order[a]] < leafOf[e.order[b]] })
+	e.leaf = make([]int, len(cols))
+	for i, ci := range e.order {
+		e.leaf[i] = leafOf[ci]
+	}
+
+	e.w = parquet.NewWriter(w, schema,
+		parquet.Compression(&parquet.Snappy),
+		parquet.MaxRowsPerRowGroup(parquetRowGroupRows))
+	return nil
+}
+
+func (e *parquetExporter) WriteRow(vals []interface{}) error {
+	row := make(parquet.Row, 0, len(vals))
+	for i, ci := range e.order {
+		idx := e.leaf[i]
+		switch x := vals[ci].(type) {
+		case []string:
+			if len(x) == 0 {
+				row = append(row, parquet.Value{}.Level(0, 0, idx))
+			}
+			for j, s := range x {
+				rep := 1
+				if j == 0 {
+					rep = 0
+				}
+				row = append(row, parquet.ByteArrayValue([]byte(s)).Level(rep, 1, idx))
+			}
+		case string:
+			if e.cols[ci].Type == ExportNumber {
+				row = append(row, parquet.Value{}.Level(0, 0, idx))
+			} else {
+				row = append(row, parquet.ByteArrayValue([]byte(x)).Level(0, 1, idx))
+			}
+		case float64:
+			row = append(row, parquet.DoubleValue(x).Level(0, 1, idx))
+		case time.Time:
+			row = append(row, parquet.Int64Value(x.UnixMilli()).Level(0, 1, idx))
+		default:
+			row = append(row, parquet.Value{}.Level(0, 0, idx))
+		}
+	}
+	_, err := e.w.WriteRows([]parquet.Row{row})
+	return err
+}
+
+func (e *parquetExporter) Close() error {
+	return e.w.Close()
+}
@@ -0,0 +1,352 @@
+package services
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// savExporter ghi file SPSS .sav (không nén, little-endian, mã hoá UTF-8).
+//   - Câu hỏi chọn một đáp án (có Options): biến số mã 1..n, nhãn giá trị lấy từ LuaChon;
+//     câu trả lời không khớp lựa chọn nào để trống (sysmis).
+//   - Câu hỏi chọn nhiều: mỗi lựa chọn một biến 0/1 (0 = "Không chọn", 1 = nhãn lựa chọn).
+//   - Cột số: F10.2 (giá trị không phải số để trống); cột thời gian: DATETIME20.
+//   - Cột chữ: A255, chuỗi dài hơn 255 byte bị cắt (tại biên ký tự UTF-8).
+type savExporter struct {
+	w    *bufio.Writer
+	vars []savVar
+}
+
+type savVar struct {
+	col    int // chỉ số cột ExportColumn
+	opt    int // với biến 0/1 của câu chọn nhiều: chỉ số lựa chọn; còn lại -1
+	name   string
+	long   string
+	label  string
+	width  int // 0 = số; >0 = chuỗi
+	format int32
+	labels []savLabel
+	codes  map[string]float64 // giá trị ô → mã (biến chọn một)
+	match  string             // giá trị lựa chọn ứng với biến 0/1
+	index  int                // vị trí (1-based) trong từ điển, tính cả bản ghi nối tiếp
+}
+
+type savLabel struct {
+	value float64
+	label string
+}
+
+const (
+	savStringWidth = 255
+	savFmtA        = 1
+	savFmtF        = 5
+	savFmtDateTime = 22
+)
+
+var savEpoch = time.Date(1582, 10, 14, 0, 0, 0, 0, time.UTC)
+
+func savFormat(typ, width, decimals int) int32 {
+	return int32(typ<<16 | width<<8 | decimals)
+}
+
+// segments: số ô 8 byte một biến chiếm trong mỗi bản ghi dữ liệu
+func (v savVar) segments() int {
+	if v.width == 0 {
+		return 1
+	}
+	return (v.width + 7) / 8
+}
+
+func (e *savExporter) Begin(w io.Writer, cols []ExportColumn) error {
+	e.w = bufio.NewWriter(w)
+	e.vars = nil
+	used, usedLong := map[string]bool{}, map[string]bool{}
+	add := func(v savVar, key string) {
+		v.name = savShortName(key, len(e.vars)+1, used)
+		v.long = savLongName(key, v.name, usedLong)
+		e.vars = append(e.vars, v)
+	}
+	for i, c := range cols {
+		switch {
+		case c.Multi && len(c.Options) > 0:
+			for j, o := range c.Options {
+				add(savVar{
+					col: i, opt: j, match: o,
+					label:  c.Label + ": " + c.OptionLabel(j),
+					format: savFormat(savFmtF, 1, 0),
+					labels: []savLabel{{0, "Không chọn"}, {1, c.OptionLabel(j)}},
+				}, fmt.Sprintf("%s_%d", c.Key, j+1))
+			}
+		case !c.Multi && len(c.Options) > 0:
+			// Mã 1..n; khi Options là id lựa chọn thì mã chính là id
+			labels := make([]savLabel, len(c.Options))
+			codes := make(map[string]float64, len(c.Options))
+			for j, o := range c.Options {
+				code := float64(j + 1)
+				if len(c.OptionLabels) > 0 {
+					if n, err := strconv.ParseFloat(o, 64); err == nil {
+						code = n
+					}
+				}
+				labels[j] = savLabel{code, c.OptionLabel(j)}
+				codes[o] = code
+			}
+			add(savVar{col: i, opt: -1, label: c.Label, format: savFormat(savFmtF, 8, 0), labels: labels, codes: codes}, c.Key)
+		case c.Type == ExportNumber:
+			add(savVar{col: i, opt: -1, label: c.Label, format: savFormat(savFmtF, 10, 2)}, c.Key)
+		case c.Type == ExportTime:
+			add(savVar{col: i, opt: -1, label: c.Label, format: savFormat(savFmtDateTime, 20, 0)}, c.Key)
+		default:
+			add(savVar{col: i, opt: -1, label: c.Label, width: savStringWidth,
+				format: savFormat(savFmtA, savStringWidth, 0)}, c.Key)
+		}
+	}
+
+	segs := 0
+	for i := range e.vars {
+		e.vars[i].index = segs + 1
+		segs += e.vars[i].segments()
+	}
+
+	e.writeHeader(segs)
+	for _, v := range e.vars {
+		e.writeVariable(v)
+	}
+	for _, v := range e.vars {
+		if len(v.labels) > 0 {
+			e.writeValueLabels(v)
+		}
+	}
+	e.writeExtensions()
+	e.i32(999)
+	e.i32(0)
+	return nil
+}
+
+func (e *savExporter) WriteRow(vals []interface{}) error {
+	for _, v := range e.vars {
+		val := vals[v.col]
+		switch {
+		case v.width > 0:
+			s := savTruncate(ExportCellText(val, ExportColumn{}), v.width)
+			e.w.WriteString(s)
+			e.w.WriteString(strings.Repeat(" ", v.segments()*8-len(s)))
+		case v.opt >= 0:
+			picked, _ := val.([]string)
+			opt := 0.0
+			for _, p := range picked {
+				if p == v.match {
+					opt = 1
+					break
+				}
+			}
+			e.f64(opt)
+		case len(v.labels) > 0:
+			e.f64(savCode(v.codes, val))
+		default:
+			e.f64(savNumber(val))
+		}
+	}
+	return nil
+}
+
+func (e *savExporter) Close() error {
+	return e.w.Flush()
+}
+
+func savCode(codes map[string]float64, val interface{}) float64 {
+	if s, ok := val.(string); ok {
+		if code, ok := codes[s]; ok {
+			return code
+		}
+	}
+	return -math.MaxFloat64
+}
+
+func savNumber(val interface{}) float64 {
+	switch x := val.(type) {
+	case float64:
+		return x
+	case time.Time:
+		wall := time.Date(x.Year(), x.Month(), x.Day(), x.Hour(), x.Minute(), x.Second(), 0, time.UTC)
+		return wall.Sub(savEpoch).Seconds()
+	}
+	return -math.MaxFloat64
+}
+
+func (e *savExporter) writeHeader(segs int) {
+	now := time.Now()
+	e.w.WriteString("$FL2")
+	e.pad("@(#) SPSS DATA FILE survey-server", 60)
+	e.i32(2)           // layout code
+	e.i32(int32(segs)) // nominal case size
+	e.i32(0)           // không nén
+	e.i32(0)           // không có biến trọng số
+	e.i32(-1)          // số case chưa biết (ghi luồng)
+	e.f64(100)         // bias
+	e.pad(now.Format("02 Jan 06"), 9)
+	e.pad(now.Format("15:04:05"), 8)
+	e.pad("", 64)
+	e.pad("", 3)
+}
+
+func (e *savExporter) writeVariable(v savVar) {
+	typ := int32(0)
+	if v.width > 0 {
+		typ = int32(v.width)
+	}
+	e.i32(2)
+	e.i32(typ)
+	e.i32(1) // có nhãn biến
+	e.i32(0) // không có missing value
+	e.i32(v.format)
+	e.i32(v.format)
+	e.pad(v.name, 8)
+	label := savTruncate(v.label, 255)
+	e.i32(int32(len(label)))
+	e.pad(label, (len(label)+3)/4*4)
+
+	// Biến chuỗi dài hơn 8 byte: thêm bản ghi nối tiếp cho mỗi ô 8 byte còn lại
+	for i := 1; i < v.segments(); i++ {
+		e.i32(2)
+		e.i32(-1)
+		e.i32(0)
+		e.i32(0)
+		e.i32(0)
+		e.i32(0)
+		e.pad("", 8)
+	}
+}
+
+func (e *savExporter) writeValueLabels(v savVar) {
+	e.i32(3)
+	e.i32(int32(len(v.labels)))
+	for _, l := range v.labels {
+		e.f64(l.value)
+		s := savTruncate(l.label, 120)
+		e.w.WriteByte(byte(len(s)))
+		e.pad(s, (len(s)+1+7)/8*8-1)
+	}
+	e.i32(4)
+	e.i32(1)
+	e.i32(int32(v.index))
+}
+
+func (e *savExporter) writeExtensions() {
+	// subtype 3: thông tin máy (IEEE 754, little-endian, code page 65001 = UTF-8)
+	e.i32(7)
+	e.i32(3)
+	e.i32(4)
+	e.i32(8)
+	for _, n := range []int32{20, 0, 0, -1, 1, 1, 2, 65001} {
+		e.i32(n)
+	}
+
+	// subtype 4: sysmis, highest, lowest
+	e.i32(7)
+	e.i32(4)
+	e.i32(8)
+	e.i32(3)
+	e.f64(-math.MaxFloat64)
+	e.f64(math.MaxFloat64)
+	e.f64(math.Float64frombits(0xffeffffffffffffe))
+
+	// subtype 13: tên biến dài
+	pairs := make([]string, len(e.vars))
+	for i, v := range e.vars {
+		pairs[i] = v.name + "=" + v.long
+	}
+	long := strings.Join(pairs, "\t")
+	e.i32(7)
+	e.i32(13)
+	e.i32(1)
+	e.i32(int32(len(long)))
+	e.w.WriteString(long)
+
+	// subtype 20: bảng mã
+	e.i32(7)
+	e.i32(20)
+	e.i32(1)
+	e.i32(5)
+	e.w.WriteString("UTF-8")
+}
+
+func (e *savExporter) i32(n int32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], uint32(n))
+	e.w.Write(b[:])
+}
+
+func (e *savExporter) f64(f float64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], math.Float64bits(f))
+	e.w.Write(b[:])
+}
+
+// pad ghi s, thêm khoảng trắng cho đủ n byte (s đã ≤ n)
+func (e *savExporter) pad(s string, n int) {
+	if len(s) > n {
+		s = s[:n]
+	}
+	e.w.WriteString(s)
+	e.w.WriteString(strings.Repeat(" ", n-len(s)))
+}
+
+// savTruncate cắt s còn tối đa n byte, không cắt giữa ký tự UTF-8
+func savTruncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// savShortName: tên biến ≤ 8 ký tự, chữ hoa, không trùng; không hợp lệ thì dùng V<n>
+func savShortName(key string, n int, used map[string]bool) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(key) {
+		if b.Len() >= 8 {
+			break
+		}
+		if (r >= 'A' && r <= 'Z') || (b.Len() > 0 && ((r >= '0' && r <= '9') || r == '_')) {
+			b.WriteRune(r)
+		}
+	}
+	name := b.String()
+	for i := n; name == "" || used[name]; i++ {
+		name = fmt.Sprintf("V%d", i)
+	}
+	used[name] = true
+	return name
+}
+
+// savLongName: tên biến dài (≤ 64 byte) từ key, không trùng (không phân biệt hoa thường); lỗi thì dùng tên ngắn
+func savLongName(key, short string, used map[string]bool) string {
+	name := savSanitize(key)
+	if name == "" || used[strings.ToUpper(name)] {
+		name = short
+	}
+	used[strings.ToUpper(name)] = true
+	return name
+}
+
+func savSanitize(key string) string {
+	var b strings.Builder
+	for _, r := range key {
+		if b.Len() >= 64 {
+			break
+		}
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (b.Len() > 0 && ((r >= '0' && r <= '9') || r == '_')) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
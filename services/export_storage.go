@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vnkhanh/survey-server/config"
+	"github.com/vnkhanh/survey-server/models"
+)
+
+// Endpoint tải file xuất khi lưu trên đĩa (xem LocalStorage.SignedURL)
+const ExportDownloadPath = "/api/export-downloads"
+
+var (
+	exportStorageMu sync.Mutex
+	exportStorage   Storage
+)
+
+// ExportStorage trả kho lưu file xuất theo EXPORT_STORAGE:
+//   - "local" (mặc định): thư mục EXPORT_DIR (mặc định ./exports), tải qua URL ký HMAC của server
+//   - "supabase": bucket EXPORT_BUCKET (mặc định "exports") của SUPABASE_URL
+//   - "s3": bucket tương thích S3 theo EXPORT_S3_* (xem S3ConfigFromEnv)
+func ExportStorage() (Storage, error) {
+	exportStorageMu.Lock()
+	defer exportStorageMu.Unlock()
+	if exportStorage != nil {
+		return exportStorage, nil
+	}
+	switch strings.ToLower(os.Getenv("EXPORT_STORAGE")) {
+	case "", "local":
+		dir := os.Getenv("EXPORT_DIR")
+		if dir == "" {
+			dir = "./exports"
+		}
+		secret := os.Getenv("EXPORT_SIGNING_KEY")
+		if secret == "" {
+			secret = os.Getenv("JWT_SECRET")
+		}
+		base := strings.TrimRight(os.Getenv("API_BASE_URL"), "/") + ExportDownloadPath
+		exportStorage = NewLocalStorage(dir, base, []byte(secret))
+	case "supabase":
+		if os.Getenv("SUPABASE_URL") == "" {
+			return nil, ErrStorageNotConfigured
+		}
+		bucket := os.Getenv("EXPORT_BUCKET")
+		if bucket == "" {
+			bucket = "exports"
+		}
+		exportStorage = NewSupabaseStorage(os.Getenv("SUPABASE_URL"), os.Getenv("SUPABASE_KEY"), bucket)
+	case "s3":
+		st, err := NewS3Storage(S3ConfigFromEnv("EXPORT_S3_"))
+		if err != nil {
+			return nil, err
+		}
+		exportStorage = st
+	default:
+		return nil, fmt.Errorf("EXPORT_STORAGE không hỗ trợ: %s", os.Getenv("EXPORT_STORAGE"))
+	}
+	return exportStorage, nil
+}
+
+// SetExportStorage thay kho lưu file xuất
+func SetExportStorage(s Storage) {
+	exportStorageMu.Lock()
+	exportStorage = s
+	exportStorageMu.Unlock()
+}
+
+// ExportTTL: thời gian giữ file xuất (EXPORT_TTL, mặc định 72h)
+func ExportTTL() time.Duration {
+	return envDuration("EXPORT_TTL", 72*time.Hour)
+}
+
+// ExportLinkTTL: hạn của URL tải file xuất (EXPORT_LINK_TTL, mặc định 15m)
+func ExportLinkTTL() time.Duration {
+	return envDuration("EXPORT_LINK_TTL", 15*time.Minute)
+}
+
+// ExportFileKey: key của file xuất trong kho. Job cũ lưu đường dẫn "exports/export_<id>.<ext>"
+// trên đĩa nên chỉ lấy tên file (trùng với key mới trong thư mục mặc định).
+func ExportFileKey(filePath string) string {
+	return path.Base(filePath)
+}
+
+// expireExports xoá file của job xuất đã quá hạn và chuyển job sang "expired"
+func expireExports(ctx context.Context) error {
+	now := time.Now()
+	var jobs []models.ExportJob
+	if err := config.DB.WithContext(ctx).
+		Where("status = ?", "done").
+		Where("expires_at < ? OR (expires_at IS NULL AND updated_at < ?)", now, now.Add(-ExportTTL())).
+		Limit(500).Find(&jobs).Error; err != nil {
+		return err
+	}
+	if len(jobs) == 0 {
+		return nil
+	}
+	st, err := ExportStorage()
+	if err != nil {
+		return err
+	}
+	expired := 0
+	for _, j := range jobs {
+		if j.FilePath != nil {
+			if err := st.Delete(ctx, ExportFileKey(*j.FilePath)); err != nil {
+				log.Printf("[exports] delete %s: %v", *j.FilePath, err)
+				continue
+			}
+		}
+		if err := config.DB.WithContext(ctx).Model(&j).
+			Updates(map[string]interface{}{"status": "expired", "file_path": nil}).Error; err != nil {
+			return err
+		}
+		expired++
+	}
+	log.Printf("[scheduler] expired %d export files", expired)
+	return nil
+}
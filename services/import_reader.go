@@ -0,0 +1,169 @@
+package services
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// ImportFormats: định dạng file nhập phản hồi (cùng bố cục với file xuất CSV/XLSX)
+var ImportFormats = []string{"csv", "xlsx"}
+
+// ImportFormatOf: định dạng nhập theo đuôi file ("" nếu không hỗ trợ)
+func ImportFormatOf(filename string) string {
+	switch strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), ".")) {
+	case "csv":
+		return "csv"
+	case "xlsx":
+		return "xlsx"
+	}
+	return ""
+}
+
+// ImportReader đọc tuần tự một bảng: dòng đầu là header, các dòng sau là dữ liệu
+type ImportReader interface {
+	Header() []string
+	Next() ([]string, error) // io.EOF khi hết dữ liệu
+	Close() error
+}
+
+// OpenImportFile mở file nhập theo định dạng
+func OpenImportFile(path, format string) (ImportReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	var r ImportReader
+	switch format {
+	case "csv":
+		r, err = newCSVImportReader(f)
+	case "xlsx":
+		r, err = newXLSXImportReader(f)
+	default:
+		err = fmt.Errorf("định dạng nhập không hỗ trợ: %s", format)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+var errImportEmpty = errors.New("file không có dòng tiêu đề")
+
+// --- CSV: UTF-8, bỏ BOM (file xuất có BOM cho Excel) ---
+
+type csvImportReader struct {
+	f      *os.File
+	r      *csv.Reader
+	header []string
+}
+
+func newCSVImportReader(f *os.File) (*csvImportReader, error) {
+	br := bufio.NewReader(f)
+	if b, err := br.Peek(3); err == nil && string(b) == "\xef\xbb\xbf" {
+		br.Discard(3)
+	}
+	r := csv.NewReader(br)
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, errImportEmpty
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &csvImportReader{f: f, r: r, header: header}, nil
+}
+
+func (c *csvImportReader) Header() []string        { return c.header }
+func (c *csvImportReader) Next() ([]string, error) { return c.r.Read() }
+func (c *csvImportReader) Close() error            { return c.f.Close() }
+
+// --- XLSX: sheet đầu tiên, đọc theo dòng (không nạp cả sheet vào bộ nhớ) ---
+
+type xlsxImportReader struct {
+	f      *os.File
+	x      *excelize.File
+	rows   *excelize.Rows
+	header []string
+}
+
+func newXLSXImportReader(f *os.File) (*xlsxImportReader, error) {
+	x, err := excelize.OpenReader(f)
+	if err != nil {
+		return nil, err
+	}
+	sheets := x.GetSheetList()
+	if len(sheets) == 0 {
+		x.Close()
+		return nil, errImportEmpty
+	}
+	rows, err := x.Rows(sheets[0])
+	if err != nil {
+		x.Close()
+		return nil, err
+	}
+	r := &xlsxImportReader{f: f, x: x, rows: rows}
+	if r.header, err = r.Next(); err != nil {
+		r.x.Close()
+		if err == io.EOF {
+			err = errImportEmpty
+		}
+		return nil, err
+	}
+	return r, nil
+}
+
+// Next trả giá trị thô của ô: ô ngày giờ của Excel là số serial (xem ParseImportTime)
+func (x *xlsxImportReader) Next() ([]string, error) {
+	if !x.rows.Next() {
+		if err := x.rows.Error(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	return x.rows.Columns(excelize.Options{RawCellValue: true})
+}
+
+func (x *xlsxImportReader) Header() []string { return x.header }
+
+func (x *xlsxImportReader) Close() error {
+	x.rows.Close()
+	x.x.Close()
+	return x.f.Close()
+}
+
+// ParseImportTime đọc ô thời gian: theo layout của file xuất (trong múi giờ loc), RFC3339,
+// "YYYY-MM-DD[ HH:mm[:ss]]" hoặc số serial ngày của Excel
+func ParseImportTime(s, layout string, loc *time.Location) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, l := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(l, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && f > 0 {
+		if t, err := excelize.ExcelDateToTime(f, false); err == nil {
+			// serial không có múi giờ: giữ nguyên giờ đồng hồ trong loc
+			return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, loc), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("không đọc được thời gian %q", s)
+}
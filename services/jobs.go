@@ -0,0 +1,345 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vnkhanh/survey-server/config"
+	"github.com/vnkhanh/survey-server/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	jobPoll           = time.Second
+	jobBaseBackoff    = 10 * time.Second
+	jobMaxBackoff     = 30 * time.Minute
+	defaultJobTimeout = 5 * time.Minute
+	defaultJobWorkers = 4
+)
+
+// JobHandler chạy một job. ctx bị huỷ khi job bị yêu cầu huỷ hoặc worker mất lease;
+// handler nên kiểm tra ctx.Err() trong các vòng lặp dài.
+type JobHandler func(ctx context.Context, job models.Job) error
+
+// JobOptions cấu hình theo loại job
+type JobOptions struct {
+	Timeout     time.Duration // visibility timeout: lease được gia hạn định kỳ khi job còn chạy
+	MaxAttempts int
+}
+
+type jobKind struct {
+	handler JobHandler
+	opts    JobOptions
+}
+
+var (
+	jobMu    sync.RWMutex
+	jobKinds = map[string]jobKind{}
+)
+
+// permanentJobError: lỗi không có ý nghĩa thử lại (dữ liệu không tồn tại, payload hỏng, ...)
+type permanentJobError struct{ err error }
+
+func (e permanentJobError) Error() string { return e.err.Error() }
+func (e permanentJobError) Unwrap() error { return e.err }
+
+// PermanentJobError đánh dấu lỗi để job thất bại ngay, không thử lại
+func PermanentJobError(err error) error {
+	return permanentJobError{err}
+}
+
+// RegisterJobHandler đăng ký xử lý cho một loại job (gọi trước StartJobWorkers)
+func RegisterJobHandler(kind string, h JobHandler, opts JobOptions) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultJobTimeout
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 3
+	}
+	jobMu.Lock()
+	jobKinds[kind] = jobKind{handler: h, opts: opts}
+	jobMu.Unlock()
+}
+
+// EnqueueJob thêm job vào hàng đợi trong transaction tx của thao tác
+func EnqueueJob(tx *gorm.DB, kind string, payload interface{}) (models.Job, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return models.Job{}, err
+	}
+	maxAttempts := 3
+	jobMu.RLock()
+	if k, ok := jobKinds[kind]; ok {
+		maxAttempts = k.opts.MaxAttempts
+	}
+	jobMu.RUnlock()
+
+	job := models.Job{
+		Kind:        kind,
+		Payload:     string(b),
+		Status:      models.JobQueued,
+		MaxAttempts: maxAttempts,
+		RunAt:       time.Now(),
+	}
+	err = tx.Create(&job).Error
+	return job, err
+}
+
+// CancelJob huỷ job trong tx: job đang chờ bị huỷ ngay, job đang chạy được đánh dấu để worker dừng
+func CancelJob(tx *gorm.DB, id uint) (models.Job, error) {
+	var job models.Job
+	now := time.Now()
+	if err := tx.Model(&models.Job{}).Where("id = ? AND status = ?", id, models.JobQueued).
+		Updates(map[string]interface{}{"status": models.JobCancelled, "finished_at": now}).Error; err != nil {
+		return job, err
+	}
+	if err := tx.Model(&models.Job{}).Where("id = ? AND status = ?", id, models.JobRunning).
+		Update("cancel_requested", true).Error; err != nil {
+		return job, err
+	}
+	err := tx.First(&job, id).Error
+	return job, err
+}
+
+// RetryJob đưa job đã thất bại/đã huỷ về hàng đợi trong tx, đếm lại số lần thử từ đầu
+func RetryJob(tx *gorm.DB, id uint) (models.Job, error) {
+	var job models.Job
+	res := tx.Model(&models.Job{}).
+		Where("id = ? AND status IN ?", id, []string{models.JobFailed, models.JobCancelled}).
+		Updates(map[string]interface{}{
+			"status":           models.JobQueued,
+			"attempts":         0,
+			"run_at":           time.Now(),
+			"cancel_requested": false,
+			"last_error":       "",
+			"finished_at":      nil,
+		})
+	if res.Error != nil {
+		return job, res.Error
+	}
+	if err := tx.First(&job, id).Error; err != nil {
+		return job, err
+	}
+	if res.RowsAffected == 0 {
+		return job, fmt.Errorf("job đang ở trạng thái %s", job.Status)
+	}
+	return job, nil
+}
+
+// StartJobWorkers khôi phục job mồ côi rồi chạy JOB_WORKERS worker (mặc định 4)
+func StartJobWorkers() {
+	workers := defaultJobWorkers
+	if n, err := strconv.Atoi(os.Getenv("JOB_WORKERS")); err == nil && n > 0 {
+		workers = n
+	}
+	recoverOrphanJobs()
+
+	host, _ := os.Hostname()
+	for i := 0; i < workers; i++ {
+		workerID := fmt.Sprintf("%s:%d:%d", host, os.Getpid(), i)
+		go jobWorker(workerID)
+	}
+}
+
+// recoverOrphanJobs: job "running" đã hết lease (tiến trình trước chết giữa chừng) được đưa lại hàng đợi,
+// hoặc đánh dấu thất bại nếu đã hết số lần thử
+func recoverOrphanJobs() {
+	now := time.Now()
+	failed := config.DB.Model(&models.Job{}).
+		Where("status = ? AND locked_until < ? AND attempts >= max_attempts", models.JobRunning, now).
+		Updates(map[string]interface{}{
+			"status": models.JobFailed, "last_error": "worker dừng giữa chừng", "finished_at": now,
+			"locked_by": "", "locked_until": nil,
+		})
+	requeued := config.DB.Model(&models.Job{}).
+		Where("status = ? AND locked_until < ?", models.JobRunning, now).
+		Updates(map[string]interface{}{
+			"status": models.JobQueued, "run_at": now, "locked_by": "", "locked_until": nil,
+		})
+	if failed.Error != nil || requeued.Error != nil {
+		log.Printf("[jobs] recover: %v %v", failed.Error, requeued.Error)
+		return
+	}
+	if failed.RowsAffected+requeued.RowsAffected > 0 {
+		log.Printf("[jobs] recovered orphaned jobs: %d requeued, %d failed", requeued.RowsAffected, failed.RowsAffected)
+	}
+}
+
+func jobWorker(workerID string) {
+	for {
+		job, kind, err := claimJob(workerID)
+		if err != nil {
+			log.Printf("[jobs] claim: %v", err)
+		}
+		if job == nil {
+			time.Sleep(jobPoll)
+			continue
+		}
+		runJob(workerID, *job, kind)
+	}
+}
+
+// claimJob nhận một job đến hạn (hoặc job "running" đã hết lease) thuộc các loại đã đăng ký
+func claimJob(workerID string) (*models.Job, jobKind, error) {
+	jobMu.RLock()
+	kinds := make([]string, 0, len(jobKinds))
+	for k := range jobKinds {
+		kinds = append(kinds, k)
+	}
+	jobMu.RUnlock()
+	if len(kinds) == 0 {
+		return nil, jobKind{}, nil
+	}
+
+	var claimed *models.Job
+	var kind jobKind
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		var job models.Job
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("kind IN ?", kinds).
+			Where("(status = ? AND run_at <= ?) OR (status = ? AND locked_until < ?)",
+				models.JobQueued, now, models.JobRunning, now).
+			Order("run_at").First(&job).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Worker trước mất lease ở lần thử cuối
+		if job.Status == models.JobRunning && job.Attempts >= job.MaxAttempts {
+			return tx.Model(&job).Updates(map[string]interface{}{
+				"status": models.JobFailed, "last_error": "hết thời gian xử lý", "finished_at": now,
+				"locked_by": "", "locked_until": nil,
+			}).Error
+		}
+
+		jobMu.RLock()
+		kind = jobKinds[job.Kind]
+		jobMu.RUnlock()
+		until := now.Add(kind.opts.Timeout)
+		if err := tx.Model(&job).Updates(map[string]interface{}{
+			"status":       models.JobRunning,
+			"attempts":     gorm.Expr("attempts + 1"),
+			"locked_by":    workerID,
+			"locked_until": until,
+			"started_at":   now,
+		}).Error; err != nil {
+			return err
+		}
+		job.Attempts++
+		job.Status = models.JobRunning
+		claimed = &job
+		return nil
+	})
+	return claimed, kind, err
+}
+
+func runJob(workerID string, job models.Job, kind jobKind) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var cancelRequested bool
+	var stateMu sync.Mutex
+	stop := make(chan struct{})
+	go func() {
+		t := time.NewTicker(kind.opts.Timeout / 3)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+				res := config.DB.Model(&models.Job{}).
+					Where("id = ? AND locked_by = ? AND status = ?", job.ID, workerID, models.JobRunning).
+					Update("locked_until", time.Now().Add(kind.opts.Timeout))
+				if res.Error == nil && res.RowsAffected == 0 {
+					cancel() // mất lease: worker khác đã nhận job
+					return
+				}
+				var cur models.Job
+				if err := config.DB.Select("cancel_requested").First(&cur, job.ID).Error; err == nil && cur.CancelRequested {
+					stateMu.Lock()
+					cancelRequested = true
+					stateMu.Unlock()
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	err := callJobHandler(ctx, kind.handler, job)
+	close(stop)
+
+	stateMu.Lock()
+	cancelled := cancelRequested
+	stateMu.Unlock()
+	if !cancelled && err != nil && errors.Is(err, context.Canceled) {
+		var cur models.Job
+		if config.DB.Select("cancel_requested").First(&cur, job.ID).Error == nil {
+			cancelled = cur.CancelRequested
+		}
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{"locked_by": "", "locked_until": nil}
+	switch {
+	case err == nil:
+		updates["status"] = models.JobDone
+		updates["finished_at"] = now
+		updates["last_error"] = ""
+	case cancelled:
+		updates["status"] = models.JobCancelled
+		updates["finished_at"] = now
+	case errors.As(err, new(permanentJobError)) || job.Attempts >= job.MaxAttempts:
+		updates["status"] = models.JobFailed
+		updates["finished_at"] = now
+		updates["last_error"] = err.Error()
+	default:
+		updates["status"] = models.JobQueued
+		updates["run_at"] = now.Add(jobBackoff(job.Attempts))
+		updates["last_error"] = err.Error()
+	}
+	// Chỉ ghi khi vẫn còn giữ lease
+	if err := config.DB.Model(&models.Job{}).Where("id = ? AND locked_by = ?", job.ID, workerID).
+		Updates(updates).Error; err != nil {
+		log.Printf("[jobs] finish job %d: %v", job.ID, err)
+	}
+}
+
+func callJobHandler(ctx context.Context, h JobHandler, job models.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return h(ctx, job)
+}
+
+// jobBackoff = 10s * 2^(n-1), tối đa 30 phút
+func jobBackoff(n int) time.Duration {
+	d := jobBaseBackoff
+	for i := 1; i < n && d < jobMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > jobMaxBackoff {
+		d = jobMaxBackoff
+	}
+	return d
+}
+
+// IsFinalAttempt: lần chạy hiện tại là lần cuối (lỗi sẽ không được thử lại)
+func IsFinalAttempt(job models.Job, err error) bool {
+	return job.Attempts >= job.MaxAttempts || errors.As(err, new(permanentJobError))
+}
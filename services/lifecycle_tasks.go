@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/vnkhanh/survey-server/config"
+	"github.com/vnkhanh/survey-server/models"
+	"github.com/vnkhanh/survey-server/utils"
+	"gorm.io/gorm"
+)
+
+// RegisterLifecycleTasks đăng ký các tác vụ định kỳ mặc định (gọi trước StartScheduler)
+func RegisterLifecycleTasks() {
+	RegisterTask("close_expired_forms", "*/5 * * * *", closeExpiredForms)
+	RegisterTask("archive_idle_rooms", "0 3 * * *", archiveIdleRooms)
+	RegisterTask("expire_room_invites", "0 * * * *", expireRoomInvites)
+	RegisterTask("expire_exports", "10 * * * *", expireExports)
+	RegisterTask("cleanup", "30 3 * * *", cleanupExpiredRows)
+}
+
+// closeExpiredForms đóng form đang mở đã qua ngày kết thúc (ngay_ket_thuc) hoặc settings.expire_at
+func closeExpiredForms(ctx context.Context) error {
+	now := time.Now()
+	var forms []models.KhaoSat
+	if err := config.DB.WithContext(ctx).
+		Select("id", "tieu_de", "ngay_ket_thuc", "settings_json").
+		Where("trang_thai = ?", "active").
+		Where("ngay_ket_thuc < ? OR settings_json LIKE ?", now, `%"expire_at"%`).
+		Find(&forms).Error; err != nil {
+		return err
+	}
+
+	closed := 0
+	for _, f := range forms {
+		reason := ""
+		if f.NgayKetThuc != nil && f.NgayKetThuc.Before(now) {
+			reason = "ngay_ket_thuc"
+		} else {
+			var s utils.FormSettings
+			if json.Unmarshal([]byte(f.SettingsJSON), &s) == nil && s.ExpireAt != nil && *s.ExpireAt <= now.Unix() {
+				reason = "expire_at"
+			}
+		}
+		if reason == "" {
+			continue
+		}
+
+		err := config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			res := tx.Model(&models.KhaoSat{}).Where("id = ? AND trang_thai = ?", f.ID, "active").
+				Update("trang_thai", "closed")
+			if res.Error != nil || res.RowsAffected == 0 {
+				return res.Error
+			}
+			if err := PublishEvent(tx, EventFormClosed, f.ID, map[string]interface{}{
+				"form_id": f.ID, "title": f.TieuDe, "status": "closed", "reason": reason,
+			}); err != nil {
+				return err
+			}
+			closed++
+			return RecordAudit(tx, AuditEntry{
+				ActorType:  models.ActorSystem,
+				Action:     "form.auto_close",
+				TargetType: "form",
+				TargetID:   f.ID,
+				Metadata:   map[string]interface{}{"reason": reason},
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if closed > 0 {
+		log.Printf("[scheduler] closed %d expired forms", closed)
+	}
+	return nil
+}
+
+// archiveIdleRooms lưu trữ room không thay đổi và không có ai vào trong ROOM_IDLE_DAYS ngày (mặc định 90, 0 = tắt)
+func archiveIdleRooms(ctx context.Context) error {
+	days := envInt("ROOM_IDLE_DAYS", 90)
+	if days <= 0 {
+		return nil
+	}
+	cutoff := time.Now().AddDate(0, 0, -days)
+
+	var ids []uint
+	if err := config.DB.WithContext(ctx).Model(&models.Room{}).
+		Where("trang_thai = ? AND ngay_cap_nhat < ?", "active", cutoff).
+		Where("NOT EXISTS (SELECT 1 FROM room_nguoi_tham_gia m WHERE m.room_id = room.id AND m.ngay_vao >= ?)", cutoff).
+		Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Room{}).Where("id IN ? AND trang_thai = ?", ids, "active").
+			Updates(map[string]interface{}{"trang_thai": "archived", "is_public": false}).Error; err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := RecordAudit(tx, AuditEntry{
+				ActorType:  models.ActorSystem,
+				Action:     "room.auto_archive",
+				TargetType: "room",
+				TargetID:   id,
+				Metadata:   map[string]interface{}{"idle_days": days},
+			}); err != nil {
+				return err
+			}
+		}
+		log.Printf("[scheduler] archived %d idle rooms", len(ids))
+		return nil
+	})
+}
+
+// expireRoomInvites: lời mời chưa phản hồi sau ROOM_INVITE_TTL (mặc định 720h) chuyển sang "expired"
+func expireRoomInvites(ctx context.Context) error {
+	ttl := envDuration("ROOM_INVITE_TTL", 30*24*time.Hour)
+	return config.DB.WithContext(ctx).Model(&models.RoomInvite{}).
+		Where("status = ? AND created_at < ?", "pending", time.Now().Add(-ttl)).
+		Update("status", "expired").Error
+}
+
+// cleanupExpiredRows xoá dữ liệu kỹ thuật đã hết hạn: Idempotency-Key, outbox đã giao, job đã kết thúc
+func cleanupExpiredRows(ctx context.Context) error {
+	now := time.Now()
+	db := config.DB.WithContext(ctx)
+	if err := db.Where("expires_at < ?", now).Delete(&models.IdempotencyKey{}).Error; err != nil {
+		return err
+	}
+	if err := db.Where("dispatched_at < ?", now.AddDate(0, 0, -7)).Delete(&models.OutboxEvent{}).Error; err != nil {
+		return err
+	}
+	return db.Where("status IN ? AND finished_at < ?",
+		[]string{models.JobDone, models.JobCancelled, models.JobFailed}, now.AddDate(0, 0, -30)).
+		Delete(&models.Job{}).Error
+}
+
+func envInt(name string, def int) int {
+	if n, err := strconv.Atoi(os.Getenv(name)); err == nil {
+		return n
+	}
+	return def
+}
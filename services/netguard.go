@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrBlockedAddress: đích gọi ra ngoài trỏ vào mạng nội bộ (loopback, link-local, private, unspecified)
+var ErrBlockedAddress = errors.New("địa chỉ đích thuộc mạng nội bộ")
+
+// allowPrivateOutbound: OUTBOUND_ALLOW_PRIVATE=true cho phép gọi vào mạng nội bộ (chỉ dùng khi dev/self-host)
+func allowPrivateOutbound() bool {
+	return os.Getenv("OUTBOUND_ALLOW_PRIVATE") == "true"
+}
+
+// blockedIP: địa chỉ không được phép gọi tới từ webhook/đích xuất do người dùng cấu hình
+func blockedIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast()
+}
+
+// CheckOutboundURL kiểm tra URL http(s) do người dùng nhập: phân giải host và từ chối nếu
+// có địa chỉ nào thuộc mạng nội bộ. Lúc gửi vẫn kiểm tra lại ở DialContext (chống DNS rebinding).
+func CheckOutboundURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("url phải là địa chỉ http(s) hợp lệ")
+	}
+	return CheckOutboundHost(ctx, u.Hostname())
+}
+
+// CheckOutboundHost phân giải host (tên miền hoặc IP) và từ chối địa chỉ nội bộ
+func CheckOutboundHost(ctx context.Context, host string) error {
+	if allowPrivateOutbound() {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if blockedIP(ip) {
+			return ErrBlockedAddress
+		}
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("không phân giải được host %q", host)
+	}
+	for _, a := range addrs {
+		if blockedIP(a.IP) {
+			return ErrBlockedAddress
+		}
+	}
+	return nil
+}
+
+// guardedDialer kiểm tra địa chỉ thật ngay trước khi kết nối (sau khi đã phân giải DNS)
+func guardedDialer(timeout time.Duration) *net.Dialer {
+	return &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if allowPrivateOutbound() {
+				return nil
+			}
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || blockedIP(ip) {
+				return ErrBlockedAddress
+			}
+			return nil
+		},
+	}
+}
+
+// NewOutboundHTTPClient: http.Client cho đích do người dùng cấu hình; không dùng proxy môi trường
+// và chặn kết nối vào mạng nội bộ ở mọi lần dial (kể cả sau redirect)
+func NewOutboundHTTPClient(timeout time.Duration) *http.Client {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.Proxy = nil
+	tr.DialContext = guardedDialer(10 * time.Second).DialContext
+	return &http.Client{Timeout: timeout, Transport: tr}
+}
@@ -0,0 +1,462 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vnkhanh/survey-server/config"
+	"github.com/vnkhanh/survey-server/models"
+)
+
+const (
+	oidcDiscoveryTTL  = time.Hour
+	oidcJWKSTTL       = time.Hour
+	oidcJWKSMinReload = time.Minute // tránh tải lại JWKS liên tục khi gặp kid lạ
+)
+
+var oidcHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// Hạn của nonce cấp cho một lần đăng nhập OIDC
+const oidcNonceTTL = 10 * time.Minute
+
+// ErrOIDCNonce: nonce không do server cấp, đã hết hạn hoặc đã dùng
+var ErrOIDCNonce = errors.New("nonce không hợp lệ hoặc đã được dùng")
+
+// IssueOIDCNonce cấp nonce ngẫu nhiên cho một lần đăng nhập; client gửi nonce này trong yêu cầu xác thực
+// tới provider rồi gửi lại kèm id_token. Lưu DB để mọi instance dùng chung
+func IssueOIDCNonce(ctx context.Context) (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(b)
+	db := config.DB.WithContext(ctx)
+	// dọn nonce đã hết hạn từ lâu
+	db.Where("expires_at < ?", time.Now().Add(-time.Hour)).Delete(&models.OIDCNonce{})
+	return nonce, db.Create(&models.OIDCNonce{Nonce: nonce, ExpiresAt: time.Now().Add(oidcNonceTTL)}).Error
+}
+
+// ConsumeOIDCNonce đánh dấu nonce đã dùng (sau khi id_token hợp lệ) trong một câu UPDATE:
+// nonce không do server cấp, hết hạn hoặc đã dùng (kể cả bởi request song song) → ErrOIDCNonce
+func ConsumeOIDCNonce(ctx context.Context, nonce string) error {
+	if nonce == "" {
+		return ErrOIDCNonce
+	}
+	now := time.Now()
+	res := config.DB.WithContext(ctx).Model(&models.OIDCNonce{}).
+		Where("nonce = ? AND used_at IS NULL AND expires_at > ?", nonce, now).
+		Update("used_at", now)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrOIDCNonce
+	}
+	return nil
+}
+
+// OIDCClaims: thông tin cần thiết lấy từ id_token sau khi xác minh
+type OIDCClaims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// OIDCProvider: một issuer OpenID Connect, tự discovery và cache JWKS
+type OIDCProvider struct {
+	Name        string
+	DisplayName string
+	Issuer      string
+	ClientID    string
+	// Một số issuer (Google) phát token với "iss" khác dạng URL trong discovery
+	AltIssuers []string
+
+	mu           sync.Mutex
+	jwksURI      string
+	discoveredAt time.Time
+	keys         map[string]crypto.PublicKey
+	keysAt       time.Time
+}
+
+type oidcRegistry struct {
+	mu        sync.RWMutex
+	providers map[string]*OIDCProvider // khai báo qua env, cố định trong suốt tiến trình
+	db        map[string]*OIDCProvider // bảng oidc_providers, nạp lại sau oidcDBTTL
+	dbAt      time.Time
+}
+
+var providers = &oidcRegistry{providers: map[string]*OIDCProvider{}}
+
+// oidcDBTTL: thời gian dùng lại danh sách provider trong DB; bật/tắt/sửa provider có hiệu lực sau tối đa chừng này
+const oidcDBTTL = 30 * time.Second
+
+// loadDBOIDCProviders đọc các provider đang bật trong DB (thay được khi test)
+var loadDBOIDCProviders = func() ([]models.OIDCProvider, error) {
+	if config.DB == nil {
+		return nil, nil
+	}
+	var rows []models.OIDCProvider
+	err := config.DB.Where("enabled = ?", true).Find(&rows).Error
+	return rows, err
+}
+
+// RegisterOIDCProvider thêm/ghi đè provider trong registry
+func RegisterOIDCProvider(p *OIDCProvider) {
+	normalizeOIDCProvider(p)
+	providers.mu.Lock()
+	providers.providers[p.Name] = p
+	providers.mu.Unlock()
+}
+
+func normalizeOIDCProvider(p *OIDCProvider) {
+	p.Name = strings.ToLower(strings.TrimSpace(p.Name))
+	p.Issuer = strings.TrimRight(strings.TrimSpace(p.Issuer), "/")
+	if p.DisplayName == "" {
+		p.DisplayName = p.Name
+	}
+}
+
+// InvalidateOIDCProviders bỏ cache provider của DB (gọi sau khi thêm/sửa/tắt provider)
+func InvalidateOIDCProviders() {
+	providers.mu.Lock()
+	providers.dbAt = time.Time{}
+	providers.mu.Unlock()
+}
+
+// dbProviders trả danh sách provider của DB, nạp lại khi quá oidcDBTTL.
+// Provider không đổi cấu hình giữ nguyên đối tượng cũ để không mất cache discovery/JWKS;
+// lỗi DB thì dùng tiếp danh sách cũ.
+func (r *oidcRegistry) dbProviders() map[string]*OIDCProvider {
+	r.mu.RLock()
+	if r.db != nil && time.Since(r.dbAt) < oidcDBTTL {
+		m := r.db
+		r.mu.RUnlock()
+		return m
+	}
+	r.mu.RUnlock()
+
+	rows, err := loadDBOIDCProviders()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		log.Printf("[oidc] load providers: %v", err)
+		if r.db == nil {
+			r.db = map[string]*OIDCProvider{}
+		}
+		return r.db
+	}
+	m := make(map[string]*OIDCProvider, len(rows))
+	for _, row := range rows {
+		p := &OIDCProvider{Name: row.Ten, DisplayName: row.HienThi, Issuer: row.Issuer, ClientID: row.ClientID}
+		normalizeOIDCProvider(p)
+		if old, ok := r.db[p.Name]; ok && old.Issuer == p.Issuer && old.ClientID == p.ClientID {
+			old.DisplayName = p.DisplayName
+			p = old
+		}
+		m[p.Name] = p
+	}
+	r.db, r.dbAt = m, time.Now()
+	return m
+}
+
+// InitOIDCProviders nạp provider từ env. Gọi sau khi đã load .env.
+//
+//	GOOGLE_CLIENT_ID                → provider "google"
+//	OIDC_PROVIDERS=keycloak,gitlab  → mỗi tên cần OIDC_<TÊN>_ISSUER, OIDC_<TÊN>_CLIENT_ID (tuỳ chọn OIDC_<TÊN>_NAME)
+func InitOIDCProviders() {
+	if GoogleClientID == "" {
+		GoogleClientID = os.Getenv("GOOGLE_CLIENT_ID")
+	}
+	if GoogleClientID != "" {
+		RegisterOIDCProvider(&OIDCProvider{
+			Name:        "google",
+			DisplayName: "Google",
+			Issuer:      "https://accounts.google.com",
+			ClientID:    GoogleClientID,
+			AltIssuers:  []string{"accounts.google.com"},
+		})
+	}
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		envKey := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		issuer := os.Getenv(envKey + "_ISSUER")
+		clientID := os.Getenv(envKey + "_CLIENT_ID")
+		if issuer == "" || clientID == "" {
+			continue
+		}
+		RegisterOIDCProvider(&OIDCProvider{
+			Name:        name,
+			DisplayName: os.Getenv(envKey + "_NAME"),
+			Issuer:      issuer,
+			ClientID:    clientID,
+		})
+	}
+}
+
+// GetOIDCProvider tìm provider khai báo qua env, nếu không có thì tra bảng oidc_providers
+func GetOIDCProvider(name string) (*OIDCProvider, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	providers.mu.RLock()
+	p, ok := providers.providers[name]
+	providers.mu.RUnlock()
+	if ok {
+		return p, true
+	}
+	p, ok = providers.dbProviders()[name]
+	return p, ok
+}
+
+// ListOIDCProviders: danh sách provider đang bật (env + DB, env ưu tiên khi trùng tên), sắp xếp theo tên
+func ListOIDCProviders() []*OIDCProvider {
+	db := providers.dbProviders()
+
+	providers.mu.RLock()
+	out := make([]*OIDCProvider, 0, len(providers.providers)+len(db))
+	for _, p := range providers.providers {
+		out = append(out, p)
+	}
+	for name, p := range db {
+		if _, ok := providers.providers[name]; !ok {
+			out = append(out, p)
+		}
+	}
+	providers.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Verify xác minh chữ ký, issuer, audience, thời hạn của id_token và trả về claims.
+// Claim "nonce" bắt buộc và phải trùng nonce (IssueOIDCNonce) client đã gửi trong yêu cầu xác thực.
+func (p *OIDCProvider) Verify(ctx context.Context, rawIDToken, nonce string) (*OIDCClaims, error) {
+	if nonce == "" {
+		return nil, errors.New("thiếu nonce")
+	}
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.publicKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30*time.Second),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	iss, _ := claims.GetIssuer()
+	if !p.issuerMatches(iss) {
+		return nil, fmt.Errorf("issuer không hợp lệ: %s", iss)
+	}
+
+	if got, _ := claims["nonce"].(string); got == "" || subtle.ConstantTimeCompare([]byte(got), []byte(nonce)) != 1 {
+		return nil, errors.New("nonce không khớp")
+	}
+
+	sub, _ := claims.GetSubject()
+	if sub == "" {
+		return nil, errors.New("id_token thiếu sub")
+	}
+
+	out := &OIDCClaims{Subject: sub}
+	out.Email, _ = claims["email"].(string)
+	out.Name, _ = claims["name"].(string)
+	if out.Name == "" {
+		out.Name, _ = claims["preferred_username"].(string)
+	}
+	// email_verified có thể là bool hoặc chuỗi "true" tuỳ issuer
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		out.EmailVerified = v
+	case string:
+		out.EmailVerified = strings.EqualFold(v, "true")
+	}
+	out.Email = strings.TrimSpace(strings.ToLower(out.Email))
+	return out, nil
+}
+
+func (p *OIDCProvider) issuerMatches(iss string) bool {
+	iss = strings.TrimRight(iss, "/")
+	if iss == p.Issuer {
+		return true
+	}
+	for _, alt := range p.AltIssuers {
+		if iss == alt {
+			return true
+		}
+	}
+	return false
+}
+
+// publicKey lấy khoá theo kid, tải lại JWKS khi hết hạn cache hoặc gặp kid chưa biết
+func (p *OIDCProvider) publicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.keys != nil && time.Since(p.keysAt) < oidcJWKSTTL {
+		if k, ok := p.lookupKeyLocked(kid); ok {
+			return k, nil
+		}
+		if time.Since(p.keysAt) < oidcJWKSMinReload {
+			return nil, fmt.Errorf("không tìm thấy khoá kid=%q", kid)
+		}
+	}
+
+	if err := p.refreshKeysLocked(ctx); err != nil {
+		return nil, err
+	}
+	if k, ok := p.lookupKeyLocked(kid); ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("không tìm thấy khoá kid=%q", kid)
+}
+
+func (p *OIDCProvider) lookupKeyLocked(kid string) (crypto.PublicKey, bool) {
+	if kid != "" {
+		k, ok := p.keys[kid]
+		return k, ok
+	}
+	// Token không có kid: chỉ chấp nhận khi JWKS có đúng 1 khoá
+	if len(p.keys) == 1 {
+		for _, k := range p.keys {
+			return k, true
+		}
+	}
+	return nil, false
+}
+
+func (p *OIDCProvider) refreshKeysLocked(ctx context.Context) error {
+	if p.jwksURI == "" || time.Since(p.discoveredAt) > oidcDiscoveryTTL {
+		var doc struct {
+			Issuer  string `json:"issuer"`
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := getJSON(ctx, p.Issuer+"/.well-known/openid-configuration", &doc); err != nil {
+			return fmt.Errorf("discovery thất bại: %w", err)
+		}
+		if strings.TrimRight(doc.Issuer, "/") != p.Issuer {
+			return fmt.Errorf("issuer trong discovery (%s) không khớp cấu hình", doc.Issuer)
+		}
+		if doc.JWKSURI == "" {
+			return errors.New("discovery thiếu jwks_uri")
+		}
+		p.jwksURI = doc.JWKSURI
+		p.discoveredAt = time.Now()
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := getJSON(ctx, p.jwksURI, &set); err != nil {
+		return fmt.Errorf("tải JWKS thất bại: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	if len(keys) == 0 {
+		return errors.New("JWKS không có khoá ký hợp lệ")
+	}
+	p.keys = keys
+	p.keysAt = time.Now()
+	return nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("curve không hỗ trợ: %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, fmt.Errorf("kty không hỗ trợ: %s", k.Kty)
+}
+
+func getJSON(ctx context.Context, url string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s trả về HTTP %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vnkhanh/survey-server/models"
+)
+
+// stubIssuer: issuer OIDC chạy trong tiến trình (discovery + JWKS), ký id_token bằng khoá RSA của nó
+type stubIssuer struct {
+	srv       *httptest.Server
+	key       *rsa.PrivateKey
+	kid       string
+	jwksHits  atomic.Int32
+	discovery atomic.Int32
+}
+
+func newStubIssuer(t *testing.T) *stubIssuer {
+	t.Helper()
+	s := &stubIssuer{key: newRSAKey(t), kid: "k1"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		s.discovery.Add(1)
+		json.NewEncoder(w).Encode(map[string]string{"issuer": s.srv.URL, "jwks_uri": s.srv.URL + "/jwks"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		s.jwksHits.Add(1)
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": s.kid, "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(s.key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.E)).Bytes()),
+		}}})
+	})
+	s.srv = httptest.NewServer(mux)
+	t.Cleanup(s.srv.Close)
+	return s
+}
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func (s *stubIssuer) provider() *OIDCProvider {
+	return &OIDCProvider{Name: "stub", Issuer: s.srv.URL, ClientID: "client-1"}
+}
+
+// token ký id_token với claims mặc định hợp lệ; mod sửa claims trước khi ký
+func (s *stubIssuer) token(t *testing.T, key *rsa.PrivateKey, mod func(jwt.MapClaims)) string {
+	t.Helper()
+	claims := jwt.MapClaims{
+		"iss":            s.srv.URL,
+		"aud":            "client-1",
+		"sub":            "user-42",
+		"email":          "User@Example.com",
+		"email_verified": true,
+		"nonce":          "n-1",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+	}
+	if mod != nil {
+		mod(claims)
+	}
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	tok.Header["kid"] = s.kid
+	raw, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestOIDCVerify(t *testing.T) {
+	iss := newStubIssuer(t)
+	p := iss.provider()
+	ctx := context.Background()
+
+	claims, err := p.Verify(ctx, iss.token(t, iss.key, nil), "n-1")
+	if err != nil {
+		t.Fatalf("token hợp lệ bị từ chối: %v", err)
+	}
+	if claims.Subject != "user-42" || claims.Email != "user@example.com" || !claims.EmailVerified {
+		t.Fatalf("claims sai: %+v", claims)
+	}
+
+	cases := []struct {
+		name  string
+		key   *rsa.PrivateKey
+		mod   func(jwt.MapClaims)
+		nonce string
+	}{
+		{"sai chữ ký", newRSAKey(t), nil, "n-1"},
+		{"sai issuer", iss.key, func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }, "n-1"},
+		{"sai audience", iss.key, func(c jwt.MapClaims) { c["aud"] = "other-client" }, "n-1"},
+		{"sai nonce", iss.key, nil, "n-2"},
+		{"thiếu nonce", iss.key, func(c jwt.MapClaims) { delete(c, "nonce") }, "n-1"},
+		{"client không gửi nonce", iss.key, nil, ""},
+		{"cả hai đều rỗng", iss.key, func(c jwt.MapClaims) { delete(c, "nonce") }, ""},
+		{"hết hạn", iss.key, func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, "n-1"},
+		{"thiếu sub", iss.key, func(c jwt.MapClaims) { delete(c, "sub") }, "n-1"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := p.Verify(ctx, iss.token(t, tc.key, tc.mod), tc.nonce); err == nil {
+				t.Fatal("token không hợp lệ được chấp nhận")
+			}
+		})
+	}
+}
+
+func TestOIDCJWKSCache(t *testing.T) {
+	iss := newStubIssuer(t)
+	p := iss.provider()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := p.Verify(ctx, iss.token(t, iss.key, nil), "n-1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if iss.discovery.Load() != 1 || iss.jwksHits.Load() != 1 {
+		t.Fatalf("discovery=%d jwks=%d, muốn 1/1", iss.discovery.Load(), iss.jwksHits.Load())
+	}
+
+	// Xoay khoá: kid lạ chỉ tải lại JWKS khi lần tải trước đã quá oidcJWKSMinReload
+	iss.key, iss.kid = newRSAKey(t), "k2"
+	if _, err := p.Verify(ctx, iss.token(t, iss.key, nil), "n-1"); err == nil {
+		t.Fatal("kid mới được chấp nhận trước khi tải lại JWKS")
+	}
+	p.keysAt = time.Now().Add(-2 * oidcJWKSMinReload)
+	if _, err := p.Verify(ctx, iss.token(t, iss.key, nil), "n-1"); err != nil {
+		t.Fatalf("không nhận khoá mới sau khi xoay: %v", err)
+	}
+	if iss.jwksHits.Load() != 2 {
+		t.Fatalf("jwks=%d, muốn 2", iss.jwksHits.Load())
+	}
+}
+
+func TestOIDCDiscoveryIssuerMismatch(t *testing.T) {
+	iss := newStubIssuer(t)
+	p := iss.provider()
+	p.Issuer = iss.srv.URL + "/realms/other"
+	// discovery của issuer khác trả 404 → lỗi, không dùng nhầm khoá
+	if _, err := p.Verify(context.Background(), iss.token(t, iss.key, nil), "n-1"); err == nil {
+		t.Fatal("chấp nhận token khi discovery thất bại")
+	}
+}
+
+func TestOIDCDBProviders(t *testing.T) {
+	iss := newStubIssuer(t)
+	rows := []models.OIDCProvider{{Ten: "Keycloak", HienThi: "Keycloak", Issuer: iss.srv.URL + "/", ClientID: "client-1", Enabled: true}}
+	var loadErr error
+	oldLoad := loadDBOIDCProviders
+	loadDBOIDCProviders = func() ([]models.OIDCProvider, error) { return rows, loadErr }
+	t.Cleanup(func() {
+		loadDBOIDCProviders = oldLoad
+		InvalidateOIDCProviders()
+	})
+	InvalidateOIDCProviders()
+
+	p, ok := GetOIDCProvider("keycloak")
+	if !ok || p.Issuer != iss.srv.URL {
+		t.Fatalf("không tìm thấy provider của DB: %+v", p)
+	}
+	if _, err := p.Verify(context.Background(), iss.token(t, iss.key, nil), "n-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Sửa tên hiển thị: giữ đối tượng cũ (cache JWKS) sau khi nạp lại
+	rows[0].HienThi = "SSO"
+	InvalidateOIDCProviders()
+	p2, _ := GetOIDCProvider("keycloak")
+	if p2 != p || p2.DisplayName != "SSO" {
+		t.Fatalf("provider không được cập nhật tại chỗ: %+v", p2)
+	}
+
+	// DB lỗi: dùng tiếp danh sách cũ
+	loadErr = errors.New("db down")
+	InvalidateOIDCProviders()
+	if _, ok := GetOIDCProvider("keycloak"); !ok {
+		t.Fatal("mất provider khi DB lỗi")
+	}
+
+	// Tắt provider: biến mất khỏi Get và List sau khi nạp lại
+	loadErr, rows = nil, nil
+	InvalidateOIDCProviders()
+	if _, ok := GetOIDCProvider("keycloak"); ok {
+		t.Fatal("provider đã tắt vẫn dùng được")
+	}
+	for _, lp := range ListOIDCProviders() {
+		if strings.EqualFold(lp.Name, "keycloak") {
+			t.Fatal("provider đã tắt vẫn được liệt kê")
+		}
+	}
+}
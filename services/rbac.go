@@ -0,0 +1,142 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/vnkhanh/survey-server/config"
+	"github.com/vnkhanh/survey-server/models"
+	"gorm.io/gorm"
+)
+
+// ErrLastAdmin: thao tác sẽ khiến hệ thống không còn admin nào
+var ErrLastAdmin = errors.New("hệ thống phải còn ít nhất một admin")
+
+// Khoá advisory (pg_advisory_xact_lock) khi đổi vai trò/quyền hoặc khoá tài khoản: hai thao tác song song
+// không cùng gỡ quyền quản trị của hai admin cuối cùng
+const adminGuardLockNamespace = 30
+
+// countActiveAdmins: số user đang hoạt động có quyền admin.* (qua vai trò)
+func countActiveAdmins(tx *gorm.DB) (int64, error) {
+	var n int64
+	err := tx.Table("user_roles").
+		Joins("JOIN role_permissions ON role_permissions.role_id = user_roles.role_id").
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id").
+		Joins("JOIN nguoi_dung ON nguoi_dung.id = user_roles.nguoi_dung_id").
+		Where("permissions.ma LIKE ? AND nguoi_dung.disabled_at IS NULL", "admin.%").
+		Distinct("user_roles.nguoi_dung_id").
+		Count(&n).Error
+	return n, err
+}
+
+// GuardLastAdmin chạy change trong tx: nếu trước đó còn user đang hoạt động giữ quyền admin.* mà sau
+// thay đổi không còn ai thì trả ErrLastAdmin (tx rollback)
+func GuardLastAdmin(tx *gorm.DB, change func() error) error {
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?, 0)", adminGuardLockNamespace).Error; err != nil {
+		return err
+	}
+	before, err := countActiveAdmins(tx)
+	if err != nil {
+		return err
+	}
+	if err := change(); err != nil {
+		return err
+	}
+	after, err := countActiveAdmins(tx)
+	if err != nil {
+		return err
+	}
+	if before > 0 && after == 0 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// RevokeUserSessions thu hồi mọi phiên của user: tăng token_version (JWT cũ bị từ chối) và thu hồi API key
+func RevokeUserSessions(tx *gorm.DB, userID uint) error {
+	if err := tx.Model(&models.NguoiDung{}).Where("id = ?", userID).
+		UpdateColumn("token_version", gorm.Expr("token_version + 1")).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.ApiKey{}).Where("nguoi_dung_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// MissingPermission: quyền đầu tiên (theo thứ tự mã) target có mà actor không có; rỗng = actor bao trùm target
+func MissingPermission(actor, target map[string]bool) string {
+	missing := ""
+	for p, ok := range target {
+		if ok && !actor[p] && (missing == "" || p < missing) {
+			missing = p
+		}
+	}
+	return missing
+}
+
+// UserRoleNames trả về tên các vai trò của user
+func UserRoleNames(userID uint) ([]string, error) {
+	var names []string
+	err := config.DB.Table("user_roles").
+		Select("roles.ten").
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("user_roles.nguoi_dung_id = ?", userID).
+		Order("roles.ten").
+		Scan(&names).Error
+	return names, err
+}
+
+// UserPermissions trả về tập mã quyền (hợp của mọi vai trò) của user
+func UserPermissions(userID uint) (map[string]bool, error) {
+	var codes []string
+	err := config.DB.Table("user_roles").
+		Select("DISTINCT permissions.ma").
+		Joins("JOIN role_permissions ON role_permissions.role_id = user_roles.role_id").
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id").
+		Where("user_roles.nguoi_dung_id = ?", userID).
+		Scan(&codes).Error
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		out[code] = true
+	}
+	return out, nil
+}
+
+// SetUserRoles thay toàn bộ vai trò của user và đồng bộ cột vai_tro (= có vai trò admin).
+// Không cho bỏ vai trò admin của admin cuối cùng.
+func SetUserRoles(tx *gorm.DB, userID uint, roles []models.Role) error {
+	hasAdmin := false
+	for _, r := range roles {
+		if r.Ten == models.RoleAdmin {
+			hasAdmin = true
+		}
+	}
+
+	if !hasAdmin {
+		var others int64
+		if err := tx.Table("user_roles").
+			Joins("JOIN roles ON roles.id = user_roles.role_id").
+			Where("roles.ten = ? AND user_roles.nguoi_dung_id <> ?", models.RoleAdmin, userID).
+			Count(&others).Error; err != nil {
+			return err
+		}
+		var self int64
+		if err := tx.Table("user_roles").
+			Joins("JOIN roles ON roles.id = user_roles.role_id").
+			Where("roles.ten = ? AND user_roles.nguoi_dung_id = ?", models.RoleAdmin, userID).
+			Count(&self).Error; err != nil {
+			return err
+		}
+		if self > 0 && others == 0 {
+			return ErrLastAdmin
+		}
+	}
+
+	user := models.NguoiDung{ID: userID}
+	if err := tx.Model(&user).Association("Roles").Replace(roles); err != nil {
+		return err
+	}
+	return tx.Model(&models.NguoiDung{}).Where("id = ?", userID).Update("vai_tro", hasAdmin).Error
+}
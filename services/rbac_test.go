@@ -0,0 +1,28 @@
+package services
+
+import "testing"
+
+func TestMissingPermission(t *testing.T) {
+	set := func(codes ...string) map[string]bool {
+		m := map[string]bool{}
+		for _, c := range codes {
+			m[c] = true
+		}
+		return m
+	}
+	cases := []struct {
+		actor, target map[string]bool
+		want          string
+	}{
+		{set("admin.access", "users.manage", "roles.manage"), set("admin.access", "users.manage"), ""},
+		{set("admin.access", "users.manage"), set(), ""},
+		{set("admin.access", "users.manage"), set("admin.access", "users.manage", "roles.manage"), "roles.manage"},
+		{set("users.manage"), set("stats.read", "audit.read"), "audit.read"},
+		{set("users.manage"), map[string]bool{"audit.read": false}, ""},
+	}
+	for i, tc := range cases {
+		if got := MissingPermission(tc.actor, tc.target); got != tc.want {
+			t.Errorf("case %d: MissingPermission = %q, muốn %q", i, got, tc.want)
+		}
+	}
+}
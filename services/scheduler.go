@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vnkhanh/survey-server/config"
+	"github.com/vnkhanh/survey-server/models"
+	"gorm.io/gorm"
+)
+
+// Khoá advisory (pg_try_advisory_xact_lock) của scheduler: (namespace, hashtext(tên tác vụ))
+const schedulerLockNamespace = 41
+
+const schedulerTick = 30 * time.Second
+
+// TaskFunc: một tác vụ định kỳ
+type TaskFunc func(ctx context.Context) error
+
+type scheduledTask struct {
+	name     string
+	spec     string
+	schedule *CronSchedule
+	fn       TaskFunc
+}
+
+var (
+	schedMu    sync.RWMutex
+	schedTasks = map[string]*scheduledTask{}
+)
+
+// RegisterTask đăng ký tác vụ theo lịch cron. Có thể ghi đè lịch bằng env SCHEDULE_<TÊN>
+// (vd. SCHEDULE_CLOSE_EXPIRED_FORMS="*/10 * * * *"), "off" để tắt.
+func RegisterTask(name, spec string, fn TaskFunc) {
+	if v := strings.TrimSpace(os.Getenv("SCHEDULE_" + strings.ToUpper(name))); v != "" {
+		spec = v
+	}
+	if spec == "off" {
+		return
+	}
+	sch, err := ParseCron(spec)
+	if err != nil {
+		log.Fatalf("[scheduler] task %s: %v", name, err)
+	}
+	schedMu.Lock()
+	schedTasks[name] = &scheduledTask{name: name, spec: spec, schedule: sch, fn: fn}
+	schedMu.Unlock()
+}
+
+// StartScheduler chạy nền: mỗi 30 giây kiểm tra tác vụ đến hạn. Nhiều replica cùng chạy scheduler,
+// nhưng mỗi lượt chỉ replica giữ được advisory lock của tác vụ mới thực hiện.
+func StartScheduler() {
+	host, _ := os.Hostname()
+	runner := fmt.Sprintf("%s:%d", host, os.Getpid())
+	go func() {
+		ticker := time.NewTicker(schedulerTick)
+		defer ticker.Stop()
+		for {
+			for _, t := range registeredTasks() {
+				if err := runTaskIfDue(t, runner, false); err != nil {
+					log.Printf("[scheduler] %s: %v", t.name, err)
+				}
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+func registeredTasks() []*scheduledTask {
+	schedMu.RLock()
+	defer schedMu.RUnlock()
+	out := make([]*scheduledTask, 0, len(schedTasks))
+	for _, t := range schedTasks {
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].name < out[j].name })
+	return out
+}
+
+// runTaskIfDue chạy tác vụ nếu đến hạn (hoặc force) và ghi lại kết quả.
+// Advisory lock theo transaction: replica khác đang chạy thì bỏ qua lượt này.
+func runTaskIfDue(t *scheduledTask, runner string, force bool) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		var locked bool
+		if err := tx.Raw("SELECT pg_try_advisory_xact_lock(?, hashtext(?))", schedulerLockNamespace, t.name).
+			Scan(&locked).Error; err != nil {
+			return err
+		}
+		if !locked {
+			return nil
+		}
+
+		now := time.Now()
+		var st models.ScheduledTask
+		err := tx.First(&st, "name = ?", t.name).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			// Lần đầu: chạy ở mốc kế tiếp của lịch
+			st = models.ScheduledTask{Name: t.name, Spec: t.spec, NextRunAt: t.schedule.Next(now)}
+			if err := tx.Create(&st).Error; err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		case st.Spec != t.spec:
+			// Lịch đổi (env/code): tính lại từ bây giờ
+			st.Spec, st.NextRunAt = t.spec, t.schedule.Next(now)
+			if err := tx.Model(&st).Updates(map[string]interface{}{"spec": st.Spec, "next_run_at": st.NextRunAt}).Error; err != nil {
+				return err
+			}
+		}
+		if !force && st.NextRunAt.After(now) {
+			return nil
+		}
+
+		errMsg := ""
+		if err := callTask(t); err != nil {
+			errMsg = err.Error()
+			log.Printf("[scheduler] %s failed: %v", t.name, err)
+		}
+		return tx.Model(&st).Updates(map[string]interface{}{
+			"next_run_at":      t.schedule.Next(time.Now()),
+			"last_run_at":      now,
+			"last_duration_ms": time.Since(now).Milliseconds(),
+			"last_error":       errMsg,
+			"last_run_by":      runner,
+		}).Error
+	})
+}
+
+func callTask(t *scheduledTask) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return t.fn(context.Background())
+}
+
+// ScheduledTasks trả trạng thái các tác vụ đã đăng ký trên instance này
+func ScheduledTasks() ([]models.ScheduledTask, error) {
+	tasks := registeredTasks()
+	names := make([]string, len(tasks))
+	for i, t := range tasks {
+		names[i] = t.name
+	}
+	var rows []models.ScheduledTask
+	if err := config.DB.Where("name IN ?", names).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	byName := map[string]models.ScheduledTask{}
+	for _, r := range rows {
+		byName[r.Name] = r
+	}
+	out := make([]models.ScheduledTask, 0, len(tasks))
+	for _, t := range tasks {
+		r, ok := byName[t.name]
+		if !ok {
+			r = models.ScheduledTask{Name: t.name, Spec: t.spec, NextRunAt: t.schedule.Next(time.Now())}
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// ErrTaskNotFound: tên tác vụ chưa được đăng ký
+var ErrTaskNotFound = errors.New("task not found")
+
+// ErrTaskBusy: tác vụ đang chạy ở một instance khác
+var ErrTaskBusy = errors.New("task busy")
+
+// RunTaskNow chạy ngay một tác vụ (vẫn qua advisory lock)
+func RunTaskNow(name string) (models.ScheduledTask, error) {
+	var st models.ScheduledTask
+	schedMu.RLock()
+	t, ok := schedTasks[name]
+	schedMu.RUnlock()
+	if !ok {
+		return st, ErrTaskNotFound
+	}
+	host, _ := os.Hostname()
+	before := time.Now()
+	if err := runTaskIfDue(t, fmt.Sprintf("%s:%d", host, os.Getpid()), true); err != nil {
+		return st, err
+	}
+	if err := config.DB.First(&st, "name = ?", name).Error; err != nil {
+		return st, err
+	}
+	if st.LastRunAt == nil || st.LastRunAt.Before(before) {
+		return st, ErrTaskBusy
+	}
+	return st, nil
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	storage "github.com/supabase-community/storage-go"
+)
+
+// Storage: kho lưu file (file người trả lời tải lên, ...), truy cập theo key (đường dẫn trong kho)
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	// SignedURL trả URL tải file có hạn ttl
+	SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error)
+}
+
+// ErrStorageNotConfigured: chưa cấu hình kho lưu file
+var ErrStorageNotConfigured = errors.New("storage not configured")
+
+// PublicStorage: kho có URL công khai cố định cho key (bucket public)
+type PublicStorage interface {
+	PublicURL(key string) string
+}
+
+var (
+	fileStorageMu sync.Mutex
+	fileStorage   Storage
+	answerStorage Storage
+)
+
+// Endpoint của kho file trên đĩa (FILE_STORAGE=local): tải qua link ký và đọc file công khai
+const (
+	FileDownloadPath = "/api/file-downloads"
+	FilePublicPath   = "/api/files"
+)
+
+// FileStorage trả kho lưu file tải lên theo FILE_STORAGE:
+//   - "supabase": bucket SUPABASE_BUCKET (mặc định "uploadfile_survey") của SUPABASE_URL
+//   - "s3": bucket tương thích S3 theo FILE_S3_* (xem S3ConfigFromEnv), URL công khai FILE_S3_PUBLIC_URL
+//   - "local": thư mục FILE_DIR (mặc định ./uploads), phục vụ qua server; dùng khi phát triển/kiểm thử
+//
+// Không đặt FILE_STORAGE: supabase nếu có SUPABASE_URL, ngược lại local.
+func FileStorage() (Storage, error) {
+	fileStorageMu.Lock()
+	defer fileStorageMu.Unlock()
+	return fileStorageLocked()
+}
+
+// fileStorageKind: giá trị FILE_STORAGE (không đặt: supabase nếu có SUPABASE_URL, ngược lại local)
+func fileStorageKind() string {
+	kind := strings.ToLower(os.Getenv("FILE_STORAGE"))
+	if kind == "" {
+		kind = "local"
+		if os.Getenv("SUPABASE_URL") != "" {
+			kind = "supabase"
+		}
+	}
+	return kind
+}
+
+func fileStorageLocked() (Storage, error) {
+	if fileStorage != nil {
+		return fileStorage, nil
+	}
+	kind := fileStorageKind()
+	switch kind {
+	case "supabase":
+		if os.Getenv("SUPABASE_URL") == "" {
+			return nil, ErrStorageNotConfigured
+		}
+		fileStorage = NewSupabaseStorage(os.Getenv("SUPABASE_URL"), os.Getenv("SUPABASE_KEY"), os.Getenv("SUPABASE_BUCKET"))
+	case "s3":
+		st, err := NewS3Storage(S3ConfigFromEnv("FILE_S3_"))
+		if err != nil {
+			return nil, err
+		}
+		fileStorage = st.WithPublicURL(os.Getenv("FILE_S3_PUBLIC_URL"))
+	case "local":
+		dir := os.Getenv("FILE_DIR")
+		if dir == "" {
+			dir = "./uploads"
+		}
+		secret := os.Getenv("FILE_SIGNING_KEY")
+		if secret == "" {
+			secret = os.Getenv("JWT_SECRET")
+		}
+		base := strings.TrimRight(os.Getenv("API_BASE_URL"), "/")
+		fileStorage = NewLocalStorage(dir, base+FileDownloadPath, []byte(secret)).WithPublicURL(base + FilePublicPath)
+	default:
+		return nil, fmt.Errorf("FILE_STORAGE không hỗ trợ: %s", os.Getenv("FILE_STORAGE"))
+	}
+	return fileStorage, nil
+}
+
+// SetFileStorage thay kho lưu file
+func SetFileStorage(s Storage) {
+	fileStorageMu.Lock()
+	fileStorage = s
+	fileStorageMu.Unlock()
+}
+
+// Bucket mặc định của file người trả lời nộp trên Supabase (phải là bucket private)
+const defaultAnswerBucket = "uploadfile_survey_answers"
+
+// AnswerStorage trả kho của file người trả lời nộp, tách khỏi kho file công khai của form (FileStorage)
+// để file chỉ tải được qua link ký sau khi kiểm tra quyền:
+//   - "supabase": bucket SUPABASE_ANSWER_BUCKET (mặc định "uploadfile_survey_answers"); từ chối bucket public
+//   - "s3": bucket ANSWER_S3_BUCKET (bắt buộc, khác FILE_S3_BUCKET), các ANSWER_S3_* khác mặc định theo
+//     FILE_S3_*; không có URL công khai
+//   - "local": dùng chung thư mục với FileStorage; URL công khai /api/files không phục vụ key answers/
+func AnswerStorage() (Storage, error) {
+	fileStorageMu.Lock()
+	defer fileStorageMu.Unlock()
+	if answerStorage != nil {
+		return answerStorage, nil
+	}
+	switch kind := fileStorageKind(); kind {
+	case "supabase":
+		if os.Getenv("SUPABASE_URL") == "" {
+			return nil, ErrStorageNotConfigured
+		}
+		bucket := os.Getenv("SUPABASE_ANSWER_BUCKET")
+		if bucket == "" {
+			bucket = defaultAnswerBucket
+		}
+		if pub := os.Getenv("SUPABASE_BUCKET"); bucket == pub || (pub == "" && bucket == "uploadfile_survey") {
+			return nil, errors.New("SUPABASE_ANSWER_BUCKET phải khác bucket công khai SUPABASE_BUCKET")
+		}
+		st := NewSupabaseStorage(os.Getenv("SUPABASE_URL"), os.Getenv("SUPABASE_KEY"), bucket).(*supabaseStorage)
+		b, err := st.client.GetBucket(bucket)
+		if err != nil {
+			return nil, fmt.Errorf("supabase: không đọc được bucket %s: %v", bucket, err)
+		}
+		if b.Public {
+			return nil, fmt.Errorf("supabase: bucket %s đang public, file người trả lời nộp cần bucket private", bucket)
+		}
+		answerStorage = st
+	case "s3":
+		cfg := answerS3Config()
+		if cfg.Bucket == "" {
+			return nil, errors.New("s3: thiếu ANSWER_S3_BUCKET cho file người trả lời nộp")
+		}
+		pub := S3ConfigFromEnv("FILE_S3_")
+		if cfg.Bucket == pub.Bucket && cfg.Endpoint == pub.Endpoint {
+			return nil, errors.New("s3: ANSWER_S3_BUCKET phải khác bucket công khai FILE_S3_BUCKET")
+		}
+		st, err := NewS3Storage(cfg)
+		if err != nil {
+			return nil, err
+		}
+		answerStorage = st
+	default:
+		st, err := fileStorageLocked()
+		if err != nil {
+			return nil, err
+		}
+		answerStorage = st
+	}
+	return answerStorage, nil
+}
+
+// answerS3Config: cấu hình ANSWER_S3_*, trường bỏ trống lấy theo FILE_S3_* (trừ bucket)
+func answerS3Config() S3Config {
+	cfg := S3ConfigFromEnv("ANSWER_S3_")
+	def := S3ConfigFromEnv("FILE_S3_")
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = def.Endpoint
+	}
+	if cfg.Region == "" {
+		cfg.Region = def.Region
+	}
+	if cfg.AccessKey == "" {
+		cfg.AccessKey, cfg.SecretKey = def.AccessKey, def.SecretKey
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = def.Prefix
+	}
+	if os.Getenv("ANSWER_S3_PATH_STYLE") == "" {
+		cfg.PathStyle = def.PathStyle
+	}
+	return cfg
+}
+
+// SetAnswerStorage thay kho file người trả lời nộp
+func SetAnswerStorage(s Storage) {
+	fileStorageMu.Lock()
+	answerStorage = s
+	fileStorageMu.Unlock()
+}
+
+// supabaseStorage: Supabase Storage, một bucket
+type supabaseStorage struct {
+	client *storage.Client
+	bucket string
+}
+
+// NewSupabaseStorage tạo kho Supabase; bucket rỗng → "uploadfile_survey"
+func NewSupabaseStorage(baseURL, key, bucket string) Storage {
+	if bucket == "" {
+		bucket = "uploadfile_survey"
+	}
+	return &supabaseStorage{
+		client: storage.NewClient(strings.TrimRight(baseURL, "/")+"/storage/v1", key, nil),
+		bucket: bucket,
+	}
+}
+
+func (s *supabaseStorage) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	upsert := true
+	_, err := s.client.UploadFile(s.bucket, key, r, storage.FileOptions{ContentType: &contentType, Upsert: &upsert})
+	return err
+}
+
+func (s *supabaseStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	b, err := s.client.DownloadFile(s.bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (s *supabaseStorage) Delete(ctx context.Context, key string) error {
+	_, err := s.client.RemoveFile(s.bucket, []string{key})
+	return err
+}
+
+func (s *supabaseStorage) PublicURL(key string) string {
+	return s.client.GetPublicUrl(s.bucket, key).SignedURL
+}
+
+func (s *supabaseStorage) SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	res, err := s.client.CreateSignedUrl(s.bucket, key, int(ttl.Seconds()))
+	if err != nil {
+		return "", err
+	}
+	return res.SignedURL, nil
+}
+
+// StorageKey lấy key từ giá trị đã lưu trong CauTraLoi: key thuần giữ nguyên,
+// URL Supabase (/object/public|sign|authenticated/<bucket>/<key>) → <key>
+func StorageKey(ref string) string {
+	if !strings.Contains(ref, "://") {
+		return strings.TrimPrefix(ref, "/")
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	p := u.Path
+	for _, mode := range []string{"/object/public/", "/object/sign/", "/object/authenticated/", "/object/"} {
+		if i := strings.Index(p, mode); i >= 0 {
+			rest := p[i+len(mode):]
+			// bỏ tên bucket
+			if j := strings.Index(rest, "/"); j >= 0 {
+				return rest[j+1:]
+			}
+		}
+	}
+	return strings.TrimPrefix(p, "/")
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalStorage: lưu file trên đĩa dưới thư mục dir. URL tải là endpoint của server (baseURL)
+// kèm key, hạn và chữ ký HMAC; handler tải file gọi VerifySignedURL rồi đọc FilePath.
+type LocalStorage struct {
+	dir       string
+	baseURL   string
+	publicURL string // rỗng: không có URL công khai
+	secret    []byte
+}
+
+// ErrInvalidKey: key rỗng hoặc trỏ ra ngoài thư mục lưu
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// NewLocalStorage tạo kho trên đĩa; baseURL là URL đầy đủ của endpoint tải file
+func NewLocalStorage(dir, baseURL string, secret []byte) *LocalStorage {
+	return &LocalStorage{dir: dir, baseURL: baseURL, secret: secret}
+}
+
+// WithPublicURL bật URL công khai <publicURL>/<key> (handler đọc FilePath, không cần chữ ký)
+func (s *LocalStorage) WithPublicURL(publicURL string) *LocalStorage {
+	s.publicURL = publicURL
+	return s
+}
+
+// PublicURL: URL công khai của key, rỗng nếu kho không bật
+func (s *LocalStorage) PublicURL(key string) string {
+	if s.publicURL == "" {
+		return ""
+	}
+	return s.publicURL + "/" + (&url.URL{Path: strings.TrimPrefix(key, "/")}).EscapedPath()
+}
+
+// FilePath: đường dẫn trên đĩa của key
+func (s *LocalStorage) FilePath(key string) (string, error) {
+	clean := path.Clean("/" + key)[1:]
+	if clean == "" || clean != strings.TrimPrefix(key, "/") {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(clean)), nil
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	p, err := s.FilePath(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	// Ghi file tạm rồi đổi tên: không ai đọc được file ghi dở
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".put-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (s *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := s.FilePath(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	p, err := s.FilePath(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStorage) SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	if _, err := s.FilePath(key); err != nil {
+		return "", err
+	}
+	exp := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	q := url.Values{"key": {key}, "exp": {exp}, "sig": {s.sign(key, exp)}}
+	return fmt.Sprintf("%s?%s", s.baseURL, q.Encode()), nil
+}
+
+// VerifySignedURL kiểm tra chữ ký và hạn của URL do SignedURL tạo
+func (s *LocalStorage) VerifySignedURL(key, exp, sig string) bool {
+	n, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > n {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(s.sign(key, exp)))
+}
+
+func (s *LocalStorage) sign(key, exp string) string {
+	m := hmac.New(sha256.New, s.secret)
+	m.Write([]byte(key + "\n" + exp))
+	return hex.EncodeToString(m.Sum(nil))
+}
@@ -0,0 +1,279 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Config: kho tương thích S3 (AWS S3, MinIO, Cloudflare R2, ...)
+type S3Config struct {
+	Endpoint  string `json:"endpoint"` // vd. https://s3.ap-southeast-1.amazonaws.com, http://minio:9000
+	Region    string `json:"region"`
+	Bucket    string `json:"bucket"`
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+	Prefix    string `json:"prefix,omitempty"`     // tiền tố key, vd. "reports/"
+	PathStyle bool   `json:"path_style,omitempty"` // endpoint/bucket/key thay vì bucket.endpoint/key (MinIO)
+}
+
+// S3ConfigFromEnv đọc cấu hình S3 từ biến môi trường <prefix>ENDPOINT, REGION, BUCKET,
+// ACCESS_KEY, SECRET_KEY, KEY_PREFIX, PATH_STYLE (vd. prefix "FILE_S3_")
+func S3ConfigFromEnv(prefix string) S3Config {
+	pathStyle, _ := strconv.ParseBool(os.Getenv(prefix + "PATH_STYLE"))
+	return S3Config{
+		Endpoint:  os.Getenv(prefix + "ENDPOINT"),
+		Region:    os.Getenv(prefix + "REGION"),
+		Bucket:    os.Getenv(prefix + "BUCKET"),
+		AccessKey: os.Getenv(prefix + "ACCESS_KEY"),
+		SecretKey: os.Getenv(prefix + "SECRET_KEY"),
+		Prefix:    os.Getenv(prefix + "KEY_PREFIX"),
+		PathStyle: pathStyle,
+	}
+}
+
+// S3Storage: Storage qua REST API của S3, ký AWS Signature V4
+type S3Storage struct {
+	cfg       S3Config
+	endpoint  *url.URL
+	client    *http.Client
+	publicURL string
+}
+
+// NewS3Storage kiểm tra cấu hình và tạo kho S3
+func NewS3Storage(cfg S3Config) (*S3Storage, error) {
+	if cfg.Bucket == "" || cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, errors.New("s3: thiếu bucket, access_key hoặc secret_key")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	u, err := url.Parse(strings.TrimRight(cfg.Endpoint, "/"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("s3: endpoint không hợp lệ: %s", cfg.Endpoint)
+	}
+	return &S3Storage{cfg: cfg, endpoint: u, client: &http.Client{Timeout: 10 * time.Minute}}, nil
+}
+
+// objectURL: URL của key (chưa ký)
+func (s *S3Storage) objectURL(key string) *url.URL {
+	key = strings.TrimLeft(s.cfg.Prefix+key, "/")
+	u := *s.endpoint
+	if s.cfg.PathStyle {
+		u.Path = u.Path + "/" + s.cfg.Bucket + "/" + key
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+		u.Path = u.Path + "/" + key
+	}
+	return &u
+}
+
+// WithPublicURL đặt URL gốc công khai của bucket (CDN, domain riêng); mặc định URL object của endpoint
+func (s *S3Storage) WithPublicURL(base string) *S3Storage {
+	s.publicURL = strings.TrimRight(base, "/")
+	return s
+}
+
+// PublicURL: URL không ký của key, chỉ đọc được khi bucket cho phép đọc công khai
+func (s *S3Storage) PublicURL(key string) string {
+	if s.publicURL != "" {
+		return s.publicURL + "/" + (&url.URL{Path: strings.TrimLeft(s.cfg.Prefix+key, "/")}).EscapedPath()
+	}
+	return s.objectURL(key).String()
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	// S3 cần Content-Length: file thì lấy kích thước, reader khác thì đọc vào bộ nhớ
+	var size int64 = -1
+	if f, ok := r.(*os.File); ok {
+		if fi, err := f.Stat(); err == nil {
+			size = fi.Size()
+		}
+	}
+	if size < 0 {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		r, size = bytes.NewReader(b), int64(len(b))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key).String(), r)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	res, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+func (s *S3Storage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(key).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(key).String(), nil)
+	if err != nil {
+		return err
+	}
+	res, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// SignedURL: presigned GET (tối đa 7 ngày)
+func (s *S3Storage) SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	if ttl > 7*24*time.Hour {
+		ttl = 7 * 24 * time.Hour
+	}
+	return s.presign(http.MethodGet, s.objectURL(key), time.Now().UTC(), ttl), nil
+}
+
+// do ký request (payload không ký: UNSIGNED-PAYLOAD) và trả lỗi nếu status không phải 2xx
+func (s *S3Storage) do(req *http.Request) (*http.Response, error) {
+	now := time.Now().UTC()
+	req.Header.Set("x-amz-date", now.Format("20060102T150405Z"))
+	req.Header.Set("x-amz-content-sha256", "UNSIGNED-PAYLOAD")
+
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": "UNSIGNED-PAYLOAD",
+		"x-amz-date":           now.Format("20060102T150405Z"),
+	}
+	if ct := req.Header.Get("Content-Type"); ct != "" {
+		signed = append(signed, "content-type")
+		headers["content-type"] = ct
+		sort.Strings(signed)
+	}
+	scope, sig := s.sign(req.Method, req.URL, "", signed, headers, "UNSIGNED-PAYLOAD", now)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKey, scope, strings.Join(signed, ";"), sig))
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode/100 != 2 {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		res.Body.Close()
+		return nil, fmt.Errorf("s3: %s %s: %d %s", req.Method, req.URL.Path, res.StatusCode, strings.TrimSpace(string(b)))
+	}
+	return res, nil
+}
+
+func (s *S3Storage) presign(method string, u *url.URL, now time.Time, ttl time.Duration) string {
+	date := now.Format("20060102")
+	q := url.Values{}
+	q.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	q.Set("X-Amz-Credential", s.cfg.AccessKey+"/"+date+"/"+s.cfg.Region+"/s3/aws4_request")
+	q.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	q.Set("X-Amz-Expires", strconv.Itoa(int(ttl.Seconds())))
+	q.Set("X-Amz-SignedHeaders", "host")
+	query := s3CanonicalQuery(q)
+	_, sig := s.sign(method, u, query, []string{"host"}, map[string]string{"host": u.Host}, "UNSIGNED-PAYLOAD", now)
+	out := *u
+	out.RawQuery = query + "&X-Amz-Signature=" + sig
+	return out.String()
+}
+
+// sign trả (scope, chữ ký) theo AWS Signature V4
+func (s *S3Storage) sign(method string, u *url.URL, query string, signed []string, headers map[string]string,
+	payloadHash string, now time.Time) (string, string) {
+	date := now.Format("20060102")
+	var ch strings.Builder
+	for _, h := range signed {
+		ch.WriteString(h + ":" + strings.TrimSpace(headers[h]) + "\n")
+	}
+	canonical := strings.Join([]string{
+		method, s3EscapePath(u.Path), query, ch.String(), strings.Join(signed, ";"), payloadHash,
+	}, "\n")
+	scope := date + "/" + s.cfg.Region + "/s3/aws4_request"
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	k := s3HMAC([]byte("AWS4"+s.cfg.SecretKey), date)
+	k = s3HMAC(k, s.cfg.Region)
+	k = s3HMAC(k, "s3")
+	k = s3HMAC(k, "aws4_request")
+	return scope, hex.EncodeToString(s3HMAC(k, toSign))
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+// s3Escape: URI-encode theo RFC 3986 (chỉ giữ A-Z a-z 0-9 - _ . ~)
+func s3Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3EscapePath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		parts[i] = s3Escape(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+func s3CanonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, s3Escape(k)+"="+s3Escape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
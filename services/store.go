@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Store: bộ đếm & cache có TTL dùng chung (rate limit, chống trùng...).
+// Chạy nhiều instance thì cần backend dùng chung (Redis) để giới hạn nhất quán.
+type Store interface {
+	// Incr tăng bộ đếm key; lần tăng đầu tiên đặt hạn window.
+	// Trả giá trị sau khi tăng và thời điểm key hết hạn (cửa sổ cố định).
+	Incr(ctx context.Context, key string, window time.Duration) (int64, time.Time, error)
+	// Get trả giá trị và ok = false nếu key không tồn tại/đã hết hạn
+	Get(ctx context.Context, key string) (string, bool, error)
+	// Set ghi đè giá trị với TTL (ttl <= 0: không hết hạn)
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	// SetNX chỉ ghi khi key chưa tồn tại, trả true nếu đã ghi
+	SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error)
+	Del(ctx context.Context, keys ...string) error
+}
+
+var (
+	storeMu     sync.RWMutex
+	sharedStore Store
+)
+
+// InitStore chọn backend theo REDIS_URL (vd. redis://:pass@host:6379/0); không cấu hình → bộ nhớ trong
+func InitStore() {
+	url := os.Getenv("REDIS_URL")
+	if url == "" {
+		SetStore(NewMemoryStore())
+		log.Println("Store: in-memory (REDIS_URL not set)")
+		return
+	}
+	s, err := NewRedisStore(url, os.Getenv("REDIS_PREFIX"))
+	if err != nil {
+		log.Fatalf("Failed to connect Redis: %v", err)
+	}
+	SetStore(s)
+	log.Println("Store: redis")
+}
+
+// SetStore thay backend dùng chung
+func SetStore(s Store) {
+	storeMu.Lock()
+	sharedStore = s
+	storeMu.Unlock()
+}
+
+// SharedStore trả backend hiện tại (chưa InitStore → tạo store bộ nhớ)
+func SharedStore() Store {
+	storeMu.RLock()
+	s := sharedStore
+	storeMu.RUnlock()
+	if s != nil {
+		return s
+	}
+
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	if sharedStore == nil {
+		sharedStore = NewMemoryStore()
+	}
+	return sharedStore
+}
+
+// ====== Triển khai trong bộ nhớ (một instance) ======
+
+type memoryEntry struct {
+	value     string
+	count     int64
+	expiresAt time.Time // zero = không hết hạn
+}
+
+func (e *memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// MemoryStore giữ dữ liệu trong map của tiến trình
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+}
+
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{entries: make(map[string]*memoryEntry)}
+	// chạy nền dọn key hết hạn
+	go s.cleanup()
+	return s
+}
+
+// get trả entry còn hạn (gọi khi đã giữ mu)
+func (s *MemoryStore) get(key string, now time.Time) *memoryEntry {
+	e, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	if e.expired(now) {
+		delete(s.entries, key)
+		return nil
+	}
+	return e
+}
+
+func (s *MemoryStore) Incr(_ context.Context, key string, window time.Duration) (int64, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	e := s.get(key, now)
+	if e == nil {
+		e = &memoryEntry{expiresAt: now.Add(window)}
+		s.entries[key] = e
+	}
+	e.count++
+	return e.count, e.expiresAt, nil
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e := s.get(key, time.Now()); e != nil {
+		return e.value, true, nil
+	}
+	return "", false, nil
+}
+
+func (s *MemoryStore) Set(_ context.Context, key, value string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key] = newMemoryEntry(value, ttl)
+	return nil
+}
+
+func (s *MemoryStore) SetNX(_ context.Context, key, value string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.get(key, time.Now()) != nil {
+		return false, nil
+	}
+	s.entries[key] = newMemoryEntry(value, ttl)
+	return true, nil
+}
+
+func (s *MemoryStore) Del(_ context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range keys {
+		delete(s.entries, k)
+	}
+	return nil
+}
+
+func newMemoryEntry(value string, ttl time.Duration) *memoryEntry {
+	e := &memoryEntry{value: value}
+	if ttl > 0 {
+		e.expiresAt = time.Now().Add(ttl)
+	}
+	return e
+}
+
+func (s *MemoryStore) cleanup() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		s.mu.Lock()
+		for k, e := range s.entries {
+			if e.expired(now) {
+				delete(s.entries, k)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// incrScript: INCR + đặt hạn ở lần đầu trong một bước (nguyên tử), trả {giá trị, PTTL}.
+// Nếu key mất TTL (vd. bị ghi đè) thì đặt lại để bộ đếm không tồn tại mãi.
+var incrScript = redis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+local ttl = redis.call('PTTL', KEYS[1])
+if n == 1 or ttl < 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+	ttl = tonumber(ARGV[1])
+end
+return {n, ttl}
+`)
+
+// RedisStore dùng chung qua Redis (hoặc server tương thích giao thức Redis)
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore kết nối theo URL và kiểm tra bằng PING; prefix được thêm trước mọi key
+func NewRedisStore(url, prefix string) (*RedisStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	if prefix == "" {
+		prefix = "survey:"
+	}
+	s := &RedisStore{client: redis.NewClient(opts), prefix: prefix}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.client.Ping(ctx).Err(); err != nil {
+		s.client.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *RedisStore) Incr(ctx context.Context, key string, window time.Duration) (int64, time.Time, error) {
+	res, err := incrScript.Run(ctx, s.client, []string{s.prefix + key}, window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if len(res) != 2 {
+		return 0, time.Time{}, fmt.Errorf("redis incr: unexpected reply %v", res)
+	}
+	return res[0], time.Now().Add(time.Duration(res[1]) * time.Millisecond), nil
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) (string, bool, error) {
+	v, err := s.client.Get(ctx, s.prefix+key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return v, true, nil
+}
+
+func (s *RedisStore) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	if ttl < 0 {
+		ttl = 0
+	}
+	return s.client.Set(ctx, s.prefix+key, value, ttl).Err()
+}
+
+func (s *RedisStore) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	if ttl < 0 {
+		ttl = 0
+	}
+	return s.client.SetNX(ctx, s.prefix+key, value, ttl).Result()
+}
+
+func (s *RedisStore) Del(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	full := make([]string, len(keys))
+	for i, k := range keys {
+		full[i] = s.prefix + k
+	}
+	return s.client.Del(ctx, full...).Err()
+}
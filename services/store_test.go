@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// storeBackend: một Store cần kiểm tra và cách "tua" thời gian để key hết hạn
+type storeBackend struct {
+	name    string
+	store   Store
+	advance func(time.Duration)
+}
+
+func storeBackends(t *testing.T) []storeBackend {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return []storeBackend{
+		{name: "memory", store: NewMemoryStore(), advance: time.Sleep},
+		{
+			name:  "redis",
+			store: &RedisStore{client: client, prefix: "test:"},
+			// miniredis không tự hết hạn theo đồng hồ thật; cả Lua (PTTL) lẫn TTL đều theo FastForward
+			advance: mr.FastForward,
+		},
+	}
+}
+
+func TestStoreIncr(t *testing.T) {
+	ctx := context.Background()
+	for _, b := range storeBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			start := time.Now()
+			for want := int64(1); want <= 3; want++ {
+				n, reset, err := b.store.Incr(ctx, "ctr", time.Minute)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n != want {
+					t.Fatalf("Incr = %d, muốn %d", n, want)
+				}
+				// cửa sổ cố định: hạn đặt ở lần tăng đầu, không bị kéo dài
+				if reset.Before(start.Add(time.Minute-time.Second)) || reset.After(time.Now().Add(time.Minute+time.Second)) {
+					t.Fatalf("reset = %v ngoài cửa sổ 1 phút", reset)
+				}
+			}
+			if n, _, _ := b.store.Incr(ctx, "other", time.Minute); n != 1 {
+				t.Fatalf("key khác dùng chung bộ đếm: %d", n)
+			}
+		})
+	}
+}
+
+func TestStoreIncrWindowExpiry(t *testing.T) {
+	ctx := context.Background()
+	for _, b := range storeBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			window := 50 * time.Millisecond
+			b.store.Incr(ctx, "win", window)
+			b.store.Incr(ctx, "win", window)
+			b.advance(2 * window)
+			n, _, err := b.store.Incr(ctx, "win", window)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 1 {
+				t.Fatalf("bộ đếm không reset sau khi hết cửa sổ: %d", n)
+			}
+		})
+	}
+}
+
+func TestStoreIncrAtomic(t *testing.T) {
+	ctx := context.Background()
+	const workers, perWorker = 16, 25
+	for _, b := range storeBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			var (
+				wg   sync.WaitGroup
+				mu   sync.Mutex
+				seen = make(map[int64]bool, workers*perWorker)
+			)
+			for i := 0; i < workers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < perWorker; j++ {
+						n, _, err := b.store.Incr(ctx, "atomic", time.Minute)
+						if err != nil {
+							t.Error(err)
+							return
+						}
+						mu.Lock()
+						if seen[n] {
+							t.Errorf("giá trị %d bị trả về hai lần", n)
+						}
+						seen[n] = true
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+			// mọi giá trị 1..N xuất hiện đúng một lần → không mất lần tăng nào
+			for n := int64(1); n <= workers*perWorker; n++ {
+				if !seen[n] {
+					t.Fatalf("thiếu giá trị %d", n)
+				}
+			}
+		})
+	}
+}
+
+func TestStoreGetSetExpiry(t *testing.T) {
+	ctx := context.Background()
+	for _, b := range storeBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			if _, ok, err := b.store.Get(ctx, "missing"); err != nil || ok {
+				t.Fatalf("Get key chưa có: ok=%v err=%v", ok, err)
+			}
+
+			if err := b.store.Set(ctx, "k", "v1", 50*time.Millisecond); err != nil {
+				t.Fatal(err)
+			}
+			if err := b.store.Set(ctx, "forever", "x", 0); err != nil {
+				t.Fatal(err)
+			}
+			if v, ok, _ := b.store.Get(ctx, "k"); !ok || v != "v1" {
+				t.Fatalf("Get = %q,%v", v, ok)
+			}
+			b.advance(100 * time.Millisecond)
+			if _, ok, _ := b.store.Get(ctx, "k"); ok {
+				t.Fatal("key còn sau khi hết TTL")
+			}
+			if v, ok, _ := b.store.Get(ctx, "forever"); !ok || v != "x" {
+				t.Fatal("key ttl=0 bị hết hạn")
+			}
+
+			if err := b.store.Del(ctx, "forever", "missing"); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok, _ := b.store.Get(ctx, "forever"); ok {
+				t.Fatal("Del không xoá key")
+			}
+		})
+	}
+}
+
+func TestStoreSetNX(t *testing.T) {
+	ctx := context.Background()
+	for _, b := range storeBackends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			ok, err := b.store.SetNX(ctx, "once", "a", 50*time.Millisecond)
+			if err != nil || !ok {
+				t.Fatalf("SetNX lần đầu: ok=%v err=%v", ok, err)
+			}
+			if ok, _ := b.store.SetNX(ctx, "once", "b", time.Minute); ok {
+				t.Fatal("SetNX ghi đè key còn hạn")
+			}
+			if v, _, _ := b.store.Get(ctx, "once"); v != "a" {
+				t.Fatalf("giá trị bị đổi: %q", v)
+			}
+			b.advance(100 * time.Millisecond)
+			if ok, _ := b.store.SetNX(ctx, "once", "c", time.Minute); !ok {
+				t.Fatal("SetNX không ghi được sau khi key hết hạn")
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vnkhanh/survey-server/config"
+	"github.com/vnkhanh/survey-server/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ThrottlePolicy: sau MaxFailures lần thử chưa đúng (cách nhau không quá Window) thì khoá
+// BaseLockout, lần khoá kế tiếp gấp đôi, tối đa MaxLockout
+type ThrottlePolicy struct {
+	Scope       string
+	MaxFailures int
+	Window      time.Duration
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+	AuditAction string // hành động ghi nhật ký khi bị khoá
+}
+
+// ThrottleKey: một key cụ thể thuộc một chính sách
+type ThrottleKey struct {
+	Policy ThrottlePolicy
+	Key    string
+}
+
+// ThrottleLock: kết quả khi một key vừa bị khoá
+type ThrottleLock struct {
+	ThrottleKey
+	Lockouts    int
+	LockedUntil time.Time
+}
+
+// Sau khoảng này không có lần thử nào thì bậc khoá luỹ thừa được tính lại từ đầu
+const throttleLockoutDecay = 24 * time.Hour
+
+// ThrottlePolicyFor trả chính sách của một phạm vi, có thể chỉnh qua env:
+// LOCKOUT_<SCOPE>_MAX_FAILURES, LOCKOUT_WINDOW, LOCKOUT_BASE, LOCKOUT_MAX (duration Go, vd. 30s, 15m)
+func ThrottlePolicyFor(scope string) ThrottlePolicy {
+	p := ThrottlePolicy{
+		Scope:       scope,
+		MaxFailures: 5,
+		Window:      envDuration("LOCKOUT_WINDOW", 15*time.Minute),
+		BaseLockout: envDuration("LOCKOUT_BASE", time.Minute),
+		MaxLockout:  envDuration("LOCKOUT_MAX", time.Hour),
+		AuditAction: "auth.lockout",
+	}
+	switch scope {
+	case models.ThrottleLoginIP:
+		// Một IP có thể có nhiều người dùng chung (NAT) → ngưỡng cao hơn
+		p.MaxFailures = 20
+	case models.ThrottleLoginAccount:
+		// Chỉ theo email: ai cũng gửi được nên chỉ là giới hạn mềm (ngưỡng cao), khoá chặt theo email+IP
+		// (ThrottleLoginAccountIP) để kẻ dò từ nơi khác không khoá được chủ tài khoản
+		p.MaxFailures = 50
+	case models.ThrottleTwoFactor:
+		p.AuditAction = "auth.2fa.lockout"
+	case models.ThrottleRoomUser, models.ThrottleRoomIP:
+		p.AuditAction = "room.password.lockout"
+		if scope == models.ThrottleRoomIP {
+			p.MaxFailures = 20
+		}
+	}
+	if v, err := strconv.Atoi(os.Getenv("LOCKOUT_" + strings.ToUpper(scope) + "_MAX_FAILURES")); err == nil && v > 0 {
+		p.MaxFailures = v
+	}
+	return p
+}
+
+// NewThrottleKey tạo key với chính sách mặc định của phạm vi
+func NewThrottleKey(scope, key string) ThrottleKey {
+	return ThrottleKey{Policy: ThrottlePolicyFor(scope), Key: key}
+}
+
+// ThrottleAttempt tính trước một lần thử cho mọi key rồi quyết định từ chính kết quả đó, trong một transaction
+// khoá các dòng (request song song đếm tuần tự, không có khoảng hở giữa lúc kiểm tra và lúc tăng):
+// key đang bị khoá → từ chối, không tính lượt; key đã dùng hết MaxFailures lượt trong Window → khoá và từ chối.
+// wait > 0 = bị từ chối; locks là các key vừa bị khoá bởi lần thử này.
+// Lần thử đúng gọi ThrottleReset (xoá bộ đếm) hoặc ThrottleRefund (trả lại lượt) cho từng key.
+func ThrottleAttempt(keys ...ThrottleKey) (wait time.Duration, locks []ThrottleLock, err error) {
+	// khoá dòng theo thứ tự cố định để hai request cùng tập key không deadlock
+	ordered := append([]ThrottleKey(nil), keys...)
+	sort.Slice(ordered, func(i, j int) bool {
+		if ordered[i].Policy.Scope != ordered[j].Policy.Scope {
+			return ordered[i].Policy.Scope < ordered[j].Policy.Scope
+		}
+		return ordered[i].Key < ordered[j].Key
+	})
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		wait, locks = 0, nil
+		rows := make([]models.AuthThrottle, len(ordered))
+		now := time.Now()
+		for i, k := range ordered {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&models.AuthThrottle{Scope: k.Policy.Scope, Key: k.Key}).Error; err != nil {
+				return err
+			}
+			t := &rows[i]
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("scope = ? AND key = ?", k.Policy.Scope, k.Key).First(t).Error; err != nil {
+				return err
+			}
+			if t.LockedUntil != nil && t.LockedUntil.After(now) {
+				if d := t.LockedUntil.Sub(now); d > wait {
+					wait = d
+				}
+			}
+		}
+		if wait > 0 {
+			return nil
+		}
+
+		for i, k := range ordered {
+			t := &rows[i]
+			if !t.LastFailureAt.IsZero() {
+				idle := now.Sub(t.LastFailureAt)
+				if idle > throttleLockoutDecay {
+					t.Lockouts = 0
+				}
+				if idle > k.Policy.Window {
+					t.Failures = 0
+				}
+			}
+			if t.Failures >= k.Policy.MaxFailures {
+				t.Lockouts++
+				until := now.Add(lockoutDuration(k.Policy, t.Lockouts))
+				t.LockedUntil = &until
+				t.Failures = 0
+				locks = append(locks, ThrottleLock{ThrottleKey: k, Lockouts: t.Lockouts, LockedUntil: until})
+				if d := until.Sub(now); d > wait {
+					wait = d
+				}
+			} else {
+				t.Failures++
+			}
+			t.LastFailureAt = now
+			if err := tx.Save(t).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return wait, locks, err
+}
+
+// lockoutDuration = BaseLockout * 2^(n-1), tối đa MaxLockout
+func lockoutDuration(p ThrottlePolicy, n int) time.Duration {
+	d := p.BaseLockout
+	for i := 1; i < n && d < p.MaxLockout; i++ {
+		d *= 2
+	}
+	if d > p.MaxLockout {
+		d = p.MaxLockout
+	}
+	return d
+}
+
+// ThrottleRefund trả lại lượt ThrottleAttempt đã tính của một lần thử đúng, cho key không xoá bộ đếm
+// (vd. key theo IP: người khác dùng chung IP vẫn bị đếm tiếp)
+func ThrottleRefund(keys ...ThrottleKey) error {
+	for _, k := range keys {
+		if err := config.DB.Model(&models.AuthThrottle{}).
+			Where("scope = ? AND key = ? AND failures > 0", k.Policy.Scope, k.Key).
+			UpdateColumn("failures", gorm.Expr("failures - 1")).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ThrottleReset xoá bộ đếm (vd. sau khi đăng nhập thành công)
+func ThrottleReset(keys ...ThrottleKey) error {
+	for _, k := range keys {
+		if err := config.DB.Where("scope = ? AND key = ?", k.Policy.Scope, k.Key).
+			Delete(&models.AuthThrottle{}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func envDuration(name string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(name)); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"mime/multipart"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/vnkhanh/survey-server/config"
+	"github.com/vnkhanh/survey-server/models"
+)
+
+// PrivateUploadFolder: thư mục của file người trả lời nộp; chỉ tải qua link ký sau khi kiểm tra quyền
+const PrivateUploadFolder = "answers"
+
+// UploadKey: key của file tải lên, <folder>/<fileID><đuôi file gốc>
+func UploadKey(folder, fileID, filename string) string {
+	return path.Join(folder, fileID+strings.ToLower(filepath.Ext(filename)))
+}
+
+// IsPrivateUploadKey: key thuộc thư mục riêng tư (không phục vụ qua URL công khai)
+func IsPrivateUploadKey(key string) bool {
+	return strings.HasPrefix(path.Clean("/"+key), "/"+PrivateUploadFolder+"/")
+}
+
+// SaveUpload lưu file multipart (file công khai của form) vào FileStorage dưới key
+func SaveUpload(ctx context.Context, fh *multipart.FileHeader, key string) error {
+	st, err := FileStorage()
+	if err != nil {
+		return err
+	}
+	return putUpload(ctx, st, fh, key)
+}
+
+// SaveAnswerUpload lưu file người trả lời nộp vào AnswerStorage dưới key
+func SaveAnswerUpload(ctx context.Context, fh *multipart.FileHeader, key string) error {
+	st, err := AnswerStorage()
+	if err != nil {
+		return err
+	}
+	return putUpload(ctx, st, fh, key)
+}
+
+func putUpload(ctx context.Context, st Storage, fh *multipart.FileHeader, key string) error {
+	f, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return st.Put(ctx, key, f, fh.Header.Get("Content-Type"))
+}
+
+// FileURL: URL công khai của key trong kho
+func FileURL(st Storage, key string) (string, error) {
+	if p, ok := st.(PublicStorage); ok {
+		if u := p.PublicURL(key); u != "" {
+			return u, nil
+		}
+	}
+	return "", errors.New("kho lưu file không có URL công khai")
+}
+
+// FileLinkTTL: hạn của link tải file người trả lời nộp (FILE_LINK_TTL, mặc định 5m)
+func FileLinkTTL() time.Duration {
+	return envDuration("FILE_LINK_TTL", 5*time.Minute)
+}
+
+// UploadRefForClient: giá trị câu trả lời upload trả qua API. Key trong kho không được lộ (phần ngẫu nhiên
+// của key là thứ bảo vệ file) → chỉ còn "file<đuôi>", tải qua file_url; URL ngoài giữ nguyên
+func UploadRefForClient(ref string) string {
+	if ref == "" || IsExternalRef(ref) {
+		return ref
+	}
+	return "file" + strings.ToLower(path.Ext(StorageKey(ref)))
+}
+
+// IsExternalRef: giá trị câu trả lời upload là URL ngoài (phản hồi nhập từ hệ thống khác),
+// không phải key trong kho file của hệ thống
+func IsExternalRef(ref string) bool {
+	return strings.Contains(ref, "://")
+}
+
+// UploadDownloadURL: URL tải của giá trị câu trả lời upload. Key → link ký hạn FileLinkTTL;
+// URL ngoài giữ nguyên.
+func UploadDownloadURL(ctx context.Context, ref string) (string, error) {
+	if IsExternalRef(ref) {
+		return ref, nil
+	}
+	st, err := AnswerStorage()
+	if err != nil {
+		return "", err
+	}
+	return st.SignedURL(ctx, StorageKey(ref), FileLinkTTL())
+}
+
+// DeleteAnswerUploads xoá khỏi AnswerStorage file của các câu trả lời upload đã xoá (gọi sau khi commit).
+// Key còn câu trả lời khác trỏ tới hoặc URL ngoài thì giữ; lỗi chỉ ghi log
+func DeleteAnswerUploads(ctx context.Context, refs []string) {
+	st, err := AnswerStorage()
+	if err != nil {
+		if len(refs) > 0 && !errors.Is(err, ErrStorageNotConfigured) {
+			log.Printf("[upload] delete answer files: %v", err)
+		}
+		return
+	}
+	for _, ref := range refs {
+		if ref == "" || IsExternalRef(ref) || !IsPrivateUploadKey(StorageKey(ref)) {
+			continue
+		}
+		var left int64
+		if err := config.DB.Model(&models.CauTraLoi{}).Where("noi_dung = ?", ref).Count(&left).Error; err != nil || left > 0 {
+			continue
+		}
+		if err := st.Delete(ctx, StorageKey(ref)); err != nil {
+			log.Printf("[upload] delete answer file %s: %v", ref, err)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vnkhanh/survey-server/config"
+	"github.com/vnkhanh/survey-server/models"
+	"gorm.io/gorm"
+)
+
+// Tên mốc của lần chuyển file người trả lời nộp (dữ liệu cũ) từ kho công khai sang AnswerStorage
+const uploadKeysMigration = "upload_answers_storage_v2"
+
+// Khoá advisory (pg_advisory_xact_lock) của các lần chuyển dữ liệu: (namespace, hashtext(tên mốc))
+const dataMigrationLockNamespace = 50
+
+// Dạng URL cũ của file người trả lời nộp; nhóm 1 là key trong kho (bỏ query của link ký):
+// URL public/sign của Supabase và URL công khai /api/files của kho local
+var legacyUploadURLs = []*regexp.Regexp{
+	regexp.MustCompile(`^https?://[^/]+/storage/v1/object/(?:public/|sign/|authenticated/)?[^/]+/([^?#]+)`),
+	regexp.MustCompile(`^https?://[^/]+/api/files/([^?#]+)`),
+}
+
+// legacyUploadKey: key trong kho của giá trị câu trả lời upload cũ; ok=false → URL ngoài, bỏ qua
+func legacyUploadKey(ref string) (string, bool) {
+	if !IsExternalRef(ref) {
+		return strings.TrimPrefix(ref, "/"), true
+	}
+	for _, re := range legacyUploadURLs {
+		if m := re.FindStringSubmatch(ref); m != nil {
+			return m[1], true
+		}
+	}
+	return "", false
+}
+
+// MigrateLegacyUploads chuyển file người trả lời nộp còn nằm trong kho công khai (FileStorage) sang
+// AnswerStorage dưới PrivateUploadFolder, cập nhật key trong cau_tra_loi rồi xoá bản cũ.
+// Chỉ một replica chạy (advisory lock, replica khác chờ rồi thấy mốc); chỉ ghi mốc vào data_migrations
+// khi mọi file đều chuyển được, còn lỗi thì lần khởi động sau chạy lại phần còn thiếu.
+func MigrateLegacyUploads(ctx context.Context) error {
+	return config.DB.Transaction(func(lock *gorm.DB) error {
+		if err := lock.Exec("SELECT pg_advisory_xact_lock(?, hashtext(?))", dataMigrationLockNamespace, uploadKeysMigration).Error; err != nil {
+			return err
+		}
+		var done int64
+		if err := lock.Model(&models.DataMigration{}).Where("name = ?", uploadKeysMigration).Count(&done).Error; err != nil {
+			return err
+		}
+		if done > 0 {
+			return nil
+		}
+		return migrateLegacyUploads(ctx)
+	})
+}
+
+func migrateLegacyUploads(ctx context.Context) error {
+	src, err := FileStorage()
+	if errors.Is(err, ErrStorageNotConfigured) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	dst, err := AnswerStorage()
+	if err != nil {
+		return err
+	}
+	sameStorage := src == dst
+
+	// Phản hồi gửi sau thời điểm này đã lưu thẳng vào AnswerStorage
+	var maxID uint
+	if err := config.DB.Model(&models.CauTraLoi{}).Select("COALESCE(MAX(id), 0)").Scan(&maxID).Error; err != nil {
+		return err
+	}
+
+	type row struct {
+		ID        uint
+		PhanHoiID uint
+		CauHoiID  uint
+		NoiDung   string
+	}
+	var (
+		lastID              uint
+		moved, failed, skip int
+		movedKeys           = map[string]string{} // key cũ → key mới (nhiều câu trả lời trỏ cùng file)
+	)
+	for {
+		var rows []row
+		if err := config.DB.Table("cau_tra_loi AS ctl").
+			Select("ctl.id, ctl.phan_hoi_id, ctl.cau_hoi_id, ctl.noi_dung").
+			Joins("JOIN cau_hoi ch ON ch.id = ctl.cau_hoi_id").
+			Where("UPPER(ch.loai_cau_hoi) IN ?", []string{"UPLOAD_FILE", "FILE_UPLOAD"}).
+			Where("ctl.noi_dung <> '' AND ctl.id > ? AND ctl.id <= ?", lastID, maxID).
+			Order("ctl.id").Limit(500).Scan(&rows).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			break
+		}
+		lastID = rows[len(rows)-1].ID
+
+		for _, r := range rows {
+			oldKey, ok := legacyUploadKey(r.NoiDung)
+			if !ok {
+				skip++
+				continue
+			}
+			private := IsPrivateUploadKey(oldKey)
+			if private && sameStorage {
+				// kho local: key answers/ đã không phục vụ công khai
+				continue
+			}
+			newKey, cached := movedKeys[oldKey]
+			if !cached {
+				newKey = path.Clean(oldKey)
+				if !private {
+					newKey = UploadKey(PrivateUploadFolder, fmt.Sprintf("%d_%d_%s", r.PhanHoiID, r.CauHoiID, uuid.NewString()), oldKey)
+				}
+				if err := moveUpload(ctx, src, dst, oldKey, newKey, private && !sameStorage); err != nil {
+					log.Printf("[migrate] upload answer %d (%s): %v", r.ID, oldKey, err)
+					failed++
+					continue
+				}
+				movedKeys[oldKey] = newKey
+			}
+			if newKey == r.NoiDung {
+				moved++
+				continue
+			}
+			// chỉ đổi khi giá trị chưa bị sửa trong lúc chuyển
+			res := config.DB.Model(&models.CauTraLoi{}).Where("id = ? AND noi_dung = ?", r.ID, r.NoiDung).
+				Update("noi_dung", newKey)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected > 0 {
+				moved++
+			}
+		}
+	}
+
+	// bản cũ chỉ xoá khỏi kho công khai sau khi mọi câu trả lời đã trỏ sang bản mới
+	for oldKey, newKey := range movedKeys {
+		if sameStorage && oldKey == newKey {
+			continue
+		}
+		if oldKey != newKey {
+			var left int64
+			config.DB.Model(&models.CauTraLoi{}).Where("noi_dung = ? OR noi_dung LIKE ?", oldKey, "%/"+oldKey+"%").Count(&left)
+			if left > 0 {
+				continue
+			}
+		}
+		if err := src.Delete(ctx, oldKey); err != nil {
+			log.Printf("[migrate] delete legacy upload %s: %v", oldKey, err)
+		}
+	}
+
+	note := fmt.Sprintf("moved=%d failed=%d external=%d", moved, failed, skip)
+	if moved > 0 || failed > 0 {
+		log.Printf("[migrate] legacy upload answers → answer storage: %s", note)
+	}
+	if failed > 0 {
+		return fmt.Errorf("còn %d file chưa chuyển được, sẽ thử lại lần khởi động sau", failed)
+	}
+	return config.DB.Create(&models.DataMigration{Name: uploadKeysMigration, DoneAt: time.Now(), Note: note}).Error
+}
+
+// moveUpload chép object oldKey (kho src) sang newKey (kho dst). skipIfPresent: key giữ nguyên khi đổi kho,
+// object đã có ở dst (lần chạy trước bị ngắt sau khi chép) thì không chép lại
+func moveUpload(ctx context.Context, src, dst Storage, oldKey, newKey string, skipIfPresent bool) error {
+	if skipIfPresent {
+		if rc, err := dst.Get(ctx, newKey); err == nil {
+			rc.Close()
+			return nil
+		}
+	}
+	rc, err := src.Get(ctx, oldKey)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return dst.Put(ctx, newKey, rc, mime.TypeByExtension(path.Ext(newKey)))
+}
@@ -0,0 +1,333 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vnkhanh/survey-server/config"
+	"github.com/vnkhanh/survey-server/models"
+	"github.com/vnkhanh/survey-server/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Các sự kiện có thể đăng ký webhook
+var WebhookEvents = []string{EventSubmissionCreated, EventFormPublished, EventFormClosed, EventExportDone, EventExportScheduleFailed}
+
+const (
+	webhookMaxAttempts = 8
+	webhookBaseBackoff = 30 * time.Second
+	webhookMaxBackoff  = 6 * time.Hour
+	webhookLease       = 2 * time.Minute // giữ delivery khi đang gửi; instance chết thì delivery tự được nhận lại
+	webhookBatch       = 20
+	webhookPoll        = 5 * time.Second
+	webhookTimeout     = 10 * time.Second
+)
+
+// webhookClient chặn kết nối vào mạng nội bộ (URL do người dùng nhập)
+var webhookClient = NewOutboundHTTPClient(webhookTimeout)
+
+// WebhookPayload: nội dung JSON gửi tới URL đăng ký
+type WebhookPayload struct {
+	ID        string      `json:"id"` // id sự kiện
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	FormID    uint        `json:"form_id"`
+	Data      interface{} `json:"data"`
+}
+
+// GenerateWebhookSecret sinh khoá ký cho subscription
+func GenerateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// SealStoredWebhookSecrets mã hoá secret của subscription còn lưu dạng rõ (dữ liệu cũ)
+func SealStoredWebhookSecrets() error {
+	var rows []models.WebhookSubscription
+	if err := config.DB.Select("id", "secret").Where("secret NOT LIKE ?", "enc:%").Find(&rows).Error; err != nil {
+		return err
+	}
+	n := 0
+	for _, r := range rows {
+		if r.Secret == "" || utils.IsSealedSecret(r.Secret) {
+			continue
+		}
+		sealed, err := utils.SealSecret(r.Secret)
+		if err != nil {
+			return err
+		}
+		// chỉ ghi khi secret chưa bị đổi (rotate) trong lúc chạy
+		if err := config.DB.Model(&models.WebhookSubscription{}).Where("id = ? AND secret = ?", r.ID, r.Secret).
+			Update("secret", sealed).Error; err != nil {
+			return err
+		}
+		n++
+	}
+	if n > 0 {
+		log.Printf("[webhook] sealed secrets of %d subscriptions", n)
+	}
+	return nil
+}
+
+// SignWebhook = hex(HMAC-SHA256(secret, timestamp + "." + body))
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	m.Write([]byte("."))
+	m.Write(body)
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// IsWebhookEvent kiểm tra tên sự kiện hợp lệ
+func IsWebhookEvent(e string) bool {
+	for _, v := range WebhookEvents {
+		if v == e {
+			return true
+		}
+	}
+	return false
+}
+
+func subscribedTo(sub models.WebhookSubscription, event string) bool {
+	for _, e := range strings.Split(sub.Events, ",") {
+		if e = strings.TrimSpace(e); e == "*" || e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// EnqueueWebhooks tạo delivery cho mọi subscription đang bật khớp sự kiện:
+// subscription của riêng form và subscription toàn bộ form của chủ form.
+// Sự kiện đã được xếp hàng trước đó (outbox giao lại) thì bỏ qua.
+func EnqueueWebhooks(db *gorm.DB, e Event) error {
+	var n int64
+	if err := db.Model(&models.WebhookDelivery{}).
+		Where("event_id = ? AND redelivery_of IS NULL", e.ID).Count(&n).Error; err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+
+	formID := e.FormID
+	var form models.KhaoSat
+	if err := db.Select("id", "nguoi_tao_id").First(&form, formID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil // form đã bị xoá hẳn: không còn ai để báo
+		}
+		return err
+	}
+	q := db.Where("active = ?", true)
+	if form.NguoiTaoID != nil {
+		q = q.Where("khao_sat_id = ? OR (khao_sat_id IS NULL AND nguoi_dung_id = ?)", formID, *form.NguoiTaoID)
+	} else {
+		q = q.Where("khao_sat_id = ?", formID)
+	}
+	var subs []models.WebhookSubscription
+	if err := q.Find(&subs).Error; err != nil {
+		return err
+	}
+
+	payload := WebhookPayload{
+		ID:        e.ID,
+		Type:      e.Type,
+		CreatedAt: e.OccurredAt,
+		FormID:    formID,
+		Data:      e.Data,
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	var rows []models.WebhookDelivery
+	for _, s := range subs {
+		if !subscribedTo(s, e.Type) {
+			continue
+		}
+		rows = append(rows, models.WebhookDelivery{
+			SubscriptionID: s.ID,
+			EventID:        payload.ID,
+			Event:          e.Type,
+			Payload:        string(body),
+			Status:         models.WebhookPending,
+			NextAttemptAt:  time.Now(),
+		})
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return db.Create(&rows).Error
+}
+
+// Redeliver tạo delivery mới (cùng event id & payload) từ một delivery cũ
+func Redeliver(tx *gorm.DB, d models.WebhookDelivery) (models.WebhookDelivery, error) {
+	orig := d.ID
+	nd := models.WebhookDelivery{
+		SubscriptionID: d.SubscriptionID,
+		EventID:        d.EventID,
+		Event:          d.Event,
+		Payload:        d.Payload,
+		Status:         models.WebhookPending,
+		NextAttemptAt:  time.Now(),
+		RedeliveryOf:   &orig,
+	}
+	err := tx.Create(&nd).Error
+	return nd, err
+}
+
+// StartWebhookWorker đăng ký nhận sự kiện từ outbox và chạy nền: định kỳ nhận các delivery đến hạn
+// và gửi đi. Nhiều instance chạy song song an toàn nhờ FOR UPDATE SKIP LOCKED + lease.
+func StartWebhookWorker() {
+	SubscribeEvent("webhooks", func(ctx context.Context, e Event) error {
+		return EnqueueWebhooks(config.DB.WithContext(ctx), e)
+	}, WebhookEvents...)
+
+	go func() {
+		ticker := time.NewTicker(webhookPoll)
+		defer ticker.Stop()
+		for range ticker.C {
+			for {
+				n, err := processWebhookBatch()
+				if err != nil {
+					log.Printf("[webhook] %v", err)
+					break
+				}
+				if n < webhookBatch {
+					break
+				}
+			}
+		}
+	}()
+}
+
+// processWebhookBatch nhận tối đa webhookBatch delivery đến hạn, trả số đã xử lý
+func processWebhookBatch() (int, error) {
+	var batch []models.WebhookDelivery
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", models.WebhookPending, now).
+			Order("next_attempt_at").Limit(webhookBatch).Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		ids := make([]uint, len(batch))
+		for i, d := range batch {
+			ids[i] = d.ID
+		}
+		return tx.Model(&models.WebhookDelivery{}).Where("id IN ?", ids).
+			Update("next_attempt_at", now.Add(webhookLease)).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, d := range batch {
+		deliverWebhook(d)
+	}
+	return len(batch), nil
+}
+
+func deliverWebhook(d models.WebhookDelivery) {
+	var sub models.WebhookSubscription
+	if err := config.DB.First(&sub, d.SubscriptionID).Error; err != nil {
+		return
+	}
+
+	status, sendErr := sendWebhook(sub, d)
+	now := time.Now()
+	updates := map[string]interface{}{
+		"attempts":         d.Attempts + 1,
+		"last_status_code": status,
+		"last_error":       "",
+	}
+	switch {
+	case sendErr == nil:
+		updates["status"] = models.WebhookSuccess
+		updates["delivered_at"] = now
+	case !sub.Active:
+		// subscription đã tắt: không thử lại nữa
+		updates["status"] = models.WebhookDead
+		updates["last_error"] = "subscription inactive"
+	case d.Attempts+1 >= webhookMaxAttempts:
+		updates["status"] = models.WebhookDead
+		updates["last_error"] = sendErr.Error()
+	default:
+		updates["next_attempt_at"] = now.Add(webhookBackoff(d.Attempts + 1))
+		updates["last_error"] = sendErr.Error()
+	}
+	if err := config.DB.Model(&models.WebhookDelivery{}).Where("id = ?", d.ID).Updates(updates).Error; err != nil {
+		log.Printf("[webhook] update delivery %d: %v", d.ID, err)
+	}
+}
+
+// webhookBackoff = 30s * 2^(n-1), tối đa 6 giờ
+func webhookBackoff(n int) time.Duration {
+	d := webhookBaseBackoff
+	for i := 1; i < n && d < webhookMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > webhookMaxBackoff {
+		d = webhookMaxBackoff
+	}
+	return d
+}
+
+func sendWebhook(sub models.WebhookSubscription, d models.WebhookDelivery) (int, error) {
+	if !sub.Active {
+		return 0, fmt.Errorf("subscription inactive")
+	}
+	secret, err := utils.OpenSecret(sub.Secret)
+	if err != nil {
+		return 0, fmt.Errorf("webhook secret: %w", err)
+	}
+	body := []byte(d.Payload)
+	ts := time.Now().Unix()
+
+	req, err := http.NewRequest(http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "survey-server-webhooks/1.0")
+	req.Header.Set("X-Webhook-Id", d.EventID)
+	req.Header.Set("X-Webhook-Event", d.Event)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(ts, 10))
+	req.Header.Set("X-Webhook-Signature", "sha256="+SignWebhook(secret, ts, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrBlockedAddress) {
+			return 0, ErrBlockedAddress
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// không lưu nội dung phản hồi vào last_error: chỉ đọc bỏ để dùng lại kết nối
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// Các scope hợp lệ cho API key
+const (
+	ScopeFormsRead     = "forms:read"
+	ScopeResponsesRead = "responses:read"
+	ScopeExportsWrite  = "exports:write"
+)
+
+var validScopes = map[string]bool{
+	ScopeFormsRead:     true,
+	ScopeResponsesRead: true,
+	ScopeExportsWrite:  true,
+}
+
+const apiKeyPrefix = "sk_"
+
+// GenerateAPIKey sinh key ngẫu nhiên dạng sk_<32 byte base64url>
+func GenerateAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashAPIKey băm key bằng sha256 (key đủ entropy nên không cần bcrypt, và cần tra cứu theo index)
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyDisplayPrefix: phần đầu của key để hiển thị trong danh sách
+func APIKeyDisplayPrefix(key string) string {
+	if len(key) <= 11 {
+		return key
+	}
+	return key[:11]
+}
+
+// NormalizeScopes lọc trùng + kiểm tra scope hợp lệ. Trả về scope không hợp lệ đầu tiên nếu có.
+func NormalizeScopes(scopes []string) ([]string, string) {
+	seen := map[string]bool{}
+	out := make([]string, 0, len(scopes))
+	for _, s := range scopes {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if s == "" || seen[s] {
+			continue
+		}
+		if !validScopes[s] {
+			return nil, s
+		}
+		seen[s] = true
+		out = append(out, s)
+	}
+	return out, ""
+}
+
+// HasScope kiểm tra chuỗi scopes (ngăn cách bởi dấu phẩy) có chứa scope cần thiết
+func HasScope(scopes string, need string) bool {
+	for _, s := range strings.Split(scopes, ",") {
+		if strings.TrimSpace(s) == need {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/bits"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// PurposeFormChallenge: token chống bot phát kèm form public (không dùng để gọi API)
+const PurposeFormChallenge = "form_challenge"
+
+// FormChallengeClaims: thông tin challenge phát cho một lần mở form.
+// IssuedAt cũng là thời điểm mở form (dùng để kiểm tra thời gian điền tối thiểu).
+type FormChallengeClaims struct {
+	FormID     uint   `json:"form_id"`
+	Salt       string `json:"salt"`       // chuỗi ngẫu nhiên cho proof-of-work
+	Difficulty int    `json:"difficulty"` // số bit 0 đầu tiên yêu cầu (0 = không yêu cầu)
+	Purpose    string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// GenerateFormChallenge tạo challenge token cho form
+func GenerateFormChallenge(formID uint, difficulty int, ttl time.Duration) (string, *FormChallengeClaims, error) {
+	jwtKey := []byte(os.Getenv("JWT_SECRET"))
+	if len(jwtKey) == 0 {
+		return "", nil, errors.New("JWT_SECRET không được thiết lập")
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	claims := &FormChallengeClaims{
+		FormID:     formID,
+		Salt:       hex.EncodeToString(b),
+		Difficulty: difficulty,
+		Purpose:    PurposeFormChallenge,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtKey)
+	return token, claims, err
+}
+
+// VerifyFormChallenge kiểm tra chữ ký, hạn và đúng form
+func VerifyFormChallenge(tokenStr string, formID uint) (*FormChallengeClaims, error) {
+	jwtKey := []byte(os.Getenv("JWT_SECRET"))
+	if len(jwtKey) == 0 {
+		return nil, errors.New("JWT_SECRET không được thiết lập")
+	}
+	claims := &FormChallengeClaims{}
+	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		return jwtKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid || claims.Purpose != PurposeFormChallenge || claims.FormID != formID || claims.IssuedAt == nil {
+		return nil, errors.New("challenge không hợp lệ")
+	}
+	return claims, nil
+}
+
+// CheckProofOfWork: sha256(salt + ":" + nonce) phải có ít nhất difficulty bit 0 ở đầu
+func CheckProofOfWork(salt, nonce string, difficulty int) bool {
+	if difficulty <= 0 {
+		return true
+	}
+	if nonce == "" || len(nonce) > 64 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(salt + ":" + nonce))
+	zeros := 0
+	for _, b := range sum {
+		if b == 0 {
+			zeros += 8
+			continue
+		}
+		zeros += bits.LeadingZeros8(b)
+		break
+	}
+	return zeros >= difficulty
+}
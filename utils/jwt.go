@@ -9,21 +9,36 @@ import (
 )
 
 type JWTClaims struct {
-	UserID string `json:"user_id"`
-	Role   string `json:"role"`
+	UserID  string   `json:"user_id"`
+	Role    string   `json:"role"`              // "admin" | "user", giữ cho FE cũ
+	Roles   []string `json:"roles,omitempty"`   // tên các vai trò (chỉ để hiển thị, phân quyền luôn tra DB)
+	Purpose string   `json:"purpose,omitempty"` // khác rỗng = token tạm cho một bước cụ thể (vd. "2fa"), không dùng để gọi API
+	Version int      `json:"ver,omitempty"`     // NguoiDung.TokenVersion lúc cấp; khác giá trị hiện tại = đã bị thu hồi
 	jwt.RegisteredClaims
 }
 
-// GenerateToken tạo JWT token từ userID và role
-func GenerateToken(userID string, role string) (string, error) {
+// Mục đích của token tạm
+const PurposeTwoFactor = "2fa"
+
+// GenerateToken tạo JWT token từ userID, danh sách vai trò và phiên bản token của user
+func GenerateToken(userID string, roles []string, version int) (string, error) {
 	jwtKey := []byte(os.Getenv("JWT_SECRET")) // Đọc tại thời điểm gọi
 	if len(jwtKey) == 0 {
 		return "", errors.New("JWT_SECRET không được thiết lập")
 	}
 
+	role := "user"
+	for _, r := range roles {
+		if r == "admin" {
+			role = "admin"
+		}
+	}
+
 	claims := JWTClaims{
-		UserID: userID,
-		Role:   role,
+		UserID:  userID,
+		Role:    role,
+		Roles:   roles,
+		Version: version,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -34,8 +49,52 @@ func GenerateToken(userID string, role string) (string, error) {
 	return token.SignedString(jwtKey)
 }
 
-// VerifyToken xác minh và parse JWT token
+// GenerateChallengeToken tạo token tạm sống ngắn cho một bước xác thực (vd. nhập mã 2FA sau mật khẩu)
+func GenerateChallengeToken(userID string, purpose string, ttl time.Duration, version int) (string, error) {
+	jwtKey := []byte(os.Getenv("JWT_SECRET"))
+	if len(jwtKey) == 0 {
+		return "", errors.New("JWT_SECRET không được thiết lập")
+	}
+
+	claims := JWTClaims{
+		UserID:  userID,
+		Purpose: purpose,
+		Version: version,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(jwtKey)
+}
+
+// VerifyChallengeToken xác minh token tạm và kiểm tra đúng mục đích
+func VerifyChallengeToken(tokenStr string, purpose string) (*JWTClaims, error) {
+	claims, err := parseToken(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != purpose {
+		return nil, errors.New("token không hợp lệ")
+	}
+	return claims, nil
+}
+
+// VerifyToken xác minh và parse JWT token phiên đăng nhập (từ chối token tạm)
 func VerifyToken(tokenStr string) (*JWTClaims, error) {
+	claims, err := parseToken(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != "" {
+		return nil, errors.New("token không hợp lệ")
+	}
+	return claims, nil
+}
+
+func parseToken(tokenStr string) (*JWTClaims, error) {
 	jwtKey := []byte(os.Getenv("JWT_SECRET")) // Đọc tại thời điểm gọi
 	if len(jwtKey) == 0 {
 		return nil, errors.New("JWT_SECRET không được thiết lập")
@@ -1,6 +1,11 @@
 package utils
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/rand"
+	"math/big"
+
+	"golang.org/x/crypto/bcrypt"
+)
 
 func HashPassword(raw string) (string, error) {
 	b, err := bcrypt.GenerateFromPassword([]byte(raw), bcrypt.DefaultCost)
@@ -9,3 +14,18 @@ func HashPassword(raw string) (string, error) {
 func CheckPassword(hash, raw string) bool {
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(raw)) == nil
 }
+
+// GenerateRandomPassword sinh mật khẩu tạm ngẫu nhiên (dùng khi admin đặt lại mật khẩu)
+func GenerateRandomPassword(n int) (string, error) {
+	const alphabet = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	max := big.NewInt(int64(len(alphabet)))
+	b := make([]byte, n)
+	for i := range b {
+		k, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = alphabet[k.Int64()]
+	}
+	return string(b), nil
+}
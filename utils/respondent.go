@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"strings"
+)
+
+// Cookie định danh trình duyệt người trả lời (dùng để chặn gửi trùng khi không đăng nhập)
+const RespondentCookie = "survey_rid"
+
+func respondentKey() []byte {
+	return []byte("respondent:" + os.Getenv("JWT_SECRET"))
+}
+
+// NewRespondentCookie sinh id ngẫu nhiên và trả (id, giá trị cookie đã ký "id.chữ_ký")
+func NewRespondentCookie() (string, string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	id := hex.EncodeToString(b)
+	return id, id + "." + signRespondent(id), nil
+}
+
+// VerifyRespondentCookie kiểm tra chữ ký, trả id nếu hợp lệ
+func VerifyRespondentCookie(value string) (string, bool) {
+	id, sig, ok := strings.Cut(value, ".")
+	if !ok || len(id) != 32 {
+		return "", false
+	}
+	if !hmac.Equal([]byte(sig), []byte(signRespondent(id))) {
+		return "", false
+	}
+	return id, true
+}
+
+func signRespondent(id string) string {
+	m := hmac.New(sha256.New, respondentKey())
+	m.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+// HashIP băm IP kèm secret để so trùng mà không lưu IP gốc
+func HashIP(ip string) string {
+	m := hmac.New(sha256.New, []byte("ip:"+os.Getenv("JWT_SECRET")))
+	m.Write([]byte(ip))
+	return hex.EncodeToString(m.Sum(nil))
+}
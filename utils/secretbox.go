@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strings"
+)
+
+// Tiền tố của giá trị đã mã hoá bằng SealSecret; giá trị không có tiền tố là dạng rõ (dữ liệu cũ)
+const sealedPrefix = "enc:v1:"
+
+// secretBoxKey: khoá AES-256 lấy từ CONFIG_SECRET_KEY (không đặt → từ JWT_SECRET).
+// Đổi khoá này thì không mở được các giá trị đã mã hoá trước đó.
+func secretBoxKey() []byte {
+	k := os.Getenv("CONFIG_SECRET_KEY")
+	if k == "" {
+		k = os.Getenv("JWT_SECRET")
+	}
+	sum := sha256.Sum256([]byte("config-secret:" + k))
+	return sum[:]
+}
+
+func secretBoxAEAD() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(secretBoxKey())
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SealSecret mã hoá (AES-GCM) khoá bí mật để lưu DB; chuỗi rỗng giữ nguyên
+func SealSecret(plain string) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+	aead, err := secretBoxAEAD()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	out := aead.Seal(nonce, nonce, []byte(plain), nil)
+	return sealedPrefix + base64.RawStdEncoding.EncodeToString(out), nil
+}
+
+// IsSealedSecret: giá trị đã được SealSecret mã hoá
+func IsSealedSecret(s string) bool {
+	return strings.HasPrefix(s, sealedPrefix)
+}
+
+// OpenSecret giải mã giá trị của SealSecret; giá trị chưa mã hoá (dữ liệu cũ) trả nguyên
+func OpenSecret(s string) (string, error) {
+	if !IsSealedSecret(s) {
+		return s, nil
+	}
+	raw, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(s, sealedPrefix))
+	if err != nil {
+		return "", errors.New("khoá bí mật đã mã hoá không hợp lệ")
+	}
+	aead, err := secretBoxAEAD()
+	if err != nil {
+		return "", err
+	}
+	if len(raw) < aead.NonceSize() {
+		return "", errors.New("khoá bí mật đã mã hoá không hợp lệ")
+	}
+	plain, err := aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("không giải mã được khoá bí mật (CONFIG_SECRET_KEY đã đổi?)")
+	}
+	return string(plain), nil
+}
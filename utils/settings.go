@@ -35,13 +35,88 @@ func (n NullableInt) MarshalJSON() ([]byte, error) {
 }
 
 type FormSettings struct {
-	MaxResponses     NullableInt `json:"max_responses,omitempty"`     // giới hạn tổng số lượt trả lời (nil = không giới hạn)
-	CollectEmail     *bool       `json:"collect_email,omitempty"`     // yêu cầu nhập email
-	ShowProgress     *bool       `json:"show_progress,omitempty"`     // hiển thị progress bar
-	ShuffleQuestions *bool       `json:"shuffle_questions,omitempty"` // xáo trộn câu hỏi
-	StartAt          *int64      `json:"start_at,omitempty"`          // thời điểm bắt đầu (unix seconds)
-	ExpireAt         *int64      `json:"expire_at,omitempty"`         // thời điểm hết hạn (unix seconds)
-	Language         string      `json:"language,omitempty"`          // ngôn ngữ hiển thị ("vi", "en")
+	MaxResponses     NullableInt        `json:"max_responses,omitempty"`     // giới hạn tổng số lượt trả lời (nil = không giới hạn)
+	CollectEmail     *bool              `json:"collect_email,omitempty"`     // yêu cầu nhập email
+	ShowProgress     *bool              `json:"show_progress,omitempty"`     // hiển thị progress bar
+	ShuffleQuestions *bool              `json:"shuffle_questions,omitempty"` // xáo trộn câu hỏi
+	StartAt          *int64             `json:"start_at,omitempty"`          // thời điểm bắt đầu (unix seconds)
+	ExpireAt         *int64             `json:"expire_at,omitempty"`         // thời điểm hết hạn (unix seconds)
+	Language         string             `json:"language,omitempty"`          // ngôn ngữ hiển thị ("vi", "en")
+	AntiSpam         *AntiSpamSettings  `json:"anti_spam,omitempty"`         // chống bot/spam khi gửi phản hồi
+	Duplicates       *DuplicateSettings `json:"duplicates,omitempty"`        // chặn một người gửi nhiều lần
+}
+
+// DuplicateSettings: các cơ chế chặn gửi trùng, bật/tắt độc lập (mặc định tắt hết)
+type DuplicateSettings struct {
+	OnePerBrowser *bool `json:"one_per_browser,omitempty"` // theo cookie định danh đã ký
+	OnePerIP      *bool `json:"one_per_ip,omitempty"`      // theo IP (lưu dạng hash) trong khoảng ip_window_hours
+	IPWindowHours *int  `json:"ip_window_hours,omitempty"` // mặc định 24
+	OnePerEmail   *bool `json:"one_per_email,omitempty"`   // mỗi email một phản hồi (bắt buộc nhập email)
+}
+
+// DuplicateConfig: cấu hình đã áp giá trị mặc định
+type DuplicateConfig struct {
+	OnePerBrowser bool
+	OnePerIP      bool
+	IPWindow      time.Duration
+	OnePerEmail   bool
+}
+
+// Resolve áp giá trị mặc định (nhận cả receiver nil)
+func (d *DuplicateSettings) Resolve() DuplicateConfig {
+	cfg := DuplicateConfig{IPWindow: 24 * time.Hour}
+	if d == nil {
+		return cfg
+	}
+	cfg.OnePerBrowser = d.OnePerBrowser != nil && *d.OnePerBrowser
+	cfg.OnePerIP = d.OnePerIP != nil && *d.OnePerIP
+	cfg.OnePerEmail = d.OnePerEmail != nil && *d.OnePerEmail
+	if d.IPWindowHours != nil {
+		cfg.IPWindow = time.Duration(*d.IPWindowHours) * time.Hour
+	}
+	return cfg
+}
+
+// AntiSpamSettings: cấu hình chống bot; trường bỏ trống dùng giá trị mặc định
+type AntiSpamSettings struct {
+	Enabled        *bool `json:"enabled,omitempty"`          // mặc định tắt: chủ form tự bật khi client đã gửi challenge
+	PowDifficulty  *int  `json:"pow_difficulty,omitempty"`   // số bit 0 yêu cầu cho proof-of-work (mặc định 16, 0 = tắt)
+	MinFillSeconds *int  `json:"min_fill_seconds,omitempty"` // thời gian điền tối thiểu tính từ lúc mở form (mặc định 3)
+	SpamThreshold  *int  `json:"spam_threshold,omitempty"`   // điểm >= ngưỡng thì bị đánh dấu spam (mặc định 50)
+	RejectSpam     *bool `json:"reject_spam,omitempty"`      // true: từ chối phản hồi spam thay vì chỉ đánh dấu
+}
+
+// AntiSpamConfig: cấu hình đã áp giá trị mặc định
+type AntiSpamConfig struct {
+	Enabled        bool
+	PowDifficulty  int
+	MinFillSeconds int
+	SpamThreshold  int
+	RejectSpam     bool
+}
+
+// Resolve áp giá trị mặc định (nhận cả receiver nil)
+func (a *AntiSpamSettings) Resolve() AntiSpamConfig {
+	cfg := AntiSpamConfig{PowDifficulty: 16, MinFillSeconds: 3, SpamThreshold: 50}
+	if a == nil {
+		return cfg
+	}
+	if a.Enabled != nil {
+		cfg.Enabled = *a.Enabled
+	}
+	if a.PowDifficulty != nil {
+		cfg.PowDifficulty = *a.PowDifficulty
+	}
+	if a.MinFillSeconds != nil {
+		cfg.MinFillSeconds = *a.MinFillSeconds
+	}
+	if a.SpamThreshold != nil {
+		cfg.SpamThreshold = *a.SpamThreshold
+	}
+	if a.RejectSpam != nil {
+		cfg.RejectSpam = *a.RejectSpam
+	}
+	return cfg
 }
 
 // ValidateSettings với clamp cho MaxResponses
@@ -58,6 +133,20 @@ func ValidateSettings(s *FormSettings) error {
 	if s.StartAt != nil && s.ExpireAt != nil && *s.ExpireAt <= *s.StartAt {
 		return errors.New("expire_at phải lớn hơn start_at")
 	}
+	if a := s.AntiSpam; a != nil {
+		if a.PowDifficulty != nil && (*a.PowDifficulty < 0 || *a.PowDifficulty > 24) {
+			return errors.New("anti_spam.pow_difficulty phải trong khoảng 0-24")
+		}
+		if a.MinFillSeconds != nil && (*a.MinFillSeconds < 0 || *a.MinFillSeconds > 3600) {
+			return errors.New("anti_spam.min_fill_seconds phải trong khoảng 0-3600")
+		}
+		if a.SpamThreshold != nil && (*a.SpamThreshold < 1 || *a.SpamThreshold > 100) {
+			return errors.New("anti_spam.spam_threshold phải trong khoảng 1-100")
+		}
+	}
+	if d := s.Duplicates; d != nil && d.IPWindowHours != nil && (*d.IPWindowHours < 1 || *d.IPWindowHours > 24*365) {
+		return errors.New("duplicates.ip_window_hours phải trong khoảng 1-8760")
+	}
 	return nil
 }
 
@@ -129,7 +218,56 @@ func MergeSettings(base *FormSettings, patch *FormSettings) *FormSettings {
 	if patch.Language != "" {
 		out.Language = patch.Language
 	}
+	if patch.AntiSpam != nil {
+		out.AntiSpam = mergeAntiSpam(out.AntiSpam, patch.AntiSpam)
+	}
+	if patch.Duplicates != nil {
+		out.Duplicates = mergeDuplicates(out.Duplicates, patch.Duplicates)
+	}
+	return &out
+}
+
+func mergeAntiSpam(base, patch *AntiSpamSettings) *AntiSpamSettings {
+	out := AntiSpamSettings{}
+	if base != nil {
+		out = *base
+	}
+	if patch.Enabled != nil {
+		out.Enabled = patch.Enabled
+	}
+	if patch.PowDifficulty != nil {
+		out.PowDifficulty = patch.PowDifficulty
+	}
+	if patch.MinFillSeconds != nil {
+		out.MinFillSeconds = patch.MinFillSeconds
+	}
+	if patch.SpamThreshold != nil {
+		out.SpamThreshold = patch.SpamThreshold
+	}
+	if patch.RejectSpam != nil {
+		out.RejectSpam = patch.RejectSpam
+	}
 	return &out
 }
 
 func NowUnix() int64 { return time.Now().Unix() }
+
+func mergeDuplicates(base, patch *DuplicateSettings) *DuplicateSettings {
+	out := DuplicateSettings{}
+	if base != nil {
+		out = *base
+	}
+	if patch.OnePerBrowser != nil {
+		out.OnePerBrowser = patch.OnePerBrowser
+	}
+	if patch.OnePerIP != nil {
+		out.OnePerIP = patch.OnePerIP
+	}
+	if patch.IPWindowHours != nil {
+		out.IPWindowHours = patch.IPWindowHours
+	}
+	if patch.OnePerEmail != nil {
+		out.OnePerEmail = patch.OnePerEmail
+	}
+	return &out
+}